@@ -17,17 +17,25 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
+	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 
+	corev1 "k8s.io/api/core/v1"
 	kRuntime "k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
@@ -39,11 +47,11 @@ import (
 	"github.com/IBM/staticroute-operator/pkg/routemanager"
 	"github.com/IBM/staticroute-operator/pkg/types"
 	"github.com/IBM/staticroute-operator/version"
-	"github.com/vishvananda/netlink"
 
 	"github.com/operator-framework/operator-sdk/pkg/log/zap"
 	sdkVersion "github.com/operator-framework/operator-sdk/version"
 	"github.com/spf13/pflag"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -54,7 +62,19 @@ import (
 // Change below variables to serve metrics on different host or port.
 var (
 	defaultRouteTable = 254
+	localRouteTable   = 255
 	defaultFallbackIP = net.IP{10, 0, 0, 1}
+
+	defaultMaxConcurrentReconciles = 1
+
+	defaultGatewayResolveInterval  = 5 * time.Minute
+	defaultGatewayProbeInterval    = 10 * time.Second
+	defaultDegradedAfter           = 30 * time.Second
+	defaultRecoveredAfter          = 30 * time.Second
+	defaultDriftCorrectionInterval = time.Minute
+	defaultNetlinkTimeout          = 30 * time.Second
+	defaultCacheSyncTimeout        = 2 * time.Minute
+	apiServerRefreshInterval       = time.Minute
 )
 var log = logf.Log.WithName("cmd")
 
@@ -87,13 +107,14 @@ func main() {
 
 	printVersion()
 
-	mainImpl(mainImplParams{
-		logger:      log,
-		getEnv:      os.Getenv,
-		osEnv:       os.Environ,
-		getConfig:   config.GetConfig,
-		newManager:  manager.New,
-		addToScheme: apis.AddToScheme,
+	if err := mainImpl(mainImplParams{
+		logger:       log,
+		configLogger: logf.Log.WithName("config"),
+		getEnv:       os.Getenv,
+		osEnv:        os.Environ,
+		getConfig:    config.GetConfig,
+		newManager:   manager.New,
+		addToScheme:  apis.AddToScheme,
 		newKubernetesConfig: func(config *rest.Config) (discoverable, error) {
 			clientSet, err := kubernetes.NewForConfig(config)
 			return clientSet, err
@@ -101,15 +122,16 @@ func main() {
 		newRouterManager:         routemanager.New,
 		addStaticRouteController: staticroute.Add,
 		addNodeController:        node.Add,
-		getGw: func(ip net.IP) (net.IP, error) {
-			route, err := netlink.RouteGet(ip)
-			if err != nil {
-				return nil, err
-			}
-			return route[0].Gw, nil
-		},
-		setupSignalHandler: signals.SetupSignalHandler,
-	})
+		gatewayResolver:          routemanager.NewGatewayResolver(),
+		primaryRouteResolver:     routemanager.NewGatewayResolver(),
+		lookupIP:                 net.LookupIP,
+		readFile:                 ioutil.ReadFile,
+		osHostname:               os.Hostname,
+		setupSignalHandler:       signals.SetupSignalHandler,
+	}); err != nil {
+		log.Error(err, "Unable to start the operator")
+		os.Exit(1)
+	}
 }
 
 func parseCommandLine() {
@@ -126,16 +148,21 @@ func parseCommandLine() {
 
 type mainImplParams struct {
 	logger                   types.Logger
+	configLogger             types.Logger
 	getEnv                   func(string) string
 	osEnv                    func() []string
 	getConfig                func() (*rest.Config, error)
 	newManager               func(*rest.Config, manager.Options) (manager.Manager, error)
 	addToScheme              func(s *kRuntime.Scheme) error
 	newKubernetesConfig      func(*rest.Config) (discoverable, error)
-	newRouterManager         func() routemanager.RouteManager
+	newRouterManager         func(routemanager.Options) routemanager.RouteManager
 	addStaticRouteController func(manager.Manager, staticroute.ManagerOptions) error
-	addNodeController        func(manager.Manager) error
-	getGw                    func(net.IP) (net.IP, error)
+	addNodeController        func(manager.Manager, node.ManagerOptions) error
+	gatewayResolver          types.GatewayResolver
+	primaryRouteResolver     types.PrimaryRouteResolver
+	lookupIP                 func(string) ([]net.IP, error)
+	readFile                 func(string) ([]byte, error)
+	osHostname               func() (string, error)
 	setupSignalHandler       func() (stopCh <-chan struct{})
 }
 
@@ -143,11 +170,12 @@ type discoverable interface {
 	Discovery() discovery.DiscoveryInterface
 }
 
-func mainImpl(params mainImplParams) {
+//mainImpl returns an error for startup problems (ie. misconfiguration), panics are reserved for unexpected states
+func mainImpl(params mainImplParams) error {
 	// Get a config to talk to the apiserver
 	cfg, err := params.getConfig()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	// Create a new Cmd to provide shared dependencies and start components
@@ -157,38 +185,48 @@ func mainImpl(params mainImplParams) {
 		MetricsBindAddress: "0",
 	})
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	params.logger.Info("Registering Components.")
 
 	// Setup Scheme for all resources
 	if err := params.addToScheme(mgr.GetScheme()); err != nil {
-		panic(err)
+		return err
 	}
 
-	hostname := params.getEnv("NODE_HOSTNAME")
+	hostname, hostnameSource := resolveHostname(params)
 	if hostname == "" {
-		panic("Missing environment variable: NODE_HOSTNAME")
+		hostnameFile := "NODE_HOSTNAME_FILE is not set"
+		if file := params.getEnv("NODE_HOSTNAME_FILE"); file != "" {
+			hostnameFile = fmt.Sprintf("the file of NODE_HOSTNAME_FILE '%s' is unreadable or empty", file)
+		}
+		return fmt.Errorf("Unable to determine the hostname of the node: NODE_HOSTNAME is not set, %s, and the hostname of the host is not available", hostnameFile)
 	}
 
-	params.logger.Info(fmt.Sprintf("Node Hostname: %s", hostname))
+	params.logger.Info(fmt.Sprintf("Node Hostname: %s", hostname), "source", hostnameSource)
 	params.logger.Info("Registering Components.")
 
 	clientset, err := params.newKubernetesConfig(cfg)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	resources, err := clientset.Discovery().ServerResourcesForGroupVersion("static-route.ibm.com/v1")
 	if err != nil {
-		panic(err)
+		return err
 	}
 
+	largeTableIDs, err := parseBool("LARGE_TABLE_IDS", params.getEnv("LARGE_TABLE_IDS"))
+	if err != nil {
+		return err
+	}
 	table := defaultRouteTable
 	targetTableEnv := params.getEnv("TARGET_TABLE")
 	if len(targetTableEnv) != 0 {
-		table = parseTargetTable(targetTableEnv)
+		if table, err = parseTargetTable(targetTableEnv, largeTableIDs); err != nil {
+			return err
+		}
 	}
 	params.logger.Info("Table selected", "value", table)
 
@@ -197,13 +235,187 @@ func mainImpl(params mainImplParams) {
 	if len(fallbackIPEnv) != 0 {
 		fallbackIP = net.ParseIP(fallbackIPEnv)
 		if fallbackIP == nil || strings.Contains(fallbackIPEnv, ":") {
-			panic("Environment variable parse error: FALLBACK_IP_FOR_GW_SELECTION.")
+			return errors.New("Environment variable parse error: FALLBACK_IP_FOR_GW_SELECTION.")
 		}
 	}
 	params.logger.Info("Fallback IP for gateway selection:", "value", fallbackIP)
 
-	protectedSubnets := collectProtectedSubnets(params.osEnv())
+	var defaultGateway net.IP
+	if defaultGatewayEnv := params.getEnv("DEFAULT_GATEWAY"); len(defaultGatewayEnv) != 0 {
+		if defaultGateway = net.ParseIP(defaultGatewayEnv); defaultGateway == nil {
+			return errors.New("Environment variable parse error: DEFAULT_GATEWAY.")
+		}
+		if ip4 := defaultGateway.To4(); ip4 != nil {
+			defaultGateway = ip4
+		}
+		params.logger.Info("Default gateway of the routes without gateway:", "value", defaultGateway)
+	}
+
+	protectedSubnets, err := collectProtectedSubnets(params.osEnv())
+	if err != nil {
+		return err
+	}
+	protectedSubnetExceptions, err := collectProtectedSubnetExceptions(params.osEnv(), protectedSubnets)
+	if err != nil {
+		return err
+	}
+	if len(protectedSubnetExceptions) != 0 {
+		params.logger.Info("Protected subnet exceptions", "value", protectedSubnetExceptions)
+	}
+	protectedSubnetsConfigMap, err := parseConfigMapName("Protected subnets ConfigMap", "PROTECTED_SUBNETS_CONFIGMAP", params.getEnv("PROTECTED_SUBNETS_CONFIGMAP"))
+	if err != nil {
+		return err
+	}
+	params.logger.Info("Protected subnets", "configMap", protectedSubnetsConfigMap.String())
 
+	reconcileInterval, err := parseInterval("RECONCILE_INTERVAL", params.getEnv("RECONCILE_INTERVAL"), 0)
+	if err != nil {
+		return err
+	}
+	params.logger.Info("Periodic reconciliation interval", "value", reconcileInterval)
+
+	gatewayResolveInterval, err := parseInterval("GATEWAY_RESOLVE_INTERVAL", params.getEnv("GATEWAY_RESOLVE_INTERVAL"), defaultGatewayResolveInterval)
+	if err != nil {
+		return err
+	}
+	params.logger.Info("Gateway hostname resolution interval", "value", gatewayResolveInterval)
+
+	onDrain, err := parseDrainPolicy(params.getEnv("ON_DRAIN"))
+	if err != nil {
+		return err
+	}
+	params.logger.Info("Drain policy", "value", onDrain)
+
+	killSwitch, err := parseKillSwitch(params.getEnv("KILL_SWITCH_CONFIGMAP"))
+	if err != nil {
+		return err
+	}
+	params.logger.Info("Kill switch", "configMap", killSwitch.String())
+
+	managementRoutes, err := parseBool("NODE_MANAGEMENT_ROUTES", params.getEnv("NODE_MANAGEMENT_ROUTES"))
+	if err != nil {
+		return err
+	}
+	params.logger.Info("Node management routes", "enabled", managementRoutes)
+
+	publishPrimaryRoute, err := parseBool("PUBLISH_PRIMARY_ROUTE", params.getEnv("PUBLISH_PRIMARY_ROUTE"))
+	if err != nil {
+		return err
+	}
+	params.logger.Info("Primary route annotations", "enabled", publishPrimaryRoute)
+
+	failOnUnreachable, err := parseBool("FAIL_ON_UNREACHABLE", params.getEnv("FAIL_ON_UNREACHABLE"))
+	if err != nil {
+		return err
+	}
+	params.logger.Info("Unreachable network fails the routes", "enabled", failOnUnreachable)
+
+	cacheSyncTimeout, err := parseInterval("CACHE_SYNC_TIMEOUT", params.getEnv("CACHE_SYNC_TIMEOUT"), defaultCacheSyncTimeout)
+	if err != nil {
+		return err
+	}
+	params.logger.Info("Cache sync", "timeout", cacheSyncTimeout)
+
+	maxConcurrentReconciles, err := parseMaxConcurrentReconciles(params.getEnv("MAX_CONCURRENT_RECONCILES"))
+	if err != nil {
+		return err
+	}
+	params.logger.Info("Concurrent reconciles", "max", maxConcurrentReconciles)
+
+	operatorID, protocol, err := parseOperatorID(params.getEnv("OPERATOR_ID"))
+	if err != nil {
+		return err
+	}
+	params.logger.Info("Operator instance", "id", operatorID, "protocol", protocol)
+
+	routeManagerOptions := routemanager.Options{Protocol: protocol}
+	if routeManagerOptions.AdoptProtocols, err = parseAdoptProtocols(params.getEnv("ADOPT_PROTOCOLS"), protocol); err != nil {
+		return err
+	}
+	if len(routeManagerOptions.AdoptProtocols) != 0 {
+		params.logger.Info("Routes of previous versions are adopted", "protocols", routeManagerOptions.AdoptProtocols)
+	}
+	if routeManagerOptions.ProbeInterval, err = parseInterval("GATEWAY_PROBE_INTERVAL", params.getEnv("GATEWAY_PROBE_INTERVAL"), defaultGatewayProbeInterval); err != nil {
+		return err
+	}
+	if routeManagerOptions.DegradedAfter, err = parseInterval("DEGRADED_AFTER", params.getEnv("DEGRADED_AFTER"), defaultDegradedAfter); err != nil {
+		return err
+	}
+	if routeManagerOptions.RecoveredAfter, err = parseInterval("RECOVERED_AFTER", params.getEnv("RECOVERED_AFTER"), defaultRecoveredAfter); err != nil {
+		return err
+	}
+	params.logger.Info("Gateway probe", "interval", routeManagerOptions.ProbeInterval, "degradedAfter", routeManagerOptions.DegradedAfter, "recoveredAfter", routeManagerOptions.RecoveredAfter)
+	if routeManagerOptions.DriftCorrectionInterval, err = parseInterval("DRIFT_CORRECTION_INTERVAL", params.getEnv("DRIFT_CORRECTION_INTERVAL"), defaultDriftCorrectionInterval); err != nil {
+		return err
+	}
+	params.logger.Info("Drift correction", "interval", routeManagerOptions.DriftCorrectionInterval)
+	if routeManagerOptions.NetlinkTimeout, err = parseInterval("NETLINK_TIMEOUT", params.getEnv("NETLINK_TIMEOUT"), defaultNetlinkTimeout); err != nil {
+		return err
+	}
+	params.logger.Info("Netlink", "timeout", routeManagerOptions.NetlinkTimeout)
+	if routeManagerOptions.ECMPMerge, err = parseBool("ECMP_MERGE", params.getEnv("ECMP_MERGE")); err != nil {
+		return err
+	}
+	params.logger.Info("ECMP merge", "enabled", routeManagerOptions.ECMPMerge)
+	if routeManagerOptions.ECMPRebalance, err = parseECMPRebalance(params.getEnv("ECMP_REBALANCE"), routeManagerOptions.ECMPMerge); err != nil {
+		return err
+	}
+	if routeManagerOptions.ECMPDegradedWeightPercent, err = parseDegradedWeightPercent(params.getEnv("ECMP_DEGRADED_WEIGHT_PERCENT")); err != nil {
+		return err
+	}
+	params.logger.Info("ECMP rebalance", "policy", routeManagerOptions.ECMPRebalance, "degradedWeightPercent", routeManagerOptions.ECMPDegradedWeightPercent)
+	protectAPIServerRoute, err := parseBoolWithDefault("PROTECT_APISERVER_ROUTE", params.getEnv("PROTECT_APISERVER_ROUTE"), true)
+	if err != nil {
+		return err
+	}
+	apiServer := &apiServerAddresses{}
+	if protectAPIServerRoute {
+		// The operator does not start unprotected, the protection can be turned off explicitly
+		if apiServer, err = newAPIServerAddresses(mgr.GetAPIReader(), params.logger); err != nil {
+			return fmt.Errorf("Unable to resolve the addresses of the apiserver, set PROTECT_APISERVER_ROUTE=false to run without protecting its route: %s", err.Error())
+		}
+		routeManagerOptions.APIServerIPs = apiServer.IPs
+		go apiServer.run(apiServerRefreshInterval)
+	}
+	params.logger.Info("Route to the apiserver", "protected", protectAPIServerRoute, "apiserver", ipStrings(apiServer.IPs()))
+
+	// The whole configuration in a single line, so misconfiguration is obvious from the logs alone
+	params.configLogger.Info("Effective configuration",
+		"hostname", hostname,
+		"hostnameSource", hostnameSource,
+		"watchNamespace", "",
+		"operatorID", operatorID,
+		"protocol", protocol,
+		"adoptProtocols", routeManagerOptions.AdoptProtocols,
+		"table", table,
+		"largeTableIDs", largeTableIDs,
+		"fallbackIP", fallbackIP.String(),
+		"defaultGateway", ipString(defaultGateway),
+		"protectedSubnets", ipNetStrings(protectedSubnets),
+		"protectedSubnetExceptions", ipNetStrings(protectedSubnetExceptions),
+		"protectedSubnetsConfigMap", protectedSubnetsConfigMap.String(),
+		"reconcileInterval", reconcileInterval.String(),
+		"gatewayResolveInterval", gatewayResolveInterval.String(),
+		"onDrain", onDrain,
+		"killSwitch", killSwitch.String(),
+		"managementRoutes", managementRoutes,
+		"publishPrimaryRoute", publishPrimaryRoute,
+		"failOnUnreachable", failOnUnreachable,
+		"cacheSyncTimeout", cacheSyncTimeout.String(),
+		"gatewayProbeInterval", routeManagerOptions.ProbeInterval.String(),
+		"degradedAfter", routeManagerOptions.DegradedAfter.String(),
+		"recoveredAfter", routeManagerOptions.RecoveredAfter.String(),
+		"driftCorrectionInterval", routeManagerOptions.DriftCorrectionInterval.String(),
+		"netlinkTimeout", routeManagerOptions.NetlinkTimeout.String(),
+		"ecmpMerge", routeManagerOptions.ECMPMerge,
+		"ecmpRebalance", routeManagerOptions.ECMPRebalance,
+		"ecmpDegradedWeightPercent", routeManagerOptions.ECMPDegradedWeightPercent,
+		"protectAPIServerRoute", protectAPIServerRoute,
+		"apiServerIPs", ipStrings(apiServer.IPs()),
+		"maxConcurrentReconciles", maxConcurrentReconciles,
+	)
+
+	var routeManager routemanager.RouteManager
 	crdFound := false
 	for _, resource := range resources.APIResources {
 		if resource.Kind != "StaticRoute" {
@@ -211,7 +423,7 @@ func mainImpl(params mainImplParams) {
 		}
 
 		// Create RouteManager
-		routeManager := params.newRouterManager()
+		routeManager = params.newRouterManager(routeManagerOptions)
 		stopChan := make(chan struct{})
 		go func() {
 			panic(routeManager.Run(stopChan))
@@ -219,58 +431,417 @@ func mainImpl(params mainImplParams) {
 
 		// Start static route controller
 		if err := params.addStaticRouteController(mgr, staticroute.ManagerOptions{
-			Hostname:                 hostname,
-			Table:                    table,
-			ProtectedSubnets:         protectedSubnets,
-			FallbackIPForGwSelection: fallbackIP,
-			RouteManager:             routeManager,
-			GetGw:                    params.getGw,
+			Hostname:                  hostname,
+			Table:                     table,
+			ProtectedSubnets:          protectedSubnets,
+			ProtectedSubnetExceptions: protectedSubnetExceptions,
+			ProtectedSubnetsConfigMap: protectedSubnetsConfigMap,
+			FallbackIPForGwSelection:  fallbackIP,
+			DefaultGateway:            defaultGateway,
+			RouteManager:              routeManager,
+			GatewayResolver:           params.gatewayResolver,
+			ReconcileInterval:         reconcileInterval,
+			LookupIP:                  params.lookupIP,
+			GatewayResolveInterval:    gatewayResolveInterval,
+			OnDrain:                   onDrain,
+			OperatorID:                operatorID,
+			KillSwitch:                killSwitch,
+			ECMPMerge:                 routeManagerOptions.ECMPMerge,
+			MaxConcurrentReconciles:   maxConcurrentReconciles,
+			FailOnUnreachable:         failOnUnreachable,
 		}); err != nil {
-			panic(err)
+			return err
 		}
 		crdFound = true
 		break
 	}
 	if !crdFound {
-		params.logger.Info("CRD not found: staticroutes.static-route.ibm.com")
-		panic(err)
+		return errors.New("CRD not found: staticroutes.static-route.ibm.com")
 	}
 
 	// Start node controller
-	if err := params.addNodeController(mgr); err != nil {
-		panic(err)
+	if err := params.addNodeController(mgr, node.ManagerOptions{
+		RouteManager:             routeManager,
+		Hostname:                 hostname,
+		Table:                    table,
+		ProtectedSubnets:         protectedSubnets,
+		ManagementRoutes:         managementRoutes,
+		PublishPrimaryRoute:      publishPrimaryRoute,
+		PrimaryRouteResolver:     params.primaryRouteResolver,
+		FallbackIPForGwSelection: fallbackIP,
+		MaxConcurrentReconciles:  maxConcurrentReconciles,
+	}); err != nil {
+		return err
 	}
 
 	params.logger.Info("Starting the Cmd.")
 	// Start the Cmd
-	if err := mgr.Start(params.setupSignalHandler()); err != nil {
+	if err := startManager(mgr, params.setupSignalHandler(), cacheSyncTimeout); err == errCacheSyncTimeout {
+		err = fmt.Errorf("%w within %s 'CACHE_SYNC_TIMEOUT=%s', check the RBAC rules of the service account, that the CRDs are installed and the apiserver is reachable", err, cacheSyncTimeout, params.getEnv("CACHE_SYNC_TIMEOUT"))
+		params.logger.Error(err, "Cache never synced")
+		return err
+	} else if err != nil {
 		params.logger.Error(err, "Manager exited non-zero")
-		panic(err)
+		return err
 	}
+	return nil
 }
 
-func parseTargetTable(targetTableEnv string) int {
+var errCacheSyncTimeout = errors.New("Cache did not sync")
+
+/* startManager runs the manager until the stop channel is closed. The controllers wait for the cache without limit, so the operator
+   would hang silently if the resources can't be listed. The manager is stopped if its cache doesn't sync within the timeout, zero waits forever. */
+func startManager(mgr manager.Manager, stop <-chan struct{}, timeout time.Duration) error {
+	if timeout <= 0 {
+		return mgr.Start(stop)
+	}
+	managerStop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- mgr.Start(managerStop)
+	}()
+	syncStop := make(chan struct{})
+	defer close(syncStop)
+	synced := make(chan bool, 1)
+	go func() {
+		synced <- mgr.GetCache().WaitForCacheSync(syncStop)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-stop:
+		close(managerStop)
+		return <-done
+	case <-timer.C:
+		close(managerStop)
+		<-done
+		return errCacheSyncTimeout
+	case <-synced:
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-stop:
+		close(managerStop)
+		return <-done
+	}
+}
+
+//resolveHostname tries NODE_HOSTNAME, then the file given by NODE_HOSTNAME_FILE (ie. a downward API volume), then the hostname of the host. Returns the hostname and its source.
+func resolveHostname(params mainImplParams) (string, string) {
+	if hostname := params.getEnv("NODE_HOSTNAME"); hostname != "" {
+		return hostname, "NODE_HOSTNAME"
+	}
+	if hostnameFile := params.getEnv("NODE_HOSTNAME_FILE"); hostnameFile != "" {
+		if content, err := params.readFile(hostnameFile); err != nil {
+			params.logger.Error(err, "Unable to read hostname file", "path", hostnameFile)
+		} else if hostname := strings.TrimSpace(string(content)); hostname != "" {
+			return hostname, hostnameFile
+		}
+	}
+	if hostname, err := params.osHostname(); err != nil {
+		params.logger.Error(err, "Unable to get the hostname of the host")
+	} else if hostname != "" {
+		// Outside of the host network the hostname is the name of the pod, which matches no node
+		params.logger.Info("Falling back to the hostname of the host, it is the name of the pod unless the pod runs in the host network", "hostname", hostname)
+		return hostname, "os.Hostname"
+	}
+	return "", ""
+}
+
+//parseTargetTable accepts the ids of the classic rt_tables range, or every 32 bit id except the local table if largeTableIDs is set
+func parseTargetTable(targetTableEnv string, largeTableIDs bool) (int, error) {
 	if customTable, err := strconv.Atoi(targetTableEnv); err != nil {
-		panic(fmt.Sprintf("Unable to parse custom table 'TARGET_TABLE=%s' %s", targetTableEnv, err.Error()))
-	} else if customTable < 0 || customTable > 254 {
-		panic(fmt.Sprintf("Target table must be between 0 and 254 'TARGET_TABLE=%s'", targetTableEnv))
+		return 0, fmt.Errorf("Unable to parse custom table 'TARGET_TABLE=%s' %s", targetTableEnv, err.Error())
+	} else if !largeTableIDs && (customTable < 0 || customTable > 254) {
+		return 0, fmt.Errorf("Target table must be between 0 and 254 'TARGET_TABLE=%s'", targetTableEnv)
+	} else if largeTableIDs && (customTable < 0 || int64(customTable) > routemanager.MaxTable || customTable == localRouteTable) {
+		return 0, fmt.Errorf("Target table must be between 0 and %d, except %d 'TARGET_TABLE=%s'", int64(routemanager.MaxTable), localRouteTable, targetTableEnv)
+	} else {
+		return customTable, nil
+	}
+}
+
+func parseInterval(name, intervalEnv string, defaultInterval time.Duration) (time.Duration, error) {
+	if len(intervalEnv) == 0 {
+		return defaultInterval, nil
+	}
+	if interval, err := time.ParseDuration(intervalEnv); err != nil {
+		return 0, fmt.Errorf("Unable to parse interval '%s=%s' %s", name, intervalEnv, err.Error())
+	} else if interval < 0 {
+		return 0, fmt.Errorf("Interval must not be negative '%s=%s'", name, intervalEnv)
+	} else {
+		return interval, nil
+	}
+}
+
+func parseBool(name, boolEnv string) (bool, error) {
+	return parseBoolWithDefault(name, boolEnv, false)
+}
+
+//parseBoolWithDefault returns the default value if the variable is not set
+func parseBoolWithDefault(name, boolEnv string, defaultValue bool) (bool, error) {
+	if len(boolEnv) == 0 {
+		return defaultValue, nil
+	}
+	value, err := strconv.ParseBool(boolEnv)
+	if err != nil {
+		return false, fmt.Errorf("Unable to parse '%s=%s' %s", name, boolEnv, err.Error())
+	}
+	return value, nil
+}
+
+//parseOperatorID returns the ID of the operator instance and the routing protocol of its routes, the instance without ID uses the default protocol
+func parseOperatorID(operatorIDEnv string) (string, int, error) {
+	if len(operatorIDEnv) == 0 {
+		return "", routemanager.DefaultProtocol, nil
+	}
+	maxID := routemanager.MaxProtocol - routemanager.DefaultProtocol
+	if id, err := strconv.Atoi(operatorIDEnv); err != nil {
+		return "", 0, fmt.Errorf("Unable to parse operator ID 'OPERATOR_ID=%s' %s", operatorIDEnv, err.Error())
+	} else if id < 1 || id > maxID {
+		return "", 0, fmt.Errorf("Operator ID must be between 1 and %d 'OPERATOR_ID=%s'", maxID, operatorIDEnv)
 	} else {
-		return customTable
+		return strconv.Itoa(id), routemanager.DefaultProtocol + id, nil
 	}
 }
 
-func collectProtectedSubnets(envVars []string) []*net.IPNet {
+//parseAdoptProtocols parses the comma separated protocols of the previous operator versions, whose routes are taken over. Only the protocols reserved for the operator are accepted, except its own.
+func parseAdoptProtocols(adoptEnv string, protocol int) ([]int, error) {
+	if len(adoptEnv) == 0 {
+		return nil, nil
+	}
+	protocols := []int{}
+	for _, value := range strings.Split(adoptEnv, ",") {
+		adopt, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse 'ADOPT_PROTOCOLS=%s' %s", adoptEnv, err.Error())
+		}
+		if adopt < routemanager.DefaultProtocol || adopt > routemanager.MaxProtocol || adopt == protocol {
+			return nil, fmt.Errorf("Adopted protocols must be between %d and %d, other than %d 'ADOPT_PROTOCOLS=%s'", routemanager.DefaultProtocol, routemanager.MaxProtocol, protocol, adoptEnv)
+		}
+		protocols = append(protocols, adopt)
+	}
+	return protocols, nil
+}
+
+//parseECMPRebalance parses the policy of shifting the weight of the merged routes from their degraded nexthops, which is meaningful only with ECMP merge
+func parseECMPRebalance(rebalanceEnv string, merge bool) (string, error) {
+	switch rebalanceEnv {
+	case routemanager.ECMPRebalanceNone:
+		return rebalanceEnv, nil
+	case routemanager.ECMPRebalanceDrain, routemanager.ECMPRebalanceScale:
+		if !merge {
+			return "", fmt.Errorf("ECMP rebalance requires ECMP_MERGE=true 'ECMP_REBALANCE=%s'", rebalanceEnv)
+		}
+		return rebalanceEnv, nil
+	default:
+		return "", fmt.Errorf("ECMP rebalance must be %s or %s 'ECMP_REBALANCE=%s'", routemanager.ECMPRebalanceDrain, routemanager.ECMPRebalanceScale, rebalanceEnv)
+	}
+}
+
+func parseDegradedWeightPercent(percentEnv string) (int, error) {
+	if len(percentEnv) == 0 {
+		return 0, nil
+	}
+	if percent, err := strconv.Atoi(percentEnv); err != nil {
+		return 0, fmt.Errorf("Unable to parse 'ECMP_DEGRADED_WEIGHT_PERCENT=%s' %s", percentEnv, err.Error())
+	} else if percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("Degraded weight percent must be between 0 and 100 'ECMP_DEGRADED_WEIGHT_PERCENT=%s'", percentEnv)
+	} else {
+		return percent, nil
+	}
+}
+
+func parseMaxConcurrentReconciles(maxEnv string) (int, error) {
+	if len(maxEnv) == 0 {
+		return defaultMaxConcurrentReconciles, nil
+	}
+	if max, err := strconv.Atoi(maxEnv); err != nil {
+		return 0, fmt.Errorf("Unable to parse 'MAX_CONCURRENT_RECONCILES=%s' %s", maxEnv, err.Error())
+	} else if max < 1 {
+		return 0, fmt.Errorf("Concurrent reconciles must be at least 1 'MAX_CONCURRENT_RECONCILES=%s'", maxEnv)
+	} else {
+		return max, nil
+	}
+}
+
+func parseDrainPolicy(onDrainEnv string) (string, error) {
+	switch onDrainEnv {
+	case "", staticroute.DrainPolicyKeep:
+		return staticroute.DrainPolicyKeep, nil
+	case staticroute.DrainPolicyRemove:
+		return staticroute.DrainPolicyRemove, nil
+	default:
+		return "", fmt.Errorf("Drain policy must be %s or %s 'ON_DRAIN=%s'", staticroute.DrainPolicyKeep, staticroute.DrainPolicyRemove, onDrainEnv)
+	}
+}
+
+//ipNetStrings formats the subnets for logging
+func ipNetStrings(subnets []*net.IPNet) []string {
+	formatted := []string{}
+	for _, subnet := range subnets {
+		formatted = append(formatted, subnet.String())
+	}
+	return formatted
+}
+
+//apiServerIPs returns the addresses of the apiserver from the endpoints of the kubernetes service. The host of the client configuration is the virtual IP of the service in the cluster, the node has no route to that.
+func apiServerIPs(reader client.Reader) ([]net.IP, error) {
+	endpoints := &corev1.Endpoints{}
+	if err := reader.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "kubernetes"}, endpoints); err != nil {
+		return nil, err
+	}
+	ips := []net.IP{}
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			if ip := net.ParseIP(address.IP); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("Endpoints of the kubernetes service have no address")
+	}
+	return ips, nil
+}
+
+//apiServerAddresses keeps the addresses of the apiserver up to date, the endpoints of the kubernetes service change when the control plane moves
+type apiServerAddresses struct {
+	mutex  sync.RWMutex
+	ips    []net.IP
+	reader client.Reader
+	logger types.Logger
+}
+
+//newAPIServerAddresses reads the addresses of the apiserver for the first time, it fails if they are not available
+func newAPIServerAddresses(reader client.Reader, logger types.Logger) (*apiServerAddresses, error) {
+	ips, err := apiServerIPs(reader)
+	if err != nil {
+		return nil, err
+	}
+	return &apiServerAddresses{ips: ips, reader: reader, logger: logger}, nil
+}
+
+//IPs returns the last known addresses of the apiserver
+func (a *apiServerAddresses) IPs() []net.IP {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.ips
+}
+
+//refresh reads the addresses again, the last known ones are kept if they can't be read
+func (a *apiServerAddresses) refresh() {
+	ips, err := apiServerIPs(a.reader)
+	if err != nil {
+		a.logger.Error(err, "Unable to refresh the addresses of the apiserver, the last known ones are protected", "apiserver", ipStrings(a.IPs()))
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if !reflect.DeepEqual(a.ips, ips) {
+		a.logger.Info("Addresses of the apiserver changed", "apiserver", ipStrings(ips))
+	}
+	a.ips = ips
+}
+
+//run refreshes the addresses periodically, for the lifetime of the process like the route manager
+func (a *apiServerAddresses) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		a.refresh()
+	}
+}
+
+//ipString formats the address for logging, empty if it is not set
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+//ipStrings formats the addresses for logging
+func ipStrings(ips []net.IP) []string {
+	formatted := []string{}
+	for _, ip := range ips {
+		formatted = append(formatted, ip.String())
+	}
+	return formatted
+}
+
+//parseKillSwitch parses the namespace/name of the kill switch ConfigMap, empty value turns the kill switch off
+func parseKillSwitch(killSwitchEnv string) (k8stypes.NamespacedName, error) {
+	return parseConfigMapName("Kill switch", "KILL_SWITCH_CONFIGMAP", killSwitchEnv)
+}
+
+//parseConfigMapName parses the namespace/name of the ConfigMap given by the environment variable, empty value gives an empty name
+func parseConfigMapName(what, name, value string) (k8stypes.NamespacedName, error) {
+	if len(value) == 0 {
+		return k8stypes.NamespacedName{}, nil
+	}
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return k8stypes.NamespacedName{}, fmt.Errorf("%s must be given as namespace/name '%s=%s'", what, name, value)
+	}
+	return k8stypes.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+func collectProtectedSubnets(envVars []string) ([]*net.IPNet, error) {
 	protectedSubnets := []*net.IPNet{}
 	for _, e := range envVars {
-		if v := strings.SplitN(e, "=", 2); strings.Contains(v[0], "PROTECTED_SUBNET_") {
-			for _, subnet := range strings.Split(v[1], ",") {
-				_, subnetNet, err := net.ParseCIDR(strings.Trim(subnet, " "))
-				if err != nil {
-					panic(err)
+		if v := strings.SplitN(e, "=", 2); strings.Contains(v[0], "PROTECTED_SUBNET_") && !strings.Contains(v[0], "PROTECTED_SUBNET_EXCEPTION_") {
+			subnets, err := parseSubnets(v[1])
+			if err != nil {
+				return nil, err
+			}
+			protectedSubnets = append(protectedSubnets, subnets...)
+		}
+	}
+	return protectedSubnets, nil
+}
+
+//collectProtectedSubnetExceptions returns the subnets which can be routed, even though they are within a protected subnet
+func collectProtectedSubnetExceptions(envVars []string, protectedSubnets []*net.IPNet) ([]*net.IPNet, error) {
+	exceptions := []*net.IPNet{}
+	for _, e := range envVars {
+		if v := strings.SplitN(e, "=", 2); strings.Contains(v[0], "PROTECTED_SUBNET_EXCEPTION_") {
+			subnets, err := parseSubnets(v[1])
+			if err != nil {
+				return nil, err
+			}
+			for _, subnet := range subnets {
+				if !isWithinAny(subnet, protectedSubnets) {
+					return nil, fmt.Errorf("Protected subnet exception is not within any protected subnet '%s=%s'", v[0], subnet.String())
 				}
-				protectedSubnets = append(protectedSubnets, subnetNet)
 			}
+			exceptions = append(exceptions, subnets...)
+		}
+	}
+	return exceptions, nil
+}
+
+func parseSubnets(subnetsEnv string) ([]*net.IPNet, error) {
+	subnets := []*net.IPNet{}
+	for _, subnet := range strings.Split(subnetsEnv, ",") {
+		_, subnetNet, err := net.ParseCIDR(strings.Trim(subnet, " "))
+		if err != nil {
+			return nil, err
+		}
+		subnets = append(subnets, subnetNet)
+	}
+	return subnets, nil
+}
+
+func isWithinAny(subnet *net.IPNet, subnets []*net.IPNet) bool {
+	ones, bits := subnet.Mask.Size()
+	for _, s := range subnets {
+		if sOnes, sBits := s.Mask.Size(); sBits == bits && sOnes <= ones && s.Contains(subnet.IP) {
+			return true
 		}
 	}
-	return protectedSubnets
+	return false
 }
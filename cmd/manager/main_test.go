@@ -20,13 +20,19 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"reflect"
 	"runtime/debug"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/IBM/staticroute-operator/pkg/controller/node"
 	"github.com/IBM/staticroute-operator/pkg/controller/staticroute"
 	"github.com/IBM/staticroute-operator/pkg/routemanager"
+	"github.com/IBM/staticroute-operator/pkg/types"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
@@ -41,7 +47,9 @@ func TestMainImpl(t *testing.T) {
 	defer catchError(t)()
 	params, callbacks := getContextForHappyFlow()
 
-	mainImpl(*params)
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
 
 	expected := mockCallbacks{
 		getConfigCalled:                true,
@@ -70,7 +78,9 @@ func TestMainImplTargetTableOk(t *testing.T) {
 		return nil
 	}
 
-	mainImpl(*params)
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
 
 	if actualTable != 42 {
 		t.Errorf("Target table not match 42 != %d", actualTable)
@@ -93,7 +103,9 @@ func TestMainImplProtectedSubnetsOk(t *testing.T) {
 		return nil
 	}
 
-	mainImpl(*params)
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
 
 	expectedSubnets := []*net.IPNet{
 		&net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.IPv4Mask(0xff, 0, 0, 0)},
@@ -105,6 +117,32 @@ func TestMainImplProtectedSubnetsOk(t *testing.T) {
 	}
 }
 
+func TestMainImplProtectedSubnetExceptionsOk(t *testing.T) {
+	var actualSubnets, actualExceptions []*net.IPNet
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.osEnv = osEnvMock([]string{
+		"PROTECTED_SUBNET_CALICO=10.0.0.0/8",
+		"PROTECTED_SUBNET_EXCEPTION_DB=10.1.2.0/24, 10.1.3.0/24",
+	})
+	params.addStaticRouteController = func(mgr manager.Manager, options staticroute.ManagerOptions) error {
+		actualSubnets = options.ProtectedSubnets
+		actualExceptions = options.ProtectedSubnetExceptions
+		return nil
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if fmt.Sprintf("%v", actualSubnets) != "[10.0.0.0/8]" {
+		t.Errorf("Exceptions must not be protected: %v", actualSubnets)
+	}
+	if fmt.Sprintf("%v", actualExceptions) != "[10.1.2.0/24 10.1.3.0/24]" {
+		t.Errorf("Protected subnet exceptions are not match: %v", actualExceptions)
+	}
+}
+
 func TestMainImplFallbackIPOk(t *testing.T) {
 	var actualFallbackIP net.IP
 	expectedFallbackIP := net.IP{192, 168, 1, 1}
@@ -116,208 +154,1045 @@ func TestMainImplFallbackIPOk(t *testing.T) {
 		return nil
 	}
 
-	mainImpl(*params)
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
 
 	if !expectedFallbackIP.Equal(actualFallbackIP) {
 		t.Errorf("Invalid fallback IP detected %s != %s", expectedFallbackIP.String(), actualFallbackIP.String())
 	}
 }
 
+func TestMainImplReconcileIntervalOk(t *testing.T) {
+	var actualInterval time.Duration
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"RECONCILE_INTERVAL": "5m"})
+	params.addStaticRouteController = func(mgr manager.Manager, options staticroute.ManagerOptions) error {
+		actualInterval = options.ReconcileInterval
+		return nil
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualInterval != 5*time.Minute {
+		t.Errorf("Reconcile interval not match 5m != %s", actualInterval)
+	}
+}
+
+func TestMainImplReconcileIntervalDefaultOff(t *testing.T) {
+	actualInterval := time.Minute
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.addStaticRouteController = func(mgr manager.Manager, options staticroute.ManagerOptions) error {
+		actualInterval = options.ReconcileInterval
+		return nil
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualInterval != 0 {
+		t.Errorf("Reconcile interval must be off by default: %s", actualInterval)
+	}
+}
+
+func TestMainImplNodeControllerOptions(t *testing.T) {
+	var actualOptions node.ManagerOptions
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "100", "", ""), map[string]string{"NODE_MANAGEMENT_ROUTES": "true"})
+	params.addNodeController = func(mgr manager.Manager, options node.ManagerOptions) error {
+		actualOptions = options
+		return nil
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if !actualOptions.ManagementRoutes || actualOptions.Hostname != "hostname" || actualOptions.Table != 100 || actualOptions.RouteManager == nil {
+		t.Errorf("Node controller options not match: %v", actualOptions)
+	}
+
+	params.getEnv = getEnvMock("", "hostname", "", "", "")
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualOptions.ManagementRoutes {
+		t.Error("Management routes must be disabled by default")
+	}
+}
+
+func TestMainImplPublishPrimaryRoute(t *testing.T) {
+	var actualOptions node.ManagerOptions
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.addNodeController = func(mgr manager.Manager, options node.ManagerOptions) error {
+		actualOptions = options
+		return nil
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualOptions.PublishPrimaryRoute {
+		t.Error("Primary route annotations must be disabled by default")
+	}
+
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"PUBLISH_PRIMARY_ROUTE": "true", "FALLBACK_IP_FOR_GW_SELECTION": "10.1.0.1"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if !actualOptions.PublishPrimaryRoute || actualOptions.PrimaryRouteResolver == nil || !actualOptions.FallbackIPForGwSelection.Equal(net.IP{10, 1, 0, 1}) {
+		t.Errorf("Node controller options not match: %v", actualOptions)
+	}
+}
+
+func TestMainImplPublishPrimaryRouteInvalid(t *testing.T) {
+	params, _ := getContextForHappyFlow()
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"PUBLISH_PRIMARY_ROUTE": "invalid"})
+
+	validateError(t, mainImpl(*params), "Unable to parse 'PUBLISH_PRIMARY_ROUTE=invalid' strconv.ParseBool: parsing \"invalid\": invalid syntax")
+}
+
+func TestMainImplDrainPolicy(t *testing.T) {
+	var actualPolicy string
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.addStaticRouteController = func(mgr manager.Manager, options staticroute.ManagerOptions) error {
+		actualPolicy = options.OnDrain
+		return nil
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualPolicy != staticroute.DrainPolicyKeep {
+		t.Errorf("Drain policy must be keep by default: %s", actualPolicy)
+	}
+
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"ON_DRAIN": "remove"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualPolicy != staticroute.DrainPolicyRemove {
+		t.Errorf("Drain policy not match remove != %s", actualPolicy)
+	}
+}
+
+func TestMainImplGatewayResolveInterval(t *testing.T) {
+	var actualInterval time.Duration
+	var actualLookupIP func(string) ([]net.IP, error)
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.addStaticRouteController = func(mgr manager.Manager, options staticroute.ManagerOptions) error {
+		actualInterval = options.GatewayResolveInterval
+		actualLookupIP = options.LookupIP
+		return nil
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualInterval != defaultGatewayResolveInterval {
+		t.Errorf("Gateway resolve interval must be the default: %s", actualInterval)
+	}
+	if actualLookupIP == nil {
+		t.Error("LookupIP must be passed to the controller")
+	}
+
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"GATEWAY_RESOLVE_INTERVAL": "30s"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualInterval != 30*time.Second {
+		t.Errorf("Gateway resolve interval not match 30s != %s", actualInterval)
+	}
+}
+
+func TestMainImplGatewayProbeOptions(t *testing.T) {
+	var actualOptions routemanager.Options
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.newRouterManager = func(options routemanager.Options) routemanager.RouteManager {
+		actualOptions = options
+		return mockRouteManager{}
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualOptions.ProbeInterval != defaultGatewayProbeInterval || actualOptions.DegradedAfter != defaultDegradedAfter || actualOptions.RecoveredAfter != defaultRecoveredAfter {
+		t.Errorf("Gateway probe options must be the default: %+v", actualOptions)
+	}
+
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"GATEWAY_PROBE_INTERVAL": "0", "DEGRADED_AFTER": "1m", "RECOVERED_AFTER": "2m"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualOptions.ProbeInterval != 0 || actualOptions.DegradedAfter != time.Minute || actualOptions.RecoveredAfter != 2*time.Minute {
+		t.Errorf("Gateway probe options not match: %+v", actualOptions)
+	}
+}
+
+func TestMainImplDriftCorrectionInterval(t *testing.T) {
+	var actualOptions routemanager.Options
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.newRouterManager = func(options routemanager.Options) routemanager.RouteManager {
+		actualOptions = options
+		return mockRouteManager{}
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualOptions.DriftCorrectionInterval != defaultDriftCorrectionInterval {
+		t.Errorf("Drift correction interval must be the default: %s", actualOptions.DriftCorrectionInterval)
+	}
+
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"DRIFT_CORRECTION_INTERVAL": "0"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualOptions.DriftCorrectionInterval != 0 {
+		t.Errorf("Drift correction interval not match: %s", actualOptions.DriftCorrectionInterval)
+	}
+}
+
+func TestMainImplNetlinkTimeout(t *testing.T) {
+	var actualOptions routemanager.Options
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.newRouterManager = func(options routemanager.Options) routemanager.RouteManager {
+		actualOptions = options
+		return mockRouteManager{}
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualOptions.NetlinkTimeout != defaultNetlinkTimeout {
+		t.Errorf("Netlink timeout must be the default: %s", actualOptions.NetlinkTimeout)
+	}
+
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"NETLINK_TIMEOUT": "5s"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualOptions.NetlinkTimeout != 5*time.Second {
+		t.Errorf("Netlink timeout not match: %s", actualOptions.NetlinkTimeout)
+	}
+}
+
+func TestMainImplECMPMerge(t *testing.T) {
+	var actualOptions routemanager.Options
+	var actualMerge bool
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.newRouterManager = func(options routemanager.Options) routemanager.RouteManager {
+		actualOptions = options
+		return mockRouteManager{}
+	}
+	params.addStaticRouteController = func(mgr manager.Manager, options staticroute.ManagerOptions) error {
+		actualMerge = options.ECMPMerge
+		return nil
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualOptions.ECMPMerge || actualMerge {
+		t.Error("ECMP merge must be disabled by default")
+	}
+
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"ECMP_MERGE": "true"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if !actualOptions.ECMPMerge || !actualMerge {
+		t.Errorf("ECMP merge must be enabled: %v %v", actualOptions.ECMPMerge, actualMerge)
+	}
+}
+
+func TestMainImplAPIServerRouteProtection(t *testing.T) {
+	var actualOptions routemanager.Options
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.newManager = func(*rest.Config, manager.Options) (manager.Manager, error) {
+		return mockManager{client: newFakeClientWithEndpoints("10.1.0.1", "10.1.0.2")}, nil
+	}
+	params.newRouterManager = func(options routemanager.Options) routemanager.RouteManager {
+		actualOptions = options
+		return mockRouteManager{}
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualOptions.APIServerIPs == nil {
+		t.Fatal("Route to the apiserver must be protected by default")
+	}
+	if ips := actualOptions.APIServerIPs(); len(ips) != 2 || !ips[0].Equal(net.IP{10, 1, 0, 1}) || !ips[1].Equal(net.IP{10, 1, 0, 2}) {
+		t.Errorf("Routes to the endpoints of the apiserver must be protected: %v", ips)
+	}
+
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"PROTECT_APISERVER_ROUTE": "false"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualOptions.APIServerIPs != nil {
+		t.Errorf("Route to the apiserver must be not protected with the override: %v", actualOptions.APIServerIPs())
+	}
+}
+
+func TestMainImplAPIServerRouteProtectionUnresolved(t *testing.T) {
+	defer catchError(t)()
+	params, callbacks := getContextForHappyFlow()
+	params.newManager = func(*rest.Config, manager.Options) (manager.Manager, error) {
+		return mockManager{client: newFakeClientWithEndpoints()}, nil
+	}
+
+	err := mainImpl(*params)
+
+	validateError(t, err, "Unable to resolve the addresses of the apiserver, set PROTECT_APISERVER_ROUTE=false to run without protecting its route: Endpoints of the kubernetes service have no address")
+	if callbacks.newRouterManagerCalled {
+		t.Error("Operator must not start without the protection")
+	}
+}
+
+func TestAPIServerAddressesRefresh(t *testing.T) {
+	addresses, err := newAPIServerAddresses(newFakeClientWithEndpoints("10.1.0.1"), mockLogger{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	addresses.reader = newFakeClientWithEndpoints("10.1.0.2")
+	addresses.refresh()
+
+	if ips := addresses.IPs(); len(ips) != 1 || !ips[0].Equal(net.IP{10, 1, 0, 2}) {
+		t.Errorf("Changed addresses of the apiserver must be protected: %v", ips)
+	}
+
+	addresses.reader = newFakeClientWithoutEndpoints()
+	addresses.refresh()
+
+	if ips := addresses.IPs(); len(ips) != 1 || !ips[0].Equal(net.IP{10, 1, 0, 2}) {
+		t.Errorf("Last known addresses of the apiserver must be kept: %v", ips)
+	}
+
+	if _, err := newAPIServerAddresses(newFakeClientWithoutEndpoints(), mockLogger{}); err == nil {
+		t.Error("Missing endpoints must fail")
+	}
+}
+
+func TestAPIServerIPs(t *testing.T) {
+	ips, err := apiServerIPs(newFakeClientWithEndpoints("10.1.0.1", "invalid", "fd00::1"))
+	if err != nil || len(ips) != 2 || !ips[0].Equal(net.IP{10, 1, 0, 1}) || !ips[1].Equal(net.ParseIP("fd00::1")) {
+		t.Errorf("Addresses of the endpoints must be returned: %v %v", ips, err)
+	}
+
+	if ips, err := apiServerIPs(newFakeClientWithEndpoints()); err == nil || err.Error() != "Endpoints of the kubernetes service have no address" {
+		t.Errorf("Endpoints without address must fail: %v %v", ips, err)
+	}
+
+	if ips, err := apiServerIPs(newFakeClientWithoutEndpoints()); err == nil {
+		t.Errorf("Missing endpoints must fail: %v", ips)
+	}
+}
+
+func TestMainImplECMPRebalance(t *testing.T) {
+	var actualOptions routemanager.Options
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.newRouterManager = func(options routemanager.Options) routemanager.RouteManager {
+		actualOptions = options
+		return mockRouteManager{}
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualOptions.ECMPRebalance != routemanager.ECMPRebalanceNone || actualOptions.ECMPDegradedWeightPercent != 0 {
+		t.Errorf("ECMP rebalance must be disabled by default: %q %d", actualOptions.ECMPRebalance, actualOptions.ECMPDegradedWeightPercent)
+	}
+
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"ECMP_MERGE": "true", "ECMP_REBALANCE": "scale", "ECMP_DEGRADED_WEIGHT_PERCENT": "25"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualOptions.ECMPRebalance != routemanager.ECMPRebalanceScale || actualOptions.ECMPDegradedWeightPercent != 25 {
+		t.Errorf("ECMP rebalance must be scale: %q %d", actualOptions.ECMPRebalance, actualOptions.ECMPDegradedWeightPercent)
+	}
+}
+
+func TestMainImplFailOnUnreachable(t *testing.T) {
+	var actual bool
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.addStaticRouteController = func(mgr manager.Manager, options staticroute.ManagerOptions) error {
+		actual = options.FailOnUnreachable
+		return nil
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actual {
+		t.Error("Unreachable network must be retried by default")
+	}
+
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"FAIL_ON_UNREACHABLE": "true"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if !actual {
+		t.Error("Unreachable network must fail the routes")
+	}
+}
+
+func TestMainImplMaxConcurrentReconciles(t *testing.T) {
+	var staticRouteMax, nodeMax int
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.addStaticRouteController = func(mgr manager.Manager, options staticroute.ManagerOptions) error {
+		staticRouteMax = options.MaxConcurrentReconciles
+		return nil
+	}
+	params.addNodeController = func(mgr manager.Manager, options node.ManagerOptions) error {
+		nodeMax = options.MaxConcurrentReconciles
+		return nil
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if staticRouteMax != 1 || nodeMax != 1 {
+		t.Errorf("Reconciles must be single-threaded by default: %d %d", staticRouteMax, nodeMax)
+	}
+
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"MAX_CONCURRENT_RECONCILES": "8"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if staticRouteMax != 8 || nodeMax != 8 {
+		t.Errorf("Concurrent reconciles not match: %d %d", staticRouteMax, nodeMax)
+	}
+}
+
+func TestMainImplDegradedAfterInvalid(t *testing.T) {
+	params, _ := getContextForHappyFlow()
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"DEGRADED_AFTER": "-1s"})
+
+	validateError(t, mainImpl(*params), "Interval must not be negative 'DEGRADED_AFTER=-1s'")
+}
+
+func TestMainImplOperatorID(t *testing.T) {
+	var actualProtocol int
+	var actualID string
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.newRouterManager = func(options routemanager.Options) routemanager.RouteManager {
+		actualProtocol = options.Protocol
+		return mockRouteManager{}
+	}
+	params.addStaticRouteController = func(mgr manager.Manager, options staticroute.ManagerOptions) error {
+		actualID = options.OperatorID
+		return nil
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualID != "" || actualProtocol != routemanager.DefaultProtocol {
+		t.Errorf("Operator instance must be the default: %s %d", actualID, actualProtocol)
+	}
+
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"OPERATOR_ID": "07"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualID != "7" || actualProtocol != routemanager.DefaultProtocol+7 {
+		t.Errorf("Operator instance not match: %s %d", actualID, actualProtocol)
+	}
+}
+
+func TestMainImplAdoptProtocols(t *testing.T) {
+	var actual []int
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.newRouterManager = func(options routemanager.Options) routemanager.RouteManager {
+		actual = options.AdoptProtocols
+		return mockRouteManager{}
+	}
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"OPERATOR_ID": "1", "ADOPT_PROTOCOLS": "196, 250"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(actual, []int{196, 250}) {
+		t.Errorf("Adopted protocols not match: %v", actual)
+	}
+}
+
+func TestMainImplOperatorIDInvalid(t *testing.T) {
+	params, _ := getContextForHappyFlow()
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"OPERATOR_ID": "60"})
+
+	validateError(t, mainImpl(*params), "Operator ID must be between 1 and 59 'OPERATOR_ID=60'")
+}
+
 func TestMainImplGetConfigFails(t *testing.T) {
 	err := errors.New("fatal-error")
-	defer validateRecovery(t, err)()
 	params, _ := getContextForHappyFlow()
 	params.getConfig = func() (*rest.Config, error) {
 		return nil, err
 	}
 
-	mainImpl(*params)
-
-	t.Error("Error didn't appear")
+	validateError(t, mainImpl(*params), err)
 }
 
 func TestMainImplNewManagerFails(t *testing.T) {
 	err := errors.New("fatal-error")
-	defer validateRecovery(t, err)()
 	params, _ := getContextForHappyFlow()
 	params.newManager = func(*rest.Config, manager.Options) (manager.Manager, error) {
 		return mockManager{}, err
 	}
 
-	mainImpl(*params)
-
-	t.Error("Error didn't appear")
+	validateError(t, mainImpl(*params), err)
 }
 
 func TestMainImplAddToSchemeFails(t *testing.T) {
 	err := errors.New("fatal-error")
-	defer validateRecovery(t, err)()
 	params, _ := getContextForHappyFlow()
 	params.addToScheme = func(s *runtime.Scheme) error {
 		return err
 	}
 
-	mainImpl(*params)
-
-	t.Error("Error didn't appear")
+	validateError(t, mainImpl(*params), err)
 }
 
 func TestMainImplHostnameMissing(t *testing.T) {
-	defer validateRecovery(t, "Missing environment variable: NODE_HOSTNAME")()
 	params, _ := getContextForHappyFlow()
 	params.getEnv = getEnvMock("", "", "", "", "")
 
-	mainImpl(*params)
+	validateError(t, mainImpl(*params), "Unable to determine the hostname of the node: NODE_HOSTNAME is not set, NODE_HOSTNAME_FILE is not set, and the hostname of the host is not available")
+}
 
-	t.Error("Error didn't appear")
+func TestMainImplHostnameFallback(t *testing.T) {
+	var testData = []struct {
+		hostnameFile string
+		fileContent  string
+		osHostname   string
+		expected     string
+	}{
+		{"/etc/podinfo/nodename", "node-from-file\n", "os-hostname", "node-from-file"},
+		{"/etc/podinfo/nodename", "", "os-hostname", "os-hostname"},
+		{"", "node-from-file", "os-hostname", "os-hostname"},
+	}
+	for i, td := range testData {
+		var actualHostname, readPath string
+		func() {
+			defer catchError(t)()
+			params, _ := getContextForHappyFlow()
+			params.getEnv = getEnvMockWith(getEnvMock("", "", "", "", ""), map[string]string{"NODE_HOSTNAME_FILE": td.hostnameFile})
+			params.readFile = func(path string) ([]byte, error) {
+				readPath = path
+				return []byte(td.fileContent), nil
+			}
+			params.osHostname = func() (string, error) {
+				return td.osHostname, nil
+			}
+			params.addStaticRouteController = func(mgr manager.Manager, options staticroute.ManagerOptions) error {
+				actualHostname = options.Hostname
+				return nil
+			}
+
+			if err := mainImpl(*params); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+
+		if actualHostname != td.expected {
+			t.Errorf("Hostname must be %s, it is %s at %d", td.expected, actualHostname, i)
+		}
+		if readPath != td.hostnameFile {
+			t.Errorf("Hostname file must be read from %s, it is %s at %d", td.hostnameFile, readPath, i)
+		}
+	}
+}
+
+func TestMainImplHostnameFallbackFails(t *testing.T) {
+	params, _ := getContextForHappyFlow()
+	params.getEnv = getEnvMockWith(getEnvMock("", "", "", "", ""), map[string]string{"NODE_HOSTNAME_FILE": "/etc/podinfo/nodename"})
+
+	validateError(t, mainImpl(*params), "Unable to determine the hostname of the node: NODE_HOSTNAME is not set, the file of NODE_HOSTNAME_FILE '/etc/podinfo/nodename' is unreadable or empty, and the hostname of the host is not available")
+}
+
+func TestMainImplHostnameFallbackWarns(t *testing.T) {
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.getEnv = getEnvMock("", "", "", "", "")
+	params.osHostname = func() (string, error) {
+		return "pod-name", nil
+	}
+	logger := &recordingLogger{}
+	params.logger = logger
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	for _, message := range logger.messages {
+		if strings.HasPrefix(message, "Falling back to the hostname of the host") {
+			return
+		}
+	}
+	t.Errorf("Fallback to the hostname of the host must be logged: %v", logger.messages)
 }
 
 func TestMainImplTargetTableInvalid(t *testing.T) {
-	defer validateRecovery(t, "Unable to parse custom table 'TARGET_TABLE=invalid-table' strconv.Atoi: parsing \"invalid-table\": invalid syntax")()
 	params, _ := getContextForHappyFlow()
 	params.getEnv = getEnvMock("", "hostname", "invalid-table", "", "")
 
-	mainImpl(*params)
-
-	t.Error("Error didn't appear")
+	validateError(t, mainImpl(*params), "Unable to parse custom table 'TARGET_TABLE=invalid-table' strconv.Atoi: parsing \"invalid-table\": invalid syntax")
 }
 
 func TestMainImplTargetTableFewer(t *testing.T) {
-	defer validateRecovery(t, "Target table must be between 0 and 254 'TARGET_TABLE=-1'")()
 	params, _ := getContextForHappyFlow()
 	params.getEnv = getEnvMock("", "hostname", "-1", "", "")
 
-	mainImpl(*params)
-
-	t.Error("Error didn't appear")
+	validateError(t, mainImpl(*params), "Target table must be between 0 and 254 'TARGET_TABLE=-1'")
 }
 
 func TestMainImplTargetTableGreater(t *testing.T) {
-	defer validateRecovery(t, "Target table must be between 0 and 254 'TARGET_TABLE=255'")()
 	params, _ := getContextForHappyFlow()
 	params.getEnv = getEnvMock("", "hostname", "255", "", "")
 
-	mainImpl(*params)
+	validateError(t, mainImpl(*params), "Target table must be between 0 and 254 'TARGET_TABLE=255'")
+}
 
-	t.Error("Error didn't appear")
+func TestMainImplLargeTableIDs(t *testing.T) {
+	var actualTable int
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "100000", "", ""), map[string]string{"LARGE_TABLE_IDS": "true"})
+	params.addStaticRouteController = func(mgr manager.Manager, options staticroute.ManagerOptions) error {
+		actualTable = options.Table
+		return nil
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualTable != 100000 {
+		t.Errorf("Target table not match 100000 != %d", actualTable)
+	}
+
+	params.getEnv = getEnvMock("", "hostname", "100000", "", "")
+
+	validateError(t, mainImpl(*params), "Target table must be between 0 and 254 'TARGET_TABLE=100000'")
+}
+
+func TestMainImplLargeTableIDsInvalid(t *testing.T) {
+	for _, table := range []string{"255", "4294967296", "-1"} {
+		params, _ := getContextForHappyFlow()
+		params.getEnv = getEnvMockWith(getEnvMock("", "hostname", table, "", ""), map[string]string{"LARGE_TABLE_IDS": "true"})
+
+		validateError(t, mainImpl(*params), "Target table must be between 0 and 4294967295, except 255 'TARGET_TABLE="+table+"'")
+	}
 }
 
 func TestMainImplProtectedSubnetsInvalid(t *testing.T) {
-	defer validateRecovery(t, "invalid CIDR address: 987.654.321.012")()
 	params, _ := getContextForHappyFlow()
 	params.osEnv = osEnvMock([]string{
 		"PROTECTED_SUBNET_MYNET=987.654.321.012",
 	})
 
-	mainImpl(*params)
+	validateError(t, mainImpl(*params), "invalid CIDR address: 987.654.321.012")
+}
+
+func TestMainImplProtectedSubnetExceptionNotWithinProtected(t *testing.T) {
+	params, _ := getContextForHappyFlow()
+	params.osEnv = osEnvMock([]string{
+		"PROTECTED_SUBNET_CALICO=10.0.0.0/16",
+		"PROTECTED_SUBNET_EXCEPTION_DB=10.0.0.0/8",
+	})
 
-	t.Error("Error didn't appear")
+	validateError(t, mainImpl(*params), "Protected subnet exception is not within any protected subnet 'PROTECTED_SUBNET_EXCEPTION_DB=10.0.0.0/8'")
+}
+
+func TestMainImplProtectedSubnetExceptionInvalid(t *testing.T) {
+	params, _ := getContextForHappyFlow()
+	params.osEnv = osEnvMock([]string{
+		"PROTECTED_SUBNET_CALICO=10.0.0.0/8",
+		"PROTECTED_SUBNET_EXCEPTION_DB=10.1.2.0",
+	})
+
+	validateError(t, mainImpl(*params), "invalid CIDR address: 10.1.2.0")
 }
 
 func TestMainImplFallbackIPInvalid(t *testing.T) {
-	defer validateRecovery(t, "Environment variable parse error: FALLBACK_IP_FOR_GW_SELECTION.")()
 	params, _ := getContextForHappyFlow()
 	params.getEnv = getEnvMock("", "hostname", "", "", "invalid-ip")
 
-	mainImpl(*params)
-
-	t.Error("Error didn't appear")
+	validateError(t, mainImpl(*params), "Environment variable parse error: FALLBACK_IP_FOR_GW_SELECTION.")
 }
 
 func TestMainImplFallbackIPv6Provided(t *testing.T) {
-	defer validateRecovery(t, "Environment variable parse error: FALLBACK_IP_FOR_GW_SELECTION.")()
 	params, _ := getContextForHappyFlow()
 	params.getEnv = getEnvMock("", "hostname", "", "", "1:2:3:4:5::6")
 
-	mainImpl(*params)
+	validateError(t, mainImpl(*params), "Environment variable parse error: FALLBACK_IP_FOR_GW_SELECTION.")
+}
+
+func TestMainImplDefaultGateway(t *testing.T) {
+	var actualDefaultGateway net.IP
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.addStaticRouteController = func(mgr manager.Manager, options staticroute.ManagerOptions) error {
+		actualDefaultGateway = options.DefaultGateway
+		return nil
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualDefaultGateway != nil {
+		t.Errorf("Default gateway must be off by default: %v", actualDefaultGateway)
+	}
+
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"DEFAULT_GATEWAY": "10.0.0.5"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if !actualDefaultGateway.Equal(net.IP{10, 0, 0, 5}) || len(actualDefaultGateway) != net.IPv4len {
+		t.Errorf("Default gateway must be passed to the controller: %v", actualDefaultGateway)
+	}
+}
+
+func TestMainImplDefaultGatewayInvalid(t *testing.T) {
+	params, _ := getContextForHappyFlow()
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"DEFAULT_GATEWAY": "invalid-ip"})
+
+	validateError(t, mainImpl(*params), "Environment variable parse error: DEFAULT_GATEWAY.")
+}
+
+func TestMainImplReconcileIntervalInvalid(t *testing.T) {
+	_, parseErr := time.ParseDuration("invalid")
+	params, _ := getContextForHappyFlow()
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"RECONCILE_INTERVAL": "invalid"})
+
+	validateError(t, mainImpl(*params), "Unable to parse interval 'RECONCILE_INTERVAL=invalid' "+parseErr.Error())
+}
+
+func TestMainImplReconcileIntervalNegative(t *testing.T) {
+	params, _ := getContextForHappyFlow()
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"RECONCILE_INTERVAL": "-1s"})
+
+	validateError(t, mainImpl(*params), "Interval must not be negative 'RECONCILE_INTERVAL=-1s'")
+}
+
+func TestMainImplManagementRoutesInvalid(t *testing.T) {
+	params, _ := getContextForHappyFlow()
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"NODE_MANAGEMENT_ROUTES": "invalid"})
+
+	validateError(t, mainImpl(*params), "Unable to parse 'NODE_MANAGEMENT_ROUTES=invalid' strconv.ParseBool: parsing \"invalid\": invalid syntax")
+}
+
+func TestMainImplKillSwitch(t *testing.T) {
+	var actualKillSwitch k8stypes.NamespacedName
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.addStaticRouteController = func(mgr manager.Manager, options staticroute.ManagerOptions) error {
+		actualKillSwitch = options.KillSwitch
+		return nil
+	}
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if len(actualKillSwitch.Name) != 0 {
+		t.Errorf("Kill switch must be off by default: %v", actualKillSwitch)
+	}
+
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"KILL_SWITCH_CONFIGMAP": "kube-system/static-route-kill-switch"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if actualKillSwitch.Namespace != "kube-system" || actualKillSwitch.Name != "static-route-kill-switch" {
+		t.Errorf("Kill switch not match: %v", actualKillSwitch)
+	}
+}
+
+func TestMainImplProtectedSubnetsConfigMap(t *testing.T) {
+	var actualConfigMap k8stypes.NamespacedName
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.addStaticRouteController = func(mgr manager.Manager, options staticroute.ManagerOptions) error {
+		actualConfigMap = options.ProtectedSubnetsConfigMap
+		return nil
+	}
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"PROTECTED_SUBNETS_CONFIGMAP": "kube-system/protected-subnets"})
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
 
-	t.Error("Error didn't appear")
+	if actualConfigMap.Namespace != "kube-system" || actualConfigMap.Name != "protected-subnets" {
+		t.Errorf("Protected subnets ConfigMap not match: %v", actualConfigMap)
+	}
+}
+
+func TestMainImplDumpsEffectiveConfiguration(t *testing.T) {
+	defer catchError(t)()
+	params, _ := getContextForHappyFlow()
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "100", "", ""), map[string]string{"NODE_MANAGEMENT_ROUTES": "true", "OPERATOR_ID": "2", "DEFAULT_GATEWAY": "10.0.0.5"})
+	params.osEnv = osEnvMock([]string{"PROTECTED_SUBNET_TEST=10.1.0.0/16"})
+	logger := &recordingLogger{}
+	params.configLogger = logger
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if len(logger.messages) != 1 || logger.messages[0] != "Effective configuration" {
+		t.Fatalf("Configuration must be dumped in a single line: %v", logger.messages)
+	}
+	config := map[string]interface{}{}
+	for i := 0; i+1 < len(logger.keysAndValues[0]); i += 2 {
+		config[logger.keysAndValues[0][i].(string)] = logger.keysAndValues[0][i+1]
+	}
+	expected := map[string]interface{}{
+		"hostname":          "hostname",
+		"table":             100,
+		"operatorID":        "2",
+		"managementRoutes":  true,
+		"fallbackIP":        "10.0.0.1",
+		"defaultGateway":    "10.0.0.5",
+		"reconcileInterval": "0s",
+		"netlinkTimeout":    defaultNetlinkTimeout.String(),
+	}
+	for key, value := range expected {
+		if !reflect.DeepEqual(config[key], value) {
+			t.Errorf("Configuration %s not match: %v != %v", key, config[key], value)
+		}
+	}
+	if !reflect.DeepEqual(config["protectedSubnets"], []string{"10.1.0.0/16"}) {
+		t.Errorf("Protected subnets not match: %v", config["protectedSubnets"])
+	}
+}
+
+func TestMainImplDrainPolicyInvalid(t *testing.T) {
+	params, _ := getContextForHappyFlow()
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"ON_DRAIN": "invalid"})
+
+	validateError(t, mainImpl(*params), "Drain policy must be keep or remove 'ON_DRAIN=invalid'")
+}
+
+func TestMainImplMisconfigurationDoesNotStartComponents(t *testing.T) {
+	var testData = []struct {
+		env      map[string]string
+		expected string
+	}{
+		{map[string]string{"GATEWAY_RESOLVE_INTERVAL": "-1m"}, "Interval must not be negative 'GATEWAY_RESOLVE_INTERVAL=-1m'"},
+		{map[string]string{"GATEWAY_PROBE_INTERVAL": "-1s"}, "Interval must not be negative 'GATEWAY_PROBE_INTERVAL=-1s'"},
+		{map[string]string{"RECOVERED_AFTER": "-1s"}, "Interval must not be negative 'RECOVERED_AFTER=-1s'"},
+		{map[string]string{"DRIFT_CORRECTION_INTERVAL": "-1s"}, "Interval must not be negative 'DRIFT_CORRECTION_INTERVAL=-1s'"},
+		{map[string]string{"NETLINK_TIMEOUT": "-1s"}, "Interval must not be negative 'NETLINK_TIMEOUT=-1s'"},
+		{map[string]string{"CACHE_SYNC_TIMEOUT": "-1s"}, "Interval must not be negative 'CACHE_SYNC_TIMEOUT=-1s'"},
+		{map[string]string{"MAX_CONCURRENT_RECONCILES": "0"}, "Concurrent reconciles must be at least 1 'MAX_CONCURRENT_RECONCILES=0'"},
+		{map[string]string{"MAX_CONCURRENT_RECONCILES": "many"}, "Unable to parse 'MAX_CONCURRENT_RECONCILES=many' strconv.Atoi: parsing \"many\": invalid syntax"},
+		{map[string]string{"FAIL_ON_UNREACHABLE": "invalid"}, "Unable to parse 'FAIL_ON_UNREACHABLE=invalid' strconv.ParseBool: parsing \"invalid\": invalid syntax"},
+		{map[string]string{"ECMP_MERGE": "invalid"}, "Unable to parse 'ECMP_MERGE=invalid' strconv.ParseBool: parsing \"invalid\": invalid syntax"},
+		{map[string]string{"ECMP_REBALANCE": "drain"}, "ECMP rebalance requires ECMP_MERGE=true 'ECMP_REBALANCE=drain'"},
+		{map[string]string{"ECMP_MERGE": "true", "ECMP_REBALANCE": "spread"}, "ECMP rebalance must be drain or scale 'ECMP_REBALANCE=spread'"},
+		{map[string]string{"ECMP_DEGRADED_WEIGHT_PERCENT": "half"}, "Unable to parse 'ECMP_DEGRADED_WEIGHT_PERCENT=half' strconv.Atoi: parsing \"half\": invalid syntax"},
+		{map[string]string{"ECMP_DEGRADED_WEIGHT_PERCENT": "101"}, "Degraded weight percent must be between 0 and 100 'ECMP_DEGRADED_WEIGHT_PERCENT=101'"},
+		{map[string]string{"PROTECT_APISERVER_ROUTE": "invalid"}, "Unable to parse 'PROTECT_APISERVER_ROUTE=invalid' strconv.ParseBool: parsing \"invalid\": invalid syntax"},
+		{map[string]string{"OPERATOR_ID": "0"}, "Operator ID must be between 1 and 59 'OPERATOR_ID=0'"},
+		{map[string]string{"OPERATOR_ID": "invalid"}, "Unable to parse operator ID 'OPERATOR_ID=invalid' strconv.Atoi: parsing \"invalid\": invalid syntax"},
+		{map[string]string{"ADOPT_PROTOCOLS": "old"}, "Unable to parse 'ADOPT_PROTOCOLS=old' strconv.Atoi: parsing \"old\": invalid syntax"},
+		{map[string]string{"ADOPT_PROTOCOLS": "4"}, "Adopted protocols must be between 196 and 255, other than 196 'ADOPT_PROTOCOLS=4'"},
+		{map[string]string{"ADOPT_PROTOCOLS": "197,196"}, "Adopted protocols must be between 196 and 255, other than 196 'ADOPT_PROTOCOLS=197,196'"},
+		{map[string]string{"KILL_SWITCH_CONFIGMAP": "kill-switch"}, "Kill switch must be given as namespace/name 'KILL_SWITCH_CONFIGMAP=kill-switch'"},
+		{map[string]string{"KILL_SWITCH_CONFIGMAP": "/kill-switch"}, "Kill switch must be given as namespace/name 'KILL_SWITCH_CONFIGMAP=/kill-switch'"},
+		{map[string]string{"PROTECTED_SUBNETS_CONFIGMAP": "protected-subnets"}, "Protected subnets ConfigMap must be given as namespace/name 'PROTECTED_SUBNETS_CONFIGMAP=protected-subnets'"},
+	}
+	for i, td := range testData {
+		func() {
+			defer catchError(t)()
+			params, callbacks := getContextForHappyFlow()
+			params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), td.env)
+
+			validateError(t, mainImpl(*params), td.expected)
+
+			if callbacks.newRouterManagerCalled || callbacks.addStaticRouteControllerCalled || callbacks.setupSignalHandlerCalled {
+				t.Errorf("Components must not be started on misconfiguration at %d: %+v", i, *callbacks)
+			}
+		}()
+	}
 }
 
 func TestMainImplNewKubernetesConfigFails(t *testing.T) {
 	err := errors.New("fatal-error")
-	defer validateRecovery(t, err)()
 	params, _ := getContextForHappyFlow()
 	params.newKubernetesConfig = func(c *rest.Config) (discoverable, error) {
 		return mockDiscoverable{}, err
 	}
 
-	mainImpl(*params)
-
-	t.Error("Error didn't appear")
+	validateError(t, mainImpl(*params), err)
 }
 
 func TestMainImplServerResourcesForGroupVersionFails(t *testing.T) {
 	err := errors.New("fatal-error")
-	defer validateRecovery(t, err)()
 	params, _ := getContextForHappyFlow()
 	params.newKubernetesConfig = func(c *rest.Config) (discoverable, error) {
 		return mockDiscoverable{serverResourcesForGroupVersionErr: err}, nil
 	}
 
-	mainImpl(*params)
-
-	t.Error("Error didn't appear")
+	validateError(t, mainImpl(*params), err)
 }
 
 func TestMainImplCrdNorFound(t *testing.T) {
-	err := errors.New("fatal-error")
-	defer validateRecovery(t, err)()
 	params, _ := getContextForHappyFlow()
 	params.newKubernetesConfig = func(c *rest.Config) (discoverable, error) {
 		return mockDiscoverable{apiResourceList: &metav1.APIResourceList{}}, nil
 	}
 
-	mainImpl(*params)
-
-	t.Error("Error didn't appear")
+	validateError(t, mainImpl(*params), "CRD not found: staticroutes.static-route.ibm.com")
 }
 
 func TestMainImplAddStaticRouteControllerFails(t *testing.T) {
 	err := errors.New("fatal-error")
-	defer validateRecovery(t, err)()
 	params, _ := getContextForHappyFlow()
 	params.addStaticRouteController = func(manager.Manager, staticroute.ManagerOptions) error {
 		return err
 	}
 
-	mainImpl(*params)
-
-	t.Error("Error didn't appear")
+	validateError(t, mainImpl(*params), err)
 }
 
 func TestMainImplAddNodeControllerFails(t *testing.T) {
 	err := errors.New("fatal-error")
-	defer validateRecovery(t, err)()
 	params, _ := getContextForHappyFlow()
-	params.addNodeController = func(manager.Manager) error {
+	params.addNodeController = func(manager.Manager, node.ManagerOptions) error {
 		return err
 	}
 
-	mainImpl(*params)
+	validateError(t, mainImpl(*params), err)
+}
 
-	t.Error("Error didn't appear")
+func TestMainImplCacheSyncTimeout(t *testing.T) {
+	params, _ := getContextForHappyFlow()
+	params.newManager = func(*rest.Config, manager.Options) (manager.Manager, error) {
+		return mockManager{blocking: true, cache: mockCache{}}, nil
+	}
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"CACHE_SYNC_TIMEOUT": "10ms"})
+
+	err := mainImpl(*params)
+
+	if !errors.Is(err, errCacheSyncTimeout) || !strings.Contains(err.Error(), "RBAC") {
+		t.Errorf("Cache sync must time out with the likely causes: %v", err)
+	}
+}
+
+func TestMainImplCacheSynced(t *testing.T) {
+	params, _ := getContextForHappyFlow()
+	stop := make(chan struct{})
+	params.newManager = func(*rest.Config, manager.Options) (manager.Manager, error) {
+		return mockManager{blocking: true}, nil
+	}
+	params.setupSignalHandler = func() <-chan struct{} {
+		return stop
+	}
+	params.getEnv = getEnvMockWith(getEnvMock("", "hostname", "", "", ""), map[string]string{"CACHE_SYNC_TIMEOUT": "10ms"})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(stop)
+	}()
+
+	if err := mainImpl(*params); err != nil {
+		t.Errorf("Manager must run until it is stopped: %v", err)
+	}
+}
+
+func TestStartManagerWithoutTimeout(t *testing.T) {
+	stop := make(chan struct{})
+	close(stop)
+
+	if err := startManager(mockManager{blocking: true, cache: mockCache{}}, stop, 0); err != nil {
+		t.Errorf("Manager must not wait for the cache: %v", err)
+	}
 }
 
 func TestMainImplManagerStartFails(t *testing.T) {
 	err := errors.New("fatal-error")
-	defer validateRecovery(t, err)()
 	params, _ := getContextForHappyFlow()
 	params.newManager = func(*rest.Config, manager.Options) (manager.Manager, error) {
 		return mockManager{startErr: err}, nil
 	}
 
-	mainImpl(*params)
-
-	t.Error("Error didn't appear")
+	validateError(t, mainImpl(*params), err)
 }
 
 func getContextForHappyFlow() (*mainImplParams, *mockCallbacks) {
 	callbacks := mockCallbacks{}
 	return &mainImplParams{
-		logger: mockLogger{},
-		getEnv: getEnvMock("", "hostname", "", "", ""),
-		osEnv:  osEnvMock([]string{}),
+		logger:       mockLogger{},
+		configLogger: mockLogger{},
+		getEnv:       getEnvMock("", "hostname", "", "", ""),
+		osEnv:        osEnvMock([]string{}),
 		getConfig: func() (*rest.Config, error) {
 			callbacks.getConfigCalled = true
 			return nil, nil
@@ -334,23 +1209,33 @@ func getContextForHappyFlow() (*mainImplParams, *mockCallbacks) {
 			callbacks.newKubernetesConfigCalled = true
 			return mockDiscoverable{}, nil
 		},
-		newRouterManager: func() routemanager.RouteManager {
+		newRouterManager: func(routemanager.Options) routemanager.RouteManager {
 			callbacks.newRouterManagerCalled = true
 			return mockRouteManager{}
 		},
 		addStaticRouteController: func(mgr manager.Manager, options staticroute.ManagerOptions) error {
 			//nolint:errcheck
-			options.GetGw(net.IP{10, 0, 0, 1})
+			options.GatewayResolver.ResolveGateway(net.IP{10, 0, 0, 1})
 			callbacks.addStaticRouteControllerCalled = true
 			return nil
 		},
-		addNodeController: func(manager.Manager) error {
+		addNodeController: func(manager.Manager, node.ManagerOptions) error {
 			callbacks.addNodeControllerCalled = true
 			return nil
 		},
-		getGw: func(ip net.IP) (net.IP, error) {
+		gatewayResolver: types.GatewayResolverFunc(func(ip net.IP) (net.IP, error) {
 			callbacks.routerGetCalled = true
 			return net.IP{10, 0, 0, 1}, nil
+		}),
+		primaryRouteResolver: &routemanager.FakeGatewayResolver{Gateway: net.IP{10, 0, 0, 1}, Interface: "eth0"},
+		lookupIP: func(string) ([]net.IP, error) {
+			return []net.IP{net.IP{10, 0, 0, 1}}, nil
+		},
+		readFile: func(string) ([]byte, error) {
+			return nil, errors.New("no such file")
+		},
+		osHostname: func() (string, error) {
+			return "", errors.New("no hostname")
 		},
 		setupSignalHandler: func() (stopCh <-chan struct{}) {
 			callbacks.setupSignalHandlerCalled = true
@@ -368,12 +1253,10 @@ func catchError(t *testing.T) func() {
 	}
 }
 
-func validateRecovery(t *testing.T, expected interface{}) func() {
-	return func() {
-		if r := recover(); r != nil {
-			if fmt.Sprintf("%v", r) != fmt.Sprintf("%v", expected) {
-				t.Errorf("Error not match '%v' != '%v'", r, expected)
-			}
-		}
+func validateError(t *testing.T, err error, expected interface{}) {
+	if err == nil {
+		t.Error("Error didn't appear")
+	} else if err.Error() != fmt.Sprintf("%v", expected) {
+		t.Errorf("Error not match '%v' != '%v'", err, expected)
 	}
 }
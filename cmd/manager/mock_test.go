@@ -59,6 +59,15 @@ func getEnvMock(metricsNS, nodeHostName, targetTable, protectedSubnets, fallback
 	}
 }
 
+func getEnvMockWith(getEnv func(string) string, extra map[string]string) func(string) string {
+	return func(key string) string {
+		if value, found := extra[key]; found {
+			return value
+		}
+		return getEnv(key)
+	}
+}
+
 func osEnvMock(envvars []string) func() []string {
 	return func() []string {
 		return envvars
@@ -77,8 +86,37 @@ func newFakeClient() client.Client {
 			Name: "hostname",
 		},
 	}
-	s.AddKnownTypes(corev1.SchemeGroupVersion, node)
-	return fake.NewFakeClientWithScheme(s, []runtime.Object{node, route}...)
+	// The route to the apiserver is protected by default, so the cluster has the endpoints of it
+	endpoints := newKubernetesEndpoints("10.1.0.1")
+	s.AddKnownTypes(corev1.SchemeGroupVersion, node, endpoints)
+	return fake.NewFakeClientWithScheme(s, []runtime.Object{node, route, endpoints}...)
+}
+
+//newFakeClientWithEndpoints has the endpoints of the kubernetes service with the given addresses
+func newFakeClientWithEndpoints(ips ...string) client.Client {
+	s := runtime.NewScheme()
+	endpoints := newKubernetesEndpoints(ips...)
+	s.AddKnownTypes(corev1.SchemeGroupVersion, endpoints)
+	return fake.NewFakeClientWithScheme(s, endpoints)
+}
+
+//newFakeClientWithoutEndpoints has no endpoints of the kubernetes service
+func newFakeClientWithoutEndpoints() client.Client {
+	return fake.NewFakeClientWithScheme(runtime.NewScheme())
+}
+
+func newKubernetesEndpoints(ips ...string) *corev1.Endpoints {
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "kubernetes",
+			Namespace: "default",
+		},
+		Subsets: []corev1.EndpointSubset{{}},
+	}
+	for _, ip := range ips {
+		endpoints.Subsets[0].Addresses = append(endpoints.Subsets[0].Addresses, corev1.EndpointAddress{IP: ip})
+	}
+	return endpoints
 }
 
 type mockLogger struct{}
@@ -87,6 +125,18 @@ func (l mockLogger) Info(string, ...interface{}) {}
 
 func (l mockLogger) Error(error, string, ...interface{}) {}
 
+type recordingLogger struct {
+	messages      []string
+	keysAndValues [][]interface{}
+}
+
+func (l *recordingLogger) Info(message string, keysAndValues ...interface{}) {
+	l.messages = append(l.messages, message)
+	l.keysAndValues = append(l.keysAndValues, keysAndValues)
+}
+
+func (l *recordingLogger) Error(error, string, ...interface{}) {}
+
 type mockCallbacks struct {
 	getConfigCalled                bool
 	newManagerCalled               bool
@@ -101,7 +151,10 @@ type mockCallbacks struct {
 
 type mockManager struct {
 	client   client.Client
+	cache    cache.Cache
 	startErr error
+	// Start blocks until it is stopped like the real manager
+	blocking bool
 }
 
 func (m mockManager) Add(manager.Runnable) error {
@@ -112,7 +165,10 @@ func (m mockManager) SetFields(interface{}) error {
 	return nil
 }
 
-func (m mockManager) Start(<-chan struct{}) error {
+func (m mockManager) Start(stop <-chan struct{}) error {
+	if m.blocking {
+		<-stop
+	}
 	return m.startErr
 }
 
@@ -136,7 +192,24 @@ func (m mockManager) GetFieldIndexer() client.FieldIndexer {
 }
 
 func (m mockManager) GetCache() cache.Cache {
-	return nil
+	if m.cache != nil {
+		return m.cache
+	}
+	return mockCache{synced: true}
+}
+
+type mockCache struct {
+	cache.Cache
+	synced bool
+}
+
+//WaitForCacheSync never returns true if the cache is not synced, like an informer which can't list its resources
+func (m mockCache) WaitForCacheSync(stop <-chan struct{}) bool {
+	if m.synced {
+		return true
+	}
+	<-stop
+	return false
 }
 
 func (m mockManager) GetEventRecorderFor(name string) record.EventRecorder {
@@ -148,7 +221,7 @@ func (m mockManager) GetRESTMapper() meta.RESTMapper {
 }
 
 func (m mockManager) GetAPIReader() client.Reader {
-	return nil
+	return m.GetClient()
 }
 
 func (m mockManager) GetWebhookServer() *webhook.Server {
@@ -177,10 +250,50 @@ func (m mockRouteManager) RegisterRoute(string, routemanager.Route) error {
 	return nil
 }
 
+func (m mockRouteManager) RegisterRoutes(map[string]routemanager.Route) error {
+	return nil
+}
+
 func (m mockRouteManager) DeRegisterRoute(string) error {
 	return nil
 }
 
+func (m mockRouteManager) VerifyRoute(string) (routemanager.Repair, error) {
+	return routemanager.RepairNone, nil
+}
+
+func (m mockRouteManager) FlushTable(int) (int, error) {
+	return 0, nil
+}
+
+func (m mockRouteManager) EnsureAbsent(routemanager.Route) (int, error) {
+	return 0, nil
+}
+
+func (m mockRouteManager) ListRoutes() ([]routemanager.Route, error) {
+	return nil, nil
+}
+
+func (m mockRouteManager) ExportRoutes() ([]string, error) {
+	return nil, nil
+}
+
+func (m mockRouteManager) IsDegraded(string) bool {
+	return false
+}
+
+func (m mockRouteManager) Nexthops(string) []routemanager.Nexthop {
+	return nil
+}
+
+func (m mockRouteManager) ApplyRoutes(map[string]routemanager.Route) map[string]error {
+	return nil
+}
+
+func (m mockRouteManager) IsLinkUp(string) bool {
+	return true
+}
+
 func (m mockRouteManager) RegisterWatcher(routemanager.RouteWatcher) {
 
 }
@@ -6,6 +6,7 @@ require (
 	github.com/go-openapi/spec v0.19.4
 	github.com/googleapis/gnostic v0.3.1
 	github.com/operator-framework/operator-sdk v0.15.1
+	github.com/prometheus/client_golang v1.2.1
 	github.com/spf13/pflag v1.0.5
 	github.com/vishvananda/netlink v0.0.0-20171020171820-b2de5d10e38e
 	golang.org/x/sys v0.0.0-20191028164358-195ce5e7f934
@@ -0,0 +1,53 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NetworkGroupSpec defines the subnets of the NetworkGroup
+// +k8s:openapi-gen=true
+type NetworkGroupSpec struct {
+	// Subnets the IP subnets of the group in the form of: "x.x.x.x/x"
+	Subnets []string `json:"subnets"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// NetworkGroup is the Schema for the networkgroups API, a named list of subnets the StaticRoutes refer to by networkGroup
+// +k8s:openapi-gen=true
+// +kubebuilder:resource:path=networkgroups,scope=Cluster
+type NetworkGroup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec NetworkGroupSpec `json:"spec,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// NetworkGroupList contains a list of NetworkGroup
+type NetworkGroupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NetworkGroup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NetworkGroup{}, &NetworkGroupList{})
+}
@@ -30,16 +30,89 @@ type StaticRouteSpec struct {
 	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
 	// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
 
-	// Subnet defines the required IP subnet in the form of: "x.x.x.x/x"
+	// Subnet defines the IP subnet in the form of: "x.x.x.x/x" (required if subnets is not set)
 	// +kubebuilder:validation:Pattern=`^([0-9]{1,3}\.){3}[0-9]{1,3}(\/([0-9]|[1-2][0-9]|3[0-2]))?$`
-	Subnet string `json:"subnet"`
+	Subnet string `json:"subnet,omitempty"`
+
+	// Subnets list of further IP subnets routed through the same gateway (optional)
+	Subnets []string `json:"subnets,omitempty"`
+
+	// NetworkGroup name of the NetworkGroup whose subnets are routed like the subnets list, followed when the group changes (optional)
+	NetworkGroup string `json:"networkGroup,omitempty"`
+
+	// Tables further routing tables the route of subnet is duplicated into, besides the target table of the operator (optional)
+	Tables []int `json:"tables,omitempty"`
 
-	// Gateway the gateway the subnet is routed through (optional, discovered if not set)
-	// +kubebuilder:validation:Pattern=`^([0-9]{1,3}\.){3}[0-9]{1,3}$`
+	// Gateway the gateway the subnet is routed through (optional, discovered if not set, followed on the changes of the default route if auto)
+	// +kubebuilder:validation:Pattern=`^(auto|([0-9]{1,3}\.){3}[0-9]{1,3})$`
 	Gateway string `json:"gateway,omitempty"`
 
+	// Interface the interface the link-local subnets are reached through without gateway, loopback subnets use lo (required for link-local subnets)
+	Interface string `json:"interface,omitempty"`
+
+	// GatewayHostname DNS name of the gateway, resolved periodically (optional, mutually exclusive with gateway)
+	GatewayHostname string `json:"gatewayHostname,omitempty"`
+
+	// SourceAddress the preferred source address of the route, its family must match the subnet's (optional)
+	SourceAddress string `json:"sourceAddress,omitempty"`
+
+	// Tos the type of service (TOS/DSCP) the route applies to, IPv4 only (optional)
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=255
+	Tos int `json:"tos,omitempty"`
+
 	// Selector defines the target nodes by requirement (optional, default is apply to all)
 	Selectors []metav1.LabelSelectorRequirement `json:"selectors,omitempty"`
+
+	// ExpiresAt the point in time when the route is removed from the nodes (optional)
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// TTL the lifetime of the route counted from the creation of the resource (optional)
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// Group the routes of the same group are applied on a node as a unit, all or nothing (optional)
+	Group string `json:"group,omitempty"`
+
+	// EnsureAbsent the route must not exist, it is removed from the nodes whenever found (optional)
+	EnsureAbsent bool `json:"ensureAbsent,omitempty"`
+
+	// Disabled the route is removed from the nodes and not installed until the flag is cleared (optional)
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Description the reason why the route exists, it is logged and added to the events of the route (optional)
+	Description string `json:"description,omitempty"`
+
+	// RequireInterfaceUp name of the interface which has to be up to install the route, ie. the tunnel of a VPN (optional)
+	RequireInterfaceUp string `json:"requireInterfaceUp,omitempty"`
+
+	// Vrf name of the VRF device, the route is created in the routing table of the VRF instead of the target table (optional)
+	Vrf string `json:"vrf,omitempty"`
+
+	// HealthCheck the probe verifying the data plane of the route after it is installed and periodically, the route is degraded while it fails (optional)
+	HealthCheck *StaticRouteHealthCheck `json:"healthCheck,omitempty"`
+
+	// Weight the weight of the gateway as a nexthop, when the operator merges the routes of the same destination into a multipath route (optional, default 1)
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=256
+	Weight int `json:"weight,omitempty"`
+
+	// FailoverGroup name of the failover group, the routes of the same destination in the group get increasing metrics in the order of their creation, so the oldest one is preferred (optional)
+	FailoverGroup string `json:"failoverGroup,omitempty"`
+
+	// InstallPriority the routes of higher priority are installed first when the operator starts on a node, ie. the route to the apiserver (optional, default 0)
+	InstallPriority int `json:"installPriority,omitempty"`
+}
+
+// StaticRouteHealthCheck defines the probe of the route on the nodes
+type StaticRouteHealthCheck struct {
+	// TCP the address in the form of host:port dialed through the route, an ICMP echo is sent to the gateway if not set (optional)
+	TCP string `json:"tcp,omitempty"`
+
+	// Interval the time between two probes (optional, default 30s)
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Timeout the upper limit of a probe (optional, default 1s)
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
 }
 
 // StaticRouteNodeStatus defines the observed state of one IKS node, related to the StaticRoute
@@ -47,8 +120,183 @@ type StaticRouteNodeStatus struct {
 	Hostname string          `json:"hostname"`
 	State    StaticRouteSpec `json:"state"`
 	Error    string          `json:"error"`
+	Reason   string          `json:"reason,omitempty"`
+
+	// ReasonCode the outcome of the last reconciliation on the node, one of the ReasonCode constants. Unlike reason, the set of the codes is a stable API for automation.
+	// +kubebuilder:validation:Enum=Applied;ProtectedSubnet;InvalidSpec;NetlinkError;GatewayUnreachable;Pending;Disabled;Paused;Conflicting;ReconcileError
+	ReasonCode string `json:"reasonCode,omitempty"`
+
+	// ResolvedGateway the IP address which gatewayHostname was resolved to
+	ResolvedGateway string `json:"resolvedGateway,omitempty"`
+	// LastResolution the time of the last resolution of gatewayHostname
+	LastResolution *metav1.Time `json:"lastResolution,omitempty"`
+
+	// Subnets the outcome of each subnet given in the subnets list
+	Subnets []StaticRouteSubnetStatus `json:"subnets,omitempty"`
+
+	// Tables the outcome of each table given in the tables list
+	Tables []StaticRouteTableStatus `json:"tables,omitempty"`
+
+	// Flush the outcome of the last table flush requested by annotation
+	Flush *StaticRouteFlushStatus `json:"flush,omitempty"`
+
+	// Dump the routes of the node dumped on request by annotation
+	Dump *StaticRouteDumpStatus `json:"dump,omitempty"`
+
+	// RemovedRoutes the number of routes removed from the node, because they had to be absent
+	RemovedRoutes int `json:"removedRoutes,omitempty"`
+
+	// Rule the policy rule created together with the route, given by the fwmark annotations
+	Rule string `json:"rule,omitempty"`
+
+	// ProtectedSubnetException the exception which allowed the subnet, even though it overlaps with a protected subnet
+	ProtectedSubnetException string `json:"protectedSubnetException,omitempty"`
+
+	// Owner the resource which generated the route in the form of kind/name, taken from the owner references
+	Owner string `json:"owner,omitempty"`
+
+	// GatewayChanges the number of times the automatic gateway was changed on the node
+	GatewayChanges int `json:"gatewayChanges,omitempty"`
+
+	// InstalledAt the time the route got installed on the node, cleared while the route is not installed
+	InstalledAt *metav1.Time `json:"installedAt,omitempty"`
+
+	// Nexthops the effective weights of the nexthops of the multipath route the route is merged into
+	Nexthops []StaticRouteNexthopStatus `json:"nexthops,omitempty"`
+
+	// Metric the metric assigned to the route by its position in the failover group
+	Metric int `json:"metric,omitempty"`
+	// Preferred the name of the StaticRoute of the failover group the node currently prefers, the one with the lowest metric
+	Preferred string `json:"preferred,omitempty"`
+
+	// DefaultGateway the route is created through the default gateway of the operator, as the StaticRoute sets no gateway
+	DefaultGateway bool `json:"defaultGateway,omitempty"`
+}
+
+// StaticRouteNexthopStatus defines one nexthop of a merged multipath route on a node
+type StaticRouteNexthopStatus struct {
+	Gateway string `json:"gateway"`
+	Weight  int    `json:"weight"`
+}
+
+// StaticRouteFlushStatus defines the outcome of a table flush on a node
+type StaticRouteFlushStatus struct {
+	Token   string `json:"token"`
+	Removed int    `json:"removed"`
+	Error   string `json:"error,omitempty"`
 }
 
+// StaticRouteDumpStatus defines one page of the routes the operator created on a node
+type StaticRouteDumpStatus struct {
+	Token  string   `json:"token"`
+	Format string   `json:"format,omitempty"`
+	Page   int      `json:"page"`
+	Pages  int      `json:"pages"`
+	Total  int      `json:"total"`
+	Routes []string `json:"routes,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// StaticRouteSubnetStatus defines the observed state of one subnet of the subnets list on a node
+type StaticRouteSubnetStatus struct {
+	Subnet string `json:"subnet"`
+	Error  string `json:"error,omitempty"`
+
+	// ProtectedSubnetException the exception which allowed the subnet, even though it overlaps with a protected subnet
+	ProtectedSubnetException string `json:"protectedSubnetException,omitempty"`
+}
+
+// StaticRouteTableStatus defines the observed state of the duplicate of the route in one table of the tables list on a node
+type StaticRouteTableStatus struct {
+	Table int    `json:"table"`
+	Error string `json:"error,omitempty"`
+}
+
+//DumpFormatIPRoute2 dumps the routes as ip route add commands, which create them again with every attribute the kernel reports
+const DumpFormatIPRoute2 = "iproute2"
+
+//GatewayAuto selects the gateway like an empty gateway does, but the routes follow it when the default route of the node changes
+const GatewayAuto = "auto"
+
+const (
+	//FlushTableAnnotation requests to flush our routes from the target table and reinstall them, once per distinct value
+	FlushTableAnnotation = "static-route.ibm.com/flush-table"
+	//PauseAnnotation set to true freezes the route on the nodes, it is neither added, removed nor corrected until the annotation is removed
+	PauseAnnotation = "static-route.ibm.com/pause"
+	//DumpRoutesAnnotation requests the nodes to dump the routes of the operator into the status, once per distinct value
+	DumpRoutesAnnotation = "static-route.ibm.com/dump-routes"
+	//DumpRoutesPageAnnotation selects the page of the dump, counted from 0
+	DumpRoutesPageAnnotation = "static-route.ibm.com/dump-routes-page"
+	//DumpRoutesFormatAnnotation selects the format of the dumped routes, DumpFormatIPRoute2 or the iproute2 listing format if not set
+	DumpRoutesFormatAnnotation = "static-route.ibm.com/dump-routes-format"
+	//ManagementRoutesAnnotation lists the management routes of a node in the form of "subnet via gateway", separated by comma
+	ManagementRoutesAnnotation = "static-route.ibm.com/management-routes"
+	//DefaultGatewayAnnotation the gateway of the primary route of the node, published by the operator for audit
+	DefaultGatewayAnnotation = "static-route.ibm.com/default-gateway"
+	//PrimaryInterfaceAnnotation the outgoing interface of the primary route of the node, published by the operator for audit
+	PrimaryInterfaceAnnotation = "static-route.ibm.com/primary-interface"
+	//FwMarkAnnotation the firewall mark of the packets the route applies to, an ip rule is created for it together with the route
+	FwMarkAnnotation = "static-route.ibm.com/fwmark"
+	//FwMarkTableAnnotation the table of the route and the rule given by the fwmark annotation, the target table if not set
+	FwMarkTableAnnotation = "static-route.ibm.com/fwmark-table"
+	//FwMarkSuppressPrefixLengthAnnotation makes the rule of the fwmark reject the routes of its table with the given prefix length or shorter, like suppress_prefixlength of iproute2
+	FwMarkSuppressPrefixLengthAnnotation = "static-route.ibm.com/fwmark-suppress-prefixlength"
+	//FwMarkGotoAnnotation makes the rule of the fwmark jump to the rule of the given priority instead of looking up a table, like goto of iproute2
+	FwMarkGotoAnnotation = "static-route.ibm.com/fwmark-goto"
+	//OperatorIDLabel selects the operator instance which manages the route, the instances without ID manage the routes without the label
+	OperatorIDLabel = "static-route.ibm.com/operator-id"
+
+	//ReasonExpired the route was removed from the node, because its expiration time has passed
+	ReasonExpired = "Expired"
+	//ReasonDrained the route was withdrawn from the node, because the node is cordoned and the drain policy is remove
+	ReasonDrained = "Drained"
+	//ReasonConflicting the route is not installed on the node, because an older resource routes the same destination
+	ReasonConflicting = "Conflicting"
+	//ReasonDisabled the route was removed from the node, because it is disabled
+	ReasonDisabled = "Disabled"
+	//ReasonDegraded the route is installed on the node, but its gateway is unreachable according to the neighbor table
+	ReasonDegraded = "Degraded"
+	//ReasonWaitingForInterface the route is not installed on the node, because the required interface is not up
+	ReasonWaitingForInterface = "WaitingForInterface"
+	//ReasonNetlinkTimeout the route could not be applied, because the kernel did not answer within the netlink timeout
+	ReasonNetlinkTimeout = "NetlinkTimeout"
+	//ReasonKillSwitch the route was withdrawn from the node, because the kill switch of the operator is engaged
+	ReasonKillSwitch = "KillSwitch"
+	//ReasonVrfNotFound the route is not installed on the node, because the VRF device of the route is missing
+	ReasonVrfNotFound = "VrfNotFound"
+	//ReasonProtectedSubnetRejected the route is not installed on the node, because its subnet overlaps with some protected subnet
+	ReasonProtectedSubnetRejected = "ProtectedSubnetRejected"
+	//ReasonPending the route is not installed on the node yet, because the network of its gateway is unreachable, it is retried with backoff
+	ReasonPending = "Pending"
+	//ReasonInvalidRoute the route is not installed on the node, because the kernel rejected it, it is not retried until the resource is changed
+	ReasonInvalidRoute = "InvalidRoute"
+	//ReasonInterfaceMissing the route is not installed on the node, because the device it goes through does not exist
+	ReasonInterfaceMissing = "InterfaceMissing"
+	//ReasonPaused the reconciliation of the route is paused by annotation, the route is left on the node as it was
+	ReasonPaused = "Paused"
+
+	//ReasonCodeApplied the route is in place on the node as specified, an absent route is removed
+	ReasonCodeApplied = "Applied"
+	//ReasonCodeProtectedSubnet the route is not installed, because its subnet overlaps with some protected subnet
+	ReasonCodeProtectedSubnet = "ProtectedSubnet"
+	//ReasonCodeInvalidSpec the route is not installed, because the resource is invalid or the kernel rejected the route, it fails until the resource is changed
+	ReasonCodeInvalidSpec = "InvalidSpec"
+	//ReasonCodeNetlinkError the route could not be changed in the kernel, it is retried
+	ReasonCodeNetlinkError = "NetlinkError"
+	//ReasonCodeGatewayUnreachable the gateway of the route can not be determined or reached, the installed route is degraded
+	ReasonCodeGatewayUnreachable = "GatewayUnreachable"
+	//ReasonCodePending the route is not installed yet, because the node or the cluster is not ready for it, it is retried
+	ReasonCodePending = "Pending"
+	//ReasonCodeDisabled the route was withdrawn from the node, because the resource is disabled or expired, the node is drained or the kill switch is on. The reason tells which.
+	ReasonCodeDisabled = "Disabled"
+	//ReasonCodePaused the reconciliation of the route is paused by annotation
+	ReasonCodePaused = "Paused"
+	//ReasonCodeConflicting the route is not installed, because an older resource routes the same destination
+	ReasonCodeConflicting = "Conflicting"
+	//ReasonCodeReconcileError the resources could not be read or written through the API server, or the reconciliation failed unexpectedly, it is retried
+	ReasonCodeReconcileError = "ReconcileError"
+)
+
 // StaticRouteStatus defines the observed state of StaticRoute
 // +k8s:openapi-gen=true
 type StaticRouteStatus struct {
@@ -9,6 +9,87 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkGroup) DeepCopyInto(out *NetworkGroup) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkGroup.
+func (in *NetworkGroup) DeepCopy() *NetworkGroup {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkGroup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NetworkGroup) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkGroupList) DeepCopyInto(out *NetworkGroupList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NetworkGroup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkGroupList.
+func (in *NetworkGroupList) DeepCopy() *NetworkGroupList {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkGroupList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NetworkGroupList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkGroupSpec) DeepCopyInto(out *NetworkGroupSpec) {
+	*out = *in
+	if in.Subnets != nil {
+		in, out := &in.Subnets, &out.Subnets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkGroupSpec.
+func (in *NetworkGroupSpec) DeepCopy() *NetworkGroupSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkGroupSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StaticRoute) DeepCopyInto(out *StaticRoute) {
 	*out = *in
@@ -37,6 +118,69 @@ func (in *StaticRoute) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticRouteDumpStatus) DeepCopyInto(out *StaticRouteDumpStatus) {
+	*out = *in
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticRouteDumpStatus.
+func (in *StaticRouteDumpStatus) DeepCopy() *StaticRouteDumpStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticRouteDumpStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticRouteFlushStatus) DeepCopyInto(out *StaticRouteFlushStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticRouteFlushStatus.
+func (in *StaticRouteFlushStatus) DeepCopy() *StaticRouteFlushStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticRouteFlushStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticRouteHealthCheck) DeepCopyInto(out *StaticRouteHealthCheck) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticRouteHealthCheck.
+func (in *StaticRouteHealthCheck) DeepCopy() *StaticRouteHealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticRouteHealthCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StaticRouteList) DeepCopyInto(out *StaticRouteList) {
 	*out = *in
@@ -70,10 +214,59 @@ func (in *StaticRouteList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticRouteNexthopStatus) DeepCopyInto(out *StaticRouteNexthopStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticRouteNexthopStatus.
+func (in *StaticRouteNexthopStatus) DeepCopy() *StaticRouteNexthopStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticRouteNexthopStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StaticRouteNodeStatus) DeepCopyInto(out *StaticRouteNodeStatus) {
 	*out = *in
 	in.State.DeepCopyInto(&out.State)
+	if in.LastResolution != nil {
+		in, out := &in.LastResolution, &out.LastResolution
+		*out = (*in).DeepCopy()
+	}
+	if in.Subnets != nil {
+		in, out := &in.Subnets, &out.Subnets
+		*out = make([]StaticRouteSubnetStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Tables != nil {
+		in, out := &in.Tables, &out.Tables
+		*out = make([]StaticRouteTableStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Flush != nil {
+		in, out := &in.Flush, &out.Flush
+		*out = new(StaticRouteFlushStatus)
+		**out = **in
+	}
+	if in.Dump != nil {
+		in, out := &in.Dump, &out.Dump
+		*out = new(StaticRouteDumpStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.InstalledAt != nil {
+		in, out := &in.InstalledAt, &out.InstalledAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Nexthops != nil {
+		in, out := &in.Nexthops, &out.Nexthops
+		*out = make([]StaticRouteNexthopStatus, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -87,9 +280,35 @@ func (in *StaticRouteNodeStatus) DeepCopy() *StaticRouteNodeStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticRouteSubnetStatus) DeepCopyInto(out *StaticRouteSubnetStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticRouteSubnetStatus.
+func (in *StaticRouteSubnetStatus) DeepCopy() *StaticRouteSubnetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticRouteSubnetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StaticRouteSpec) DeepCopyInto(out *StaticRouteSpec) {
 	*out = *in
+	if in.Subnets != nil {
+		in, out := &in.Subnets, &out.Subnets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Tables != nil {
+		in, out := &in.Tables, &out.Tables
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
 	if in.Selectors != nil {
 		in, out := &in.Selectors, &out.Selectors
 		*out = make([]metav1.LabelSelectorRequirement, len(*in))
@@ -97,6 +316,20 @@ func (in *StaticRouteSpec) DeepCopyInto(out *StaticRouteSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ExpiresAt != nil {
+		in, out := &in.ExpiresAt, &out.ExpiresAt
+		*out = (*in).DeepCopy()
+	}
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.HealthCheck != nil {
+		in, out := &in.HealthCheck, &out.HealthCheck
+		*out = new(StaticRouteHealthCheck)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -132,3 +365,19 @@ func (in *StaticRouteStatus) DeepCopy() *StaticRouteStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticRouteTableStatus) DeepCopyInto(out *StaticRouteTableStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticRouteTableStatus.
+func (in *StaticRouteTableStatus) DeepCopy() *StaticRouteTableStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticRouteTableStatus)
+	in.DeepCopyInto(out)
+	return out
+}
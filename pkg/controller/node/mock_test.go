@@ -20,6 +20,7 @@ import (
 	"context"
 
 	iksv1 "github.com/IBM/staticroute-operator/pkg/apis/iks/v1"
+	"github.com/IBM/staticroute-operator/pkg/routemanager"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -32,6 +33,7 @@ type reconcileImplClientMock struct {
 	client reconcileImplClient
 	get    func(context.Context, client.ObjectKey, runtime.Object) error
 	list   func(context.Context, runtime.Object, ...client.ListOption) error
+	update func(context.Context, runtime.Object, ...client.UpdateOption) error
 	status func() client.StatusWriter
 }
 
@@ -49,6 +51,13 @@ func (m reconcileImplClientMock) List(ctx context.Context, obj runtime.Object, o
 	return m.client.List(ctx, obj, options...)
 }
 
+func (m reconcileImplClientMock) Update(ctx context.Context, obj runtime.Object, options ...client.UpdateOption) error {
+	if m.update != nil {
+		return m.update(ctx, obj, options...)
+	}
+	return m.client.Update(ctx, obj, options...)
+}
+
 func (m reconcileImplClientMock) Status() client.StatusWriter {
 	if m.status != nil {
 		return m.status()
@@ -69,6 +78,79 @@ func (m statusWriterMock) Patch(context.Context, runtime.Object, client.Patch, .
 	return m.patchErr
 }
 
+type routeManagerMock struct {
+	registeredCallback   func(string, routemanager.Route) error
+	deRegisteredCallback func(string) error
+}
+
+func (m routeManagerMock) IsRegistered(string) bool {
+	return false
+}
+
+func (m routeManagerMock) RegisterRoute(n string, r routemanager.Route) error {
+	if m.registeredCallback != nil {
+		return m.registeredCallback(n, r)
+	}
+	return nil
+}
+
+func (m routeManagerMock) RegisterRoutes(map[string]routemanager.Route) error {
+	return nil
+}
+
+func (m routeManagerMock) DeRegisterRoute(n string) error {
+	if m.deRegisteredCallback != nil {
+		return m.deRegisteredCallback(n)
+	}
+	return nil
+}
+
+func (m routeManagerMock) VerifyRoute(string) (routemanager.Repair, error) {
+	return routemanager.RepairNone, nil
+}
+
+func (m routeManagerMock) FlushTable(int) (int, error) {
+	return 0, nil
+}
+
+func (m routeManagerMock) EnsureAbsent(routemanager.Route) (int, error) {
+	return 0, nil
+}
+
+func (m routeManagerMock) ListRoutes() ([]routemanager.Route, error) {
+	return nil, nil
+}
+
+func (m routeManagerMock) ExportRoutes() ([]string, error) {
+	return nil, nil
+}
+
+func (m routeManagerMock) IsDegraded(string) bool {
+	return false
+}
+
+func (m routeManagerMock) Nexthops(string) []routemanager.Nexthop {
+	return nil
+}
+
+func (m routeManagerMock) ApplyRoutes(map[string]routemanager.Route) map[string]error {
+	return nil
+}
+
+func (m routeManagerMock) IsLinkUp(string) bool {
+	return true
+}
+
+func (m routeManagerMock) RegisterWatcher(routemanager.RouteWatcher) {
+}
+
+func (m routeManagerMock) DeRegisterWatcher(routemanager.RouteWatcher) {
+}
+
+func (m routeManagerMock) Run(chan struct{}) error {
+	return nil
+}
+
 func newReconcileImplParams(client reconcileImplClient) *reconcileImplParams {
 	return &reconcileImplParams{
 		request: reconcile.Request{
@@ -83,6 +165,6 @@ func newReconcileImplParams(client reconcileImplClient) *reconcileImplParams {
 
 func newFakeClient(routes *iksv1.StaticRouteList) client.Client {
 	s := runtime.NewScheme()
-	s.AddKnownTypes(iksv1.SchemeGroupVersion, routes)
+	s.AddKnownTypes(iksv1.SchemeGroupVersion, &iksv1.StaticRoute{}, routes)
 	return fake.NewFakeClientWithScheme(s, []runtime.Object{routes}...)
 }
@@ -18,10 +18,18 @@ package node
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
 
 	iksv1 "github.com/IBM/staticroute-operator/pkg/apis/iks/v1"
+	"github.com/IBM/staticroute-operator/pkg/metrics"
+	"github.com/IBM/staticroute-operator/pkg/routemanager"
+	"github.com/IBM/staticroute-operator/pkg/types"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -36,25 +44,94 @@ import (
 
 var log = logf.Log.WithName("controller_node")
 
+//managementRoutePrefix prefixes the names of the management routes in the RouteManager, it is not allowed in resource names
+const managementRoutePrefix = "node:"
+
+// ManagerOptions contains the node related properties of the node controller
+type ManagerOptions struct {
+	RouteManager     routemanager.RouteManager
+	Hostname         string
+	Table            int
+	ProtectedSubnets []*net.IPNet
+	// ManagementRoutes enables the management routes of the own node given by annotation
+	ManagementRoutes bool
+	// PublishPrimaryRoute enables the annotations of the own node telling its default gateway and primary interface
+	PublishPrimaryRoute      bool
+	PrimaryRouteResolver     types.PrimaryRouteResolver
+	FallbackIPForGwSelection net.IP
+	// MaxConcurrentReconciles the number of nodes reconciled in parallel, 1 if not set
+	MaxConcurrentReconciles int
+}
+
 // Add creates a new Node Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
-func Add(mgr manager.Manager) error {
-	return add(mgr, newReconciler(mgr))
+func Add(mgr manager.Manager, options ManagerOptions) error {
+	return add(mgr, newReconciler(mgr, options))
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileNode{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+func newReconciler(mgr manager.Manager, options ManagerOptions) reconcile.Reconciler {
+	return &ReconcileNode{client: mgr.GetClient(), scheme: mgr.GetScheme(), options: options, managementRoutes: map[string]routemanager.Route{}}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
 func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	// Create a new controller
-	c, err := controller.New("node-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New("node-controller", mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: r.(*ReconcileNode).options.MaxConcurrentReconciles})
 	if err != nil {
 		return err
 	}
 
+	options := r.(*ReconcileNode).options
+	if options.ManagementRoutes {
+		// Watch the management routes of the own node
+		err = c.Watch(&source.Kind{Type: &corev1.Node{}}, &handler.EnqueueRequestForObject{},
+			&predicate.Funcs{
+				CreateFunc: func(e event.CreateEvent) bool {
+					return e.Meta.GetName() == options.Hostname
+				},
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					return e.MetaNew.GetName() == options.Hostname &&
+						e.MetaOld.GetAnnotations()[iksv1.ManagementRoutesAnnotation] != e.MetaNew.GetAnnotations()[iksv1.ManagementRoutesAnnotation]
+				},
+				DeleteFunc: func(e event.DeleteEvent) bool {
+					return false
+				},
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.PublishPrimaryRoute {
+		// Publish the primary route of the own node on startup
+		err = c.Watch(&source.Kind{Type: &corev1.Node{}}, &handler.EnqueueRequestForObject{},
+			&predicate.Funcs{
+				CreateFunc: func(e event.CreateEvent) bool {
+					return e.Meta.GetName() == options.Hostname
+				},
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					return false
+				},
+				DeleteFunc: func(e event.DeleteEvent) bool {
+					return false
+				},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		// Refresh it when the RouteManager sees the default route changing
+		if options.RouteManager != nil {
+			events := make(chan event.GenericEvent)
+			if err = c.Watch(&source.Channel{Source: events}, &handler.EnqueueRequestForObject{}); err != nil {
+				return err
+			}
+			options.RouteManager.RegisterWatcher(defaultRouteWatcher{events: events, hostname: options.Hostname})
+		}
+	}
+
 	// Watch for changes to primary resource Node
 	return c.Watch(&source.Kind{Type: &corev1.Node{}}, &handler.EnqueueRequestForObject{},
 		&predicate.Funcs{
@@ -78,8 +155,10 @@ var _ reconcile.Reconciler = &ReconcileNode{}
 type ReconcileNode struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
-	client client.Client
-	scheme *runtime.Scheme
+	client           client.Client
+	scheme           *runtime.Scheme
+	options          ManagerOptions
+	managementRoutes map[string]routemanager.Route
 }
 
 // Reconcile reads that state of the cluster for a Node object and makes changes based on the state read
@@ -88,9 +167,12 @@ type ReconcileNode struct {
 // The Controller will requeue the Request to be processed again if the returned error is non-nil or
 // Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
 func (r *ReconcileNode) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	defer metrics.ObserveReconcile("node", time.Now())
 	params := reconcileImplParams{
-		request: request,
-		client:  r.client,
+		request:          request,
+		client:           r.client,
+		options:          r.options,
+		managementRoutes: r.managementRoutes,
 	}
 	result, err := reconcileImpl(params)
 	return *result, err
@@ -99,21 +181,29 @@ func (r *ReconcileNode) Reconcile(request reconcile.Request) (reconcile.Result,
 type reconcileImplClient interface {
 	Get(context.Context, client.ObjectKey, runtime.Object) error
 	List(context.Context, runtime.Object, ...client.ListOption) error
+	Update(context.Context, runtime.Object, ...client.UpdateOption) error
 	Status() client.StatusWriter
 }
 
 type reconcileImplParams struct {
 	request reconcile.Request
 	client  reconcileImplClient
+	options ManagerOptions
+	// managementRoutes the management routes registered by the controller, by name
+	managementRoutes map[string]routemanager.Route
 }
 
 var (
 	nodeStillExists = &reconcile.Result{}
 	finished        = &reconcile.Result{}
 
-	nodeGetError         = &reconcile.Result{}
-	staticRouteListError = &reconcile.Result{}
-	deleteRouteError     = &reconcile.Result{}
+	nodeGetError          = &reconcile.Result{}
+	staticRouteListError  = &reconcile.Result{}
+	deleteRouteError      = &reconcile.Result{}
+	managementRoutesError = &reconcile.Result{}
+	managementSyncError   = &reconcile.Result{}
+	primaryRouteError     = &reconcile.Result{}
+	primaryRouteSyncError = &reconcile.Result{}
 )
 
 func reconcileImpl(params reconcileImplParams) (*reconcile.Result, error) {
@@ -122,6 +212,17 @@ func reconcileImpl(params reconcileImplParams) (*reconcile.Result, error) {
 	// Fetch the Node instance
 	node := &corev1.Node{}
 	if err := params.client.Get(context.Background(), params.request.NamespacedName, node); err == nil {
+		if params.request.Name != params.options.Hostname {
+			return nodeStillExists, nil
+		}
+		if params.options.PublishPrimaryRoute {
+			if res, err := publishPrimaryRoute(params, node, reqLogger); res != nil {
+				return res, err
+			}
+		}
+		if params.options.ManagementRoutes {
+			return syncManagementRoutes(params, node, reqLogger)
+		}
 		return nodeStillExists, nil
 	} else if !errors.IsNotFound(err) {
 		// Error reading the object - requeue the request.
@@ -139,6 +240,9 @@ func reconcileImpl(params reconcileImplParams) (*reconcile.Result, error) {
 		updateCallback: func(route *iksv1.StaticRoute) error {
 			return params.client.Status().Update(context.Background(), route)
 		},
+		finalizeCallback: func(route *iksv1.StaticRoute) error {
+			return params.client.Update(context.Background(), route)
+		},
 		infoLogger: reqLogger.Info,
 	}
 	if err := nf.delete(routes); err != nil {
@@ -149,13 +253,139 @@ func reconcileImpl(params reconcileImplParams) (*reconcile.Result, error) {
 	return finished, nil
 }
 
+/* syncManagementRoutes registers the management routes given in the annotation of the own node and drops the ones removed from it.
+   The routes go through the RouteManager, so they are tagged with the protocol of the operator and created in the target table. */
+func syncManagementRoutes(params reconcileImplParams, node *corev1.Node, logger types.Logger) (*reconcile.Result, error) {
+	desired, err := parseManagementRoutes(node.GetAnnotations()[iksv1.ManagementRoutesAnnotation], params.options.Table)
+	if err != nil {
+		logger.Error(err, "Invalid management routes annotation")
+		return managementRoutesError, nil
+	}
+	for _, route := range desired {
+		if protected := findProtected(route.Dst, params.options.ProtectedSubnets); protected != nil {
+			logger.Error(fmt.Errorf("Management route %s overlaps with protected subnet %s", route.Dst.String(), protected.String()), "")
+			return managementRoutesError, nil
+		}
+	}
+	for name, route := range params.managementRoutes {
+		if desiredRoute, found := desired[name]; found && desiredRoute.String() == route.String() {
+			continue
+		}
+		logger.Info("Deregistering management route", "Route", route.String())
+		if err := params.options.RouteManager.DeRegisterRoute(name); err != nil && err != routemanager.ErrNotFound {
+			logger.Error(err, "Unable to deregister management route")
+			return managementSyncError, err
+		}
+		delete(params.managementRoutes, name)
+	}
+	for name, route := range desired {
+		if _, found := params.managementRoutes[name]; found {
+			continue
+		}
+		logger.Info("Registering management route", "Route", route.String())
+		if err := params.options.RouteManager.RegisterRoute(name, route); err != nil {
+			logger.Error(err, "Unable to register management route")
+			return managementSyncError, err
+		}
+		params.managementRoutes[name] = route
+	}
+	return finished, nil
+}
+
+/* publishPrimaryRoute annotates the own node with the gateway and the interface of the route the kernel selects towards
+   the fallback IP, the same one the empty gateway of the StaticRoutes resolves to. The node is updated only if they changed. */
+func publishPrimaryRoute(params reconcileImplParams, node *corev1.Node, logger types.Logger) (*reconcile.Result, error) {
+	gateway, iface, err := params.options.PrimaryRouteResolver.ResolvePrimaryRoute(params.options.FallbackIPForGwSelection)
+	if err != nil {
+		logger.Error(err, "Unable to resolve the primary route")
+		return primaryRouteError, err
+	}
+	gatewayValue := ""
+	if gateway != nil {
+		gatewayValue = gateway.String()
+	}
+	annotations := node.GetAnnotations()
+	if annotations[iksv1.DefaultGatewayAnnotation] == gatewayValue && annotations[iksv1.PrimaryInterfaceAnnotation] == iface {
+		return nil, nil
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[iksv1.DefaultGatewayAnnotation] = gatewayValue
+	annotations[iksv1.PrimaryInterfaceAnnotation] = iface
+	node.SetAnnotations(annotations)
+	logger.Info("Publishing the primary route", "Gateway", gatewayValue, "Interface", iface)
+	if err := params.client.Update(context.Background(), node); err != nil {
+		logger.Error(err, "Unable to update the node")
+		return primaryRouteSyncError, err
+	}
+	return nil, nil
+}
+
+//parseManagementRoutes parses the "subnet via gateway" items of the annotation into routes by name
+func parseManagementRoutes(annotation string, table int) (map[string]routemanager.Route, error) {
+	routes := map[string]routemanager.Route{}
+	for _, item := range strings.Split(annotation, ",") {
+		if len(strings.TrimSpace(item)) == 0 {
+			continue
+		}
+		fields := strings.Fields(item)
+		if len(fields) != 3 || fields[1] != "via" {
+			return nil, fmt.Errorf("Management route must be in the form of 'subnet via gateway': %s", item)
+		}
+		_, dst, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		gw := net.ParseIP(fields[2])
+		if gw == nil || (gw.To4() == nil) != (dst.IP.To4() == nil) {
+			return nil, fmt.Errorf("Invalid gateway of management route: %s", item)
+		}
+		if gw4 := gw.To4(); gw4 != nil {
+			gw = gw4
+		}
+		routes[managementRoutePrefix+dst.String()] = routemanager.Route{Dst: *dst, Gw: gw, Table: table}
+	}
+	return routes, nil
+}
+
+//findProtected returns the first protected subnet which overlaps with the given one
+func findProtected(subnet net.IPNet, protecteds []*net.IPNet) *net.IPNet {
+	for _, protected := range protecteds {
+		if protected.Contains(subnet.IP) || subnet.Contains(protected.IP) {
+			return protected
+		}
+	}
+	return nil
+}
+
+//defaultRouteWatcher requests the reconciliation of the own node when the default route changes, so its annotations follow
+type defaultRouteWatcher struct {
+	events   chan<- event.GenericEvent
+	hostname string
+}
+
+//RouteDeleted is not needed, only the default route changes are watched
+func (w defaultRouteWatcher) RouteDeleted(routemanager.Route) {
+}
+
+func (w defaultRouteWatcher) DefaultRouteChanged() {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: w.hostname}}
+	// The event loop of the RouteManager must not wait for the controller
+	go func() {
+		w.events <- event.GenericEvent{Meta: node, Object: node}
+	}()
+}
+
 type nodeFinder struct {
-	nodeName       string
-	updateCallback func(*iksv1.StaticRoute) error
-	infoLogger     func(string, ...interface{})
+	nodeName         string
+	updateCallback   func(*iksv1.StaticRoute) error
+	finalizeCallback func(*iksv1.StaticRoute) error
+	infoLogger       func(string, ...interface{})
 }
 
-func (nf *nodeFinder) delete(routes *iksv1.StaticRouteList) error {
+//delete prunes the node from every route, a failing route does not stop the others. Returns the first error.
+func (nf *nodeFinder) delete(routes *iksv1.StaticRouteList) (err error) {
 	for _, route := range routes.Items {
 		statusToDelete := nf.findNode(&route)
 		if statusToDelete == -1 {
@@ -167,12 +397,24 @@ func (nf *nodeFinder) delete(routes *iksv1.StaticRouteList) error {
 		route.Status.NodeStatus[len(route.Status.NodeStatus)-1] = iksv1.StaticRouteNodeStatus{}
 		route.Status.NodeStatus = route.Status.NodeStatus[:len(route.Status.NodeStatus)-1]
 
-		if err := nf.updateCallback(&route); err != nil {
-			return err
+		if uerr := nf.updateCallback(&route); uerr != nil {
+			if err == nil {
+				err = uerr
+			}
+			continue
+		}
+
+		// The deleted node was the last one, nobody else would remove the finalizer
+		if route.GetDeletionTimestamp() != nil && len(route.Status.NodeStatus) == 0 && len(route.GetFinalizers()) != 0 {
+			nf.infoLogger("Removing finalizer for StaticRoute", "name", route.GetName())
+			route.SetFinalizers(nil)
+			if ferr := nf.finalizeCallback(&route); ferr != nil && err == nil {
+				err = ferr
+			}
 		}
 	}
 
-	return nil
+	return
 }
 
 func (nf *nodeFinder) findNode(route *iksv1.StaticRoute) int {
@@ -19,15 +19,20 @@ package node
 import (
 	"context"
 	"errors"
+	"net"
 	"testing"
 
 	iksv1 "github.com/IBM/staticroute-operator/pkg/apis/iks/v1"
+	"github.com/IBM/staticroute-operator/pkg/routemanager"
+	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
 func TestFindNodeFound(t *testing.T) {
@@ -106,6 +111,99 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestDeleteContinuesAfterError(t *testing.T) {
+	var updated []string
+	nf := nodeFinder{
+		nodeName: "to-delete",
+		updateCallback: func(r *iksv1.StaticRoute) error {
+			updated = append(updated, r.GetName())
+			if r.GetName() == "first" {
+				return errors.New("update failed")
+			}
+			return nil
+		},
+		infoLogger: func(string, ...interface{}) {},
+	}
+	routes := &iksv1.StaticRouteList{}
+	for _, name := range []string{"first", "second"} {
+		routes.Items = append(routes.Items, iksv1.StaticRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: iksv1.StaticRouteStatus{
+				NodeStatus: []iksv1.StaticRouteNodeStatus{
+					iksv1.StaticRouteNodeStatus{Hostname: "to-delete"},
+				},
+			},
+		})
+	}
+
+	err := nf.delete(routes)
+
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+	if len(updated) != 2 {
+		t.Errorf("Every route must be updated: %v", updated)
+	}
+}
+
+func TestReconcileImplPrunesEveryRoute(t *testing.T) {
+	deletedAt := metav1.Now()
+	newRoute := func(name string, hostnames ...string) iksv1.StaticRoute {
+		route := iksv1.StaticRoute{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		for _, hostname := range hostnames {
+			route.Status.NodeStatus = append(route.Status.NodeStatus, iksv1.StaticRouteNodeStatus{Hostname: hostname})
+		}
+		return route
+	}
+	deleting := newRoute("deleting", "CR")
+	deleting.SetDeletionTimestamp(&deletedAt)
+	deleting.SetFinalizers([]string{"finalizer.static-route.ibm.com"})
+	routes := &iksv1.StaticRouteList{
+		Items: []iksv1.StaticRoute{
+			newRoute("first", "foo", "CR"),
+			newRoute("second", "CR", "bar"),
+			newRoute("untouched", "foo"),
+			deleting,
+		},
+	}
+	mockClient := reconcileImplClientMock{
+		client: newFakeClient(routes),
+		get: func(context.Context, client.ObjectKey, runtime.Object) error {
+			return kerrors.NewNotFound(schema.GroupResource{}, "name")
+		},
+	}
+	params := newReconcileImplParams(&mockClient)
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	expected := map[string][]string{"first": {"foo"}, "second": {"bar"}, "untouched": {"foo"}, "deleting": {}}
+	for name, hostnames := range expected {
+		route := &iksv1.StaticRoute{}
+		if err := mockClient.client.Get(context.Background(), client.ObjectKey{Name: name}, route); err != nil {
+			t.Errorf("Failed to read the CR %s: %s", name, err.Error())
+			continue
+		}
+		if len(route.Status.NodeStatus) != len(hostnames) {
+			t.Errorf("Status of %s not match %v != %v", name, hostnames, route.Status.NodeStatus)
+			continue
+		}
+		for i, hostname := range hostnames {
+			if route.Status.NodeStatus[i].Hostname != hostname {
+				t.Errorf("Status of %s not match %v != %v", name, hostnames, route.Status.NodeStatus)
+			}
+		}
+		if name == "deleting" && len(route.GetFinalizers()) != 0 {
+			t.Errorf("Finalizer must be removed after the last node is pruned: %v", route.GetFinalizers())
+		}
+	}
+}
+
 func TestReconcileImpl(t *testing.T) {
 	var statusUpdateCalled bool
 	statusUpdateCallback := func() client.StatusWriter {
@@ -143,6 +241,247 @@ func TestReconcileImplNodeGetNodeFound(t *testing.T) {
 	}
 }
 
+func TestReconcileImplOtherNodeSkipsManagementRoutes(t *testing.T) {
+	params, mockClient := getReconcileContextForHappyFlow(nil)
+	mockClient.get = func(context.Context, client.ObjectKey, runtime.Object) error {
+		return nil
+	}
+	params.options = ManagerOptions{ManagementRoutes: true, Hostname: "other"}
+
+	res, err := reconcileImpl(*params)
+
+	if res != nodeStillExists {
+		t.Error("Result must be nodeStillExists")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+}
+
+func TestReconcileImplManagementRoutes(t *testing.T) {
+	registered := map[string]routemanager.Route{}
+	params, _ := getReconcileContextForManagementRoutes("10.1.0.0/16 via 10.0.0.1, 10.2.0.0/16 via 10.0.0.2", registered)
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if len(registered) != 2 || registered["node:10.1.0.0/16"].Gw.String() != "10.0.0.1" || registered["node:10.2.0.0/16"].Table != 100 {
+		t.Errorf("Management routes not match: %v", registered)
+	}
+	if len(params.managementRoutes) != 2 {
+		t.Errorf("Management routes are not tracked: %v", params.managementRoutes)
+	}
+}
+
+func TestReconcileImplManagementRoutesRemoved(t *testing.T) {
+	registered := map[string]routemanager.Route{}
+	params, _ := getReconcileContextForManagementRoutes("10.1.0.0/16 via 10.0.0.1", registered)
+	_, dst, _ := net.ParseCIDR("10.2.0.0/16")
+	params.managementRoutes["node:10.1.0.0/16"] = routemanager.Route{Dst: *dst, Gw: net.IP{10, 0, 0, 9}, Table: 100}
+	params.managementRoutes["node:10.2.0.0/16"] = routemanager.Route{Dst: *dst, Gw: net.IP{10, 0, 0, 2}, Table: 100}
+	deRegistered := []string{}
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered[n] = r
+			return nil
+		},
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if len(deRegistered) != 2 {
+		t.Errorf("Changed and removed routes must be deregistered: %v", deRegistered)
+	}
+	if len(registered) != 1 || registered["node:10.1.0.0/16"].Gw.String() != "10.0.0.1" {
+		t.Errorf("Changed route must be registered again: %v", registered)
+	}
+	if _, found := params.managementRoutes["node:10.2.0.0/16"]; found || len(params.managementRoutes) != 1 {
+		t.Errorf("Removed route is still tracked: %v", params.managementRoutes)
+	}
+}
+
+func TestReconcileImplManagementRoutesInvalid(t *testing.T) {
+	params, _ := getReconcileContextForManagementRoutes("10.1.0.0/16 10.0.0.1", map[string]routemanager.Route{})
+
+	res, err := reconcileImpl(*params)
+
+	if res != managementRoutesError {
+		t.Error("Result must be managementRoutesError")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+}
+
+func TestReconcileImplManagementRoutesProtected(t *testing.T) {
+	registered := map[string]routemanager.Route{}
+	params, _ := getReconcileContextForManagementRoutes("10.1.0.0/16 via 10.0.0.1", registered)
+	_, protected, _ := net.ParseCIDR("10.1.2.0/24")
+	params.options.ProtectedSubnets = []*net.IPNet{protected}
+
+	res, err := reconcileImpl(*params)
+
+	if res != managementRoutesError {
+		t.Error("Result must be managementRoutesError")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if len(registered) != 0 {
+		t.Errorf("Protected route must not be registered: %v", registered)
+	}
+}
+
+func TestReconcileImplManagementRoutesRegisterError(t *testing.T) {
+	params, _ := getReconcileContextForManagementRoutes("10.1.0.0/16 via 10.0.0.1", nil)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(string, routemanager.Route) error {
+			return errors.New("register failed")
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != managementSyncError {
+		t.Error("Result must be managementSyncError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+	if len(params.managementRoutes) != 0 {
+		t.Errorf("Failed route must not be tracked: %v", params.managementRoutes)
+	}
+}
+
+func TestReconcileImplPublishPrimaryRoute(t *testing.T) {
+	params, mockClient := getReconcileContextForPrimaryRoute(nil)
+	var updated *corev1.Node
+	mockClient.update = func(ctx context.Context, obj runtime.Object, options ...client.UpdateOption) error {
+		updated = obj.(*corev1.Node)
+		return nil
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != nodeStillExists {
+		t.Error("Result must be nodeStillExists")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if updated == nil || updated.Annotations[iksv1.DefaultGatewayAnnotation] != "10.0.0.1" || updated.Annotations[iksv1.PrimaryInterfaceAnnotation] != "eth0" {
+		t.Errorf("Primary route must be published: %v", updated)
+	}
+	if updated.Annotations["other"] != "value" {
+		t.Errorf("Other annotations must be kept: %v", updated.Annotations)
+	}
+}
+
+func TestReconcileImplPublishPrimaryRouteUnchanged(t *testing.T) {
+	params, mockClient := getReconcileContextForPrimaryRoute(map[string]string{
+		iksv1.DefaultGatewayAnnotation:   "10.0.0.1",
+		iksv1.PrimaryInterfaceAnnotation: "eth0",
+	})
+	mockClient.update = func(context.Context, runtime.Object, ...client.UpdateOption) error {
+		t.Error("Unchanged primary route must not update the node")
+		return nil
+	}
+
+	if res, err := reconcileImpl(*params); res != nodeStillExists || err != nil {
+		t.Errorf("Result must be nodeStillExists: %v", err)
+	}
+}
+
+func TestReconcileImplPublishPrimaryRouteErrors(t *testing.T) {
+	params, mockClient := getReconcileContextForPrimaryRoute(nil)
+	params.options.PrimaryRouteResolver = &routemanager.FakeGatewayResolver{Err: errors.New("no route")}
+
+	if res, err := reconcileImpl(*params); res != primaryRouteError || err == nil {
+		t.Errorf("Result must be primaryRouteError: %v", err)
+	}
+
+	params.options.PrimaryRouteResolver = &routemanager.FakeGatewayResolver{Gateway: net.IP{10, 0, 0, 1}, Interface: "eth0"}
+	mockClient.update = func(context.Context, runtime.Object, ...client.UpdateOption) error {
+		return errors.New("update failed")
+	}
+
+	if res, err := reconcileImpl(*params); res != primaryRouteSyncError || err == nil {
+		t.Errorf("Result must be primaryRouteSyncError: %v", err)
+	}
+}
+
+func TestReconcileImplPublishPrimaryRouteWithManagementRoutes(t *testing.T) {
+	registered := map[string]routemanager.Route{}
+	params, mockClient := getReconcileContextForManagementRoutes("10.1.0.0/16 via 10.0.0.1", registered)
+	params.options.PublishPrimaryRoute = true
+	params.options.PrimaryRouteResolver = &routemanager.FakeGatewayResolver{Gateway: net.IP{10, 0, 0, 1}, Interface: "eth0"}
+	updated := false
+	mockClient.update = func(context.Context, runtime.Object, ...client.UpdateOption) error {
+		updated = true
+		return nil
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished || err != nil {
+		t.Errorf("Result must be finished: %v", err)
+	}
+	if !updated || len(registered) != 1 {
+		t.Errorf("Both the primary route and the management routes must be synced: %t %v", updated, registered)
+	}
+}
+
+func TestDefaultRouteWatcherRequestsOwnNode(t *testing.T) {
+	events := make(chan event.GenericEvent)
+	watcher := defaultRouteWatcher{events: events, hostname: "hostname"}
+
+	watcher.DefaultRouteChanged()
+
+	if e := <-events; e.Meta.GetName() != "hostname" {
+		t.Errorf("Own node must be reconciled: %s", e.Meta.GetName())
+	}
+}
+
+func TestParseManagementRoutes(t *testing.T) {
+	routes, err := parseManagementRoutes(" 10.1.0.0/16 via 10.0.0.1,,fd00::/64 via fd00::1 ", 5)
+
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if len(routes) != 2 || routes["node:fd00::/64"].Gw.String() != "fd00::1" || routes["node:10.1.0.0/16"].Table != 5 {
+		t.Errorf("Routes not match: %v", routes)
+	}
+}
+
+func TestParseManagementRoutesInvalid(t *testing.T) {
+	for _, annotation := range []string{
+		"10.1.0.0/16",
+		"10.1.0.0/16 through 10.0.0.1",
+		"10.1.0.0 via 10.0.0.1",
+		"10.1.0.0/16 via invalid",
+		"10.1.0.0/16 via fd00::1",
+	} {
+		if _, err := parseManagementRoutes(annotation, 0); err == nil {
+			t.Errorf("Error must be not nil: %s", annotation)
+		}
+	}
+}
+
 func TestReconcileImplNodeGetNodeFatalError(t *testing.T) {
 	params, mockClient := getReconcileContextForHappyFlow(nil)
 	mockClient.get = func(context.Context, client.ObjectKey, runtime.Object) error {
@@ -219,6 +558,45 @@ func TestReconcileDeleteError(t *testing.T) {
 	}
 }
 
+func getReconcileContextForManagementRoutes(annotation string, registered map[string]routemanager.Route) (*reconcileImplParams, *reconcileImplClientMock) {
+	params, mockClient := getReconcileContextForHappyFlow(nil)
+	mockClient.get = func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+		obj.(*corev1.Node).Annotations = map[string]string{iksv1.ManagementRoutesAnnotation: annotation}
+		return nil
+	}
+	params.options = ManagerOptions{
+		ManagementRoutes: true,
+		Hostname:         "CR",
+		Table:            100,
+		RouteManager: routeManagerMock{
+			registeredCallback: func(n string, r routemanager.Route) error {
+				registered[n] = r
+				return nil
+			},
+		},
+	}
+	params.managementRoutes = map[string]routemanager.Route{}
+	return params, mockClient
+}
+
+func getReconcileContextForPrimaryRoute(annotations map[string]string) (*reconcileImplParams, *reconcileImplClientMock) {
+	params, mockClient := getReconcileContextForHappyFlow(nil)
+	if annotations == nil {
+		annotations = map[string]string{"other": "value"}
+	}
+	mockClient.get = func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+		obj.(*corev1.Node).Annotations = annotations
+		return nil
+	}
+	params.options = ManagerOptions{
+		PublishPrimaryRoute:      true,
+		Hostname:                 "CR",
+		FallbackIPForGwSelection: net.IP{10, 0, 0, 1},
+		PrimaryRouteResolver:     &routemanager.FakeGatewayResolver{Gateway: net.IP{10, 0, 0, 1}, Interface: "eth0"},
+	}
+	return params, mockClient
+}
+
 func getReconcileContextForHappyFlow(statusUpdateCallback func() client.StatusWriter) (*reconcileImplParams, *reconcileImplClientMock) {
 	routes := &iksv1.StaticRouteList{}
 	mockClient := reconcileImplClientMock{
@@ -37,6 +37,7 @@ type reconcileImplClientMock struct {
 	getErr          error
 	updateErr       error
 	listErr         error
+	listCallback    func(runtime.Object) error
 }
 
 func (m reconcileImplClientMock) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
@@ -60,6 +61,11 @@ func (m reconcileImplClientMock) List(ctx context.Context, list runtime.Object,
 	if m.listErr != nil {
 		return m.listErr
 	}
+	if m.listCallback != nil {
+		if err := m.listCallback(list); err != nil {
+			return err
+		}
+	}
 	return m.client.List(ctx, list, options...)
 }
 
@@ -71,26 +77,46 @@ func (m reconcileImplClientMock) Status() client.StatusWriter {
 }
 
 type statusWriterMock struct {
-	updateErr error
-	patchErr  error
+	updateErr     error
+	patchErr      error
+	patchCallback func(runtime.Object, client.Patch) error
 }
 
 func (m statusWriterMock) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
 	return m.updateErr
 }
 
-func (m statusWriterMock) Patch(context.Context, runtime.Object, client.Patch, ...client.PatchOption) error {
+func (m statusWriterMock) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if m.patchCallback != nil {
+		return m.patchCallback(obj, patch)
+	}
 	return m.patchErr
 }
 
 type routeManagerMock struct {
-	isRegistered       bool
-	registeredCallback func(string, routemanager.Route) error
-	registerRouteErr   error
-	deRegisterRouteErr error
+	isRegistered             bool
+	isRegisteredCallback     func(string) bool
+	registeredCallback       func(string, routemanager.Route) error
+	registeredRoutesCallback func(map[string]routemanager.Route) error
+	appliedRoutesCallback    func(map[string]routemanager.Route) map[string]error
+	registerRouteErr         error
+	deRegisterRouteErr       error
+	deRegisteredCallback     func(string) error
+	repair                   routemanager.Repair
+	flushTableCallback       func(int) (int, error)
+	ensureAbsentCallback     func(routemanager.Route) (int, error)
+	listRoutesCallback       func() ([]routemanager.Route, error)
+	exportRoutesCallback     func() ([]string, error)
+	isDegradedCallback       func(string) bool
+	nexthopsCallback         func(string) []routemanager.Nexthop
+	isLinkUpCallback         func(string) bool
+	verifyRouteErr           error
 }
 
-func (m routeManagerMock) IsRegistered(string) bool {
+func (m routeManagerMock) IsRegistered(n string) bool {
+	if m.isRegisteredCallback != nil {
+		return m.isRegisteredCallback(n)
+	}
 	return m.isRegistered
 }
 
@@ -101,10 +127,80 @@ func (m routeManagerMock) RegisterRoute(n string, r routemanager.Route) error {
 	return m.registerRouteErr
 }
 
-func (m routeManagerMock) DeRegisterRoute(string) error {
+func (m routeManagerMock) RegisterRoutes(routes map[string]routemanager.Route) error {
+	if m.registeredRoutesCallback != nil {
+		return m.registeredRoutesCallback(routes)
+	}
+	return m.registerRouteErr
+}
+
+func (m routeManagerMock) ApplyRoutes(routes map[string]routemanager.Route) map[string]error {
+	if m.appliedRoutesCallback != nil {
+		return m.appliedRoutesCallback(routes)
+	}
+	return nil
+}
+
+func (m routeManagerMock) DeRegisterRoute(n string) error {
+	if m.deRegisteredCallback != nil {
+		return m.deRegisteredCallback(n)
+	}
 	return m.deRegisterRouteErr
 }
 
+func (m routeManagerMock) VerifyRoute(string) (routemanager.Repair, error) {
+	return m.repair, m.verifyRouteErr
+}
+
+func (m routeManagerMock) FlushTable(table int) (int, error) {
+	if m.flushTableCallback != nil {
+		return m.flushTableCallback(table)
+	}
+	return 0, nil
+}
+
+func (m routeManagerMock) EnsureAbsent(r routemanager.Route) (int, error) {
+	if m.ensureAbsentCallback != nil {
+		return m.ensureAbsentCallback(r)
+	}
+	return 0, nil
+}
+
+func (m routeManagerMock) ListRoutes() ([]routemanager.Route, error) {
+	if m.listRoutesCallback != nil {
+		return m.listRoutesCallback()
+	}
+	return nil, nil
+}
+
+func (m routeManagerMock) ExportRoutes() ([]string, error) {
+	if m.exportRoutesCallback != nil {
+		return m.exportRoutesCallback()
+	}
+	return nil, nil
+}
+
+func (m routeManagerMock) IsDegraded(n string) bool {
+	if m.isDegradedCallback != nil {
+		return m.isDegradedCallback(n)
+	}
+	return false
+}
+
+func (m routeManagerMock) Nexthops(n string) []routemanager.Nexthop {
+	if m.nexthopsCallback != nil {
+		return m.nexthopsCallback(n)
+	}
+	return nil
+}
+
+func (m routeManagerMock) IsLinkUp(n string) bool {
+	if m.isLinkUpCallback != nil {
+		return m.isLinkUpCallback(n)
+	}
+	return true
+}
+
 func (m routeManagerMock) RegisterWatcher(routemanager.RouteWatcher) {
 }
 
@@ -115,12 +211,23 @@ func (m routeManagerMock) Run(chan struct{}) error {
 	return nil
 }
 
-func newFakeClient(route *iksv1.StaticRoute) client.Client {
+func newFakeClient(routes ...*iksv1.StaticRoute) client.Client {
+	return newFakeClientWithNode(nil, routes...)
+}
+
+func newFakeClientWithNode(node *corev1.Node, routes ...*iksv1.StaticRoute) client.Client {
 	s := runtime.NewScheme()
-	s.AddKnownTypes(iksv1.SchemeGroupVersion, route)
+	s.AddKnownTypes(iksv1.SchemeGroupVersion, &iksv1.StaticRoute{}, &iksv1.StaticRouteList{}, &iksv1.NetworkGroup{}, &iksv1.NetworkGroupList{})
 	nodes := &corev1.NodeList{}
-	s.AddKnownTypes(corev1.SchemeGroupVersion, nodes)
-	return fake.NewFakeClientWithScheme(s, []runtime.Object{route}...)
+	s.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Node{}, nodes, &corev1.ConfigMap{}, &corev1.ConfigMapList{})
+	objs := []runtime.Object{}
+	if node != nil {
+		objs = append(objs, node)
+	}
+	for _, route := range routes {
+		objs = append(objs, route)
+	}
+	return fake.NewFakeClientWithScheme(s, objs...)
 }
 
 func newReconcileImplParams(client reconcileImplClient) *reconcileImplParams {
@@ -17,12 +17,20 @@
 package staticroute
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"net"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	iksv1 "github.com/IBM/staticroute-operator/pkg/apis/iks/v1"
+	"github.com/IBM/staticroute-operator/pkg/metrics"
 	"github.com/IBM/staticroute-operator/pkg/routemanager"
 	"github.com/IBM/staticroute-operator/pkg/types"
 	corev1 "k8s.io/api/core/v1"
@@ -32,6 +40,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/selection"
 	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
@@ -43,6 +52,32 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+const (
+	//DrainPolicyKeep keeps the routes on cordoned nodes
+	DrainPolicyKeep = "keep"
+	//DrainPolicyRemove withdraws the routes from cordoned nodes until they are uncordoned
+	DrainPolicyRemove = "remove"
+)
+
+//dumpPageSize the number of routes in one page of the dump
+const dumpPageSize = 50
+
+const (
+	//KillSwitchKey the key of the kill switch ConfigMap which holds its state
+	KillSwitchKey = "state"
+	//KillSwitchDisabled the state of the kill switch which withdraws every route of the operator
+	KillSwitchDisabled = "disabled"
+)
+
+//defaultEnsureAbsentInterval the period of checking the absent routes if periodic reconciliation is disabled
+const defaultEnsureAbsentInterval = time.Minute
+
+//failoverBaseMetric the metric of the routes of the oldest member of a failover group, the further members get the next ones
+const failoverBaseMetric = 100
+
+//statusPatchAttempts the number of attempts to patch the entry of the node into the status of the CR
+const statusPatchAttempts = 5
+
 var (
 	//HostNameLabel label to determine hostname
 	HostNameLabel = "kubernetes.io/hostname"
@@ -52,21 +87,42 @@ var log = logf.Log.WithName("controller_staticroute")
 
 // ManagerOptions contains static route management related node properties
 type ManagerOptions struct {
-	RouteManager             routemanager.RouteManager
-	Hostname                 string
-	Table                    int
-	ProtectedSubnets         []*net.IPNet
-	FallbackIPForGwSelection net.IP
-	GetGw                    func(net.IP) (net.IP, error)
+	RouteManager              routemanager.RouteManager
+	Hostname                  string
+	Table                     int
+	ProtectedSubnets          []*net.IPNet
+	ProtectedSubnetExceptions []*net.IPNet
+	FallbackIPForGwSelection  net.IP
+	GatewayResolver           types.GatewayResolver
+	ReconcileInterval         time.Duration
+	LookupIP                  func(string) ([]net.IP, error)
+	GatewayResolveInterval    time.Duration
+	OnDrain                   string
+	OperatorID                string
+	// KillSwitch the ConfigMap which withdraws every route when its state is disabled, empty name turns it off
+	KillSwitch k8stypes.NamespacedName
+	// ProtectedSubnetsConfigMap the ConfigMap which protects further subnets besides ProtectedSubnets, each value is a comma separated list of subnets. Empty name turns it off.
+	ProtectedSubnetsConfigMap k8stypes.NamespacedName
+	// ECMPMerge the StaticRoutes of the same destination through other gateways are merged into a multipath route by the RouteManager instead of conflicting
+	ECMPMerge bool
+	// MaxConcurrentReconciles the number of StaticRoutes reconciled in parallel, 1 if not set. The RouteManager serializes the changes of the kernel.
+	MaxConcurrentReconciles int
+	// FailOnUnreachable the routes whose network is unreachable fail like on any other error, instead of being pending and retried with backoff
+	FailOnUnreachable bool
+	// DefaultGateway the gateway of the StaticRoutes setting neither gateway nor gatewayHostname, instead of the discovered one. Nil turns it off.
+	DefaultGateway net.IP
 }
 
 // ReconcileStaticRoute reconciles a StaticRoute object
 type ReconcileStaticRoute struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
-	client  client.Client
-	scheme  *runtime.Scheme
-	options ManagerOptions
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	options  ManagerOptions
+
+	startupSync sync.Once
 }
 
 // Add creates a new StaticRoute Controller and adds it to the Manager. The Manager will set fields on the Controller
@@ -77,13 +133,13 @@ func Add(mgr manager.Manager, options ManagerOptions) error {
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager, options ManagerOptions) reconcile.Reconciler {
-	return &ReconcileStaticRoute{client: mgr.GetClient(), scheme: mgr.GetScheme(), options: options}
+	return &ReconcileStaticRoute{client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: mgr.GetEventRecorderFor("staticroute-controller"), options: options}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
 func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	// Create a new controller
-	c, err := controller.New("staticroute-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New("staticroute-controller", mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: r.(*ReconcileStaticRoute).options.MaxConcurrentReconciles})
 	if err != nil {
 		return err
 	}
@@ -94,34 +150,70 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Watch the other members of the failover groups, so the metrics follow when a member comes or goes
+	err = c.Watch(&source.Kind{Type: &iksv1.StaticRoute{}}, enqueueFailoverGroupMembers(r.(*ReconcileStaticRoute).client),
+		&predicate.Funcs{
+			// The status written by the nodes does not change the order of the group
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return e.MetaOld.GetGeneration() != e.MetaNew.GetGeneration()
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Watch the NetworkGroups, so the routes follow the changes of their subnets
+	err = c.Watch(&source.Kind{Type: &iksv1.NetworkGroup{}}, enqueueNetworkGroupMembers(r.(*ReconcileStaticRoute).client))
+	if err != nil {
+		return err
+	}
+
+	// Watch the gateway and link state changes found by the RouteManager
+	if routeManager := r.(*ReconcileStaticRoute).options.RouteManager; routeManager != nil {
+		events := make(chan event.GenericEvent)
+		if err = c.Watch(&source.Channel{Source: events}, &handler.EnqueueRequestForObject{}); err != nil {
+			return err
+		}
+		routeManager.RegisterWatcher(routeManagerWatcher{events: events, client: r.(*ReconcileStaticRoute).client})
+	}
+
+	// Watch the kill switch and the protected subnets, so every route is withdrawn or restored at once
+	if configMaps := watchedConfigMaps(r.(*ReconcileStaticRoute).options); len(configMaps) != 0 {
+		isWatched := func(meta metav1.Object) bool {
+			return configMaps[k8stypes.NamespacedName{Namespace: meta.GetNamespace(), Name: meta.GetName()}]
+		}
+		err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, enqueueAllStaticRoutes(r.(*ReconcileStaticRoute).client),
+			&predicate.Funcs{
+				CreateFunc: func(e event.CreateEvent) bool {
+					return isWatched(e.Meta)
+				},
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					return isWatched(e.MetaNew)
+				},
+				DeleteFunc: func(e event.DeleteEvent) bool {
+					return isWatched(e.Meta)
+				},
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Watch if the self node labels are changed, so reconcile every route
 	err = c.Watch(
 		&source.Kind{Type: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: r.(*ReconcileStaticRoute).options.Hostname}}},
-		&handler.EnqueueRequestsFromMapFunc{
-			ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
-				routes := &iksv1.StaticRouteList{}
-				if err := r.(*ReconcileStaticRoute).client.List(context.Background(), routes); err != nil {
-					log.Error(err, "Failed to List StaticRoute CRs")
-					return nil
-				}
-
-				var result []reconcile.Request
-				for _, route := range routes.Items {
-					result = append(result, reconcile.Request{
-						NamespacedName: k8stypes.NamespacedName{
-							Name:      route.GetName(),
-							Namespace: "",
-						},
-					})
-				}
-				return result
-			}),
-		},
+		enqueueAllStaticRoutes(r.(*ReconcileStaticRoute).client),
 		&predicate.Funcs{
 			CreateFunc: func(e event.CreateEvent) bool {
 				return false
 			},
 			UpdateFunc: func(e event.UpdateEvent) bool {
+				if r.(*ReconcileStaticRoute).options.OnDrain == DrainPolicyRemove && isUnschedulableChanged(e.ObjectOld, e.ObjectNew) {
+					log.Info("Node schedulability changed. Submitting all StaticRoute CRs for reconciliation.")
+					return true
+				}
 				if len(e.MetaNew.GetLabels()) != len(e.MetaOld.GetLabels()) {
 					log.Info("Node label amount changed. Submitting all StaticRoute CRs for reconciliation.")
 					return true
@@ -142,17 +234,110 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	return err
 }
 
+//enqueueAllStaticRoutes maps any event to the reconciliation of every StaticRoute
+func enqueueAllStaticRoutes(c client.Client) handler.EventHandler {
+	return &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+			routes := &iksv1.StaticRouteList{}
+			if err := c.List(context.Background(), routes); err != nil {
+				log.Error(err, "Failed to List StaticRoute CRs")
+				return nil
+			}
+
+			var result []reconcile.Request
+			for _, route := range routes.Items {
+				result = append(result, reconcile.Request{
+					NamespacedName: k8stypes.NamespacedName{
+						Name:      route.GetName(),
+						Namespace: "",
+					},
+				})
+			}
+			return result
+		}),
+	}
+}
+
+//enqueueNetworkGroupMembers maps the events of a NetworkGroup to the reconciliation of the StaticRoutes referring to it
+func enqueueNetworkGroupMembers(c client.Client) handler.EventHandler {
+	return &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+			routes := &iksv1.StaticRouteList{}
+			if err := c.List(context.Background(), routes); err != nil {
+				log.Error(err, "Failed to List StaticRoute CRs")
+				return nil
+			}
+
+			var result []reconcile.Request
+			for _, route := range routes.Items {
+				if route.Spec.NetworkGroup != a.Meta.GetName() {
+					continue
+				}
+				result = append(result, reconcile.Request{
+					NamespacedName: k8stypes.NamespacedName{
+						Name:      route.GetName(),
+						Namespace: "",
+					},
+				})
+			}
+			return result
+		}),
+	}
+}
+
+//enqueueFailoverGroupMembers maps the events of a StaticRoute to the reconciliation of the other members of its failover group
+func enqueueFailoverGroupMembers(c client.Client) handler.EventHandler {
+	return &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+			changed, ok := a.Object.(*iksv1.StaticRoute)
+			if !ok || len(changed.Spec.FailoverGroup) == 0 {
+				return nil
+			}
+			routes := &iksv1.StaticRouteList{}
+			if err := c.List(context.Background(), routes); err != nil {
+				log.Error(err, "Failed to List StaticRoute CRs")
+				return nil
+			}
+
+			var result []reconcile.Request
+			for _, route := range routes.Items {
+				if route.Spec.FailoverGroup != changed.Spec.FailoverGroup || route.GetName() == changed.GetName() {
+					continue
+				}
+				result = append(result, reconcile.Request{
+					NamespacedName: k8stypes.NamespacedName{
+						Name:      route.GetName(),
+						Namespace: "",
+					},
+				})
+			}
+			return result
+		}),
+	}
+}
+
+func isUnschedulableChanged(oldObj, newObj runtime.Object) bool {
+	oldNode, oldOk := oldObj.(*corev1.Node)
+	newNode, newOk := newObj.(*corev1.Node)
+	return oldOk && newOk && oldNode.Spec.Unschedulable != newNode.Spec.Unschedulable
+}
+
 // blank assignment to verify that ReconcileStaticRoute implements reconcile.Reconciler
 var _ reconcile.Reconciler = &ReconcileStaticRoute{}
 
 // Reconcile reads that state of the cluster for a StaticRoute object and makes changes based on the state read
 // and what is in the StaticRoute.Spec
 func (r *ReconcileStaticRoute) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	defer metrics.ObserveReconcile("staticroute", time.Now())
 	params := reconcileImplParams{
-		request: request,
-		client:  r.client,
-		options: r.options,
+		request:  request,
+		client:   r.client,
+		recorder: r.recorder,
+		options:  r.options,
 	}
+	r.startupSync.Do(func() {
+		applyReportedRoutes(params, log.WithValues("Node", r.options.Hostname))
+	})
 	result, err := reconcileImpl(params)
 	return *result, err
 }
@@ -165,19 +350,34 @@ type reconcileImplClient interface {
 }
 
 type reconcileImplParams struct {
-	request reconcile.Request
-	client  reconcileImplClient
-	options ManagerOptions
+	request  reconcile.Request
+	client   reconcileImplClient
+	recorder record.EventRecorder
+	options  ManagerOptions
 }
 
 var (
 	crNotFound        = &reconcile.Result{}
 	nodeNotFound      = &reconcile.Result{}
 	overlapsProtected = &reconcile.Result{}
+	wrongSourceError  = &reconcile.Result{}
+	invalidTosError   = &reconcile.Result{}
+	invalidFwMarkErr  = &reconcile.Result{}
+	ambiguousGateway  = &reconcile.Result{}
+	noSubnetError     = &reconcile.Result{}
 	alreadyDeleted    = &reconcile.Result{}
 	deletionFinished  = &reconcile.Result{}
 	updateFinished    = &reconcile.Result{Requeue: true}
 	finished          = &reconcile.Result{}
+	routeExpired      = &reconcile.Result{}
+	routeDrained      = &reconcile.Result{}
+	routeConflicting  = &reconcile.Result{}
+	routeDisabled     = &reconcile.Result{}
+	routeWaiting      = &reconcile.Result{}
+	routeKilled       = &reconcile.Result{}
+	routePaused       = &reconcile.Result{}
+	routePending      = &reconcile.Result{Requeue: true}
+	otherOperator     = &reconcile.Result{}
 
 	crGetError                      = &reconcile.Result{}
 	wrongSelectorErr                = &reconcile.Result{}
@@ -189,18 +389,42 @@ var (
 	invalidGatewayError             = &reconcile.Result{}
 	gatewayNotDirectlyRoutableError = &reconcile.Result{}
 	routeGetError                   = &reconcile.Result{}
+	gatewayResolveError             = &reconcile.Result{}
 	parseSubnetError                = &reconcile.Result{}
 	registerRouteError              = &reconcile.Result{}
+	invalidRouteError               = &reconcile.Result{}
+	invalidOnLinkError              = &reconcile.Result{}
+	registerSubnetsError            = &reconcile.Result{}
+	registerTablesError             = &reconcile.Result{}
+	verifyRouteError                = &reconcile.Result{}
+	flushTableError                 = &reconcile.Result{}
+	ensureAbsentError               = &reconcile.Result{}
+	conflictCheckError              = &reconcile.Result{}
+	failoverCheckError              = &reconcile.Result{}
+	killSwitchGetError              = &reconcile.Result{}
+	protectedSubnetsGetError        = &reconcile.Result{}
+	networkGroupGetError            = &reconcile.Result{}
+	groupListError                  = &reconcile.Result{}
+	groupMemberError                = &reconcile.Result{}
 	addStatusUpdateError            = &reconcile.Result{}
+	reconcilePanicError             = &reconcile.Result{}
 )
 
 func reconcileImpl(params reconcileImplParams) (res *reconcile.Result, err error) {
 	reqLogger := log.WithValues("Node", params.options.Hostname, "Request.Name", params.request.Name)
 	reqLogger.Info("Reconciling StaticRoute")
+	defer recoverReconcile(reqLogger, &res, &err)
 
 	// Default 0.0.0.0 is set to fulfill the CRD requirements
 	gateway := net.IP{0, 0, 0, 0}
+	var resolvedAt *metav1.Time
 	reportStatus := true
+	conflictsWith := ""
+	preferred := ""
+	exception := ""
+	var unreachable error
+	var rejected error
+	var nexthops []iksv1.StaticRouteNexthopStatus
 
 	// Fetch the StaticRoute instance
 	instance := &iksv1.StaticRoute{}
@@ -210,13 +434,48 @@ func reconcileImpl(params reconcileImplParams) (res *reconcile.Result, err error
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
 			reqLogger.Info("Object not found. Probably deleted meanwhile")
+			metrics.SetConflicting(params.request.Name, false)
 			return crNotFound, nil
 		}
 		// Error reading the object - requeue the request.
 		return crGetError, err
 	}
 
+	if len(instance.Spec.Description) != 0 {
+		reqLogger = reqLogger.WithValues("Description", instance.Spec.Description)
+	}
 	rw := routeWrapper{instance: instance}
+	rw.readStatusHosts()
+	if owner := rw.owner(); len(owner) != 0 {
+		reqLogger = reqLogger.WithValues("Owner", owner)
+	}
+	if !rw.isManagedBy(params.options.OperatorID) {
+		reqLogger.Info("StaticRoute belongs to another operator instance, ignoring it", "OperatorID", rw.instance.GetLabels()[iksv1.OperatorIDLabel])
+		return otherOperator, nil
+	}
+	reportedSubnets := rw.reportedSubnets(params.options.Hostname)
+	subnetStatus := rw.getSubnetStatus(params.options.Hostname)
+	tableStatus := rw.getTableStatus(params.options.Hostname)
+	// The duplicates in the tables removed from the list may be still registered
+	ownTables := mergeTables(rw.listedTables(params.options.Table), rw.reportedTables(params.options.Hostname))
+	flushStatus := rw.getFlushStatus(params.options.Hostname)
+	removedRoutes := rw.getRemovedRoutes(params.options.Hostname)
+	dumpStatus := rw.getDumpStatus(params.options.Hostname)
+	installedAt := rw.getInstalledAt(params.options.Hostname)
+	gatewayChanges := rw.getGatewayChanges(params.options.Hostname)
+	wasDisabled := rw.getStatusReason(params.options.Hostname) == iksv1.ReasonDisabled
+	wasDegraded := rw.getStatusReason(params.options.Hostname) == iksv1.ReasonDegraded
+	wasKilled := rw.getStatusReason(params.options.Hostname) == iksv1.ReasonKillSwitch
+	degraded := false
+
+	// A paused route is left alone, but it can still be deleted
+	if rw.isPaused() && instance.GetDeletionTimestamp() == nil {
+		return pauseOperation(params, &rw, reqLogger)
+	}
+	if rw.getStatusReason(params.options.Hostname) == iksv1.ReasonPaused {
+		reqLogger.Info("Route is resumed")
+		recordEvent(params, rw.instance, corev1.EventTypeNormal, "RouteResumed", "Reconciliation of the route resumed on node %s", params.options.Hostname)
+	}
 
 	defer func() {
 		if !reportStatus {
@@ -224,39 +483,224 @@ func reconcileImpl(params reconcileImplParams) (res *reconcile.Result, err error
 		}
 		// special error handling is needed in the following cases
 		var serr error
+		reason := ""
 		switch res {
+		case routeExpired:
+			reason = iksv1.ReasonExpired
+		case routeDrained:
+			reason = iksv1.ReasonDrained
+		case routeDisabled:
+			reason = iksv1.ReasonDisabled
+		case routeWaiting:
+			reason = iksv1.ReasonWaitingForInterface
+		case routeKilled:
+			reason = iksv1.ReasonKillSwitch
+		case routeConflicting:
+			reason = iksv1.ReasonConflicting
+			serr = fmt.Errorf("Destination is routed by the older StaticRoute %s", conflictsWith)
+		case routePending:
+			reason = iksv1.ReasonPending
+			serr = unreachable
+		case invalidRouteError:
+			serr = rejected
 		case overlapsProtected:
+			reason = iksv1.ReasonProtectedSubnetRejected
 			serr = errors.New("Given subnet overlaps with some protected subnet")
+		case wrongSourceError:
+			_, serr = rw.getSourceAddress()
+		case invalidTosError:
+			serr = rw.validateTos()
+		case invalidOnLinkError:
+			serr = rw.validateOnLink()
+		case invalidFwMarkErr:
+			_, _, serr = rw.getRule()
+		case ambiguousGateway:
+			serr = errAmbiguousGateway
+		case noSubnetError:
+			serr = errNoSubnet
+		case parseSubnetError:
+			serr = errInvalidSubnet
 		case gatewayNotDirectlyRoutableError:
 			serr = errors.New("Given gateway IP is not directly routable, cannot setup the route")
 		default:
 			serr = err
 		}
+		if degraded {
+			reason = iksv1.ReasonDegraded
+		}
+		if serr != nil && errors.Is(serr, routemanager.ErrInvalidRoute) {
+			reason = iksv1.ReasonInvalidRoute
+		}
+		if serr != nil && errors.Is(serr, routemanager.ErrInterfaceMissing) {
+			reason = iksv1.ReasonInterfaceMissing
+		}
+		if serr != nil && errors.Is(serr, routemanager.ErrNetlinkTimeout) {
+			reason = iksv1.ReasonNetlinkTimeout
+		}
+		if serr != nil && errors.Is(serr, routemanager.ErrVrfNotFound) {
+			reason = iksv1.ReasonVrfNotFound
+		}
+		installed := false
+		if serr != nil || rw.instance.Spec.EnsureAbsent || (reason != "" && reason != iksv1.ReasonDegraded) {
+			installedAt = nil
+		} else if installedAt == nil {
+			now := metav1.Now()
+			installedAt = &now
+			installed = true
+		}
 		_ = rw.removeFromStatus(params.options.Hostname)
 		if rw.addToStatus(params.options.Hostname, gateway, serr) {
+			rw.setStatusReason(params.options.Hostname, reason)
+			rw.setReasonCode(params.options.Hostname, reasonCode(res, reason, serr))
+			if resolvedAt != nil {
+				rw.setResolvedGateway(params.options.Hostname, gateway, resolvedAt)
+			}
+			rw.setSubnetStatus(params.options.Hostname, subnetStatus)
+			rw.setTableStatus(params.options.Hostname, tableStatus)
+			rw.setFlushStatus(params.options.Hostname, flushStatus)
+			rw.setRemovedRoutes(params.options.Hostname, removedRoutes)
+			rw.setDumpStatus(params.options.Hostname, dumpStatus)
+			rw.setInstalledAt(params.options.Hostname, installedAt)
+			rw.setGatewayChanges(params.options.Hostname, gatewayChanges)
+			rw.setProtectedSubnetException(params.options.Hostname, exception)
+			rw.setOwner(params.options.Hostname, rw.owner())
+			rw.setNexthops(params.options.Hostname, nexthops)
+			rw.setFailoverStatus(params.options.Hostname, rw.metric, preferred)
+			rw.setDefaultGateway(params.options.Hostname, rw.usesDefaultGateway(params.options.DefaultGateway))
 			reqLogger.Info("Update the StaticRoute status", "staticroute", rw.instance.Status)
-			if cerr := params.client.Status().Update(context.Background(), rw.instance); cerr != nil {
+			if cerr := updateNodeStatus(params, &rw, params.options.Hostname); cerr != nil {
 				reqLogger.Error(err, "failed to update the staticroute")
 				res = addStatusUpdateError
 				err = cerr
+			} else if installed && rw.instance.GetGeneration() <= 1 {
+				// The latency is meaningful only if the spec was not changed since the creation
+				metrics.ObserveApplyLatency(rw.instance.GetCreationTimestamp().Time, installedAt.Time)
 			}
 		}
 	}()
+	// Runs before the status writer above, so a panic of this CR ends up in its status
+	defer recoverReconcile(reqLogger, &res, &err)
+
+	if rw.isDumpRequested(params.options.Hostname) {
+		dumpStatus = dumpRoutesOperation(params, &rw, reqLogger)
+	}
+
+	// The routes of a CR being deleted are removed by the reported subnets, even if its NetworkGroup is gone
+	if err = resolveNetworkGroup(params.client, &rw); err != nil && instance.GetDeletionTimestamp() == nil {
+		reqLogger.Error(err, "Failed to fetch the NetworkGroup", "NetworkGroup", instance.Spec.NetworkGroup)
+		res = networkGroupGetError
+		return
+	}
+	err = nil
+
+	if len(rw.instance.Spec.Subnet) == 0 && len(rw.listedSubnets()) == 0 {
+		reqLogger.Info("Error: neither subnet nor subnets are set")
+		res = noSubnetError
+		return
+	}
 
-	// Check if the staticroute overlaps with some protected subnets
-	if rw.isProtected(params.options.ProtectedSubnets) {
+	protecteds, perr := protectedSubnets(params)
+	if perr != nil {
+		reqLogger.Error(perr, "Failed to fetch the protected subnets")
+		return protectedSubnetsGetError, perr
+	}
+	params.options.ProtectedSubnets = protecteds
+
+	// Check if the staticroute overlaps with some protected subnets, a route being deleted is still removed
+	if rw.isProtected(params.options.ProtectedSubnets, params.options.ProtectedSubnetExceptions) && instance.GetDeletionTimestamp() == nil {
 		// a subnet overlaps some protected, ignore, but set error in nodeStatus
 		reqLogger.Info("Error: subnet overlaps some protected", "Subnet", rw.instance.Spec.Subnet)
+		// The subnet may have been protected after the route got installed, it must not stay on the node
+		wasApplied := rw.isApplied(params.options.Hostname)
+		gateway = net.ParseIP(rw.getStateGateway(params.options.Hostname))
+		if res, err = withdrawOperation(params, &rw, mergeSubnets(rw.listedSubnets(), reportedSubnets), ownTables, gateway, params.options.Table, reqLogger); res != nil {
+			return
+		}
 		res = overlapsProtected
+		subnetStatus = nil
+		tableStatus = nil
+		if wasApplied {
+			reqLogger.Info("Route withdrawn, because its subnet got protected")
+			recordEvent(params, rw.instance, corev1.EventTypeWarning, "ProtectedSubnetRejected", "Route withdrawn from node %s, because its subnet overlaps with some protected subnet", params.options.Hostname)
+		}
+		return
+	}
+	if exception = rw.protectedSubnetException(params.options.ProtectedSubnets, params.options.ProtectedSubnetExceptions); len(exception) != 0 {
+		reqLogger.Info("Subnet overlaps some protected, but it is allowed by exception", "Subnet", rw.instance.Spec.Subnet, "Exception", exception)
+	}
+
+	if _, serr := rw.getSourceAddress(); serr == errInvalidSourceAddress || serr == errSourceAddressFamily {
+		reqLogger.Info("Error: invalid source address", "SourceAddress", rw.instance.Spec.SourceAddress, "Reason", serr.Error())
+		res = wrongSourceError
+		return
+	}
+
+	if terr := rw.validateTos(); terr != nil {
+		reqLogger.Info("Error: invalid tos", "Tos", rw.instance.Spec.Tos, "Reason", terr.Error())
+		res = invalidTosError
+		return
+	}
+
+	if lerr := rw.validateOnLink(); lerr != nil {
+		reqLogger.Info("Error: invalid link-local or loopback route", "Interface", rw.instance.Spec.Interface, "Reason", lerr.Error())
+		res = invalidOnLinkError
+		return
+	}
+
+	if _, _, ferr := rw.getRule(); ferr != nil {
+		reqLogger.Info("Error: invalid fwmark", "Annotations", rw.instance.GetAnnotations(), "Reason", ferr.Error())
+		res = invalidFwMarkErr
+		return
+	}
+
+	if len(rw.instance.Spec.Gateway) != 0 && len(rw.instance.Spec.GatewayHostname) != 0 {
+		reqLogger.Info("Error: both gateway and gatewayHostname are set")
+		res = ambiguousGateway
 		return
 	}
 
+	if rw.instance.Spec.EnsureAbsent && instance.GetDeletionTimestamp() == nil {
+		if len(rw.instance.Spec.Selectors) > 0 {
+			if res, err = validateNodeBySelector(params, &rw, reqLogger); res != nil {
+				if res == nodeNotFound {
+					reportStatus = false
+				}
+				return
+			}
+		}
+		if gw := rw.getGateway(); gw != nil {
+			gateway = gw
+		}
+		var removed int
+		removed, err = ensureAbsentOperation(params, &rw, mergeSubnets(rw.listedSubnets(), reportedSubnets), ownTables, reqLogger)
+		removedRoutes += removed
+		subnetStatus = nil
+		tableStatus = nil
+		if err != nil {
+			return ensureAbsentError, err
+		}
+		if params.options.ReconcileInterval > 0 {
+			return &reconcile.Result{RequeueAfter: params.options.ReconcileInterval}, nil
+		}
+		return &reconcile.Result{RequeueAfter: defaultEnsureAbsentInterval}, nil
+	}
+
 	// If "gateway" is empty, we'll create the route through the default private network gateway
 	res, gateway, err = selectGateway(params, rw, reqLogger)
+	if (len(rw.instance.Spec.GatewayHostname) != 0 || rw.isAutoGateway()) && gateway != nil {
+		now := metav1.Now()
+		resolvedAt = &now
+	}
 	if gateway == nil || res == gatewayNotDirectlyRoutableError {
 		return
 	}
 
+	// The change of the automatic gateway is not a change of the spec, the routes are replaced in place below
+	stateGateway := gateway.String()
+	if previous := rw.getStateGateway(params.options.Hostname); rw.isAutoGateway() && len(previous) != 0 {
+		stateGateway = previous
+	}
+
 	selectorNoLongerMatches := false
 	if len(rw.instance.Spec.Selectors) > 0 {
 		reqLogger.Info("Node selector found", "Selector", rw.instance.Spec.Selectors)
@@ -272,7 +716,7 @@ func reconcileImpl(params reconcileImplParams) (res *reconcile.Result, err error
 		}
 	}
 
-	isChanged := rw.isChanged(params.options.Hostname, gateway.String(), rw.instance.Spec.Selectors)
+	isChanged := rw.isChanged(params.options.Hostname, stateGateway, rw.instance.Spec.Selectors)
 	reqLogger.Info("The resource is", "changed", isChanged)
 	if instance.GetDeletionTimestamp() != nil ||
 		isChanged ||
@@ -281,7 +725,7 @@ func reconcileImpl(params reconcileImplParams) (res *reconcile.Result, err error
 		if !rw.removeFromStatus(params.options.Hostname) {
 			return alreadyDeleted, nil
 		}
-		res, err = deleteOperation(params, &rw, reqLogger)
+		res, err = deleteOperation(params, &rw, mergeSubnets(rw.listedSubnets(), reportedSubnets), ownTables, reqLogger)
 
 		if isChanged {
 			return updateFinished, err
@@ -289,17 +733,221 @@ func reconcileImpl(params reconcileImplParams) (res *reconcile.Result, err error
 		return
 	}
 
-	return addOperation(params, &rw, gateway, params.options.Table, reqLogger)
+	if rw.instance.Spec.Disabled {
+		reqLogger.Info("Route is disabled, withdrawing route")
+		if res, err = withdrawOperation(params, &rw, mergeSubnets(rw.listedSubnets(), reportedSubnets), ownTables, gateway, params.options.Table, reqLogger); res == nil {
+			res = routeDisabled
+			subnetStatus = nil
+			tableStatus = nil
+			if !wasDisabled {
+				recordEvent(params, rw.instance, corev1.EventTypeNormal, "RouteDisabled", "Route disabled on node %s", params.options.Hostname)
+			}
+		}
+		return
+	}
+
+	if killed, kerr := isKillSwitchEngaged(params); kerr != nil {
+		reqLogger.Error(kerr, "Failed to fetch the kill switch")
+		return killSwitchGetError, kerr
+	} else if killed {
+		reqLogger.Info("Kill switch is engaged, withdrawing route")
+		if res, err = withdrawOperation(params, &rw, mergeSubnets(rw.listedSubnets(), reportedSubnets), ownTables, gateway, params.options.Table, reqLogger); res == nil {
+			res = routeKilled
+			subnetStatus = nil
+			tableStatus = nil
+			if !wasKilled {
+				recordEvent(params, rw.instance, corev1.EventTypeWarning, "KillSwitchEngaged", "Route withdrawn from node %s by the kill switch", params.options.Hostname)
+			}
+		}
+		return
+	}
+
+	expiresAt := rw.expiresAt()
+	if expiresAt != nil && !time.Now().Before(*expiresAt) {
+		reqLogger.Info("Route expired", "ExpiresAt", expiresAt)
+		if res, err = withdrawOperation(params, &rw, mergeSubnets(rw.listedSubnets(), reportedSubnets), ownTables, gateway, params.options.Table, reqLogger); res == nil {
+			res = routeExpired
+			subnetStatus = nil
+			tableStatus = nil
+		}
+		return
+	}
+
+	if params.options.OnDrain == DrainPolicyRemove {
+		node := &corev1.Node{}
+		if err = params.client.Get(context.Background(), client.ObjectKey{Name: params.options.Hostname}, node); err != nil {
+			reqLogger.Error(err, "Failed to fetch the node")
+			return nodeGetError, err
+		} else if node.Spec.Unschedulable {
+			reqLogger.Info("Node is cordoned, withdrawing route")
+			if res, err = withdrawOperation(params, &rw, mergeSubnets(rw.listedSubnets(), reportedSubnets), ownTables, gateway, params.options.Table, reqLogger); res == nil {
+				res = routeDrained
+				subnetStatus = nil
+				tableStatus = nil
+			}
+			return
+		}
+	}
+
+	if link := rw.instance.Spec.RequireInterfaceUp; len(link) != 0 && !params.options.RouteManager.IsLinkUp(link) {
+		reqLogger.Info("Required interface is not up, withdrawing route", "Interface", link)
+		if res, err = withdrawOperation(params, &rw, mergeSubnets(rw.listedSubnets(), reportedSubnets), ownTables, gateway, params.options.Table, reqLogger); res == nil {
+			res = routeWaiting
+			subnetStatus = nil
+			tableStatus = nil
+		}
+		return
+	}
+
+	if conflictsWith, err = findOlderConflict(params, &rw, reqLogger); err != nil {
+		return conflictCheckError, err
+	} else if len(conflictsWith) != 0 {
+		reqLogger.Info("Destination is routed by an older StaticRoute, not installing the route", "StaticRoute", conflictsWith)
+		metrics.SetConflicting(params.request.Name, true)
+		if err = deRegisterOwnRoutes(params, mergeSubnets(rw.listedSubnets(), reportedSubnets), ownTables, reqLogger); err != nil {
+			return deRegisterError, err
+		}
+		subnetStatus = nil
+		tableStatus = nil
+		return routeConflicting, nil
+	}
+	metrics.SetConflicting(params.request.Name, false)
+
+	if len(rw.instance.Spec.FailoverGroup) != 0 {
+		if rw.metric, preferred, err = failoverMetric(params, &rw, reqLogger); err != nil {
+			return failoverCheckError, err
+		}
+		if applied := rw.getMetric(params.options.Hostname); applied != rw.metric && rw.isApplied(params.options.Hostname) {
+			reqLogger.Info("Position in the failover group changed, replacing the routes", "Previous", applied, "Metric", rw.metric)
+			if err = deRegisterOwnRoutes(params, mergeSubnets(rw.listedSubnets(), reportedSubnets), ownTables, reqLogger); err != nil {
+				return deRegisterError, err
+			}
+		}
+	}
+
+	if stateGateway != gateway.String() && rw.isApplied(params.options.Hostname) {
+		reqLogger.Info("Automatic gateway changed, replacing the routes", "Previous", stateGateway, "Gateway", gateway)
+		if err = deRegisterOwnRoutes(params, mergeSubnets(rw.listedSubnets(), reportedSubnets), ownTables, reqLogger); err != nil {
+			return deRegisterError, err
+		}
+		gatewayChanges++
+		recordEvent(params, rw.instance, corev1.EventTypeNormal, "GatewayChanged", "Gateway changed from %s to %s on node %s", stateGateway, gateway, params.options.Hostname)
+	}
+
+	res, err = addOperation(params, &rw, gateway, params.options.Table, reqLogger)
+	if res != finished {
+		if isPending(params, err) {
+			reqLogger.Info("Network of the gateway is unreachable, retrying", "Gateway", gateway)
+			unreachable = err
+			return routePending, nil
+		}
+		if errors.Is(err, routemanager.ErrInvalidRoute) {
+			// Retrying is pointless, the route fails the same way until the StaticRoute is changed
+			reqLogger.Info("Route is rejected by the kernel, not retrying", "Error", err.Error())
+			rejected = err
+			return invalidRouteError, nil
+		}
+		return
+	}
+	if wasDisabled {
+		recordEvent(params, rw.instance, corev1.EventTypeNormal, "RouteEnabled", "Route enabled again on node %s", params.options.Hostname)
+	}
+	if wasKilled {
+		recordEvent(params, rw.instance, corev1.EventTypeNormal, "KillSwitchReleased", "Route restored on node %s after the kill switch was released", params.options.Hostname)
+	}
+	var statuses []iksv1.StaticRouteSubnetStatus
+	statuses, err = syncListedSubnets(params, &rw, reportedSubnets, gateway, params.options.Table, reqLogger)
+	if statuses != nil {
+		subnetStatus = statuses
+	}
+	if isPending(params, err) {
+		reqLogger.Info("Network of the gateway is unreachable, retrying the subnets", "Gateway", gateway)
+		unreachable = err
+		return routePending, nil
+	} else if err != nil {
+		return registerSubnetsError, err
+	}
+	var tables []iksv1.StaticRouteTableStatus
+	tables, err = syncTables(params, &rw, ownTables, gateway, reqLogger)
+	if tables != nil {
+		tableStatus = tables
+	}
+	if err != nil {
+		return registerTablesError, err
+	}
+	if rw.isFlushRequested(params.options.Hostname) {
+		var flush *iksv1.StaticRouteFlushStatus
+		if flush, err = flushTableOperation(params, &rw, reqLogger); err != nil {
+			return flushTableError, err
+		}
+		flushStatus = flush
+	}
+	if degraded = isGatewayDegraded(params, &rw); degraded && !wasDegraded {
+		reqLogger.Info("Gateway is unreachable", "Gateway", gateway)
+		recordEvent(params, rw.instance, corev1.EventTypeWarning, "GatewayDegraded", "Gateway %s is unreachable on node %s", gateway, params.options.Hostname)
+	} else if !degraded && wasDegraded {
+		reqLogger.Info("Gateway is reachable again", "Gateway", gateway)
+		recordEvent(params, rw.instance, corev1.EventTypeNormal, "GatewayRecovered", "Gateway %s is reachable again on node %s", gateway, params.options.Hostname)
+	}
+	nexthops = mergedNexthops(params, &rw)
+	var untilExpiration, resolveInterval time.Duration
+	if expiresAt != nil {
+		// Come back when the route expires
+		if untilExpiration = time.Until(*expiresAt); untilExpiration <= 0 {
+			untilExpiration = time.Second
+		}
+	}
+	if len(rw.instance.Spec.GatewayHostname) != 0 {
+		resolveInterval = params.options.GatewayResolveInterval
+	}
+	if requeueAfter := shortestInterval(params.options.ReconcileInterval, untilExpiration, resolveInterval); requeueAfter > 0 {
+		return &reconcile.Result{RequeueAfter: requeueAfter}, nil
+	}
+	return
+}
+
+/* recoverReconcile turns a panic of the reconcile into a failed reconcile of the given CR,
+   so a single broken custom resource can't bring down the operator and the routes of the others. */
+func recoverReconcile(logger types.Logger, res **reconcile.Result, err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("Reconcile failed: %v", r)
+		logger.Error(*err, "Recovered from panic", "stack", string(debug.Stack()))
+		*res = reconcilePanicError
+	}
+}
+
+//shortestInterval returns the shortest positive interval, 0 if there is none
+func shortestInterval(intervals ...time.Duration) (shortest time.Duration) {
+	for _, interval := range intervals {
+		if interval > 0 && (shortest == 0 || interval < shortest) {
+			shortest = interval
+		}
+	}
+	return
 }
 
 func selectGateway(params reconcileImplParams, rw routeWrapper, logger types.Logger) (*reconcile.Result, net.IP, error) {
+	if rw.isOnLink() {
+		// Reached through the interface, the unspecified address stands for the missing gateway in the status
+		return nil, net.IP{0, 0, 0, 0}, nil
+	}
 	gateway := rw.getGateway()
-	if gateway == nil && len(rw.instance.Spec.Gateway) != 0 {
+	if len(rw.instance.Spec.GatewayHostname) != 0 {
+		var err error
+		if gateway, err = resolveGatewayHostname(params, rw); err != nil {
+			logger.Error(err, "Unable to resolve gateway hostname", "GatewayHostname", rw.instance.Spec.GatewayHostname)
+			return gatewayResolveError, nil, err
+		}
+		logger.Info("Gateway hostname resolved", "GatewayHostname", rw.instance.Spec.GatewayHostname, "Gateway", gateway)
+	} else if gateway == nil && len(rw.instance.Spec.Gateway) != 0 && !rw.isAutoGateway() {
 		logger.Error(errors.New("Invalid gateway found in Spec"), rw.instance.Spec.Gateway)
 		return invalidGatewayError, nil, nil
+	} else if rw.usesDefaultGateway(params.options.DefaultGateway) {
+		gateway = params.options.DefaultGateway
+		logger.Info("Using the default gateway", "Gateway", gateway)
 	}
 	if gateway != nil {
-		extraGw, err := params.options.GetGw(gateway)
+		extraGw, err := params.options.GatewayResolver.ResolveGateway(gateway)
 		if err != nil {
 			logger.Error(err, "")
 			return routeGetError, nil, err
@@ -309,7 +957,7 @@ func selectGateway(params reconcileImplParams, rw routeWrapper, logger types.Log
 			return gatewayNotDirectlyRoutableError, gateway, nil
 		}
 	} else {
-		defaultGateway, err := params.options.GetGw(params.options.FallbackIPForGwSelection)
+		defaultGateway, err := params.options.GatewayResolver.ResolveGateway(params.options.FallbackIPForGwSelection)
 		if err != nil {
 			logger.Error(err, "")
 			return routeGetError, nil, err
@@ -320,6 +968,34 @@ func selectGateway(params reconcileImplParams, rw routeWrapper, logger types.Log
 	return nil, gateway, nil
 }
 
+//resolveGatewayHostname picks the lowest address of the subnet's family, so every node selects the same one
+func resolveGatewayHostname(params reconcileImplParams, rw routeWrapper) (net.IP, error) {
+	_, subnet, err := net.ParseCIDR(rw.primarySubnet())
+	if err != nil {
+		return nil, err
+	}
+	ips, err := params.options.LookupIP(rw.instance.Spec.GatewayHostname)
+	if err != nil {
+		return nil, err
+	}
+	var selected net.IP
+	for _, ip := range ips {
+		if (ip.To4() == nil) != (subnet.IP.To4() == nil) {
+			continue
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		if selected == nil || bytes.Compare(ip, selected) < 0 {
+			selected = ip
+		}
+	}
+	if selected == nil {
+		return nil, fmt.Errorf("No address found for %s in the family of the subnet", rw.instance.Spec.GatewayHostname)
+	}
+	return selected, nil
+}
+
 func validateNodeBySelector(params reconcileImplParams, rw *routeWrapper, logger types.Logger) (*reconcile.Result, error) {
 	nodes := &corev1.NodeList{}
 	selector := labels.NewSelector()
@@ -353,16 +1029,23 @@ func validateNodeBySelector(params reconcileImplParams, rw *routeWrapper, logger
 	return nil, nil
 }
 
-func deleteOperation(params reconcileImplParams, rw *routeWrapper, logger types.Logger) (*reconcile.Result, error) {
+func deleteOperation(params reconcileImplParams, rw *routeWrapper, subnets []string, tables []int, logger types.Logger) (*reconcile.Result, error) {
 	logger.Info("Deregistering route")
+	metrics.SetConflicting(params.request.Name, false)
 	err := params.options.RouteManager.DeRegisterRoute(params.request.Name)
 	if err != nil && err != routemanager.ErrNotFound {
 		logger.Error(err, "Unable to deregister route")
 		return deRegisterError, err
 	}
+	if err := deRegisterSubnets(params, subnets, logger); err != nil {
+		return deRegisterError, err
+	}
+	if err := deRegisterTables(params, tables, logger); err != nil {
+		return deRegisterError, err
+	}
 
 	logger.Info("Deleted status for StaticRoute", "status", rw.instance.Status)
-	err = params.client.Status().Update(context.Background(), rw.instance)
+	err = updateNodeStatus(params, rw, params.options.Hostname)
 	if err != nil {
 		logger.Error(err, "Unable to update status of CR")
 		return delStatusUpdateError, err
@@ -388,25 +1071,888 @@ func addOperation(params reconcileImplParams, rw *routeWrapper, gateway net.IP,
 			return setFinalizerError, err
 		}
 	}
+	if len(rw.instance.Spec.Subnet) == 0 {
+		// Only the subnets list is given, see syncListedSubnets
+		return finished, nil
+	}
 	if !params.options.RouteManager.IsRegistered(params.request.Name) {
 		/*  Here comes the ADD logic
 		    This also runs if the CR was asked for deletion, but the operator did not run meanwhile.
 			In this case the route is still programmed to the kernel, so we register the route here
 			in order to successfully deregister and remove it from the kernel below */
-		_, ipnet, err := net.ParseCIDR(rw.instance.Spec.Subnet)
+		if len(rw.instance.Spec.Group) != 0 {
+			if res, err := registerRouteGroup(params, rw, gateway, table, logger); res != nil {
+				return res, err
+			}
+		} else if res, err := registerRoute(params, rw, gateway, table, logger); res != nil {
+			return res, err
+		}
+	} else if params.options.ReconcileInterval > 0 {
+		// Periodic reconciliation is enabled, repair the route if it was removed or changed by someone else
+		repair, err := params.options.RouteManager.VerifyRoute(params.request.Name)
 		if err != nil {
-			logger.Error(err, "Unable to convert the subnet into IP range and mask")
-			return parseSubnetError, nil
+			logger.Error(err, "Unable to verify route")
+			return verifyRouteError, err
+		}
+		reportRepair(params, rw, repair, gateway, logger)
+	}
+	return finished, nil
+}
+
+/* applyReportedRoutes gives the routes the node reported as applied to the RouteManager in a batch per install priority,
+   the higher priority first. It runs before the first reconcile, so the routes are back quickly after a restart, and the reconciles
+   find them registered. The failing routes are left to their reconcile, which reports the error in the status. */
+func applyReportedRoutes(params reconcileImplParams, logger types.Logger) {
+	routes := &iksv1.StaticRouteList{}
+	if err := params.client.List(context.Background(), routes); err != nil {
+		logger.Error(err, "Failed to List StaticRoute CRs")
+		return
+	}
+	batches := map[int]map[string]routemanager.Route{}
+	for i := range routes.Items {
+		rw := routeWrapper{instance: &routes.Items[i]}
+		if !rw.isManagedBy(params.options.OperatorID) || rw.instance.GetDeletionTimestamp() != nil || rw.instance.Spec.EnsureAbsent || rw.instance.Spec.Disabled || len(rw.instance.Spec.RequireInterfaceUp) != 0 || rw.isPaused() {
+			continue
+		}
+		if err := resolveNetworkGroup(params.client, &rw); err != nil {
+			continue
+		}
+		if expiresAt := rw.expiresAt(); expiresAt != nil && !time.Now().Before(*expiresAt) {
+			continue
 		}
-		logger.Info("Registering route")
+		priority := rw.instance.Spec.InstallPriority
+		for name, route := range rw.appliedRoutes(params.options.Hostname, params.options.Table) {
+			if batches[priority] == nil {
+				batches[priority] = map[string]routemanager.Route{}
+			}
+			batches[priority][name] = route
+		}
+	}
+	priorities := []int{}
+	for priority := range batches {
+		priorities = append(priorities, priority)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(priorities)))
+	for _, priority := range priorities {
+		logger.Info("Applying the routes reported by the node", "Count", len(batches[priority]), "InstallPriority", priority)
+		for name, err := range params.options.RouteManager.ApplyRoutes(batches[priority]) {
+			logger.Error(err, "Unable to apply route, leaving it to the reconcile", "Route", name)
+		}
+	}
+}
 
-		err = params.options.RouteManager.RegisterRoute(params.request.Name, routemanager.Route{Dst: *ipnet, Gw: gateway, Table: table})
+//withdrawOperation removes the routes of the CR from the node, but keeps the finalizer and the status entry. Returns nil result on success.
+func withdrawOperation(params reconcileImplParams, rw *routeWrapper, subnets []string, tables []int, gateway net.IP, table int, logger types.Logger) (*reconcile.Result, error) {
+	if err := deRegisterSubnets(params, subnets, logger); err != nil {
+		return deRegisterError, err
+	}
+	if err := deRegisterTables(params, tables, logger); err != nil {
+		return deRegisterError, err
+	}
+	if len(rw.instance.Spec.Subnet) == 0 {
+		return nil, nil
+	}
+	if !params.options.RouteManager.IsRegistered(params.request.Name) {
+		if !rw.isApplied(params.options.Hostname) {
+			return nil, nil
+		}
+		// The route may be still programmed to the kernel by a previous run, it has to be registered to remove it
+		if res, err := registerRoute(params, rw, gateway, table, logger); res != nil {
+			return res, err
+		}
+	}
+	logger.Info("Deregistering withdrawn route")
+	if err := params.options.RouteManager.DeRegisterRoute(params.request.Name); err != nil && err != routemanager.ErrNotFound {
+		logger.Error(err, "Unable to deregister route")
+		return deRegisterError, err
+	}
+	return nil, nil
+}
+
+//ensureAbsentOperation drops the own routes of the CR, then removes every matching route from the table. Returns the number of removed routes.
+func ensureAbsentOperation(params reconcileImplParams, rw *routeWrapper, subnets []string, tables []int, logger types.Logger) (int, error) {
+	if err := deRegisterOwnRoutes(params, subnets, tables, logger); err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, subnet := range append([]string{rw.instance.Spec.Subnet}, rw.listedSubnets()...) {
+		if len(subnet) == 0 || isSubnetProtected(subnet, params.options.ProtectedSubnets, params.options.ProtectedSubnetExceptions) {
+			continue
+		}
+		route, err := rw.toSubnetRoute(subnet, rw.getGateway(), params.options.Table)
 		if err != nil {
-			logger.Error(err, "Unable to register route")
-			return registerRouteError, err
+			logger.Error(err, "Unable to convert the subnet", "Subnet", subnet)
+			return removed, err
+		}
+		count, err := params.options.RouteManager.EnsureAbsent(route)
+		removed += count
+		if err != nil {
+			logger.Error(err, "Unable to remove route", "Subnet", subnet)
+			return removed, err
+		}
+		if count > 0 {
+			logger.Info("Removed route which must be absent", "Subnet", subnet, "Count", count)
+			recordEvent(params, rw.instance, corev1.EventTypeWarning, "RouteRemoved", "Removed %d route(s) to %s from node %s", count, subnet, params.options.Hostname)
 		}
 	}
-	return finished, nil
+	return removed, nil
+}
+
+//reportRepair logs what VerifyRoute repaired, a restored gateway is an event too, because someone keeps changing the node
+func reportRepair(params reconcileImplParams, rw *routeWrapper, repair routemanager.Repair, gateway net.IP, logger types.Logger, keysAndValues ...interface{}) {
+	switch repair {
+	case routemanager.RepairRecreated:
+		logger.Info("Route was missing from the kernel, created again", keysAndValues...)
+	case routemanager.RepairGatewayRestored:
+		logger.Info("Gateway of the route was changed in the kernel, restored", append(keysAndValues, "Gateway", gateway.String())...)
+		recordEvent(params, rw.instance, corev1.EventTypeNormal, "DriftCorrected", "Gateway of the route restored to %s on node %s", gateway, params.options.Hostname)
+	}
+}
+
+func recordEvent(params reconcileImplParams, instance *iksv1.StaticRoute, eventType, reason, messageFmt string, args ...interface{}) {
+	if params.recorder == nil {
+		return
+	}
+	// The description tells the reader of kubectl describe why the route exists
+	if len(instance.Spec.Description) != 0 {
+		messageFmt += " (%s)"
+		args = append(args, instance.Spec.Description)
+	}
+	// The owner tells which higher level resource generated the route
+	if owner := (&routeWrapper{instance: instance}).owner(); len(owner) != 0 {
+		messageFmt += " (owned by %s)"
+		args = append(args, owner)
+	}
+	params.recorder.Eventf(instance, eventType, reason, messageFmt, args...)
+}
+
+//watchedConfigMaps returns the names of the ConfigMaps which affect every route
+func watchedConfigMaps(options ManagerOptions) map[k8stypes.NamespacedName]bool {
+	configMaps := map[k8stypes.NamespacedName]bool{}
+	for _, configMap := range []k8stypes.NamespacedName{options.KillSwitch, options.ProtectedSubnetsConfigMap} {
+		if len(configMap.Name) != 0 {
+			configMaps[configMap] = true
+		}
+	}
+	return configMaps
+}
+
+/* isPending tells whether the route failed, because the network of its gateway is not reachable yet, ie. the link is still coming up during the boot of the node.
+   Such a route is pending, it is retried with the backoff of the controller until the network becomes reachable. */
+func isPending(params reconcileImplParams, err error) bool {
+	return err != nil && !params.options.FailOnUnreachable && errors.Is(err, syscall.ENETUNREACH)
+}
+
+//resolveNetworkGroup fetches the subnets of the NetworkGroup the CR refers to, which are routed like the subnets list
+func resolveNetworkGroup(c reconcileImplClient, rw *routeWrapper) error {
+	if len(rw.instance.Spec.NetworkGroup) == 0 {
+		return nil
+	}
+	group := &iksv1.NetworkGroup{}
+	if err := c.Get(context.Background(), k8stypes.NamespacedName{Name: rw.instance.Spec.NetworkGroup}, group); err != nil {
+		return fmt.Errorf("Unable to get NetworkGroup %s: %w", rw.instance.Spec.NetworkGroup, err)
+	}
+	rw.groupSubnets = group.Spec.Subnets
+	return nil
+}
+
+//protectedSubnets returns the protected subnets given by the environment together with the ones of the protected subnets ConfigMap, a missing ConfigMap protects nothing further
+func protectedSubnets(params reconcileImplParams) ([]*net.IPNet, error) {
+	if len(params.options.ProtectedSubnetsConfigMap.Name) == 0 {
+		return params.options.ProtectedSubnets, nil
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := params.client.Get(context.Background(), params.options.ProtectedSubnetsConfigMap, configMap); err != nil {
+		if kerrors.IsNotFound(err) {
+			return params.options.ProtectedSubnets, nil
+		}
+		return nil, err
+	}
+	keys := make([]string, 0, len(configMap.Data))
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	protecteds := append([]*net.IPNet{}, params.options.ProtectedSubnets...)
+	for _, key := range keys {
+		for _, subnet := range strings.Split(configMap.Data[key], ",") {
+			if subnet = strings.TrimSpace(subnet); len(subnet) == 0 {
+				continue
+			}
+			_, protected, err := net.ParseCIDR(subnet)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid protected subnet '%s=%s' in ConfigMap %s", key, subnet, params.options.ProtectedSubnetsConfigMap.String())
+			}
+			protecteds = append(protecteds, protected)
+		}
+	}
+	return protecteds, nil
+}
+
+//isKillSwitchEngaged reads the state of the kill switch ConfigMap, a missing ConfigMap is released
+func isKillSwitchEngaged(params reconcileImplParams) (bool, error) {
+	if len(params.options.KillSwitch.Name) == 0 {
+		return false, nil
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := params.client.Get(context.Background(), params.options.KillSwitch, configMap); err != nil {
+		if !kerrors.IsNotFound(err) {
+			return false, err
+		}
+	}
+	engaged := configMap.Data[KillSwitchKey] == KillSwitchDisabled
+	metrics.SetKillSwitch(engaged)
+	return engaged, nil
+}
+
+//isGatewayDegraded tells whether the RouteManager found the gateway of any route of the CR unreachable
+func isGatewayDegraded(params reconcileImplParams, rw *routeWrapper) bool {
+	if len(rw.instance.Spec.Subnet) != 0 && params.options.RouteManager.IsDegraded(params.request.Name) {
+		return true
+	}
+	for _, subnet := range rw.listedSubnets() {
+		if params.options.RouteManager.IsDegraded(subnetRouteName(params.request.Name, subnet)) {
+			return true
+		}
+	}
+	return false
+}
+
+//mergedNexthops returns the effective nexthops of the multipath route the route of the CR is merged into, nil if it is not merged
+func mergedNexthops(params reconcileImplParams, rw *routeWrapper) []iksv1.StaticRouteNexthopStatus {
+	if len(rw.instance.Spec.Subnet) == 0 {
+		return nil
+	}
+	var statuses []iksv1.StaticRouteNexthopStatus
+	for _, nexthop := range params.options.RouteManager.Nexthops(params.request.Name) {
+		statuses = append(statuses, iksv1.StaticRouteNexthopStatus{Gateway: nexthop.Gw.String(), Weight: nexthop.Weight})
+	}
+	return statuses
+}
+
+//routeManagerWatcher turns the gateway and link state changes found by the RouteManager into reconcile requests
+type routeManagerWatcher struct {
+	events chan<- event.GenericEvent
+	client reconcileImplClient
+}
+
+//RouteDeleted is not needed, only the gateway and link state changes are watched
+func (w routeManagerWatcher) RouteDeleted(routemanager.Route) {
+}
+
+func (w routeManagerWatcher) GatewayStateChanged(name string, degraded bool) {
+	// Subnet routes are named after their CR, see subnetRouteName
+	route := &iksv1.StaticRoute{ObjectMeta: metav1.ObjectMeta{Name: strings.SplitN(name, "/", 2)[0]}}
+	// The event loop of the RouteManager must not wait for the controller
+	go func() {
+		w.events <- event.GenericEvent{Meta: route, Object: route}
+	}()
+}
+
+//LinkStateChanged requests the reconciliation of the StaticRoutes which require the link to be up
+func (w routeManagerWatcher) LinkStateChanged(name string, up bool) {
+	go w.requestReconcile(func(route *iksv1.StaticRoute) bool {
+		return route.Spec.RequireInterfaceUp == name
+	})
+}
+
+//DefaultRouteChanged requests the reconciliation of the StaticRoutes with automatic gateway, so they follow the new one
+func (w routeManagerWatcher) DefaultRouteChanged() {
+	go w.requestReconcile(func(route *iksv1.StaticRoute) bool {
+		return route.Spec.Gateway == iksv1.GatewayAuto
+	})
+}
+
+func (w routeManagerWatcher) requestReconcile(selected func(*iksv1.StaticRoute) bool) {
+	routes := &iksv1.StaticRouteList{}
+	if err := w.client.List(context.Background(), routes); err != nil {
+		log.Error(err, "Failed to List StaticRoute CRs")
+		return
+	}
+	for i := range routes.Items {
+		if route := &routes.Items[i]; selected(route) {
+			w.events <- event.GenericEvent{Meta: route, Object: route}
+		}
+	}
+}
+
+//deRegisterOwnRoutes drops the route, its duplicates in the tables and the subnet routes of the CR from the RouteManager, the unregistered ones are skipped
+func deRegisterOwnRoutes(params reconcileImplParams, subnets []string, tables []int, logger types.Logger) error {
+	if err := params.options.RouteManager.DeRegisterRoute(params.request.Name); err != nil && err != routemanager.ErrNotFound {
+		logger.Error(err, "Unable to deregister route")
+		return err
+	}
+	if err := deRegisterTables(params, tables, logger); err != nil {
+		return err
+	}
+	return deRegisterSubnets(params, subnets, logger)
+}
+
+/* updateNodeStatus writes the entry of the node into the status of the CR, without touching the entries of the other nodes.
+   If the patch is rejected because the status was changed meanwhile, the CR is read again and the entry is patched into its
+   latest status. The CR of the wrapper is replaced by the written one. */
+func updateNodeStatus(params reconcileImplParams, rw *routeWrapper, hostname string) error {
+	var entry *iksv1.StaticRouteNodeStatus
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			entry = rw.instance.Status.NodeStatus[i].DeepCopy()
+		}
+	}
+	var err error
+	for attempt := 0; attempt < statusPatchAttempts; attempt++ {
+		if attempt != 0 {
+			if err = params.client.Get(context.Background(), k8stypes.NamespacedName{Name: rw.instance.GetName(), Namespace: rw.instance.GetNamespace()}, rw.instance); err != nil {
+				return err
+			}
+			rw.readStatusHosts()
+			_ = rw.removeFromStatus(hostname)
+			if entry != nil {
+				rw.instance.Status.NodeStatus = append(rw.instance.Status.NodeStatus, *entry)
+			}
+		}
+		var patch client.Patch
+		if patch, err = rw.nodeStatusPatch(hostname); err != nil || patch == nil {
+			return err
+		}
+		if err = params.client.Status().Patch(context.Background(), rw.instance, patch); err == nil {
+			rw.readStatusHosts()
+			return nil
+		}
+		// A failed test of the JSON patch is reported as invalid by the API server
+		if !kerrors.IsConflict(err) && !kerrors.IsInvalid(err) {
+			return err
+		}
+	}
+	return err
+}
+
+/* reasonCodes maps the results of the reconciliation to the stable codes of the node status. Every result must be listed,
+   the ones ending the reconciliation without a status entry are listed as Applied. */
+var reasonCodes = map[*reconcile.Result]string{
+	crNotFound:        iksv1.ReasonCodeApplied,
+	nodeNotFound:      iksv1.ReasonCodeApplied,
+	overlapsProtected: iksv1.ReasonCodeProtectedSubnet,
+	wrongSourceError:  iksv1.ReasonCodeInvalidSpec,
+	invalidTosError:   iksv1.ReasonCodeInvalidSpec,
+	invalidFwMarkErr:  iksv1.ReasonCodeInvalidSpec,
+	ambiguousGateway:  iksv1.ReasonCodeInvalidSpec,
+	noSubnetError:     iksv1.ReasonCodeInvalidSpec,
+	alreadyDeleted:    iksv1.ReasonCodeApplied,
+	deletionFinished:  iksv1.ReasonCodeApplied,
+	updateFinished:    iksv1.ReasonCodeApplied,
+	finished:          iksv1.ReasonCodeApplied,
+	routeExpired:      iksv1.ReasonCodeDisabled,
+	routeDrained:      iksv1.ReasonCodeDisabled,
+	routeConflicting:  iksv1.ReasonCodeConflicting,
+	routeDisabled:     iksv1.ReasonCodeDisabled,
+	routeWaiting:      iksv1.ReasonCodePending,
+	routeKilled:       iksv1.ReasonCodeDisabled,
+	routePaused:       iksv1.ReasonCodePaused,
+	routePending:      iksv1.ReasonCodePending,
+	otherOperator:     iksv1.ReasonCodeApplied,
+
+	crGetError:                      iksv1.ReasonCodeReconcileError,
+	wrongSelectorErr:                iksv1.ReasonCodeInvalidSpec,
+	nodeGetError:                    iksv1.ReasonCodeReconcileError,
+	deRegisterError:                 iksv1.ReasonCodeNetlinkError,
+	delStatusUpdateError:            iksv1.ReasonCodeReconcileError,
+	emptyFinalizerError:             iksv1.ReasonCodeReconcileError,
+	setFinalizerError:               iksv1.ReasonCodeReconcileError,
+	invalidGatewayError:             iksv1.ReasonCodeInvalidSpec,
+	gatewayNotDirectlyRoutableError: iksv1.ReasonCodeGatewayUnreachable,
+	routeGetError:                   iksv1.ReasonCodeNetlinkError,
+	gatewayResolveError:             iksv1.ReasonCodeGatewayUnreachable,
+	parseSubnetError:                iksv1.ReasonCodeInvalidSpec,
+	registerRouteError:              iksv1.ReasonCodeNetlinkError,
+	invalidRouteError:               iksv1.ReasonCodeInvalidSpec,
+	invalidOnLinkError:              iksv1.ReasonCodeInvalidSpec,
+	registerSubnetsError:            iksv1.ReasonCodeNetlinkError,
+	registerTablesError:             iksv1.ReasonCodeNetlinkError,
+	verifyRouteError:                iksv1.ReasonCodeNetlinkError,
+	flushTableError:                 iksv1.ReasonCodeNetlinkError,
+	ensureAbsentError:               iksv1.ReasonCodeNetlinkError,
+	conflictCheckError:              iksv1.ReasonCodeReconcileError,
+	failoverCheckError:              iksv1.ReasonCodeReconcileError,
+	killSwitchGetError:              iksv1.ReasonCodeReconcileError,
+	protectedSubnetsGetError:        iksv1.ReasonCodeReconcileError,
+	networkGroupGetError:            iksv1.ReasonCodeReconcileError,
+	groupListError:                  iksv1.ReasonCodeReconcileError,
+	groupMemberError:                iksv1.ReasonCodeInvalidSpec,
+	addStatusUpdateError:            iksv1.ReasonCodeReconcileError,
+	reconcilePanicError:             iksv1.ReasonCodeReconcileError,
+}
+
+/* reasonCode maps the outcome of the reconciliation to the stable code of the node status. The reason is more specific, so it decides first,
+   then the result. An error of an unknown result is a reconcile error, it is never reported as pending. */
+func reasonCode(res *reconcile.Result, reason string, serr error) string {
+	switch reason {
+	case iksv1.ReasonConflicting:
+		return iksv1.ReasonCodeConflicting
+	case iksv1.ReasonDisabled, iksv1.ReasonExpired, iksv1.ReasonDrained, iksv1.ReasonKillSwitch:
+		return iksv1.ReasonCodeDisabled
+	case iksv1.ReasonPaused:
+		return iksv1.ReasonCodePaused
+	case iksv1.ReasonPending, iksv1.ReasonWaitingForInterface, iksv1.ReasonInterfaceMissing, iksv1.ReasonVrfNotFound:
+		return iksv1.ReasonCodePending
+	case iksv1.ReasonDegraded:
+		return iksv1.ReasonCodeGatewayUnreachable
+	case iksv1.ReasonProtectedSubnetRejected:
+		return iksv1.ReasonCodeProtectedSubnet
+	case iksv1.ReasonInvalidRoute:
+		return iksv1.ReasonCodeInvalidSpec
+	case iksv1.ReasonNetlinkTimeout:
+		return iksv1.ReasonCodeNetlinkError
+	}
+	if code, found := reasonCodes[res]; found {
+		return code
+	}
+	if serr != nil {
+		return iksv1.ReasonCodeReconcileError
+	}
+	return iksv1.ReasonCodeApplied
+}
+
+/* pauseOperation freezes the route on the node, nothing is added, removed or corrected until the pause annotation is removed.
+   Only the reason of the node status is changed, the rest of the status still describes the route as it was left. */
+func pauseOperation(params reconcileImplParams, rw *routeWrapper, logger types.Logger) (*reconcile.Result, error) {
+	if !rw.alreadyInStatus(params.options.Hostname) || rw.getStatusReason(params.options.Hostname) == iksv1.ReasonPaused {
+		return routePaused, nil
+	}
+	logger.Info("Route is paused, reconciliation is suspended")
+	rw.setStatusReason(params.options.Hostname, iksv1.ReasonPaused)
+	rw.setReasonCode(params.options.Hostname, iksv1.ReasonCodePaused)
+	if err := updateNodeStatus(params, rw, params.options.Hostname); err != nil {
+		logger.Error(err, "failed to update the staticroute")
+		return addStatusUpdateError, err
+	}
+	recordEvent(params, rw.instance, corev1.EventTypeNormal, "RoutePaused", "Reconciliation of the route paused on node %s", params.options.Hostname)
+	return routePaused, nil
+}
+
+/* findOlderConflict returns the name of the oldest StaticRoute applied to the node, which routes a destination of the CR with the same tos.
+   Only the oldest one is installed, so the reconciles of the CRs do not fight for the kernel route. Returns empty string if there is none.
+   With ECMPMerge there is no conflict, the RouteManager merges the gateways of the CRs into a multipath route. */
+func findOlderConflict(params reconcileImplParams, rw *routeWrapper, logger types.Logger) (string, error) {
+	if params.options.ECMPMerge {
+		return "", nil
+	}
+	destinations := rw.destinations()
+	routes := &iksv1.StaticRouteList{}
+	if err := params.client.List(context.Background(), routes); err != nil {
+		logger.Error(err, "Failed to List StaticRoute CRs")
+		return "", err
+	}
+	var winner *routeWrapper
+	for i := range routes.Items {
+		other := &routeWrapper{instance: &routes.Items[i]}
+		if other.instance.GetName() == params.request.Name || !other.isManagedBy(params.options.OperatorID) || other.instance.GetDeletionTimestamp() != nil || other.instance.Spec.EnsureAbsent || other.instance.Spec.Disabled || !other.isOlderThan(rw) {
+			continue
+		}
+		if winner != nil && !other.isOlderThan(winner) {
+			continue
+		}
+		// The members of a failover group don't conflict, they are installed with distinct metrics
+		if len(rw.instance.Spec.FailoverGroup) != 0 && other.instance.Spec.FailoverGroup == rw.instance.Spec.FailoverGroup {
+			continue
+		}
+		if shared, err := sharesDestinationOnNode(params, other, destinations, logger); err != nil {
+			return "", err
+		} else if !shared {
+			continue
+		}
+		winner = other
+	}
+	if winner == nil {
+		return "", nil
+	}
+	return winner.instance.GetName(), nil
+}
+
+/* failoverMetric returns the metric of the routes of the CR and the name of the preferred member of its failover group. The members
+   routing a destination of the CR on the node are ordered by their creation: the oldest one gets failoverBaseMetric, each further
+   one the next metric, so the kernel prefers them in the order of creation and falls back to the next one when a member is removed. */
+func failoverMetric(params reconcileImplParams, rw *routeWrapper, logger types.Logger) (int, string, error) {
+	destinations := rw.destinations()
+	routes := &iksv1.StaticRouteList{}
+	if err := params.client.List(context.Background(), routes); err != nil {
+		logger.Error(err, "Failed to List StaticRoute CRs")
+		return 0, "", err
+	}
+	older := 0
+	preferred := rw
+	for i := range routes.Items {
+		other := &routeWrapper{instance: &routes.Items[i]}
+		if other.instance.GetName() == params.request.Name || other.instance.Spec.FailoverGroup != rw.instance.Spec.FailoverGroup || !other.isManagedBy(params.options.OperatorID) || other.instance.GetDeletionTimestamp() != nil || other.instance.Spec.EnsureAbsent || other.instance.Spec.Disabled || !other.isOlderThan(rw) {
+			continue
+		}
+		if shared, err := sharesDestinationOnNode(params, other, destinations, logger); err != nil {
+			return 0, "", err
+		} else if !shared {
+			continue
+		}
+		older++
+		if other.isOlderThan(preferred) {
+			preferred = other
+		}
+	}
+	return failoverBaseMetric + older, preferred.instance.GetName(), nil
+}
+
+//sharesDestinationOnNode tells whether the other CR routes any of the destinations, and it is applied to the node by its selectors
+func sharesDestinationOnNode(params reconcileImplParams, other *routeWrapper, destinations map[string]bool, logger types.Logger) (bool, error) {
+	// The other CR fails on its missing NetworkGroup, only its own subnets are checked
+	if err := resolveNetworkGroup(params.client, other); err != nil {
+		logger.Info("Unable to resolve the NetworkGroup of the other StaticRoute", "StaticRoute", other.instance.GetName(), "Error", err.Error())
+	}
+	shared := false
+	for destination := range other.destinations() {
+		shared = shared || destinations[destination]
+	}
+	if !shared {
+		return false, nil
+	}
+	if len(other.instance.Spec.Selectors) > 0 {
+		if res, err := validateNodeBySelector(params, other, logger); res == nodeNotFound || res == wrongSelectorErr {
+			return false, nil
+		} else if res != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+/* dumpRoutesOperation lists the routes of our protocol on the node for diagnostics.
+   The dump is paginated to keep the status small, failures are reported in the status. */
+func dumpRoutesOperation(params reconcileImplParams, rw *routeWrapper, logger types.Logger) *iksv1.StaticRouteDumpStatus {
+	dump := &iksv1.StaticRouteDumpStatus{Token: rw.instance.GetAnnotations()[iksv1.DumpRoutesAnnotation], Format: rw.instance.GetAnnotations()[iksv1.DumpRoutesFormatAnnotation]}
+	page, err := rw.dumpPage()
+	if err != nil || page < 0 {
+		dump.Error = fmt.Sprintf("Invalid page '%s'", rw.instance.GetAnnotations()[iksv1.DumpRoutesPageAnnotation])
+		return dump
+	}
+	dump.Page = page
+	logger.Info("Dumping routes", "Token", dump.Token, "Page", page, "Format", dump.Format)
+	var routes []string
+	switch dump.Format {
+	case "":
+		var listed []routemanager.Route
+		listed, err = params.options.RouteManager.ListRoutes()
+		for _, route := range listed {
+			routes = append(routes, route.String())
+		}
+	case iksv1.DumpFormatIPRoute2:
+		routes, err = params.options.RouteManager.ExportRoutes()
+	default:
+		dump.Error = fmt.Sprintf("Invalid format '%s'", dump.Format)
+		return dump
+	}
+	if err != nil {
+		logger.Error(err, "Unable to list routes")
+		dump.Error = err.Error()
+		return dump
+	}
+	dump.Total = len(routes)
+	dump.Pages = (len(routes) + dumpPageSize - 1) / dumpPageSize
+	for i := page * dumpPageSize; i < len(routes) && i < (page+1)*dumpPageSize; i++ {
+		dump.Routes = append(dump.Routes, routes[i])
+	}
+	return dump
+}
+
+/* flushTableOperation removes our routes from the target table and reinstalls the registered ones.
+   A refused flush is not retried, it is reported in the status. */
+func flushTableOperation(params reconcileImplParams, rw *routeWrapper, logger types.Logger) (*iksv1.StaticRouteFlushStatus, error) {
+	flush := &iksv1.StaticRouteFlushStatus{Token: rw.instance.GetAnnotations()[iksv1.FlushTableAnnotation]}
+	logger.Info("Flushing routing table", "Table", params.options.Table, "Token", flush.Token)
+	removed, err := params.options.RouteManager.FlushTable(params.options.Table)
+	if err == routemanager.ErrTableProtected {
+		logger.Info("Error: routing table can not be flushed", "Table", params.options.Table)
+		flush.Error = err.Error()
+		return flush, nil
+	} else if err != nil {
+		logger.Error(err, "Unable to flush routing table")
+		return nil, err
+	}
+	logger.Info("Routing table flushed", "Removed", removed)
+	flush.Removed = removed
+	return flush, nil
+}
+
+/* syncListedSubnets registers the routes of the new subnets of the list and deregisters the removed ones,
+   the unchanged ones are left alone. It returns the outcome of every listed subnet, or nil if the status
+   has to be kept, because a removed subnet could not be deregistered. */
+func syncListedSubnets(params reconcileImplParams, rw *routeWrapper, reported []string, gateway net.IP, table int, logger types.Logger) ([]iksv1.StaticRouteSubnetStatus, error) {
+	listed := rw.listedSubnets()
+	removed := []string{}
+	for _, subnet := range reported {
+		if !containsSubnet(listed, subnet) {
+			removed = append(removed, subnet)
+		}
+	}
+	if err := deRegisterSubnets(params, removed, logger); err != nil {
+		return nil, err
+	}
+
+	statuses := []iksv1.StaticRouteSubnetStatus{}
+	failed, unreachable := 0, 0
+	for _, subnet := range listed {
+		status := iksv1.StaticRouteSubnetStatus{Subnet: subnet}
+		name := subnetRouteName(params.request.Name, subnet)
+		status.ProtectedSubnetException = subnetException(subnet, params.options.ProtectedSubnets, params.options.ProtectedSubnetExceptions)
+		if isSubnetProtected(subnet, params.options.ProtectedSubnets, params.options.ProtectedSubnetExceptions) {
+			logger.Info("Error: subnet overlaps some protected", "Subnet", subnet)
+			status.Error = errSubnetProtected.Error()
+			// The subnet may have been protected after its route got installed
+			if err := deRegisterSubnets(params, []string{subnet}, logger); err != nil {
+				return nil, err
+			}
+		} else if !params.options.RouteManager.IsRegistered(name) {
+			route, err := rw.toSubnetRoute(subnet, gateway, table)
+			if err != nil {
+				logger.Error(err, "Unable to convert the subnet into IP range and mask", "Subnet", subnet)
+				status.Error = err.Error()
+			} else if err = params.options.RouteManager.RegisterRoute(name, route); err != nil {
+				logger.Error(err, "Unable to register route", "Subnet", subnet)
+				status.Error = err.Error()
+				failed++
+				if errors.Is(err, syscall.ENETUNREACH) {
+					unreachable++
+				}
+			}
+		} else if params.options.ReconcileInterval > 0 {
+			if repair, err := params.options.RouteManager.VerifyRoute(name); err != nil {
+				logger.Error(err, "Unable to verify route", "Subnet", subnet)
+				status.Error = err.Error()
+				failed++
+			} else {
+				reportRepair(params, rw, repair, gateway, logger, "Subnet", subnet)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	if failed != 0 && failed == unreachable {
+		return statuses, fmt.Errorf("Unable to apply %d of %d subnets: %w", failed, len(listed), syscall.ENETUNREACH)
+	} else if failed != 0 {
+		return statuses, fmt.Errorf("Unable to apply %d of %d subnets", failed, len(listed))
+	}
+	return statuses, nil
+}
+
+//deRegisterSubnets removes the routes of the given listed subnets, the ones which are not registered are skipped
+func deRegisterSubnets(params reconcileImplParams, subnets []string, logger types.Logger) error {
+	for _, subnet := range subnets {
+		logger.Info("Deregistering route", "Subnet", subnet)
+		err := params.options.RouteManager.DeRegisterRoute(subnetRouteName(params.request.Name, subnet))
+		if err != nil && err != routemanager.ErrNotFound {
+			logger.Error(err, "Unable to deregister route", "Subnet", subnet)
+			return err
+		}
+	}
+	return nil
+}
+
+//subnetRouteName is the name of the route of a listed subnet in the RouteManager
+func subnetRouteName(name, subnet string) string {
+	return name + "/" + subnet
+}
+
+/* syncTables registers the duplicates of the route in the new tables of the list and deregisters the removed ones,
+   the unchanged ones are left alone. It returns the outcome of every listed table, or nil if the status
+   has to be kept, because a removed table could not be deregistered. */
+func syncTables(params reconcileImplParams, rw *routeWrapper, reported []int, gateway net.IP, logger types.Logger) ([]iksv1.StaticRouteTableStatus, error) {
+	listed := []int{}
+	if len(rw.instance.Spec.Subnet) != 0 {
+		// Only the route of subnet is duplicated
+		listed = rw.listedTables(params.options.Table)
+	}
+	removed := []int{}
+	for _, table := range reported {
+		if !containsTable(listed, table) {
+			removed = append(removed, table)
+		}
+	}
+	if err := deRegisterTables(params, removed, logger); err != nil {
+		return nil, err
+	}
+
+	statuses := []iksv1.StaticRouteTableStatus{}
+	failed := 0
+	for _, table := range listed {
+		status := iksv1.StaticRouteTableStatus{Table: table}
+		name := tableRouteName(params.request.Name, table)
+		if !isValidTable(table) {
+			logger.Info("Error: invalid table", "Table", table)
+			status.Error = errInvalidTable.Error()
+		} else if !params.options.RouteManager.IsRegistered(name) {
+			route, err := rw.toRoute(gateway, table)
+			// The policy rule selects the target table only, and the route of the target table is probed already
+			route.Rule, route.HealthCheck = nil, nil
+			if err != nil {
+				logger.Error(err, "Unable to convert the subnet into IP range and mask", "Table", table)
+				status.Error = err.Error()
+			} else if err = params.options.RouteManager.RegisterRoute(name, route); err != nil {
+				logger.Error(err, "Unable to register route", "Table", table)
+				status.Error = err.Error()
+				failed++
+			}
+		} else if params.options.ReconcileInterval > 0 {
+			if repair, err := params.options.RouteManager.VerifyRoute(name); err != nil {
+				logger.Error(err, "Unable to verify route", "Table", table)
+				status.Error = err.Error()
+				failed++
+			} else {
+				reportRepair(params, rw, repair, gateway, logger, "Table", table)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	if failed != 0 {
+		return statuses, fmt.Errorf("Unable to apply %d of %d tables", failed, len(listed))
+	}
+	return statuses, nil
+}
+
+//deRegisterTables removes the duplicates of the route from the given tables, the ones which are not registered are skipped
+func deRegisterTables(params reconcileImplParams, tables []int, logger types.Logger) error {
+	for _, table := range tables {
+		logger.Info("Deregistering route", "Table", table)
+		err := params.options.RouteManager.DeRegisterRoute(tableRouteName(params.request.Name, table))
+		if err != nil && err != routemanager.ErrNotFound {
+			logger.Error(err, "Unable to deregister route", "Table", table)
+			return err
+		}
+	}
+	return nil
+}
+
+//tableRouteName is the name of the duplicate of the route in a listed table in the RouteManager
+func tableRouteName(name string, table int) string {
+	return fmt.Sprintf("%s/table/%d", name, table)
+}
+
+func mergeTables(a, b []int) []int {
+	merged := append([]int{}, a...)
+	for _, table := range b {
+		if !containsTable(merged, table) {
+			merged = append(merged, table)
+		}
+	}
+	return merged
+}
+
+func containsTable(tables []int, table int) bool {
+	for _, t := range tables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeSubnets(a, b []string) []string {
+	merged := append([]string{}, a...)
+	for _, subnet := range b {
+		if !containsSubnet(merged, subnet) {
+			merged = append(merged, subnet)
+		}
+	}
+	return merged
+}
+
+func containsSubnet(subnets []string, subnet string) bool {
+	for _, s := range subnets {
+		if s == subnet {
+			return true
+		}
+	}
+	return false
+}
+
+func registerRoute(params reconcileImplParams, rw *routeWrapper, gateway net.IP, table int, logger types.Logger) (*reconcile.Result, error) {
+	route, err := rw.toRoute(gateway, table)
+	if err != nil {
+		logger.Error(err, "Unable to convert the subnet into IP range and mask")
+		return parseSubnetError, nil
+	}
+	logger.Info("Registering route")
+
+	err = params.options.RouteManager.RegisterRoute(params.request.Name, route)
+	if err != nil {
+		logger.Error(err, "Unable to register route")
+		return registerRouteError, err
+	}
+	return nil, nil
+}
+
+/* registerRouteGroup stages the routes of every group member which applies to the node
+   and registers them as a unit. If any of them fails, none of them stays on the node. */
+func registerRouteGroup(params reconcileImplParams, rw *routeWrapper, gateway net.IP, table int, logger types.Logger) (*reconcile.Result, error) {
+	group := rw.instance.Spec.Group
+	route, err := rw.toRoute(gateway, table)
+	if err != nil {
+		logger.Error(err, "Unable to convert the subnet into IP range and mask")
+		return parseSubnetError, nil
+	}
+	staged := map[string]routemanager.Route{params.request.Name: route}
+
+	routes := &iksv1.StaticRouteList{}
+	if err := params.client.List(context.Background(), routes); err != nil {
+		logger.Error(err, "Failed to List StaticRoute CRs")
+		return groupListError, err
+	}
+	for i := range routes.Items {
+		member := routeWrapper{instance: &routes.Items[i]}
+		name := member.instance.GetName()
+		if name == params.request.Name || !member.isManagedBy(params.options.OperatorID) || member.instance.Spec.Group != group || member.instance.GetDeletionTimestamp() != nil || member.instance.Spec.Disabled || len(member.instance.Spec.Subnet) == 0 {
+			continue
+		}
+		if expiresAt := member.expiresAt(); expiresAt != nil && !time.Now().Before(*expiresAt) {
+			continue
+		}
+		if link := member.instance.Spec.RequireInterfaceUp; len(link) != 0 && !params.options.RouteManager.IsLinkUp(link) {
+			continue
+		}
+		if member.isProtected(params.options.ProtectedSubnets, params.options.ProtectedSubnetExceptions) {
+			return groupMemberError, groupMemberErr(name, "overlaps with some protected subnet", nil)
+		}
+		if len(member.instance.Spec.Selectors) > 0 {
+			res, err := validateNodeBySelector(params, &member, logger)
+			if res == nodeNotFound {
+				continue
+			} else if res != nil {
+				return groupMemberError, groupMemberErr(name, "unable to validate node selector", err)
+			}
+		}
+		res, memberGateway, err := selectGateway(params, member, logger)
+		if res != nil {
+			return groupMemberError, groupMemberErr(name, "unable to select gateway", err)
+		}
+		memberRoute, err := member.toRoute(memberGateway, table)
+		if err != nil {
+			return groupMemberError, groupMemberErr(name, "invalid route", err)
+		}
+		if member.setFinalizer() {
+			logger.Info("Adding Finalizer for the group member", "Member", name)
+			if err := params.client.Update(context.Background(), member.instance); err != nil {
+				return groupMemberError, err
+			}
+		}
+		staged[name] = memberRoute
+	}
+
+	logger.Info("Registering route group", "Group", group, "Members", len(staged))
+	if err := params.options.RouteManager.RegisterRoutes(staged); err != nil {
+		logger.Error(err, "Unable to register route group")
+		return registerRouteError, err
+	}
+	return nil, nil
+}
+
+func groupMemberErr(name, msg string, err error) error {
+	if err != nil {
+		return fmt.Errorf("Group member %s: %s: %v", name, msg, err)
+	}
+	return fmt.Errorf("Group member %s: %s", name, msg)
 }
 
 func convertToOperator(operator metav1.LabelSelectorOperator) (selection.Operator, error) {
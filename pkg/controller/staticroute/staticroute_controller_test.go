@@ -19,17 +19,32 @@ package staticroute
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	iksv1 "github.com/IBM/staticroute-operator/pkg/apis/iks/v1"
 	"github.com/IBM/staticroute-operator/pkg/routemanager"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 func TestConvertTooperator(t *testing.T) {
@@ -120,6 +135,38 @@ func TestReconcileImplProtected(t *testing.T) {
 	}
 }
 
+func TestReconcileImplProtectedSubnetException(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Subnet = "10.0.0.0/24"
+	route.Spec.Subnets = []string{"10.2.0.0/24", "10.3.0.0/24"}
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	_, protected, _ := net.ParseCIDR("10.0.0.0/14")
+	_, exception, _ := net.ParseCIDR("10.0.0.0/24")
+	_, subnetException, _ := net.ParseCIDR("10.2.0.0/24")
+	params.options.ProtectedSubnets = []*net.IPNet{protected}
+	params.options.ProtectedSubnetExceptions = []*net.IPNet{exception, subnetException}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	expected := []iksv1.StaticRouteSubnetStatus{
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.2.0.0/24", ProtectedSubnetException: "10.2.0.0/24"},
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.3.0.0/24", Error: errSubnetProtected.Error()},
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].ProtectedSubnetException != "10.0.0.0/24" || !reflect.DeepEqual(instance.Status.NodeStatus[0].Subnets, expected) {
+		t.Errorf("Status must contain the exceptions: %+v", instance.Status.NodeStatus)
+	}
+}
+
 func TestReconcileImplNotDeleted(t *testing.T) {
 	route := newStaticRouteWithValues(true, false)
 	params, mockClient := getReconcileContextForAddFlow(route, true)
@@ -201,6 +248,209 @@ func TestReconcileImplNodeSelectorInvalid(t *testing.T) {
 	}
 }
 
+func TestReconcileImplNetlinkTimeoutReason(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	params.options.RouteManager = routeManagerMock{
+		registerRouteErr: fmt.Errorf("Unable to create route: %w", routemanager.ErrNetlinkTimeout),
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != registerRouteError {
+		t.Error("Result must be registerRouteError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil, so the reconcile is retried")
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != iksv1.ReasonNetlinkTimeout || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodeNetlinkError {
+		t.Errorf("Timeout must be reported as reason: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplUnreachablePendingUntilReachable(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	registered := false
+	unreachable := true
+	params.options.RouteManager = routeManagerMock{
+		isRegisteredCallback: func(string) bool {
+			return registered
+		},
+		registeredCallback: func(string, routemanager.Route) error {
+			if unreachable {
+				return syscall.ENETUNREACH
+			}
+			registered = true
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != routePending || !res.Requeue {
+		t.Error("Result must be routePending, so the reconcile is retried with backoff")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != iksv1.ReasonPending || instance.Status.NodeStatus[0].Error != syscall.ENETUNREACH.Error() || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodePending {
+		t.Errorf("Status must tell the pending route: %v", instance.Status.NodeStatus)
+	}
+
+	unreachable = false
+	res, err = reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	instance = &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || len(instance.Status.NodeStatus[0].Reason) != 0 || len(instance.Status.NodeStatus[0].Error) != 0 || instance.Status.NodeStatus[0].InstalledAt == nil {
+		t.Errorf("Status must tell the installed route: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplUnreachableSubnetsPending(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Subnet = ""
+	route.Spec.Subnets = []string{"10.1.0.0/16", "10.2.0.0/16"}
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			return fmt.Errorf("Unable to create route %s: %w", n, syscall.ENETUNREACH)
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != routePending {
+		t.Error("Result must be routePending")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != iksv1.ReasonPending || len(instance.Status.NodeStatus[0].Subnets) != 2 {
+		t.Errorf("Status must tell the pending subnets: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplUnreachableFails(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.FailOnUnreachable = true
+	params.options.RouteManager = routeManagerMock{
+		registerRouteErr: syscall.ENETUNREACH,
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != registerRouteError {
+		t.Error("Result must be registerRouteError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || len(instance.Status.NodeStatus[0].Reason) != 0 {
+		t.Errorf("Route must be failed without reason: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplInvalidRouteNotRetried(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registerRouteErr: &routemanager.RouteError{Class: routemanager.ErrInvalidRoute, Err: syscall.EINVAL},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != invalidRouteError || res.Requeue {
+		t.Error("Result must be invalidRouteError without requeue")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil, so the reconcile is not retried: %s", err.Error())
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != iksv1.ReasonInvalidRoute || instance.Status.NodeStatus[0].Error != syscall.EINVAL.Error() || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodeInvalidSpec {
+		t.Errorf("Status must tell the rejected route: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplInterfaceMissingReason(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registerRouteErr: fmt.Errorf("Unable to create route: %w", &routemanager.RouteError{Class: routemanager.ErrInterfaceMissing, Err: syscall.ENODEV}),
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != registerRouteError || err == nil {
+		t.Error("Result must be registerRouteError with error, so the reconcile is retried")
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != iksv1.ReasonInterfaceMissing {
+		t.Errorf("Missing interface must be reported as reason: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplVrf(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Vrf = "tenant"
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	var registered routemanager.Route
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(name string, r routemanager.Route) error {
+			registered = r
+			return fmt.Errorf("Unable to find VRF tenant: %w", routemanager.ErrVrfNotFound)
+		},
+	}
+
+	res, _ := reconcileImpl(*params)
+
+	if res != registerRouteError {
+		t.Error("Result must be registerRouteError")
+	}
+	if registered.Vrf != "tenant" {
+		t.Errorf("Route must be registered with the VRF: %v", registered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err := mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != iksv1.ReasonVrfNotFound || instance.Status.NodeStatus[0].State.Vrf != "tenant" || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodePending {
+		t.Errorf("Missing VRF must be reported in the status: %v", instance.Status.NodeStatus)
+	}
+}
+
 func TestReoncileImplUpdateStatus(t *testing.T) {
 	// Initialization
 	route := newStaticRouteWithValues(true, false)
@@ -350,7 +600,7 @@ func TestReconcileImplDeletedButCantDeleteStatus(t *testing.T) {
 		obj.(*iksv1.StaticRoute).SetDeletionTimestamp(&v1.Time{})
 	}
 	mockClient.statusWriteMock = statusWriterMock{
-		updateErr: errors.New("Couldn't update status"),
+		patchErr: errors.New("Couldn't patch status"),
 	}
 
 	res, err := reconcileImpl(*params)
@@ -429,7 +679,7 @@ func TestReconcileImplIsRegisteredButCantAddStatus(t *testing.T) {
 	params, mockClient := getReconcileContextForAddFlow(nil, true)
 	params.options.Hostname = "hostname2"
 	mockClient.statusWriteMock = statusWriterMock{
-		updateErr: errors.New("Couldn't update status"),
+		patchErr: errors.New("Couldn't patch status"),
 	}
 
 	res, err := reconcileImpl(*params)
@@ -442,6 +692,103 @@ func TestReconcileImplIsRegisteredButCantAddStatus(t *testing.T) {
 	}
 }
 
+func TestUpdateNodeStatusRetriesOnConflict(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Status.NodeStatus = append([]iksv1.StaticRouteNodeStatus{{Hostname: "other"}}, route.Status.NodeStatus...)
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	instance := &iksv1.StaticRoute{}
+	if err := mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	rw := routeWrapper{instance: instance}
+	rw.readStatusHosts()
+	rw.setStatusReason("hostname", iksv1.ReasonPaused)
+	patches := []string{}
+	mockClient.statusWriteMock = statusWriterMock{
+		patchCallback: func(obj runtime.Object, patch client.Patch) error {
+			data, _ := patch.Data(obj)
+			patches = append(patches, string(data))
+			if len(patches) == 1 {
+				// Another writer removes the entry before the one of this node meanwhile
+				other := &iksv1.StaticRoute{}
+				_ = mockClient.client.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, other)
+				other.Status.NodeStatus = other.Status.NodeStatus[1:]
+				_ = mockClient.client.Status().Update(context.Background(), other)
+				return kerrors.NewConflict(schema.GroupResource{Resource: "staticroutes"}, "CR", errors.New("the object has been modified"))
+			}
+			return mockClient.client.Status().Patch(context.Background(), obj, patch)
+		},
+	}
+
+	err := updateNodeStatus(*params, &rw, "hostname")
+
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if len(patches) != 2 || !strings.Contains(patches[0], "/status/nodeStatus/1") || !strings.Contains(patches[1], "/status/nodeStatus/0") {
+		t.Errorf("Entry must be patched again at its latest index: %v", patches)
+	}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != iksv1.ReasonPaused {
+		t.Errorf("Status must contain the patched entry only: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestUpdateNodeStatusConcurrentNodes(t *testing.T) {
+	const nodes = 20
+	route := newStaticRouteWithValues(true, false)
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	write := func(hostname string, change func(*routeWrapper)) error {
+		instance := &iksv1.StaticRoute{}
+		if err := mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+			return err
+		}
+		rw := routeWrapper{instance: instance}
+		rw.readStatusHosts()
+		change(&rw)
+		return updateNodeStatus(*params, &rw, hostname)
+	}
+	parallel := func(change func(string, *routeWrapper)) {
+		var wg sync.WaitGroup
+		for i := 0; i < nodes; i++ {
+			wg.Add(1)
+			go func(hostname string) {
+				defer wg.Done()
+				if err := write(hostname, func(rw *routeWrapper) { change(hostname, rw) }); err != nil {
+					t.Errorf("Status of %s must be written: %s", hostname, err.Error())
+				}
+			}(fmt.Sprintf("node%d", i))
+		}
+		wg.Wait()
+	}
+
+	parallel(func(hostname string, rw *routeWrapper) {
+		rw.addToStatus(hostname, net.IP{10, 0, 0, 1}, nil)
+	})
+	parallel(func(hostname string, rw *routeWrapper) {
+		rw.setStatusReason(hostname, iksv1.ReasonDegraded)
+	})
+
+	instance := &iksv1.StaticRoute{}
+	if err := mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	written := map[string]string{}
+	for _, status := range instance.Status.NodeStatus {
+		written[status.Hostname] = status.Reason
+	}
+	if len(instance.Status.NodeStatus) != nodes || len(written) != nodes {
+		t.Errorf("Entry of each node must be written once: %v", instance.Status.NodeStatus)
+	}
+	for hostname, reason := range written {
+		if reason != iksv1.ReasonDegraded {
+			t.Errorf("Update of %s must not be lost: %s", hostname, reason)
+		}
+	}
+}
+
 func TestReconcileImplInvalidGateway(t *testing.T) {
 	route := newStaticRouteWithValues(true, true)
 	route.Spec.Gateway = "invalid-gateway"
@@ -461,9 +808,7 @@ func TestReconcileImplCantDetermineGateway(t *testing.T) {
 	route := newStaticRouteWithValues(true, true)
 	route.Spec.Gateway = ""
 	params, _ := getReconcileContextForAddFlow(route, true)
-	params.options.GetGw = func(net.IP) (net.IP, error) {
-		return nil, errors.New("Can't determine gateway")
-	}
+	params.options.GatewayResolver = &routemanager.FakeGatewayResolver{Err: errors.New("Can't determine gateway")}
 
 	res, err := reconcileImpl(*params)
 
@@ -481,9 +826,7 @@ func TestReconcileImplDetermineGateway(t *testing.T) {
 	route := newStaticRouteWithValues(true, true)
 	route.Spec.Gateway = ""
 	params, _ := getReconcileContextForAddFlow(route, false)
-	params.options.GetGw = func(net.IP) (net.IP, error) {
-		return net.IP{10, 0, 0, 1}, nil
-	}
+	params.options.GatewayResolver = &routemanager.FakeGatewayResolver{Gateway: net.IP{10, 0, 0, 1}}
 	params.options.RouteManager = routeManagerMock{
 		isRegistered: false,
 		registeredCallback: func(n string, r routemanager.Route) error {
@@ -500,13 +843,74 @@ func TestReconcileImplDetermineGateway(t *testing.T) {
 	}
 }
 
+func TestReconcileImplDefaultGateway(t *testing.T) {
+	var registered routemanager.Route
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Gateway = ""
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	resolver := &routemanager.FakeGatewayResolver{}
+	params.options.GatewayResolver = resolver
+	params.options.DefaultGateway = net.IP{10, 0, 0, 5}
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered = r
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished || err != nil {
+		t.Errorf("Route must be created: %v %v", res, err)
+	}
+	if !registered.Gw.Equal(net.IP{10, 0, 0, 5}) {
+		t.Errorf("Route must be registered through the default gateway: %v", registered)
+	}
+	if queries := resolver.Queries(); len(queries) != 1 || !queries[0].Equal(net.IP{10, 0, 0, 5}) {
+		t.Errorf("Only the default gateway must be checked, the gateway must not be discovered: %v", queries)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if status := instance.Status.NodeStatus[0]; status.State.Gateway != "10.0.0.5" || !status.DefaultGateway || status.ReasonCode != iksv1.ReasonCodeApplied {
+		t.Errorf("Default gateway must be reported: %+v", status)
+	}
+}
+
+func TestReconcileImplExplicitGatewayWinsOverDefaultGateway(t *testing.T) {
+	var registered routemanager.Route
+	route := newStaticRouteWithValues(true, false)
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.GatewayResolver = &routemanager.FakeGatewayResolver{}
+	params.options.DefaultGateway = net.IP{10, 0, 0, 5}
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered = r
+			return nil
+		},
+	}
+
+	//nolint:errcheck
+	reconcileImpl(*params)
+
+	if !registered.Gw.Equal(net.IP{10, 0, 0, 1}) {
+		t.Errorf("Route must be registered through the gateway of the CR: %v", registered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err := mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].DefaultGateway {
+		t.Errorf("Default gateway must not be reported: %+v", instance.Status.NodeStatus[0])
+	}
+}
+
 func TestReconcileImplGatewayNotDirectlyRoutable(t *testing.T) {
 	route := newStaticRouteWithValues(true, true)
 	route.Spec.Gateway = "10.0.10.1"
 	params, _ := getReconcileContextForAddFlow(route, true)
-	params.options.GetGw = func(net.IP) (net.IP, error) {
-		return net.IP{10, 0, 0, 1}, nil
-	}
+	params.options.GatewayResolver = &routemanager.FakeGatewayResolver{Gateway: net.IP{10, 0, 0, 1}}
 
 	res, err := reconcileImpl(*params)
 
@@ -518,21 +922,3142 @@ func TestReconcileImplGatewayNotDirectlyRoutable(t *testing.T) {
 	}
 }
 
-func getReconcileContextForAddFlow(route *iksv1.StaticRoute, isRegistered bool) (*reconcileImplParams, *reconcileImplClientMock) {
-	if route == nil {
-		route = newStaticRouteWithValues(true, true)
+func TestReconcileImplExpiredAtCreation(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.ExpiresAt = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(string, routemanager.Route) error {
+			t.Error("Expired route must be not registered")
+			return nil
+		},
 	}
-	mockClient := reconcileImplClientMock{
-		client: newFakeClient(route),
+
+	res, err := reconcileImpl(*params)
+
+	if res != routeExpired {
+		t.Error("Result must be routeExpired")
 	}
-	params := newReconcileImplParams(&mockClient)
-	params.options.Hostname = "hostname"
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != iksv1.ReasonExpired || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodeDisabled {
+		t.Errorf("Status must be expired: %v", instance.Status.NodeStatus)
+	}
+	if len(instance.GetFinalizers()) != 0 {
+		t.Errorf("Finalizer must be not set: %v", instance.GetFinalizers())
+	}
+}
+
+func TestReconcileImplExpiredRemovesRoute(t *testing.T) {
+	var deRegistered string
+	route := newStaticRouteWithValues(true, true)
+	route.SetCreationTimestamp(metav1.Time{Time: time.Now().Add(-time.Hour)})
+	route.Spec.TTL = &metav1.Duration{Duration: time.Minute}
+	params, _ := getReconcileContextForAddFlow(route, true)
 	params.options.RouteManager = routeManagerMock{
-		isRegistered: isRegistered,
+		isRegistered: true,
+		deRegisteredCallback: func(n string) error {
+			deRegistered = n
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != routeExpired {
+		t.Error("Result must be routeExpired")
 	}
-	params.options.GetGw = func(net.IP) (net.IP, error) {
-		return nil, nil
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if deRegistered != "CR" {
+		t.Errorf("Route must be deregistered: %s", deRegistered)
+	}
+}
+
+func TestReconcileImplExpiredRemovesRouteOfPreviousRun(t *testing.T) {
+	var registered, deRegistered string
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.ExpiresAt = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+	params, _ := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered = n
+			return nil
+		},
+		deRegisteredCallback: func(n string) error {
+			deRegistered = n
+			return nil
+		},
+	}
+
+	res, _ := reconcileImpl(*params)
+
+	if res != routeExpired {
+		t.Error("Result must be routeExpired")
+	}
+	if registered != "CR" || deRegistered != "CR" {
+		t.Errorf("Route must be registered and deregistered: %s %s", registered, deRegistered)
+	}
+}
+
+func TestReconcileImplExpiredButCantDeregister(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.ExpiresAt = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+	params, _ := getReconcileContextForAddFlow(route, true)
+	params.options.RouteManager = routeManagerMock{
+		isRegistered:       true,
+		deRegisterRouteErr: errors.New("bla"),
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != deRegisterError {
+		t.Error("Result must be deRegisterError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+}
+
+func TestReconcileImplRequeueUntilExpiration(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.ExpiresAt = &metav1.Time{Time: time.Now().Add(time.Hour)}
+	params, _ := getReconcileContextForAddFlow(route, true)
+
+	res, err := reconcileImpl(*params)
+
+	if res.RequeueAfter <= 0 || res.RequeueAfter > time.Hour {
+		t.Errorf("Result must be requeued until expiration: %v", res.RequeueAfter)
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+}
+
+func TestReconcileImplInvalidTos(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Tos = 256
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(string, routemanager.Route) error {
+			t.Error("Route with invalid tos must be not registered")
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != invalidTosError {
+		t.Error("Result must be invalidTosError")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].Error != errInvalidTos.Error() || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodeInvalidSpec {
+		t.Errorf("Status error must be set: %+v", instance.Status.NodeStatus[0])
+	}
+}
+
+func TestReconcileImplOnLink(t *testing.T) {
+	var registered routemanager.Route
+	route := newStaticRouteWithValues(false, false)
+	route.Spec.Subnet = "169.254.0.0/16"
+	route.Spec.Interface = "eth1"
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered = r
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if registered.Device != "eth1" || registered.Gw != nil {
+		t.Errorf("Route must be registered on the interface without gateway: %v", registered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].State.Gateway != "0.0.0.0" || instance.Status.NodeStatus[0].State.Interface != "eth1" {
+		t.Errorf("Status must contain the interface: %v", instance.Status.NodeStatus[0].State)
+	}
+}
+
+func TestReconcileImplInvalidOnLink(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Subnet = "169.254.0.0/16"
+	route.Spec.Interface = "eth1"
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(string, routemanager.Route) error {
+			t.Error("Link-local route with gateway must be not registered")
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != invalidOnLinkError {
+		t.Error("Result must be invalidOnLinkError")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].Error != errOnLinkGateway.Error() {
+		t.Errorf("Status error must be set: %s", instance.Status.NodeStatus[0].Error)
+	}
+}
+
+func TestReconcileImplFwMark(t *testing.T) {
+	var registered routemanager.Route
+	route := newStaticRouteWithValues(true, false)
+	route.Annotations = map[string]string{iksv1.FwMarkAnnotation: "0x10", iksv1.FwMarkTableAnnotation: "200"}
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.Table = 100
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered = r
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if registered.Rule == nil || registered.Rule.Mark != 0x10 || registered.Table != 200 {
+		t.Errorf("Route must be registered with its rule: %v", registered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].Rule != "fwmark 0x10 lookup 200" {
+		t.Errorf("Status must contain the rule: %s", instance.Status.NodeStatus[0].Rule)
+	}
+}
+
+func TestReconcileImplInvalidFwMark(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Annotations = map[string]string{iksv1.FwMarkAnnotation: "0x100000000"}
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(string, routemanager.Route) error {
+			t.Error("Route with invalid fwmark must be not registered")
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != invalidFwMarkErr {
+		t.Error("Result must be invalidFwMarkErr")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].Error != errInvalidFwMark.Error() {
+		t.Errorf("Status error must be set: %s", instance.Status.NodeStatus[0].Error)
+	}
+}
+
+func TestReconcileImplSourceAddressFamilyMismatch(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.SourceAddress = "fd00::1"
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(string, routemanager.Route) error {
+			t.Error("Route with wrong source address must be not registered")
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != wrongSourceError {
+		t.Error("Result must be wrongSourceError")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].Error != errSourceAddressFamily.Error() {
+		t.Errorf("Status error must be set: %s", instance.Status.NodeStatus[0].Error)
+	}
+}
+
+func TestReconcileImplSourceAddress(t *testing.T) {
+	var src net.IP
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.SourceAddress = "10.1.0.1"
+	params, _ := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			src = r.Src
+			return nil
+		},
+	}
+
+	res, _ := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if !src.Equal(net.IP{10, 1, 0, 1}) {
+		t.Errorf("Source address must be set: %s", src)
+	}
+}
+
+func TestReconcileImplPeriodicVerify(t *testing.T) {
+	params, _ := getReconcileContextForAddFlow(nil, true)
+	params.options.ReconcileInterval = time.Minute
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: true,
+		repair:       routemanager.RepairRecreated,
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res.RequeueAfter != time.Minute {
+		t.Errorf("Result must be requeued after the interval: %v", res.RequeueAfter)
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+}
+
+func TestReconcileImplPeriodicVerifyDriftCorrected(t *testing.T) {
+	params, _ := getReconcileContextForAddFlow(nil, true)
+	params.options.ReconcileInterval = time.Minute
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: true,
+		repair:       routemanager.RepairGatewayRestored,
+	}
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+
+	res, err := reconcileImpl(*params)
+
+	if res.RequeueAfter != time.Minute {
+		t.Errorf("Result must be requeued after the interval: %v", res.RequeueAfter)
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("Drift correction must be recorded as an event: %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; event != "Normal DriftCorrected Gateway of the route restored to 10.0.0.1 on node hostname" {
+		t.Errorf("Event must tell the restored gateway: %s", event)
+	}
+}
+
+func TestReconcileImplPeriodicVerifyExpiresEarlier(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.ExpiresAt = &metav1.Time{Time: time.Now().Add(time.Minute)}
+	params, _ := getReconcileContextForAddFlow(route, true)
+	params.options.ReconcileInterval = time.Hour
+
+	res, _ := reconcileImpl(*params)
+
+	if res.RequeueAfter <= 0 || res.RequeueAfter > time.Minute {
+		t.Errorf("Result must be requeued until expiration: %v", res.RequeueAfter)
+	}
+}
+
+func TestReconcileImplPeriodicVerifyFails(t *testing.T) {
+	params, _ := getReconcileContextForAddFlow(nil, true)
+	params.options.ReconcileInterval = time.Minute
+	params.options.RouteManager = routeManagerMock{
+		isRegistered:   true,
+		verifyRouteErr: errors.New("bla"),
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != verifyRouteError {
+		t.Error("Result must be verifyRouteError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+}
+
+func TestResolveGatewayHostname(t *testing.T) {
+	var testData = []struct {
+		subnet string
+		ips    []net.IP
+		out    net.IP
+	}{
+		{"10.0.0.0/16", []net.IP{net.ParseIP("10.0.0.3"), net.ParseIP("10.0.0.2"), net.ParseIP("fd00::1")}, net.IP{10, 0, 0, 2}},
+		{"fd00:1::/64", []net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("fd00::2"), net.ParseIP("fd00::1")}, net.ParseIP("fd00::1")},
+		{"10.0.0.0/16", []net.IP{net.ParseIP("fd00::1")}, nil},
+	}
+
+	for i, td := range testData {
+		route := newStaticRouteWithValues(false, false)
+		route.Spec.Subnet = td.subnet
+		route.Spec.GatewayHostname = "gateway.example.com"
+		params, _ := getReconcileContextForAddFlow(route, false)
+		ips := td.ips
+		params.options.LookupIP = func(host string) ([]net.IP, error) {
+			return ips, nil
+		}
+
+		out, err := resolveGatewayHostname(*params, routeWrapper{instance: route})
+
+		if !out.Equal(td.out) {
+			t.Errorf("Result must be %v, it is %v at %d", td.out, out, i)
+		}
+		if (td.out == nil) != (err != nil) {
+			t.Errorf("Error must be set only if no address is selected: %v at %d", err, i)
+		}
+	}
+}
+
+func TestReconcileImplGatewayHostname(t *testing.T) {
+	var gatewayParam net.IP
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Gateway = ""
+	route.Spec.GatewayHostname = "gateway.example.com"
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.GatewayResolveInterval = time.Minute
+	params.options.LookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("10.0.0.9")}, nil
+	}
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			gatewayParam = r.Gw
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res.RequeueAfter != time.Minute {
+		t.Errorf("Result must be requeued for re-resolution: %v", res.RequeueAfter)
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !gatewayParam.Equal(net.IP{10, 0, 0, 9}) {
+		t.Errorf("Resolved gateway must be used: %s", gatewayParam)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].ResolvedGateway != "10.0.0.9" || instance.Status.NodeStatus[0].LastResolution == nil {
+		t.Errorf("Resolution must be recorded in the status: %v", instance.Status.NodeStatus[0])
+	}
+}
+
+func TestReconcileImplGatewayHostnameChanged(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.Gateway = ""
+	route.Spec.GatewayHostname = "gateway.example.com"
+	params, _ := getReconcileContextForAddFlow(route, true)
+	params.options.LookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("10.0.0.9")}, nil
+	}
+
+	res, _ := reconcileImpl(*params)
+
+	if res != updateFinished {
+		t.Error("Result must be updateFinished")
+	}
+}
+
+func TestReconcileImplGatewayHostnameCantResolve(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Gateway = ""
+	route.Spec.GatewayHostname = "gateway.example.com"
+	params, _ := getReconcileContextForAddFlow(route, false)
+	params.options.LookupIP = func(host string) ([]net.IP, error) {
+		return nil, errors.New("bla")
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != gatewayResolveError {
+		t.Error("Result must be gatewayResolveError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+}
+
+func TestReconcileImplAmbiguousGateway(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.GatewayHostname = "gateway.example.com"
+	params, _ := getReconcileContextForAddFlow(route, false)
+
+	res, err := reconcileImpl(*params)
+
+	if res != ambiguousGateway {
+		t.Error("Result must be ambiguousGateway")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+}
+
+func TestShortestInterval(t *testing.T) {
+	if shortestInterval() != 0 || shortestInterval(0, 0) != 0 {
+		t.Error("Shortest interval must be 0 without positive intervals")
+	}
+	if shortestInterval(0, time.Hour, time.Minute) != time.Minute {
+		t.Error("Shortest interval must be a minute")
+	}
+}
+
+func newGroupMember(name, subnet string) *iksv1.StaticRoute {
+	route := newStaticRouteWithValues(true, false)
+	route.SetName(name)
+	route.Spec.Subnet = subnet
+	route.Spec.Group = "group"
+	return route
+}
+
+func TestReconcileImplGroupRegistersMembers(t *testing.T) {
+	var staged map[string]routemanager.Route
+	route := newGroupMember("CR", "10.0.0.0/16")
+	other := newGroupMember("other", "10.1.0.0/16")
+	notMember := newStaticRouteWithValues(true, false)
+	notMember.SetName("not-member")
+	mockClient := reconcileImplClientMock{client: newFakeClient(route, other, notMember)}
+	params, _ := getReconcileContextForAddFlow(route, false)
+	params.client = &mockClient
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(string, routemanager.Route) error {
+			t.Error("Group members must be registered together")
+			return nil
+		},
+		registeredRoutesCallback: func(routes map[string]routemanager.Route) error {
+			staged = routes
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	crRoute, otherRoute := staged["CR"], staged["other"]
+	if len(staged) != 2 || crRoute.Dst.String() != "10.0.0.0/16" || otherRoute.Dst.String() != "10.1.0.0/16" {
+		t.Errorf("Both group members must be staged: %v", staged)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "other", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.GetFinalizers()) != 1 {
+		t.Error("Finalizer must be set on the staged group member")
+	}
+}
+
+func TestReconcileImplGroupInvalidMember(t *testing.T) {
+	route := newGroupMember("CR", "10.0.0.0/16")
+	other := newGroupMember("other", "10.1.0.0/16")
+	other.Spec.Gateway = "invalid"
+	params, _ := getReconcileContextForAddFlow(route, false)
+	params.client = &reconcileImplClientMock{client: newFakeClient(route, other)}
+	params.options.RouteManager = routeManagerMock{
+		registeredRoutesCallback: func(routes map[string]routemanager.Route) error {
+			t.Error("Group must be not registered")
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != groupMemberError {
+		t.Error("Result must be groupMemberError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+}
+
+func TestReconcileImplGroupCantRegister(t *testing.T) {
+	route := newGroupMember("CR", "10.0.0.0/16")
+	params, _ := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registerRouteErr: errors.New("bla"),
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != registerRouteError {
+		t.Error("Result must be registerRouteError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+}
+
+func TestReconcileImplGroupCantList(t *testing.T) {
+	route := newGroupMember("CR", "10.0.0.0/16")
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	lists := 0
+	mockClient.listCallback = func(runtime.Object) error {
+		// The first list is the conflict check
+		if lists++; lists > 1 {
+			return errors.New("bla")
+		}
+		return nil
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != groupListError {
+		t.Error("Result must be groupListError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+}
+
+func TestReconcileImplRecoversFromPanic(t *testing.T) {
+	params, mockClient := getReconcileContextForAddFlow(nil, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(string, routemanager.Route) error {
+			panic("broken route")
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != reconcilePanicError {
+		t.Error("Result must be reconcilePanicError")
+	}
+	if err == nil || err.Error() != "Reconcile failed: broken route" {
+		t.Errorf("Error not match: %v", err)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Error != "Reconcile failed: broken route" || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodeReconcileError {
+		t.Errorf("Status must contain the error: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplBrokenCRsDoNotAffectOthers(t *testing.T) {
+	newRoute := func(name, subnet string) *iksv1.StaticRoute {
+		route := newStaticRouteWithValues(true, false)
+		route.Name = name
+		route.Spec.Subnet = subnet
+		return route
+	}
+	registered := map[string]routemanager.Route{}
+	params, mockClient := getReconcileContextForAddFlow(nil, false)
+	mockClient.client = newFakeClient(
+		newRoute("valid-1", "10.1.0.0/16"),
+		newRoute("invalid", "10.2.0.0/99"),
+		newRoute("panicking", "10.3.0.0/16"),
+		newRoute("valid-2", "10.4.0.0/16"),
+	)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			if n == "panicking" {
+				panic("broken route")
+			}
+			registered[n] = r
+			return nil
+		},
+	}
+	var testData = []struct {
+		name        string
+		result      *reconcile.Result
+		statusError string
+	}{
+		{"valid-1", finished, ""},
+		{"invalid", parseSubnetError, errInvalidSubnet.Error()},
+		{"panicking", reconcilePanicError, "Reconcile failed: broken route"},
+		{"valid-2", finished, ""},
+	}
+	for _, td := range testData {
+		params.request.Name = td.name
+
+		res, _ := reconcileImpl(*params)
+
+		if res != td.result {
+			t.Errorf("Result of %s not match: %v", td.name, res)
+		}
+		instance := &iksv1.StaticRoute{}
+		if err := mockClient.Get(context.Background(), types.NamespacedName{Name: td.name, Namespace: "default"}, instance); err != nil {
+			t.Errorf("Failed to read the CR: %s", err.Error())
+		}
+		if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Error != td.statusError {
+			t.Errorf("Status of %s not match: %v", td.name, instance.Status.NodeStatus)
+		}
+	}
+	dst1, dst2 := registered["valid-1"].Dst, registered["valid-2"].Dst
+	if len(registered) != 2 || dst1.String() != "10.1.0.0/16" || dst2.String() != "10.4.0.0/16" {
+		t.Errorf("Valid routes must be registered: %v", registered)
+	}
+}
+
+func TestReconcileImplNoSubnet(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Subnet = ""
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+
+	res, err := reconcileImpl(*params)
+
+	if res != noSubnetError {
+		t.Error("Result must be noSubnetError")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Error != errNoSubnet.Error() {
+		t.Errorf("Status must contain the error: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplSubnetsRegistersEach(t *testing.T) {
+	registered := map[string]routemanager.Route{}
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Subnets = []string{"10.1.0.0/16", "10.2.0.0/16", "10.1.0.0/16", "10.0.0.1/16"}
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered[n] = r
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if len(registered) != 3 {
+		t.Errorf("Every subnet must be registered once: %v", registered)
+	}
+	for _, name := range []string{"CR", "CR/10.1.0.0/16", "CR/10.2.0.0/16"} {
+		if r, found := registered[name]; !found || !r.Gw.Equal(net.IP{10, 0, 0, 1}) {
+			t.Errorf("Route %s must be registered to the gateway: %v", name, registered)
+		}
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	expected := []iksv1.StaticRouteSubnetStatus{
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.1.0.0/16"},
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.2.0.0/16"},
+	}
+	if len(instance.Status.NodeStatus) != 1 || !reflect.DeepEqual(instance.Status.NodeStatus[0].Subnets, expected) {
+		t.Errorf("Status must contain the subnets: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplSubnetsOnly(t *testing.T) {
+	registered := []string{}
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Subnet = ""
+	route.Spec.Subnets = []string{"10.1.0.0/16"}
+	params, _ := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered = append(registered, n)
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(registered, []string{"CR/10.1.0.0/16"}) {
+		t.Errorf("Only the listed subnet must be registered: %v", registered)
+	}
+}
+
+func TestReconcileImplSubnetsUpdated(t *testing.T) {
+	registered, deRegistered := []string{}, []string{}
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.Subnets = []string{"10.2.0.0/16", "10.3.0.0/16"}
+	route.Status.NodeStatus[0].Subnets = []iksv1.StaticRouteSubnetStatus{
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.1.0.0/16"},
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.2.0.0/16"},
+	}
+	params, _ := getReconcileContextForAddFlow(route, true)
+	params.options.RouteManager = routeManagerMock{
+		isRegisteredCallback: func(n string) bool {
+			return n == "CR" || n == "CR/10.1.0.0/16" || n == "CR/10.2.0.0/16"
+		},
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered = append(registered, n)
+			return nil
+		},
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(registered, []string{"CR/10.3.0.0/16"}) {
+		t.Errorf("Only the new subnet must be registered: %v", registered)
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR/10.1.0.0/16"}) {
+		t.Errorf("Only the removed subnet must be deregistered: %v", deRegistered)
+	}
+}
+
+func TestReconcileImplSubnetsPartialFailure(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Subnets = []string{"10.1.0.0/16", "10.2.0.0/16", "172.0.0.0/16"}
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	_, protected, _ := net.ParseCIDR("172.0.0.0/24")
+	params.options.ProtectedSubnets = []*net.IPNet{protected}
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			if n == "CR/10.1.0.0/16" {
+				return errors.New("bla")
+			}
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != registerSubnetsError {
+		t.Error("Result must be registerSubnetsError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	expected := []iksv1.StaticRouteSubnetStatus{
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.1.0.0/16", Error: "bla"},
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.2.0.0/16"},
+		iksv1.StaticRouteSubnetStatus{Subnet: "172.0.0.0/16", Error: errSubnetProtected.Error()},
+	}
+	if len(instance.Status.NodeStatus) != 1 || !reflect.DeepEqual(instance.Status.NodeStatus[0].Subnets, expected) {
+		t.Errorf("Status must contain the outcome of each subnet: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplSubnetsDeleted(t *testing.T) {
+	deRegistered := []string{}
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.Subnets = []string{"10.2.0.0/16"}
+	route.Status.NodeStatus[0].Subnets = []iksv1.StaticRouteSubnetStatus{
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.1.0.0/16"},
+	}
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	params.options.RouteManager = routeManagerMock{
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+	}
+	mockClient.postfixGet = func(obj runtime.Object) {
+		obj.(*iksv1.StaticRoute).SetDeletionTimestamp(&v1.Time{})
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != deletionFinished {
+		t.Error("Result must be deletionFinished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR", "CR/10.2.0.0/16", "CR/10.1.0.0/16"}) {
+		t.Errorf("Every route must be deregistered: %v", deRegistered)
+	}
+}
+
+func TestReconcileImplNetworkGroupFollowsChanges(t *testing.T) {
+	registered := map[string]bool{}
+	registrations, deRegistrations := []string{}, []string{}
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Subnet = ""
+	route.Spec.Subnets = []string{"10.1.0.0/16"}
+	route.Spec.NetworkGroup = "group"
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		isRegisteredCallback: func(n string) bool {
+			return registered[n]
+		},
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered[n] = true
+			registrations = append(registrations, n)
+			return nil
+		},
+		deRegisteredCallback: func(n string) error {
+			delete(registered, n)
+			deRegistrations = append(deRegistrations, n)
+			return nil
+		},
+	}
+	group := &iksv1.NetworkGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "group"},
+		Spec:       iksv1.NetworkGroupSpec{Subnets: []string{"10.1.0.0/16", "10.2.0.0/16", "10.3.0.0/16"}},
+	}
+	if err := mockClient.client.(client.Client).Create(context.Background(), group); err != nil {
+		t.Fatalf("Failed to create the NetworkGroup: %s", err.Error())
+	}
+
+	if res, err := reconcileImpl(*params); res != finished || err != nil {
+		t.Errorf("Route must be applied: %v", err)
+	}
+	if !reflect.DeepEqual(registrations, []string{"CR/10.1.0.0/16", "CR/10.2.0.0/16", "CR/10.3.0.0/16"}) {
+		t.Errorf("Every subnet of the group must be registered once: %v", registrations)
+	}
+
+	group.Spec.Subnets = []string{"10.3.0.0/16", "10.4.0.0/16"}
+	if err := mockClient.client.(client.Client).Update(context.Background(), group); err != nil {
+		t.Fatalf("Failed to update the NetworkGroup: %s", err.Error())
+	}
+	registrations = []string{}
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(registrations, []string{"CR/10.4.0.0/16"}) {
+		t.Errorf("Only the new subnet of the group must be registered: %v", registrations)
+	}
+	if !reflect.DeepEqual(deRegistrations, []string{"CR/10.2.0.0/16"}) {
+		t.Errorf("Only the removed subnet of the group must be deregistered: %v", deRegistrations)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	expected := []iksv1.StaticRouteSubnetStatus{
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.1.0.0/16"},
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.3.0.0/16"},
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.4.0.0/16"},
+	}
+	if len(instance.Status.NodeStatus) != 1 || !reflect.DeepEqual(instance.Status.NodeStatus[0].Subnets, expected) {
+		t.Errorf("Status must contain every expanded subnet: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplNetworkGroupNotFound(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.NetworkGroup = "missing"
+	route.Status.NodeStatus[0].Subnets = []iksv1.StaticRouteSubnetStatus{
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.1.0.0/16"},
+	}
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: true,
+		deRegisteredCallback: func(n string) error {
+			t.Errorf("Route must be kept: %s", n)
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != networkGroupGetError {
+		t.Error("Result must be networkGroupGetError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || !strings.HasPrefix(instance.Status.NodeStatus[0].Error, "Unable to get NetworkGroup missing") || len(instance.Status.NodeStatus[0].Subnets) != 1 || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodeReconcileError {
+		t.Errorf("Status must tell the missing group and keep the subnets: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplNetworkGroupNotFoundDeleted(t *testing.T) {
+	deRegistered := []string{}
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.NetworkGroup = "missing"
+	route.Status.NodeStatus[0].Subnets = []iksv1.StaticRouteSubnetStatus{
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.1.0.0/16"},
+	}
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	params.options.RouteManager = routeManagerMock{
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+	}
+	mockClient.postfixGet = func(obj runtime.Object) {
+		if instance, ok := obj.(*iksv1.StaticRoute); ok {
+			instance.SetDeletionTimestamp(&v1.Time{})
+		}
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != deletionFinished {
+		t.Error("Result must be deletionFinished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR", "CR/10.1.0.0/16"}) {
+		t.Errorf("Reported subnets of the group must be deregistered: %v", deRegistered)
+	}
+}
+
+func TestEnqueueNetworkGroupMembers(t *testing.T) {
+	member, other := newStaticRouteWithValues(true, false), newStaticRouteWithValues(true, false)
+	member.Spec.NetworkGroup = "group"
+	other.Name = "other"
+	mapper := enqueueNetworkGroupMembers(newFakeClient(member, other)).(*handler.EnqueueRequestsFromMapFunc)
+
+	requests := mapper.ToRequests.Map(handler.MapObject{Meta: &metav1.ObjectMeta{Name: "group"}})
+
+	if !reflect.DeepEqual(requests, []reconcile.Request{reconcile.Request{NamespacedName: types.NamespacedName{Name: "CR"}}}) {
+		t.Errorf("Only the members of the group must be reconciled: %v", requests)
+	}
+}
+
+func TestReconcileImplTablesRegistersEach(t *testing.T) {
+	registered := map[string]routemanager.Route{}
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Tables = []int{100, 200, 100, 254, 255}
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.Table = 254
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered[n] = r
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	expectedTables := map[string]int{"CR": 254, "CR/table/100": 100, "CR/table/200": 200}
+	if len(registered) != len(expectedTables) {
+		t.Errorf("The route must be registered once in every table: %v", registered)
+	}
+	for name, table := range expectedTables {
+		if r, found := registered[name]; !found || r.Table != table || r.Dst.String() != "10.0.0.0/16" {
+			t.Errorf("Route %s must be registered to table %d: %v", name, table, registered)
+		}
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	expected := []iksv1.StaticRouteTableStatus{
+		iksv1.StaticRouteTableStatus{Table: 100},
+		iksv1.StaticRouteTableStatus{Table: 200},
+		iksv1.StaticRouteTableStatus{Table: 255, Error: errInvalidTable.Error()},
+	}
+	if len(instance.Status.NodeStatus) != 1 || !reflect.DeepEqual(instance.Status.NodeStatus[0].Tables, expected) {
+		t.Errorf("Status must contain the outcome of each table: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplHealthCheckProbesTargetTableOnly(t *testing.T) {
+	registered := map[string]routemanager.Route{}
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Tables = []int{100}
+	route.Spec.HealthCheck = &iksv1.StaticRouteHealthCheck{Timeout: &metav1.Duration{Duration: 2 * time.Second}}
+	params, _ := getReconcileContextForAddFlow(route, false)
+	params.options.Table = 254
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered[n] = r
+			return nil
+		},
+	}
+
+	if _, err := reconcileImpl(*params); err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if r := registered["CR"]; r.HealthCheck == nil || r.HealthCheck.Timeout != 2*time.Second {
+		t.Errorf("Route of the target table must be probed: %v", r.HealthCheck)
+	}
+	if r, found := registered["CR/table/100"]; !found || r.HealthCheck != nil {
+		t.Errorf("Duplicate of the route must not be probed: %v", r.HealthCheck)
+	}
+}
+
+func TestReconcileImplTablesUpdated(t *testing.T) {
+	registered, deRegistered := []string{}, []string{}
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.Tables = []int{200, 300}
+	route.Status.NodeStatus[0].Tables = []iksv1.StaticRouteTableStatus{
+		iksv1.StaticRouteTableStatus{Table: 100},
+		iksv1.StaticRouteTableStatus{Table: 200},
+	}
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	params.options.RouteManager = routeManagerMock{
+		isRegisteredCallback: func(n string) bool {
+			return n == "CR" || n == "CR/table/100" || n == "CR/table/200"
+		},
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered = append(registered, n)
+			return nil
+		},
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(registered, []string{"CR/table/300"}) {
+		t.Errorf("Only the added table must be registered: %v", registered)
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR/table/100"}) {
+		t.Errorf("Only the removed table must be deregistered: %v", deRegistered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	expected := []iksv1.StaticRouteTableStatus{
+		iksv1.StaticRouteTableStatus{Table: 200},
+		iksv1.StaticRouteTableStatus{Table: 300},
+	}
+	if len(instance.Status.NodeStatus) != 1 || !reflect.DeepEqual(instance.Status.NodeStatus[0].Tables, expected) {
+		t.Errorf("Status must contain the listed tables: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplTablesPartialFailure(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Tables = []int{100, 200}
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			if n == "CR/table/100" {
+				return errors.New("bla")
+			}
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != registerTablesError {
+		t.Error("Result must be registerTablesError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	expected := []iksv1.StaticRouteTableStatus{
+		iksv1.StaticRouteTableStatus{Table: 100, Error: "bla"},
+		iksv1.StaticRouteTableStatus{Table: 200},
+	}
+	if len(instance.Status.NodeStatus) != 1 || !reflect.DeepEqual(instance.Status.NodeStatus[0].Tables, expected) {
+		t.Errorf("Status must contain the outcome of each table: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplTablesDeleted(t *testing.T) {
+	deRegistered := []string{}
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.Tables = []int{200}
+	route.Status.NodeStatus[0].Tables = []iksv1.StaticRouteTableStatus{
+		iksv1.StaticRouteTableStatus{Table: 100},
+	}
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	params.options.RouteManager = routeManagerMock{
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+	}
+	mockClient.postfixGet = func(obj runtime.Object) {
+		obj.(*iksv1.StaticRoute).SetDeletionTimestamp(&v1.Time{})
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != deletionFinished {
+		t.Error("Result must be deletionFinished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR", "CR/table/200", "CR/table/100"}) {
+		t.Errorf("Every route must be deregistered: %v", deRegistered)
+	}
+}
+
+func getReconcileContextForDrain(route *iksv1.StaticRoute, unschedulable bool) (*reconcileImplParams, *reconcileImplClientMock) {
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "hostname"},
+		Spec:       corev1.NodeSpec{Unschedulable: unschedulable},
+	}
+	mockClient.client = newFakeClientWithNode(node, route)
+	params.options.OnDrain = DrainPolicyRemove
+	return params, mockClient
+}
+
+func TestReconcileImplDrainedWithdrawsRoute(t *testing.T) {
+	deRegistered := []string{}
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.Subnets = []string{"10.1.0.0/16"}
+	params, mockClient := getReconcileContextForDrain(route, true)
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: true,
+		registeredCallback: func(string, routemanager.Route) error {
+			t.Error("Route must be not registered on a cordoned node")
+			return nil
+		},
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != routeDrained {
+		t.Error("Result must be routeDrained")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR/10.1.0.0/16", "CR"}) {
+		t.Errorf("Every route must be deregistered: %v", deRegistered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != iksv1.ReasonDrained || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodeDisabled {
+		t.Errorf("Status must be drained: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplUncordonedRestoresRoute(t *testing.T) {
+	var registered string
+	route := newStaticRouteWithValues(true, true)
+	route.Status.NodeStatus[0].Reason = iksv1.ReasonDrained
+	params, mockClient := getReconcileContextForDrain(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered = n
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if registered != "CR" {
+		t.Errorf("Route must be registered again: %s", registered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != "" {
+		t.Errorf("Drained reason must be cleared: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplDrainedKeepPolicy(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	params, _ := getReconcileContextForDrain(route, true)
+	params.options.OnDrain = DrainPolicyKeep
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: true,
+		deRegisteredCallback: func(n string) error {
+			t.Errorf("Route must be kept: %s", n)
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+}
+
+func TestReconcileImplDrainCantGetNode(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	params.options.OnDrain = DrainPolicyRemove
+	mockClient.client = newFakeClientWithNode(nil, route)
+
+	res, err := reconcileImpl(*params)
+
+	if res != nodeGetError {
+		t.Error("Result must be nodeGetError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+}
+
+func TestReconcileImplDisabledWithdrawsRoute(t *testing.T) {
+	deRegistered := []string{}
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.Disabled = true
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: true,
+		registeredCallback: func(string, routemanager.Route) error {
+			t.Error("Disabled route must be not registered")
+			return nil
+		},
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+
+	res, err := reconcileImpl(*params)
+
+	if res != routeDisabled {
+		t.Error("Result must be routeDisabled")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR"}) {
+		t.Errorf("Route must be deregistered: %v", deRegistered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != iksv1.ReasonDisabled || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodeDisabled {
+		t.Errorf("Status must be disabled: %v", instance.Status.NodeStatus)
+	}
+	if len(recorder.Events) != 1 || !strings.HasPrefix(<-recorder.Events, "Normal RouteDisabled") {
+		t.Error("Transition must be recorded as an event")
+	}
+}
+
+func TestReconcileImplPaused(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.SetAnnotations(map[string]string{iksv1.PauseAnnotation: "true"})
+	route.Spec.Disabled = true
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	params.options.ReconcileInterval = time.Minute
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(string, routemanager.Route) error {
+			t.Error("Paused route must be not registered")
+			return nil
+		},
+		deRegisteredCallback: func(string) error {
+			t.Error("Paused route must be not deregistered")
+			return nil
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+
+	res, err := reconcileImpl(*params)
+	again, _ := reconcileImpl(*params)
+
+	if res != routePaused || again != routePaused || err != nil {
+		t.Errorf("Result must be routePaused without requeue: %v", err)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != iksv1.ReasonPaused || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodePaused || instance.Status.NodeStatus[0].State.Gateway != "10.0.0.1" {
+		t.Errorf("Only the reason of the status must be changed: %v", instance.Status.NodeStatus)
+	}
+	if len(recorder.Events) != 1 || !strings.HasPrefix(<-recorder.Events, "Normal RoutePaused") {
+		t.Error("Pause must be recorded as an event once")
+	}
+}
+
+func TestReconcileImplResumed(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Status.NodeStatus[0].Reason = iksv1.ReasonPaused
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished || err != nil {
+		t.Errorf("Result must be finished: %v", err)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != "" {
+		t.Errorf("Paused reason must be cleared: %v", instance.Status.NodeStatus)
+	}
+	if len(recorder.Events) != 1 || !strings.HasPrefix(<-recorder.Events, "Normal RouteResumed") {
+		t.Error("Resume must be recorded as an event")
+	}
+}
+
+func TestReconcileImplPausedRouteCanBeDeleted(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.SetAnnotations(map[string]string{iksv1.PauseAnnotation: "true"})
+	now := metav1.Now()
+	route.SetDeletionTimestamp(&now)
+	params, _ := getReconcileContextForAddFlow(route, true)
+	deRegistered := []string{}
+	params.options.RouteManager = routeManagerMock{
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+	}
+
+	if res, _ := reconcileImpl(*params); res == routePaused {
+		t.Error("Deletion must be not paused")
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR"}) {
+		t.Errorf("Route must be deregistered: %v", deRegistered)
+	}
+}
+
+func TestReconcileImplEventsCarryDescription(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.Disabled = true
+	route.Spec.Description = "Backup link of the DC"
+	params, _ := getReconcileContextForAddFlow(route, true)
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+
+	if res, _ := reconcileImpl(*params); res != routeDisabled {
+		t.Error("Result must be routeDisabled")
+	}
+
+	if event := <-recorder.Events; event != "Normal RouteDisabled Route disabled on node hostname (Backup link of the DC)" {
+		t.Errorf("Description must be in the event: %s", event)
+	}
+}
+
+func TestReconcileImplOwnerIsReported(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.Disabled = true
+	route.SetOwnerReferences([]metav1.OwnerReference{metav1.OwnerReference{Kind: "VPNConnection", Name: "dc-east"}})
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+
+	if res, _ := reconcileImpl(*params); res != routeDisabled {
+		t.Error("Result must be routeDisabled")
+	}
+
+	if event := <-recorder.Events; event != "Normal RouteDisabled Route disabled on node hostname (owned by VPNConnection/dc-east)" {
+		t.Errorf("Owner must be in the event: %s", event)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err := mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Owner != "VPNConnection/dc-east" {
+		t.Errorf("Owner must be in the status: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplOwnerDeletionCleansUp(t *testing.T) {
+	deRegistered := []string{}
+	route := newStaticRouteWithValues(true, true)
+	route.SetFinalizers([]string{"finalizer.static-route.ibm.com"})
+	route.SetOwnerReferences([]metav1.OwnerReference{metav1.OwnerReference{Kind: "VPNConnection", Name: "dc-east"}})
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	params.options.RouteManager = routeManagerMock{
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+	}
+	// The garbage collector deletes the StaticRoute of the deleted owner, the finalizer keeps it until the route is removed
+	mockClient.postfixGet = func(obj runtime.Object) {
+		obj.(*iksv1.StaticRoute).SetDeletionTimestamp(&v1.Time{})
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != deletionFinished {
+		t.Error("Result must be deletionFinished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR"}) {
+		t.Errorf("Kernel route must be removed: %v", deRegistered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.GetFinalizers()) != 0 {
+		t.Errorf("Finalizer must be removed by the last node: %v", instance.GetFinalizers())
+	}
+	if len(instance.GetOwnerReferences()) != 1 {
+		t.Errorf("Owner references must be kept: %v", instance.GetOwnerReferences())
+	}
+}
+
+func TestReconcileImplStillDisabled(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.Disabled = true
+	route.Status.NodeStatus[0].Reason = iksv1.ReasonDisabled
+	params, _ := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(string, routemanager.Route) error {
+			t.Error("Disabled route must be not registered to remove it again")
+			return nil
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+
+	res, _ := reconcileImpl(*params)
+
+	if res != routeDisabled {
+		t.Error("Result must be routeDisabled")
+	}
+	if len(recorder.Events) != 0 {
+		t.Error("No event must be recorded without transition")
+	}
+}
+
+func TestReconcileImplReEnabledRestoresRoute(t *testing.T) {
+	var registered string
+	route := newStaticRouteWithValues(true, true)
+	route.Status.NodeStatus[0].Reason = iksv1.ReasonDisabled
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered = n
+			return nil
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if registered != "CR" {
+		t.Error("Route must be registered again")
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].Reason != "" {
+		t.Errorf("Disabled reason must be cleared: %s", instance.Status.NodeStatus[0].Reason)
+	}
+	if len(recorder.Events) != 1 || !strings.HasPrefix(<-recorder.Events, "Normal RouteEnabled") {
+		t.Error("Transition must be recorded as an event")
+	}
+}
+
+func TestReconcileImplKillSwitchWithdrawsRoute(t *testing.T) {
+	deRegistered := []string{}
+	params, mockClient := getReconcileContextForKillSwitch(newStaticRouteWithValues(true, true), KillSwitchDisabled)
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: true,
+		registeredCallback: func(string, routemanager.Route) error {
+			t.Error("Route must be not registered while the kill switch is engaged")
+			return nil
+		},
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+
+	res, err := reconcileImpl(*params)
+
+	if res != routeKilled {
+		t.Error("Result must be routeKilled")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR"}) {
+		t.Errorf("Route must be deregistered: %v", deRegistered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != iksv1.ReasonKillSwitch || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodeDisabled {
+		t.Errorf("Status must tell the kill switch: %v", instance.Status.NodeStatus)
+	}
+	if len(recorder.Events) != 1 || !strings.HasPrefix(<-recorder.Events, "Warning KillSwitchEngaged") {
+		t.Error("Transition must be recorded as an event")
+	}
+}
+
+func TestReconcileImplKillSwitchReleased(t *testing.T) {
+	registered := ""
+	route := newStaticRouteWithValues(true, true)
+	route.Status.NodeStatus[0].Reason = iksv1.ReasonKillSwitch
+	params, _ := getReconcileContextForKillSwitch(route, "enabled")
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered = n
+			return nil
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished || err != nil {
+		t.Errorf("Result must be finished: %v", err)
+	}
+	if registered != "CR" {
+		t.Error("Route must be restored after the kill switch is released")
+	}
+	if len(recorder.Events) != 1 || !strings.HasPrefix(<-recorder.Events, "Normal KillSwitchReleased") {
+		t.Error("Transition must be recorded as an event")
+	}
+}
+
+func TestReconcileImplKillSwitchMissingIsReleased(t *testing.T) {
+	params, _ := getReconcileContextForAddFlow(nil, false)
+	params.options.KillSwitch = types.NamespacedName{Namespace: "kube-system", Name: "kill-switch"}
+
+	if res, err := reconcileImpl(*params); res != finished || err != nil {
+		t.Errorf("Missing kill switch must not withdraw the route: %v", err)
+	}
+}
+
+func getReconcileContextForKillSwitch(route *iksv1.StaticRoute, state string) (*reconcileImplParams, *reconcileImplClientMock) {
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.KillSwitch = types.NamespacedName{Namespace: "kube-system", Name: "kill-switch"}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "kill-switch"},
+		Data:       map[string]string{KillSwitchKey: state},
+	}
+	if err := mockClient.client.(client.Client).Create(context.Background(), configMap); err != nil {
+		panic(err)
+	}
+	return params, mockClient
+}
+
+func TestReconcileImplProtectedSubnetsChangeWithdrawsRoute(t *testing.T) {
+	deRegistered := []string{}
+	params, mockClient := getReconcileContextForAddFlow(nil, true)
+	params.options.ProtectedSubnetsConfigMap = types.NamespacedName{Namespace: "kube-system", Name: "protected-subnets"}
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: true,
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "protected-subnets"},
+		Data:       map[string]string{"infrastructure": "172.16.0.0/12"},
+	}
+	if err := mockClient.client.(client.Client).Create(context.Background(), configMap); err != nil {
+		t.Fatalf("Failed to create the ConfigMap: %s", err.Error())
+	}
+
+	if res, err := reconcileImpl(*params); res != finished || err != nil {
+		t.Errorf("Route must be applied while its subnet is not protected: %v", err)
+	}
+	if len(deRegistered) != 0 {
+		t.Errorf("Route must not be withdrawn: %v", deRegistered)
+	}
+
+	configMap.Data["infrastructure"] = "172.16.0.0/12, 10.0.0.0/8"
+	if err := mockClient.client.(client.Client).Update(context.Background(), configMap); err != nil {
+		t.Fatalf("Failed to update the ConfigMap: %s", err.Error())
+	}
+	res, err := reconcileImpl(*params)
+
+	if res != overlapsProtected {
+		t.Error("Result must be overlapsProtected")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR"}) {
+		t.Errorf("Route must be withdrawn: %v", deRegistered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != iksv1.ReasonProtectedSubnetRejected || len(instance.Status.NodeStatus[0].Error) == 0 || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodeProtectedSubnet {
+		t.Errorf("Status must tell the protection: %v", instance.Status.NodeStatus)
+	}
+	if len(recorder.Events) != 1 || !strings.HasPrefix(<-recorder.Events, "Warning ProtectedSubnetRejected") {
+		t.Error("Withdrawal must be recorded as an event")
+	}
+
+	if _, err := reconcileImpl(*params); err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if len(recorder.Events) != 0 {
+		t.Error("Withdrawal must be recorded once")
+	}
+}
+
+func TestReconcileImplProtectedSubnetsWithdrawListedSubnet(t *testing.T) {
+	deRegistered := []string{}
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Subnets = []string{"10.1.0.0/16", "172.16.0.0/16"}
+	params, _ := getReconcileContextForAddFlow(route, true)
+	params.options.ProtectedSubnets = []*net.IPNet{&net.IPNet{IP: net.IP{172, 16, 0, 0}, Mask: net.CIDRMask(12, 32)}}
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: true,
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+	}
+
+	if _, err := reconcileImpl(*params); err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR/172.16.0.0/16"}) {
+		t.Errorf("Route of the protected subnet must be withdrawn: %v", deRegistered)
+	}
+}
+
+func TestReconcileImplProtectedRouteCanBeDeleted(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	now := metav1.Now()
+	route.SetDeletionTimestamp(&now)
+	params, _ := getReconcileContextForAddFlow(route, true)
+	params.options.ProtectedSubnets = []*net.IPNet{&net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)}}
+	deRegistered := []string{}
+	params.options.RouteManager = routeManagerMock{
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+	}
+
+	if res, _ := reconcileImpl(*params); res == overlapsProtected {
+		t.Error("Deletion must be not rejected")
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR"}) {
+		t.Errorf("Route must be deregistered: %v", deRegistered)
+	}
+}
+
+func TestReconcileImplProtectedSubnetsInvalid(t *testing.T) {
+	params, mockClient := getReconcileContextForAddFlow(nil, true)
+	params.options.ProtectedSubnetsConfigMap = types.NamespacedName{Namespace: "kube-system", Name: "protected-subnets"}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "protected-subnets"},
+		Data:       map[string]string{"infrastructure": "172.16.0.0"},
+	}
+	if err := mockClient.client.(client.Client).Create(context.Background(), configMap); err != nil {
+		t.Fatalf("Failed to create the ConfigMap: %s", err.Error())
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != protectedSubnetsGetError {
+		t.Error("Result must be protectedSubnetsGetError")
+	}
+	if err == nil || err.Error() != "Invalid protected subnet 'infrastructure=172.16.0.0' in ConfigMap kube-system/protected-subnets" {
+		t.Errorf("Error mismatch: %v", err)
+	}
+}
+
+func TestWatchedConfigMaps(t *testing.T) {
+	killSwitch := types.NamespacedName{Namespace: "kube-system", Name: "kill-switch"}
+	protected := types.NamespacedName{Namespace: "kube-system", Name: "protected-subnets"}
+
+	if configMaps := watchedConfigMaps(ManagerOptions{}); len(configMaps) != 0 {
+		t.Errorf("No ConfigMap must be watched: %v", configMaps)
+	}
+	if configMaps := watchedConfigMaps(ManagerOptions{KillSwitch: killSwitch, ProtectedSubnetsConfigMap: protected}); !reflect.DeepEqual(configMaps, map[types.NamespacedName]bool{killSwitch: true, protected: true}) {
+		t.Errorf("Both ConfigMaps must be watched: %v", configMaps)
+	}
+}
+
+func TestReconcileImplGatewayDegraded(t *testing.T) {
+	var testData = []struct {
+		subnet      string
+		subnets     []string
+		degradedFor string
+	}{
+		{"10.0.0.1/16", nil, "CR"},
+		{"", []string{"10.1.0.0/16", "10.2.0.0/16"}, "CR/10.2.0.0/16"},
+	}
+	for i, td := range testData {
+		route := newStaticRouteWithValues(true, false)
+		route.Spec.Subnet = td.subnet
+		route.Spec.Subnets = td.subnets
+		params, mockClient := getReconcileContextForAddFlow(route, false)
+		params.options.RouteManager = routeManagerMock{
+			isDegradedCallback: func(n string) bool {
+				return n == td.degradedFor
+			},
+		}
+		recorder := record.NewFakeRecorder(10)
+		params.recorder = recorder
+
+		res, err := reconcileImpl(*params)
+
+		if res != finished {
+			t.Errorf("Result must be finished at %d", i)
+		}
+		if err != nil {
+			t.Errorf("Error must be nil: %s", err.Error())
+		}
+		instance := &iksv1.StaticRoute{}
+		if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+			t.Errorf("Failed to read the CR: %s", err.Error())
+		}
+		if instance.Status.NodeStatus[0].Reason != iksv1.ReasonDegraded || instance.Status.NodeStatus[0].Error != "" || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodeGatewayUnreachable {
+			t.Errorf("Status must be degraded at %d: %v", i, instance.Status.NodeStatus[0])
+		}
+		if len(recorder.Events) != 1 || !strings.HasPrefix(<-recorder.Events, "Warning GatewayDegraded") {
+			t.Errorf("Transition must be recorded as an event at %d", i)
+		}
+	}
+}
+
+func TestReconcileImplGatewayStillDegraded(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Status.NodeStatus[0].Reason = iksv1.ReasonDegraded
+	params, _ := getReconcileContextForAddFlow(route, true)
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: true,
+		isDegradedCallback: func(string) bool {
+			return true
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+
+	if _, err := reconcileImpl(*params); err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+
+	if len(recorder.Events) != 0 {
+		t.Error("Event must be recorded only on transition")
+	}
+}
+
+func TestReconcileImplMergedNexthops(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		nexthopsCallback: func(n string) []routemanager.Nexthop {
+			if n != "CR" {
+				t.Errorf("Nexthops of another route are queried: %s", n)
+			}
+			return []routemanager.Nexthop{{Gw: net.IP{10, 0, 0, 1}, Weight: 3}, {Gw: net.IP{10, 0, 0, 2}, Weight: 1}}
+		},
+	}
+
+	if _, err := reconcileImpl(*params); err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+
+	instance := &iksv1.StaticRoute{}
+	if err := mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	expected := []iksv1.StaticRouteNexthopStatus{{Gateway: "10.0.0.1", Weight: 3}, {Gateway: "10.0.0.2", Weight: 1}}
+	if !reflect.DeepEqual(instance.Status.NodeStatus[0].Nexthops, expected) {
+		t.Errorf("Nexthops must be reported: %v", instance.Status.NodeStatus[0].Nexthops)
+	}
+}
+
+func TestReconcileImplGatewayRecovered(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Status.NodeStatus[0].Reason = iksv1.ReasonDegraded
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].Reason != "" {
+		t.Errorf("Degraded reason must be cleared: %s", instance.Status.NodeStatus[0].Reason)
+	}
+	if len(recorder.Events) != 1 || !strings.HasPrefix(<-recorder.Events, "Normal GatewayRecovered") {
+		t.Error("Transition must be recorded as an event")
+	}
+}
+
+func TestReconcileImplRecordsInstallTime(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+
+	if res, err := reconcileImpl(*params); res != finished || err != nil {
+		t.Errorf("Result must be finished: %v", err)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err := mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	installedAt := instance.Status.NodeStatus[0].InstalledAt
+	if installedAt == nil {
+		t.Fatal("Install time must be recorded")
+	}
+
+	if res, err := reconcileImpl(*params); res != finished || err != nil {
+		t.Errorf("Result must be finished: %v", err)
+	}
+	if err := mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if !installedAt.Equal(instance.Status.NodeStatus[0].InstalledAt) {
+		t.Errorf("Install time must be kept: %v", instance.Status.NodeStatus[0].InstalledAt)
+	}
+}
+
+func TestReconcileImplClearsInstallTimeOfWithdrawnRoute(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.Disabled = true
+	installedAt := metav1.Now()
+	route.Status.NodeStatus[0].InstalledAt = &installedAt
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+
+	if res, _ := reconcileImpl(*params); res != routeDisabled {
+		t.Error("Result must be routeDisabled")
+	}
+	instance := &iksv1.StaticRoute{}
+	if err := mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].InstalledAt != nil {
+		t.Errorf("Install time must be cleared: %v", instance.Status.NodeStatus[0].InstalledAt)
+	}
+}
+
+func TestApplyReportedRoutes(t *testing.T) {
+	applied := newStaticRouteWithValues(true, true)
+	applied.Spec.Tables = []int{200, 300}
+	applied.Status.NodeStatus[0].Tables = []iksv1.StaticRouteTableStatus{{Table: 200}, {Table: 300, Error: "bla"}}
+	listed := newStaticRouteWithValues(true, true)
+	listed.SetName("listed")
+	listed.Spec.Subnet, listed.Status.NodeStatus[0].State.Subnet = "", ""
+	listed.Spec.Subnets = []string{"10.2.0.0/16", "10.3.0.0/16"}
+	listed.Status.NodeStatus[0].Subnets = []iksv1.StaticRouteSubnetStatus{{Subnet: "10.2.0.0/16"}, {Subnet: "10.3.0.0/16", Error: "bla"}}
+	failed := newStaticRouteWithValues(true, true)
+	failed.SetName("failed")
+	failed.Status.NodeStatus[0].Error = "bla"
+	disabled := newStaticRouteWithValues(true, true)
+	disabled.SetName("disabled")
+	disabled.Status.NodeStatus[0].Reason = iksv1.ReasonDisabled
+	changed := newStaticRouteWithValues(true, true)
+	changed.SetName("changed")
+	changed.Spec.Gateway = "10.0.0.2"
+	paused := newStaticRouteWithValues(true, true)
+	paused.SetName("paused")
+	paused.SetAnnotations(map[string]string{iksv1.PauseAnnotation: "true"})
+	otherNode := newStaticRouteWithValues(true, true)
+	otherNode.SetName("other-node")
+	otherNode.Status.NodeStatus[0].Hostname = "other"
+	notReported := newStaticRouteWithValues(true, false)
+	notReported.SetName("not-reported")
+	mockClient := reconcileImplClientMock{
+		client: newFakeClient(applied, listed, failed, disabled, changed, paused, otherNode, notReported),
+	}
+	params := newReconcileImplParams(&mockClient)
+	params.options.Hostname = "hostname"
+	params.options.Table = 100
+	var batches []map[string]routemanager.Route
+	params.options.RouteManager = routeManagerMock{
+		appliedRoutesCallback: func(routes map[string]routemanager.Route) map[string]error {
+			batches = append(batches, routes)
+			return map[string]error{"CR": errors.New("bla")}
+		},
+	}
+
+	applyReportedRoutes(*params, log)
+
+	if len(batches) != 1 || len(batches[0]) != 3 {
+		t.Fatalf("Reported routes must be applied in a single batch: %v", batches)
+	}
+	if route, found := batches[0]["CR"]; !found || route.Dst.String() != "10.0.0.0/16" || !route.Gw.Equal(net.IP{10, 0, 0, 1}) || route.Table != 100 {
+		t.Errorf("Route of the CR not match: %v", batches[0])
+	}
+	if _, found := batches[0]["listed/10.2.0.0/16"]; !found {
+		t.Errorf("Route of the subnet not match: %v", batches[0])
+	}
+	if route, found := batches[0]["CR/table/200"]; !found || route.Table != 200 {
+		t.Errorf("Route of the table not match: %v", batches[0])
+	}
+}
+
+func TestApplyReportedRoutesByInstallPriority(t *testing.T) {
+	routes := []*iksv1.StaticRoute{}
+	for _, item := range []struct {
+		name     string
+		priority int
+	}{{"default", 0}, {"apiserver", 100}, {"bulk", -10}, {"dns", 50}, {"dns-secondary", 50}} {
+		route := newStaticRouteWithValues(true, true)
+		route.SetName(item.name)
+		route.Spec.InstallPriority = item.priority
+		routes = append(routes, route)
+	}
+	mockClient := reconcileImplClientMock{client: newFakeClient(routes...)}
+	params := newReconcileImplParams(&mockClient)
+	params.options.Hostname = "hostname"
+	var order [][]string
+	params.options.RouteManager = routeManagerMock{
+		appliedRoutesCallback: func(routes map[string]routemanager.Route) map[string]error {
+			names := []string{}
+			for name := range routes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			order = append(order, names)
+			return nil
+		},
+	}
+
+	applyReportedRoutes(*params, log)
+
+	expected := [][]string{{"apiserver"}, {"dns", "dns-secondary"}, {"default"}, {"bulk"}}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Routes must be applied by decreasing install priority: %v", order)
+	}
+}
+
+func TestApplyReportedRoutesListFails(t *testing.T) {
+	params, mockClient := getReconcileContextForAddFlow(nil, false)
+	mockClient.listErr = errors.New("bla")
+	params.options.RouteManager = routeManagerMock{
+		appliedRoutesCallback: func(routes map[string]routemanager.Route) map[string]error {
+			t.Error("Nothing must be applied")
+			return nil
+		},
+	}
+
+	applyReportedRoutes(*params, log)
+}
+
+func TestReconcileImplOperatorsIgnoreRoutesOfEachOther(t *testing.T) {
+	var testData = []struct {
+		label      string
+		operatorID string
+		managed    bool
+	}{
+		{"", "", true},
+		{"", "1", false},
+		{"1", "", false},
+		{"1", "1", true},
+		{"1", "2", false},
+	}
+	for _, td := range testData {
+		route := newStaticRouteWithValues(true, false)
+		if td.label != "" {
+			route.SetLabels(map[string]string{iksv1.OperatorIDLabel: td.label})
+		}
+		params, mockClient := getReconcileContextForAddFlow(route, false)
+		params.options.OperatorID = td.operatorID
+		registered := false
+		params.options.RouteManager = routeManagerMock{
+			registeredCallback: func(string, routemanager.Route) error {
+				registered = true
+				return nil
+			},
+		}
+
+		res, err := reconcileImpl(*params)
+
+		if err != nil {
+			t.Errorf("Error must be nil: %s", err.Error())
+		}
+		if registered != td.managed || (res == otherOperator) == td.managed {
+			t.Errorf("Route labeled %q must be managed by operator %q: %t", td.label, td.operatorID, td.managed)
+		}
+		instance := &iksv1.StaticRoute{}
+		if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+			t.Errorf("Failed to read the CR: %s", err.Error())
+		}
+		if !td.managed && (len(instance.Status.NodeStatus) != 0 || len(instance.GetFinalizers()) != 0) {
+			t.Errorf("Route of another operator must be untouched: %v", instance)
+		}
+	}
+}
+
+func TestReconcileImplWaitsForInterface(t *testing.T) {
+	deRegistered := []string{}
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.RequireInterfaceUp = "tun0"
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: true,
+		registeredCallback: func(string, routemanager.Route) error {
+			t.Error("Route must be not registered while the interface is down")
+			return nil
+		},
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			return nil
+		},
+		isLinkUpCallback: func(n string) bool {
+			if n != "tun0" {
+				t.Errorf("Required interface must be checked: %s", n)
+			}
+			return false
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != routeWaiting {
+		t.Error("Result must be routeWaiting")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR"}) {
+		t.Errorf("Route must be withdrawn: %v", deRegistered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].Reason != iksv1.ReasonWaitingForInterface || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodePending {
+		t.Errorf("Status must be waiting for interface: %v", instance.Status.NodeStatus)
+	}
+}
+
+func TestReconcileImplInterfaceUpAppliesRoute(t *testing.T) {
+	var registered string
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.RequireInterfaceUp = "tun0"
+	route.Status.NodeStatus[0].Reason = iksv1.ReasonWaitingForInterface
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered = n
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if registered != "CR" {
+		t.Error("Route must be registered when the interface is up")
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].Reason != "" {
+		t.Errorf("Waiting reason must be cleared: %s", instance.Status.NodeStatus[0].Reason)
+	}
+}
+
+func TestReconcileImplAutoGateway(t *testing.T) {
+	var registered routemanager.Route
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Gateway = iksv1.GatewayAuto
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.GatewayResolver = &routemanager.FakeGatewayResolver{Gateway: net.IP{10, 0, 0, 1}}
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered = r
+			return nil
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !registered.Gw.Equal(net.IP{10, 0, 0, 1}) {
+		t.Errorf("Route must be registered through the default gateway: %v", registered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if status := instance.Status.NodeStatus[0]; status.State.Gateway != "10.0.0.1" || status.ResolvedGateway != "10.0.0.1" || status.LastResolution == nil || status.GatewayChanges != 0 {
+		t.Errorf("Resolved gateway must be reported: %+v", status)
+	}
+}
+
+func TestReconcileImplAutoGatewayChanged(t *testing.T) {
+	var registered routemanager.Route
+	deRegistered := []string{}
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.Gateway = iksv1.GatewayAuto
+	route.Status.NodeStatus[0].State.Gateway = "10.0.0.9"
+	route.Status.NodeStatus[0].GatewayChanges = 1
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	params.options.GatewayResolver = &routemanager.FakeGatewayResolver{Gateway: net.IP{10, 0, 0, 1}}
+	registeredNames := map[string]bool{"CR": true}
+	params.options.RouteManager = routeManagerMock{
+		isRegisteredCallback: func(n string) bool {
+			return registeredNames[n]
+		},
+		registeredCallback: func(n string, r routemanager.Route) error {
+			registered = r
+			return nil
+		},
+		deRegisteredCallback: func(n string) error {
+			deRegistered = append(deRegistered, n)
+			delete(registeredNames, n)
+			return nil
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !reflect.DeepEqual(deRegistered, []string{"CR"}) || !registered.Gw.Equal(net.IP{10, 0, 0, 1}) {
+		t.Errorf("Route must be replaced through the new gateway: %v %v", deRegistered, registered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if status := instance.Status.NodeStatus[0]; status.State.Gateway != "10.0.0.1" || status.GatewayChanges != 2 {
+		t.Errorf("Gateway change must be reported: %+v", status)
+	}
+	if len(recorder.Events) != 1 || <-recorder.Events != "Normal GatewayChanged Gateway changed from 10.0.0.9 to 10.0.0.1 on node hostname" {
+		t.Error("Gateway change must be recorded as an event")
+	}
+}
+
+func TestGatewayWatcherRequestsReconcileOfOwner(t *testing.T) {
+	events := make(chan event.GenericEvent)
+	watcher := routeManagerWatcher{events: events}
+
+	watcher.GatewayStateChanged("CR/10.1.0.0/16", true)
+
+	select {
+	case e := <-events:
+		if e.Meta.GetName() != "CR" {
+			t.Errorf("Owner of the route must be reconciled: %s", e.Meta.GetName())
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Event must be sent")
+	}
+}
+
+func TestLinkStateChangeRequestsReconcileOfDependents(t *testing.T) {
+	vpn := newStaticRouteWithValues(true, false)
+	vpn.Spec.RequireInterfaceUp = "tun0"
+	other := newStaticRouteWithValues(true, false)
+	other.SetName("other")
+	events := make(chan event.GenericEvent)
+	watcher := routeManagerWatcher{events: events, client: newFakeClient(vpn, other)}
+
+	watcher.LinkStateChanged("tun0", false)
+
+	select {
+	case e := <-events:
+		if e.Meta.GetName() != "CR" {
+			t.Errorf("Route requiring the interface must be reconciled: %s", e.Meta.GetName())
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Event must be sent")
+	}
+	select {
+	case e := <-events:
+		t.Errorf("Other routes must be not reconciled: %s", e.Meta.GetName())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDefaultRouteChangeRequestsReconcileOfAutoGateways(t *testing.T) {
+	auto := newStaticRouteWithValues(true, false)
+	auto.Spec.Gateway = iksv1.GatewayAuto
+	other := newStaticRouteWithValues(true, false)
+	other.SetName("other")
+	events := make(chan event.GenericEvent)
+	watcher := routeManagerWatcher{events: events, client: newFakeClient(auto, other)}
+
+	watcher.DefaultRouteChanged()
+
+	select {
+	case e := <-events:
+		if e.Meta.GetName() != "CR" {
+			t.Errorf("Route with automatic gateway must be reconciled: %s", e.Meta.GetName())
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Event must be sent")
+	}
+	select {
+	case e := <-events:
+		t.Errorf("Other routes must be not reconciled: %s", e.Meta.GetName())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestIsUnschedulableChanged(t *testing.T) {
+	cordoned := &corev1.Node{Spec: corev1.NodeSpec{Unschedulable: true}}
+	if !isUnschedulableChanged(&corev1.Node{}, cordoned) {
+		t.Error("Cordon must be detected")
+	}
+	if isUnschedulableChanged(cordoned, cordoned) {
+		t.Error("Unchanged node must be not detected")
+	}
+	if isUnschedulableChanged(&iksv1.StaticRoute{}, cordoned) {
+		t.Error("Other objects must be ignored")
+	}
+}
+
+func getReconcileContextForFlush(token string, flushed *iksv1.StaticRouteFlushStatus, flushTable func(int) (int, error)) (*reconcileImplParams, *reconcileImplClientMock) {
+	route := newStaticRouteWithValues(true, true)
+	route.SetAnnotations(map[string]string{iksv1.FlushTableAnnotation: token})
+	route.Status.NodeStatus[0].Flush = flushed
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	params.options.Table = 100
+	params.options.RouteManager = routeManagerMock{
+		isRegistered:       true,
+		flushTableCallback: flushTable,
+	}
+	return params, mockClient
+}
+
+func getFlushStatus(t *testing.T, mockClient *reconcileImplClientMock) *iksv1.StaticRouteFlushStatus {
+	instance := &iksv1.StaticRoute{}
+	if err := mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 {
+		t.Errorf("Status must contain the node: %v", instance.Status.NodeStatus)
+		return nil
+	}
+	return instance.Status.NodeStatus[0].Flush
+}
+
+func TestReconcileImplFlushTable(t *testing.T) {
+	var flushedTable int
+	params, mockClient := getReconcileContextForFlush("first", nil, func(table int) (int, error) {
+		flushedTable = table
+		return 2, nil
+	})
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if flushedTable != 100 {
+		t.Errorf("Target table must be flushed: %d", flushedTable)
+	}
+	if flush := getFlushStatus(t, mockClient); flush == nil || *flush != (iksv1.StaticRouteFlushStatus{Token: "first", Removed: 2}) {
+		t.Errorf("Flush must be recorded in the status: %v", flush)
+	}
+}
+
+func TestReconcileImplFlushTableAlreadyDone(t *testing.T) {
+	params, mockClient := getReconcileContextForFlush("first", &iksv1.StaticRouteFlushStatus{Token: "first", Removed: 2}, func(table int) (int, error) {
+		t.Error("Table must be flushed once per token")
+		return 0, nil
+	})
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if flush := getFlushStatus(t, mockClient); flush == nil || flush.Token != "first" {
+		t.Errorf("Flush status must be kept: %v", flush)
+	}
+}
+
+func TestReconcileImplFlushTableProtected(t *testing.T) {
+	params, mockClient := getReconcileContextForFlush("first", nil, func(table int) (int, error) {
+		return 0, routemanager.ErrTableProtected
+	})
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if flush := getFlushStatus(t, mockClient); flush == nil || flush.Token != "first" || flush.Error != routemanager.ErrTableProtected.Error() {
+		t.Errorf("Refused flush must be recorded in the status: %v", flush)
+	}
+}
+
+func TestReconcileImplFlushTableFails(t *testing.T) {
+	params, _ := getReconcileContextForFlush("first", nil, func(table int) (int, error) {
+		return 0, errors.New("bla")
+	})
+
+	res, err := reconcileImpl(*params)
+
+	if res != flushTableError {
+		t.Error("Result must be flushTableError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+}
+
+func getReconcileContextForEnsureAbsent(removedRoutes int, ensureAbsent func(routemanager.Route) (int, error)) (*reconcileImplParams, *reconcileImplClientMock, *record.FakeRecorder) {
+	route := newStaticRouteWithValues(true, true)
+	route.Spec.EnsureAbsent = true
+	route.Status.NodeStatus[0].State.EnsureAbsent = true
+	route.Status.NodeStatus[0].RemovedRoutes = removedRoutes
+	params, mockClient := getReconcileContextForAddFlow(route, false)
+	params.options.RouteManager = routeManagerMock{
+		ensureAbsentCallback: ensureAbsent,
+	}
+	recorder := record.NewFakeRecorder(10)
+	params.recorder = recorder
+	return params, mockClient, recorder
+}
+
+func TestReconcileImplEnsureAbsent(t *testing.T) {
+	var absent routemanager.Route
+	params, mockClient, recorder := getReconcileContextForEnsureAbsent(3, func(route routemanager.Route) (int, error) {
+		absent = route
+		return 2, nil
+	})
+
+	res, err := reconcileImpl(*params)
+
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if res.RequeueAfter != defaultEnsureAbsentInterval {
+		t.Errorf("Absent route must be checked periodically: %v", res)
+	}
+	if absent.Dst.String() != "10.0.0.0/16" || !absent.Gw.Equal(net.IP{10, 0, 0, 1}) {
+		t.Errorf("Route to the subnet through the gateway must be removed: %v", absent)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err := mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 || instance.Status.NodeStatus[0].RemovedRoutes != 5 {
+		t.Errorf("Removed routes must be counted in the status: %v", instance.Status.NodeStatus)
+	}
+	if len(instance.GetFinalizers()) != 0 {
+		t.Error("Finalizer must not be set for an absent route")
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, "Warning RouteRemoved") {
+			t.Errorf("Unexpected event: %s", event)
+		}
+	default:
+		t.Error("Removal must be recorded as an event")
+	}
+}
+
+func TestReconcileImplEnsureAbsentNothingToRemove(t *testing.T) {
+	params, _, recorder := getReconcileContextForEnsureAbsent(0, func(route routemanager.Route) (int, error) {
+		return 0, nil
+	})
+	params.options.ReconcileInterval = time.Second
+
+	res, err := reconcileImpl(*params)
+
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if res.RequeueAfter != time.Second {
+		t.Errorf("Reconcile interval must be used: %v", res)
+	}
+	if len(recorder.Events) != 0 {
+		t.Error("No event must be recorded")
+	}
+}
+
+func TestReconcileImplEnsureAbsentFails(t *testing.T) {
+	params, _, _ := getReconcileContextForEnsureAbsent(0, func(route routemanager.Route) (int, error) {
+		return 0, errors.New("bla")
+	})
+
+	res, err := reconcileImpl(*params)
+
+	if res != ensureAbsentError {
+		t.Error("Result must be ensureAbsentError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+}
+
+func TestReconcileImplEnsureAbsentRefusedForAPIServerRoute(t *testing.T) {
+	params, mockClient, _ := getReconcileContextForEnsureAbsent(0, func(route routemanager.Route) (int, error) {
+		return 0, routemanager.ErrAPIServerRoute
+	})
+
+	res, err := reconcileImpl(*params)
+
+	if res != ensureAbsentError || err != routemanager.ErrAPIServerRoute {
+		t.Errorf("Clobbering the route to the apiserver must fail: %v %v", res, err)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if status := instance.Status.NodeStatus[0]; status.Reason != iksv1.ReasonInvalidRoute || status.Error != routemanager.ErrAPIServerRoute.Error() {
+		t.Errorf("Refused route must be reported as invalid: %+v", status)
+	}
+}
+
+func TestReasonCode(t *testing.T) {
+	var testData = []struct {
+		res    *reconcile.Result
+		reason string
+		serr   error
+		code   string
+	}{
+		{finished, "", nil, iksv1.ReasonCodeApplied},
+		{&reconcile.Result{RequeueAfter: time.Minute}, "", nil, iksv1.ReasonCodeApplied},
+		{overlapsProtected, iksv1.ReasonProtectedSubnetRejected, errors.New("bla"), iksv1.ReasonCodeProtectedSubnet},
+		{invalidGatewayError, "", nil, iksv1.ReasonCodeInvalidSpec},
+		{invalidRouteError, iksv1.ReasonInvalidRoute, routemanager.ErrInvalidTable, iksv1.ReasonCodeInvalidSpec},
+		{wrongSourceError, "", errInvalidSourceAddress, iksv1.ReasonCodeInvalidSpec},
+		{invalidTosError, "", errInvalidTos, iksv1.ReasonCodeInvalidSpec},
+		{invalidOnLinkError, "", errOnLinkInterface, iksv1.ReasonCodeInvalidSpec},
+		{invalidFwMarkErr, "", errors.New("bla"), iksv1.ReasonCodeInvalidSpec},
+		{ambiguousGateway, "", errAmbiguousGateway, iksv1.ReasonCodeInvalidSpec},
+		{noSubnetError, "", errNoSubnet, iksv1.ReasonCodeInvalidSpec},
+		{parseSubnetError, "", errInvalidSubnet, iksv1.ReasonCodeInvalidSpec},
+		{wrongSelectorErr, "", nil, iksv1.ReasonCodeInvalidSpec},
+		{ensureAbsentError, iksv1.ReasonInvalidRoute, routemanager.ErrAPIServerRoute, iksv1.ReasonCodeInvalidSpec},
+		{registerRouteError, "", errors.New("bla"), iksv1.ReasonCodeNetlinkError},
+		{registerSubnetsError, "", errors.New("bla"), iksv1.ReasonCodeNetlinkError},
+		{registerTablesError, "", errors.New("bla"), iksv1.ReasonCodeNetlinkError},
+		{verifyRouteError, "", errors.New("bla"), iksv1.ReasonCodeNetlinkError},
+		{flushTableError, "", errors.New("bla"), iksv1.ReasonCodeNetlinkError},
+		{ensureAbsentError, "", errors.New("bla"), iksv1.ReasonCodeNetlinkError},
+		{deRegisterError, "", errors.New("bla"), iksv1.ReasonCodeNetlinkError},
+		{routeGetError, "", errors.New("bla"), iksv1.ReasonCodeNetlinkError},
+		{registerRouteError, iksv1.ReasonNetlinkTimeout, routemanager.ErrNetlinkTimeout, iksv1.ReasonCodeNetlinkError},
+		{gatewayNotDirectlyRoutableError, "", errors.New("bla"), iksv1.ReasonCodeGatewayUnreachable},
+		{gatewayResolveError, "", errors.New("bla"), iksv1.ReasonCodeGatewayUnreachable},
+		{finished, iksv1.ReasonDegraded, nil, iksv1.ReasonCodeGatewayUnreachable},
+		{routePending, iksv1.ReasonPending, errors.New("network is unreachable"), iksv1.ReasonCodePending},
+		{routeWaiting, iksv1.ReasonWaitingForInterface, nil, iksv1.ReasonCodePending},
+		{registerRouteError, iksv1.ReasonInterfaceMissing, errors.New("bla"), iksv1.ReasonCodePending},
+		{registerRouteError, iksv1.ReasonVrfNotFound, routemanager.ErrVrfNotFound, iksv1.ReasonCodePending},
+		{killSwitchGetError, "", errors.New("bla"), iksv1.ReasonCodeReconcileError},
+		{networkGroupGetError, "", errors.New("bla"), iksv1.ReasonCodeReconcileError},
+		{addStatusUpdateError, "", errors.New("bla"), iksv1.ReasonCodeReconcileError},
+		{reconcilePanicError, "", errors.New("bla"), iksv1.ReasonCodeReconcileError},
+		{&reconcile.Result{}, "", errors.New("bla"), iksv1.ReasonCodeReconcileError},
+		{routeDisabled, iksv1.ReasonDisabled, nil, iksv1.ReasonCodeDisabled},
+		{routeExpired, iksv1.ReasonExpired, nil, iksv1.ReasonCodeDisabled},
+		{routeDrained, iksv1.ReasonDrained, nil, iksv1.ReasonCodeDisabled},
+		{routeKilled, iksv1.ReasonKillSwitch, nil, iksv1.ReasonCodeDisabled},
+		{routePaused, iksv1.ReasonPaused, nil, iksv1.ReasonCodePaused},
+		{routeConflicting, iksv1.ReasonConflicting, errors.New("bla"), iksv1.ReasonCodeConflicting},
+	}
+
+	for i, td := range testData {
+		if code := reasonCode(td.res, td.reason, td.serr); code != td.code {
+			t.Errorf("Code must be %s, it is %s at %d", td.code, code, i)
+		}
+	}
+}
+
+func getReconcileContextForConflict(createdAt, otherCreatedAt time.Time, otherTos int) (*reconcileImplParams, *reconcileImplClientMock, *[]string) {
+	route := newStaticRouteWithValues(true, false)
+	route.SetCreationTimestamp(metav1.NewTime(createdAt))
+	other := newStaticRouteWithValues(true, false)
+	other.SetName("other")
+	other.SetCreationTimestamp(metav1.NewTime(otherCreatedAt))
+	other.Spec.Tos = otherTos
+	mockClient := reconcileImplClientMock{
+		client: newFakeClient(route, other),
+	}
+	params := newReconcileImplParams(&mockClient)
+	params.options.Hostname = "hostname"
+	params.options.GatewayResolver = &routemanager.FakeGatewayResolver{}
+	registered := []string{}
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(name string, r routemanager.Route) error {
+			registered = append(registered, name)
+			return nil
+		},
+	}
+	return params, &mockClient, &registered
+}
+
+func TestReconcileImplConflictOlderWins(t *testing.T) {
+	now := time.Now()
+	params, _, registered := getReconcileContextForConflict(now.Add(-time.Hour), now, 0)
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if len(*registered) != 1 {
+		t.Errorf("Older route must be installed: %v", *registered)
+	}
+}
+
+func TestReconcileImplConflictNewerLoses(t *testing.T) {
+	now := time.Now()
+	params, mockClient, registered := getReconcileContextForConflict(now, now.Add(-time.Hour), 0)
+	deRegistered := []string{}
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(name string, r routemanager.Route) error {
+			*registered = append(*registered, name)
+			return nil
+		},
+		deRegisteredCallback: func(name string) error {
+			deRegistered = append(deRegistered, name)
+			return routemanager.ErrNotFound
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != routeConflicting {
+		t.Error("Result must be routeConflicting")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if len(*registered) != 0 {
+		t.Errorf("Newer route must be not installed: %v", *registered)
+	}
+	if len(deRegistered) != 1 || deRegistered[0] != "CR" {
+		t.Errorf("Own route must be deregistered: %v", deRegistered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].Reason != iksv1.ReasonConflicting || !strings.Contains(instance.Status.NodeStatus[0].Error, "other") || instance.Status.NodeStatus[0].ReasonCode != iksv1.ReasonCodeConflicting {
+		t.Errorf("Conflict must be reported in the status: %v", instance.Status.NodeStatus[0])
+	}
+}
+
+func getReconcileContextForFailover(route *iksv1.StaticRoute, members ...*iksv1.StaticRoute) (*reconcileImplParams, *reconcileImplClientMock, map[string]routemanager.Route) {
+	route.Spec.FailoverGroup = "uplink"
+	mockClient := reconcileImplClientMock{
+		client: newFakeClient(append([]*iksv1.StaticRoute{route}, members...)...),
+	}
+	params := newReconcileImplParams(&mockClient)
+	params.options.Hostname = "hostname"
+	params.options.GatewayResolver = &routemanager.FakeGatewayResolver{}
+	registered := map[string]routemanager.Route{}
+	params.options.RouteManager = routeManagerMock{
+		registeredCallback: func(name string, r routemanager.Route) error {
+			registered[name] = r
+			return nil
+		},
+		deRegisteredCallback: func(name string) error {
+			delete(registered, name)
+			return routemanager.ErrNotFound
+		},
+	}
+	return params, &mockClient, registered
+}
+
+func newFailoverMember(name, group string, createdAt time.Time) *iksv1.StaticRoute {
+	member := newStaticRouteWithValues(true, false)
+	member.SetName(name)
+	member.SetCreationTimestamp(metav1.NewTime(createdAt))
+	member.Spec.Gateway = "10.0.0.2"
+	member.Spec.FailoverGroup = group
+	return member
+}
+
+func TestReconcileImplFailoverGroupOrder(t *testing.T) {
+	now := time.Now()
+	route := newStaticRouteWithValues(true, false)
+	route.SetCreationTimestamp(metav1.NewTime(now))
+	disabled := newFailoverMember("disabled", "uplink", now.Add(-3*time.Hour))
+	disabled.Spec.Disabled = true
+	otherSubnet := newFailoverMember("other-subnet", "uplink", now.Add(-3*time.Hour))
+	otherSubnet.Spec.Subnet = "10.2.0.0/16"
+	params, mockClient, registered := getReconcileContextForFailover(route,
+		newFailoverMember("first", "uplink", now.Add(-2*time.Hour)),
+		newFailoverMember("second", "uplink", now.Add(-time.Hour)),
+		newFailoverMember("newer", "uplink", now.Add(time.Hour)),
+		disabled,
+		otherSubnet,
+	)
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished, the members of the group don't conflict")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if r, found := registered["CR"]; !found || r.Metric != failoverBaseMetric+2 {
+		t.Errorf("Route must be installed with the metric of its position: %v", registered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].Metric != failoverBaseMetric+2 || instance.Status.NodeStatus[0].Preferred != "first" {
+		t.Errorf("Status must contain the metric and the preferred member: %v", instance.Status.NodeStatus[0])
+	}
+}
+
+func TestReconcileImplFailoverGroupOldestIsPreferred(t *testing.T) {
+	now := time.Now()
+	route := newStaticRouteWithValues(true, false)
+	route.SetCreationTimestamp(metav1.NewTime(now))
+	params, mockClient, registered := getReconcileContextForFailover(route, newFailoverMember("newer", "uplink", now.Add(time.Hour)))
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished || err != nil {
+		t.Errorf("Result must be finished without error: %v", err)
+	}
+	if r, found := registered["CR"]; !found || r.Metric != failoverBaseMetric {
+		t.Errorf("Oldest member must be installed with the base metric: %v", registered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].Preferred != "CR" {
+		t.Errorf("Oldest member must be preferred: %v", instance.Status.NodeStatus[0])
+	}
+}
+
+func TestReconcileImplFailoverGroupReorderedOnDelete(t *testing.T) {
+	now := time.Now()
+	route := newStaticRouteWithValues(true, true)
+	route.SetCreationTimestamp(metav1.NewTime(now))
+	route.Status.NodeStatus[0].State.FailoverGroup = "uplink"
+	route.Status.NodeStatus[0].Metric = failoverBaseMetric + 1
+	route.Status.NodeStatus[0].Preferred = "deleted"
+	params, mockClient, registered := getReconcileContextForFailover(route)
+	deRegistered := []string{}
+	mock := params.options.RouteManager.(routeManagerMock)
+	mock.deRegisteredCallback = func(name string) error {
+		deRegistered = append(deRegistered, name)
+		return nil
+	}
+	params.options.RouteManager = mock
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if len(deRegistered) == 0 || deRegistered[0] != "CR" {
+		t.Errorf("Route of the previous metric must be deregistered: %v", deRegistered)
+	}
+	if r, found := registered["CR"]; !found || r.Metric != failoverBaseMetric {
+		t.Errorf("Route must be installed with the metric of the deleted member: %v", registered)
+	}
+	instance := &iksv1.StaticRoute{}
+	if err = mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if instance.Status.NodeStatus[0].Metric != failoverBaseMetric || instance.Status.NodeStatus[0].Preferred != "CR" {
+		t.Errorf("Status must follow the new order of the group: %v", instance.Status.NodeStatus[0])
+	}
+}
+
+func TestReconcileImplFailoverGroupCantList(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	params, mockClient, _ := getReconcileContextForFailover(route)
+	mockClient.listErr = errors.New("List failed")
+	// The conflict check would fail on the list first
+	params.options.ECMPMerge = true
+
+	res, err := reconcileImpl(*params)
+
+	if res != failoverCheckError || err == nil {
+		t.Errorf("Result must be failoverCheckError with error: %v", err)
+	}
+}
+
+func TestEnqueueFailoverGroupMembers(t *testing.T) {
+	now := time.Now()
+	member := newFailoverMember("member", "uplink", now)
+	other := newFailoverMember("other", "backup", now)
+	changed := newFailoverMember("changed", "uplink", now)
+	mapper := enqueueFailoverGroupMembers(newFakeClient(member, other, changed)).(*handler.EnqueueRequestsFromMapFunc)
+
+	requests := mapper.ToRequests.Map(handler.MapObject{Meta: changed, Object: changed})
+	none := mapper.ToRequests.Map(handler.MapObject{Meta: newStaticRouteWithValues(true, false), Object: newStaticRouteWithValues(true, false)})
+
+	if !reflect.DeepEqual(requests, []reconcile.Request{reconcile.Request{NamespacedName: types.NamespacedName{Name: "member"}}}) {
+		t.Errorf("Only the other members of the group must be reconciled: %v", requests)
+	}
+	if len(none) != 0 {
+		t.Errorf("Route without failover group must not reconcile others: %v", none)
+	}
+}
+
+func TestReconcileImplNoConflictWithECMPMerge(t *testing.T) {
+	now := time.Now()
+	params, _, registered := getReconcileContextForConflict(now, now.Add(-time.Hour), 0)
+	params.options.ECMPMerge = true
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished || err != nil {
+		t.Errorf("Result must be finished: %v", err)
+	}
+	if len(*registered) != 1 {
+		t.Errorf("Newer route must be installed to be merged: %v", *registered)
+	}
+}
+
+func TestReconcileImplConflictSameTimeNameWins(t *testing.T) {
+	now := time.Now()
+	params, _, _ := getReconcileContextForConflict(now, now, 0)
+
+	res, _ := reconcileImpl(*params)
+
+	// "CR" < "other"
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+}
+
+func TestReconcileImplNoConflictWithOtherTos(t *testing.T) {
+	now := time.Now()
+	params, _, registered := getReconcileContextForConflict(now, now.Add(-time.Hour), 0x10)
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished || err != nil {
+		t.Errorf("Result must be finished: %v", err)
+	}
+	if len(*registered) != 1 {
+		t.Errorf("Route with other tos must be installed: %v", *registered)
+	}
+}
+
+func TestReconcileImplNoConflictWithOtherOperator(t *testing.T) {
+	now := time.Now()
+	params, mockClient, registered := getReconcileContextForConflict(now, now.Add(-time.Hour), 0)
+	other := &iksv1.StaticRoute{}
+	if err := mockClient.Get(context.Background(), types.NamespacedName{Name: "other", Namespace: "default"}, other); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	other.SetLabels(map[string]string{iksv1.OperatorIDLabel: "2"})
+	if err := mockClient.Update(context.Background(), other); err != nil {
+		t.Errorf("Failed to update the CR: %s", err.Error())
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished || err != nil {
+		t.Errorf("Result must be finished: %v", err)
+	}
+	if len(*registered) != 1 {
+		t.Errorf("Route of another operator must be not in conflict: %v", *registered)
+	}
+}
+
+func TestReconcileImplConflictCantList(t *testing.T) {
+	now := time.Now()
+	params, mockClient, _ := getReconcileContextForConflict(now, now.Add(-time.Hour), 0)
+	mockClient.listErr = errors.New("bla")
+
+	res, err := reconcileImpl(*params)
+
+	if res != conflictCheckError {
+		t.Error("Result must be conflictCheckError")
+	}
+	if err == nil {
+		t.Error("Error must be not nil")
+	}
+}
+
+func getReconcileContextForDump(token, page string, dumped *iksv1.StaticRouteDumpStatus, count int) (*reconcileImplParams, *reconcileImplClientMock) {
+	route := newStaticRouteWithValues(true, true)
+	route.SetAnnotations(map[string]string{iksv1.DumpRoutesAnnotation: token, iksv1.DumpRoutesPageAnnotation: page})
+	route.Status.NodeStatus[0].Dump = dumped
+	params, mockClient := getReconcileContextForAddFlow(route, true)
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: true,
+		listRoutesCallback: func() ([]routemanager.Route, error) {
+			routes := []routemanager.Route{}
+			for i := 0; i < count; i++ {
+				routes = append(routes, routemanager.Route{Dst: net.IPNet{IP: net.IP{10, 1, byte(i), 0}, Mask: net.CIDRMask(24, 32)}, Table: 254})
+			}
+			return routes, nil
+		},
+	}
+	return params, mockClient
+}
+
+func getDumpStatus(t *testing.T, mockClient *reconcileImplClientMock) *iksv1.StaticRouteDumpStatus {
+	instance := &iksv1.StaticRoute{}
+	if err := mockClient.Get(context.Background(), types.NamespacedName{Name: "CR", Namespace: "default"}, instance); err != nil {
+		t.Errorf("Failed to read the CR: %s", err.Error())
+	}
+	if len(instance.Status.NodeStatus) != 1 {
+		t.Errorf("Status must contain the node: %v", instance.Status.NodeStatus)
+		return nil
+	}
+	return instance.Status.NodeStatus[0].Dump
+}
+
+func TestReconcileImplDumpRoutes(t *testing.T) {
+	var testData = []struct {
+		page     string
+		expected int
+		first    string
+	}{
+		{"", 50, "10.1.0.0/24 table 254"},
+		{"1", 50, "10.1.50.0/24 table 254"},
+		{"2", 20, "10.1.100.0/24 table 254"},
+	}
+	for i, td := range testData {
+		params, mockClient := getReconcileContextForDump("first", td.page, nil, 120)
+
+		res, err := reconcileImpl(*params)
+
+		if res != finished || err != nil {
+			t.Errorf("Result must be finished: %v at %d", err, i)
+		}
+		dump := getDumpStatus(t, mockClient)
+		if dump == nil || dump.Token != "first" || dump.Total != 120 || dump.Pages != 3 || len(dump.Routes) != td.expected || dump.Routes[0] != td.first {
+			t.Errorf("Page of the dump must be in the status: %v at %d", dump, i)
+		}
+	}
+}
+
+func TestReconcileImplDumpRoutesAlreadyDone(t *testing.T) {
+	params, mockClient := getReconcileContextForDump("first", "1", &iksv1.StaticRouteDumpStatus{Token: "first", Page: 1, Pages: 3, Total: 120}, 0)
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: true,
+		listRoutesCallback: func() ([]routemanager.Route, error) {
+			t.Error("Routes must be dumped once per token and page")
+			return nil, nil
+		},
+	}
+
+	res, _ := reconcileImpl(*params)
+
+	if res != finished {
+		t.Error("Result must be finished")
+	}
+	if dump := getDumpStatus(t, mockClient); dump == nil || dump.Total != 120 {
+		t.Errorf("Dump must be kept: %v", dump)
+	}
+}
+
+func TestReconcileImplDumpRoutesFails(t *testing.T) {
+	params, mockClient := getReconcileContextForDump("first", "", nil, 0)
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: true,
+		listRoutesCallback: func() ([]routemanager.Route, error) {
+			return nil, errors.New("bla")
+		},
+	}
+
+	res, err := reconcileImpl(*params)
+
+	if res != finished || err != nil {
+		t.Errorf("Failed dump must not fail the reconcile: %v", err)
+	}
+	if dump := getDumpStatus(t, mockClient); dump == nil || dump.Error != "bla" {
+		t.Errorf("Error must be reported in the dump: %v", dump)
+	}
+}
+
+func TestReconcileImplDumpRoutesInvalidPage(t *testing.T) {
+	params, mockClient := getReconcileContextForDump("first", "-1", nil, 10)
+
+	_, _ = reconcileImpl(*params)
+
+	if dump := getDumpStatus(t, mockClient); dump == nil || dump.Error != "Invalid page '-1'" || len(dump.Routes) != 0 {
+		t.Errorf("Invalid page must be reported in the dump: %v", dump)
+	}
+}
+
+func TestReconcileImplDumpRoutesIPRoute2(t *testing.T) {
+	var testData = []struct {
+		format string
+		dumped *iksv1.StaticRouteDumpStatus
+		routes []string
+		err    string
+	}{
+		{iksv1.DumpFormatIPRoute2, nil, []string{"ip route add 10.1.0.0/24 via 10.0.0.1 table 254 proto 196 scope global"}, ""},
+		{iksv1.DumpFormatIPRoute2, &iksv1.StaticRouteDumpStatus{Token: "first", Pages: 1, Total: 1}, []string{"ip route add 10.1.0.0/24 via 10.0.0.1 table 254 proto 196 scope global"}, ""},
+		{"json", nil, nil, "Invalid format 'json'"},
+	}
+	for i, td := range testData {
+		route := newStaticRouteWithValues(true, true)
+		route.SetAnnotations(map[string]string{iksv1.DumpRoutesAnnotation: "first", iksv1.DumpRoutesFormatAnnotation: td.format})
+		route.Status.NodeStatus[0].Dump = td.dumped
+		params, mockClient := getReconcileContextForAddFlow(route, true)
+		params.options.RouteManager = routeManagerMock{
+			isRegistered: true,
+			exportRoutesCallback: func() ([]string, error) {
+				return []string{"ip route add 10.1.0.0/24 via 10.0.0.1 table 254 proto 196 scope global"}, nil
+			},
+		}
+
+		if res, err := reconcileImpl(*params); res != finished || err != nil {
+			t.Errorf("Result must be finished: %v at %d", err, i)
+		}
+		dump := getDumpStatus(t, mockClient)
+		if dump == nil || dump.Format != td.format || !reflect.DeepEqual(dump.Routes, td.routes) || dump.Error != td.err {
+			t.Errorf("Exported routes must be in the status: %v at %d", dump, i)
+		}
+	}
+}
+
+func getReconcileContextForAddFlow(route *iksv1.StaticRoute, isRegistered bool) (*reconcileImplParams, *reconcileImplClientMock) {
+	if route == nil {
+		route = newStaticRouteWithValues(true, true)
+	}
+	mockClient := reconcileImplClientMock{
+		client: newFakeClient(route),
+	}
+	params := newReconcileImplParams(&mockClient)
+	params.options.Hostname = "hostname"
+	params.options.RouteManager = routeManagerMock{
+		isRegistered: isRegistered,
 	}
+	params.options.GatewayResolver = &routemanager.FakeGatewayResolver{}
 
 	return params, &mockClient
 }
@@ -17,15 +17,58 @@
 package staticroute
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
 	"reflect"
+	"strconv"
+	"time"
 
 	iksv1 "github.com/IBM/staticroute-operator/pkg/apis/iks/v1"
+	"github.com/IBM/staticroute-operator/pkg/routemanager"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	errInvalidSourceAddress = errors.New("Given source address is not a valid IP address")
+	errSourceAddressFamily  = errors.New("Given source address family does not match the subnet family")
+	errAmbiguousGateway     = errors.New("Only one of gateway and gatewayHostname can be set")
+	errNoSubnet             = errors.New("Either subnet or subnets must be set")
+	errInvalidSubnet        = errors.New("Given subnet is not a valid CIDR")
+	errSubnetProtected      = errors.New("Given subnet overlaps with some protected subnet")
+	errInvalidTos           = errors.New("Given tos must be between 0 and 255")
+	errTosFamily            = errors.New("Given tos is only supported for IPv4 subnets")
+	errInvalidFwMark        = errors.New("Given fwmark must be a non-zero 32 bit unsigned integer")
+	errInvalidFwMarkTable   = errors.New("Given fwmark table must be between 1 and 254")
+	errInvalidSuppressLen   = errors.New("Given fwmark suppress prefix length must be between 0 and 128")
+	errInvalidGoto          = errors.New("Given fwmark goto must be the priority of the target rule, between 1 and 4294967295")
+	errGotoWithLookup       = errors.New("Given fwmark goto can not be combined with fwmark table or suppress prefix length")
+	errRuleWithoutFwMark    = errors.New("Given fwmark rule attributes require fwmark")
+	errInvalidTable         = errors.New("Given table must be between 1 and 4294967295, except the local table 255")
+	errOnLinkGateway        = errors.New("Given link-local or loopback subnet is reached without gateway, gateway and gatewayHostname must not be set")
+	errOnLinkMixed          = errors.New("Given link-local or loopback subnets can not be mixed with other subnets")
+	errOnLinkInterface      = errors.New("Given link-local subnet requires the interface it is reached through")
+	errInterfaceNotOnLink   = errors.New("Given interface is only used by link-local and loopback subnets")
 )
 
 type routeWrapper struct {
 	instance *iksv1.StaticRoute
+	//groupSubnets the subnets of the NetworkGroup referred by the CR, resolved by resolveNetworkGroup
+	groupSubnets []string
+	//statusHosts the hostnames of the node status in the order they were read from the API server, see nodeStatusPatch
+	statusHosts []string
+	//metric the metric of the routes of the CR, given by its position in the failover group, see failoverMetric
+	metric int
+}
+
+//jsonPatchOperation is one operation of a JSON patch (RFC 6902)
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
 }
 
 //addFinalizer will add this attribute to the CR
@@ -37,8 +80,26 @@ func (rw *routeWrapper) setFinalizer() bool {
 	return true
 }
 
-func (rw *routeWrapper) isProtected(protecteds []*net.IPNet) bool {
-	_, subnetNet, err := net.ParseCIDR(rw.instance.Spec.Subnet)
+func (rw *routeWrapper) isProtected(protecteds, exceptions []*net.IPNet) bool {
+	return isSubnetProtected(rw.instance.Spec.Subnet, protecteds, exceptions)
+}
+
+//protectedSubnetException returns the exception which allows the subnet overlapping with some protected subnet, empty if there is none
+func (rw *routeWrapper) protectedSubnetException(protecteds, exceptions []*net.IPNet) string {
+	return subnetException(rw.instance.Spec.Subnet, protecteds, exceptions)
+}
+
+func subnetException(subnet string, protecteds, exceptions []*net.IPNet) string {
+	if len(exceptions) == 0 || !isSubnetProtected(subnet, protecteds, nil) || isSubnetProtected(subnet, protecteds, exceptions) {
+		return ""
+	}
+	_, subnetNet, _ := net.ParseCIDR(subnet)
+	return subnetNet.String()
+}
+
+//isSubnetProtected tells whether the subnet overlaps with some protected subnet, which does not contain the subnet as an exception
+func isSubnetProtected(subnet string, protecteds, exceptions []*net.IPNet) bool {
+	_, subnetNet, err := net.ParseCIDR(subnet)
 	if err != nil {
 		return false
 	}
@@ -53,7 +114,10 @@ func (rw *routeWrapper) isProtected(protecteds []*net.IPNet) bool {
 	for _, protected := range protecteds {
 		for ip := protected.IP.Mask(protected.Mask); protected.Contains(ip); inc(ip) {
 			if subnetNet.Contains(ip) {
-				return true
+				if !isException(subnetNet, protected, exceptions) {
+					return true
+				}
+				break
 			}
 		}
 	}
@@ -61,17 +125,292 @@ func (rw *routeWrapper) isProtected(protecteds []*net.IPNet) bool {
 	return false
 }
 
+//isException tells whether the subnet is exactly one of the exceptions and the protected subnet contains it entirely
+func isException(subnet, protected *net.IPNet, exceptions []*net.IPNet) bool {
+	subnetOnes, subnetBits := subnet.Mask.Size()
+	protectedOnes, protectedBits := protected.Mask.Size()
+	if subnetBits != protectedBits || protectedOnes > subnetOnes || !protected.Contains(subnet.IP) {
+		return false
+	}
+	for _, exception := range exceptions {
+		if exception.String() == subnet.String() {
+			return true
+		}
+	}
+	return false
+}
+
 func (rw *routeWrapper) isChanged(hostname, gateway string, selectors []metav1.LabelSelectorRequirement) bool {
 	for _, s := range rw.instance.Status.NodeStatus {
 		if s.Hostname != hostname {
 			continue
-		} else if s.State.Subnet != rw.instance.Spec.Subnet || s.State.Gateway != gateway || !reflect.DeepEqual(s.State.Selectors, selectors) {
+		} else if s.State.Subnet != rw.instance.Spec.Subnet || s.State.Gateway != gateway || s.State.SourceAddress != rw.instance.Spec.SourceAddress || !reflect.DeepEqual(s.State.Selectors, selectors) || s.State.EnsureAbsent != rw.instance.Spec.EnsureAbsent || s.State.Tos != rw.instance.Spec.Tos || s.State.Vrf != rw.instance.Spec.Vrf || !reflect.DeepEqual(s.State.HealthCheck, rw.instance.Spec.HealthCheck) || s.State.Weight != rw.instance.Spec.Weight || s.State.Interface != rw.instance.Spec.Interface || s.State.FailoverGroup != rw.instance.Spec.FailoverGroup || s.Rule != rw.ruleState() {
 			return true
 		}
 	}
 	return false
 }
 
+//toRoute converts the CR into a route of the RouteManager
+func (rw *routeWrapper) toRoute(gateway net.IP, table int) (routemanager.Route, error) {
+	return rw.toSubnetRoute(rw.instance.Spec.Subnet, gateway, table)
+}
+
+//toSubnetRoute converts one subnet of the CR into a route of the RouteManager
+func (rw *routeWrapper) toSubnetRoute(subnet string, gateway net.IP, table int) (routemanager.Route, error) {
+	_, ipnet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return routemanager.Route{}, err
+	}
+	src, err := rw.getSourceAddressFor(subnet)
+	if err != nil {
+		return routemanager.Route{}, err
+	}
+	route := routemanager.Route{Dst: *ipnet, Gw: gateway, Src: src, Table: table, Tos: rw.instance.Spec.Tos, Vrf: rw.instance.Spec.Vrf, HealthCheck: rw.healthCheck(), Weight: rw.instance.Spec.Weight, Metric: rw.metric}
+	if isOnLinkSubnet(subnet) {
+		if route.Device = rw.onLinkDevice(subnet); len(route.Device) == 0 {
+			return routemanager.Route{}, errOnLinkInterface
+		}
+		route.Gw = nil
+	}
+	rule, ruleTable, err := rw.getRule()
+	if err != nil {
+		return routemanager.Route{}, err
+	}
+	if rule != nil {
+		route.Rule = rule
+		if ruleTable != 0 {
+			route.Table = ruleTable
+		}
+	}
+	return route, nil
+}
+
+//healthCheck converts the health check of the CR into the one of the RouteManager, nil if the route is not probed
+func (rw *routeWrapper) healthCheck() *routemanager.HealthCheck {
+	spec := rw.instance.Spec.HealthCheck
+	if spec == nil {
+		return nil
+	}
+	check := &routemanager.HealthCheck{TCP: spec.TCP}
+	if spec.Interval != nil {
+		check.Interval = spec.Interval.Duration
+	}
+	if spec.Timeout != nil {
+		check.Timeout = spec.Timeout.Duration
+	}
+	return check
+}
+
+//getRule returns the rule given by the fwmark annotations and its table, 0 if the target table is used. Rule is nil if there is no fwmark.
+func (rw *routeWrapper) getRule() (*routemanager.Rule, int, error) {
+	annotations := rw.instance.GetAnnotations()
+	fwMark := annotations[iksv1.FwMarkAnnotation]
+	suppressAnnotation, gotoAnnotation := annotations[iksv1.FwMarkSuppressPrefixLengthAnnotation], annotations[iksv1.FwMarkGotoAnnotation]
+	if len(fwMark) == 0 {
+		if len(suppressAnnotation) != 0 || len(gotoAnnotation) != 0 {
+			return nil, 0, errRuleWithoutFwMark
+		}
+		return nil, 0, nil
+	}
+	// A zero mark would match every packet
+	mark, err := strconv.ParseUint(fwMark, 0, 32)
+	if err != nil || mark == 0 {
+		return nil, 0, errInvalidFwMark
+	}
+	table := 0
+	if tableAnnotation := annotations[iksv1.FwMarkTableAnnotation]; len(tableAnnotation) != 0 {
+		if table, err = strconv.Atoi(tableAnnotation); err != nil || table < 1 || table > 254 {
+			return nil, 0, errInvalidFwMarkTable
+		}
+	}
+	rule := &routemanager.Rule{Mark: uint32(mark)}
+	if len(suppressAnnotation) != 0 {
+		suppress, err := strconv.Atoi(suppressAnnotation)
+		if err != nil || suppress < 0 || suppress > 128 {
+			return nil, 0, errInvalidSuppressLen
+		}
+		rule.SuppressPrefixlen = &suppress
+	}
+	// The goto rule doesn't look up any table, so it must be the only action
+	if len(gotoAnnotation) != 0 {
+		priority, err := strconv.ParseUint(gotoAnnotation, 10, 32)
+		if err != nil || priority == 0 {
+			return nil, 0, errInvalidGoto
+		}
+		if table != 0 || rule.SuppressPrefixlen != nil {
+			return nil, 0, errGotoWithLookup
+		}
+		rule.Goto = int(priority)
+	}
+	return rule, table, nil
+}
+
+//ruleState describes the rule of the CR for the node status like iproute2 does, empty if there is no valid rule
+func (rw *routeWrapper) ruleState() string {
+	rule, table, err := rw.getRule()
+	if rule == nil || err != nil {
+		return ""
+	}
+	state := fmt.Sprintf("fwmark 0x%x", rule.Mark)
+	if table != 0 {
+		state += fmt.Sprintf(" lookup %d", table)
+	}
+	if rule.SuppressPrefixlen != nil {
+		state += fmt.Sprintf(" suppress_prefixlength %d", *rule.SuppressPrefixlen)
+	}
+	if rule.Goto != 0 {
+		state += fmt.Sprintf(" goto %d", rule.Goto)
+	}
+	return state
+}
+
+//primarySubnet returns the subnet which determines the address family of the CR, the first listed one if subnet is not set
+func (rw *routeWrapper) primarySubnet() string {
+	if len(rw.instance.Spec.Subnet) != 0 {
+		return rw.instance.Spec.Subnet
+	}
+	if listed := rw.listedSubnets(); len(listed) != 0 {
+		return listed[0]
+	}
+	return ""
+}
+
+//listedSubnets returns the subnets list followed by the subnets of the NetworkGroup without duplicates and without the one given as subnet
+func (rw *routeWrapper) listedSubnets() []string {
+	seen := map[string]bool{rw.instance.Spec.Subnet: true}
+	subnets := []string{}
+	for _, subnet := range append(append([]string{}, rw.instance.Spec.Subnets...), rw.groupSubnets...) {
+		if !seen[subnet] {
+			seen[subnet] = true
+			subnets = append(subnets, subnet)
+		}
+	}
+	return subnets
+}
+
+//isValidTable tells whether the table can take a duplicate of the route, the local table is reserved for the kernel
+func isValidTable(table int) bool {
+	return table >= 1 && table != 255 && int64(table) <= routemanager.MaxTable
+}
+
+//listedTables returns the tables list without duplicates and without the target table, which has the route anyway
+func (rw *routeWrapper) listedTables(target int) []int {
+	seen := map[int]bool{target: true}
+	tables := []int{}
+	for _, table := range rw.instance.Spec.Tables {
+		if !seen[table] {
+			seen[table] = true
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+//getSourceAddress returns nil if the source address is not set. The kernel silently ignores a source address of the wrong family, so it is rejected here.
+func (rw *routeWrapper) getSourceAddress() (net.IP, error) {
+	return rw.getSourceAddressFor(rw.primarySubnet())
+}
+
+func (rw *routeWrapper) getSourceAddressFor(subnetStr string) (net.IP, error) {
+	if len(rw.instance.Spec.SourceAddress) == 0 {
+		return nil, nil
+	}
+	src := net.ParseIP(rw.instance.Spec.SourceAddress)
+	if src == nil {
+		return nil, errInvalidSourceAddress
+	}
+	_, subnet, err := net.ParseCIDR(subnetStr)
+	if err != nil {
+		return nil, err
+	}
+	if (src.To4() == nil) != (subnet.IP.To4() == nil) {
+		return nil, errSourceAddressFamily
+	}
+	return src, nil
+}
+
+//validateTos checks the range of the tos, and rejects it for IPv6 subnets, as the kernel does not support it there
+func (rw *routeWrapper) validateTos() error {
+	tos := rw.instance.Spec.Tos
+	if tos < 0 || tos > 255 {
+		return errInvalidTos
+	}
+	if tos == 0 {
+		return nil
+	}
+	subnets := append([]string{rw.instance.Spec.Subnet}, rw.listedSubnets()...)
+	for _, subnet := range subnets {
+		if _, ipnet, err := net.ParseCIDR(subnet); err == nil && ipnet.IP.To4() == nil {
+			return errTosFamily
+		}
+	}
+	return nil
+}
+
+/* validateOnLink checks the link-local and loopback subnets. They are reached through an interface instead of a gateway,
+   so a gateway conflicts with them, and they can't share the gateway of the other subnets of the CR. */
+func (rw *routeWrapper) validateOnLink() error {
+	onLink, other := 0, 0
+	missingInterface := false
+	for _, subnet := range append([]string{rw.instance.Spec.Subnet}, rw.listedSubnets()...) {
+		if _, _, err := net.ParseCIDR(subnet); err != nil {
+			continue
+		}
+		if !isOnLinkSubnet(subnet) {
+			other++
+			continue
+		}
+		onLink++
+		missingInterface = missingInterface || len(rw.onLinkDevice(subnet)) == 0
+	}
+	switch {
+	case onLink == 0 && len(rw.instance.Spec.Interface) != 0:
+		return errInterfaceNotOnLink
+	case onLink == 0:
+		return nil
+	case other != 0:
+		return errOnLinkMixed
+	case len(rw.instance.Spec.Gateway) != 0 || len(rw.instance.Spec.GatewayHostname) != 0:
+		return errOnLinkGateway
+	case missingInterface:
+		return errOnLinkInterface
+	}
+	return nil
+}
+
+//isOnLink tells whether the subnets of the CR are reached without gateway, see validateOnLink
+func (rw *routeWrapper) isOnLink() bool {
+	return isOnLinkSubnet(rw.primarySubnet())
+}
+
+//onLinkDevice returns the interface the link-local or loopback subnet is reached through, empty if it is not given
+func (rw *routeWrapper) onLinkDevice(subnet string) string {
+	if len(rw.instance.Spec.Interface) != 0 {
+		return rw.instance.Spec.Interface
+	}
+	if _, subnetNet, err := net.ParseCIDR(subnet); err == nil && subnetNet.IP.IsLoopback() {
+		return "lo"
+	}
+	return ""
+}
+
+//isOnLinkSubnet tells whether the subnet lies entirely in the link-local or the loopback range of its family
+func isOnLinkSubnet(subnet string) bool {
+	_, subnetNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return false
+	}
+	ones, bits := subnetNet.Mask.Size()
+	switch {
+	case subnetNet.IP.IsLoopback():
+		return (bits == 32 && ones >= 8) || (bits == 128 && ones == 128)
+	case subnetNet.IP.IsLinkLocalUnicast():
+		return (bits == 32 && ones >= 16) || (bits == 128 && ones >= 10)
+	}
+	return false
+}
+
 // Returns nil like the underlaying net.ParseIP()
 func (rw *routeWrapper) getGateway() net.IP {
 	gateway := rw.instance.Spec.Gateway
@@ -81,6 +420,89 @@ func (rw *routeWrapper) getGateway() net.IP {
 	return net.ParseIP(gateway)
 }
 
+//usesDefaultGateway tells whether the default gateway of the operator applies, ie. neither gateway nor gatewayHostname is set, and the default gateway is of the family of the subnet
+func (rw *routeWrapper) usesDefaultGateway(defaultGateway net.IP) bool {
+	if defaultGateway == nil || len(rw.instance.Spec.Gateway) != 0 || len(rw.instance.Spec.GatewayHostname) != 0 || rw.isOnLink() {
+		return false
+	}
+	_, subnet, err := net.ParseCIDR(rw.primarySubnet())
+	return err == nil && (subnet.IP.To4() == nil) == (defaultGateway.To4() == nil)
+}
+
+func (rw *routeWrapper) setDefaultGateway(hostname string, used bool) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].DefaultGateway = used
+		}
+	}
+}
+
+func (rw *routeWrapper) isAutoGateway() bool {
+	return rw.instance.Spec.Gateway == iksv1.GatewayAuto
+}
+
+//isPaused tells whether the reconciliation of the CR is paused by annotation
+func (rw *routeWrapper) isPaused() bool {
+	return rw.instance.GetAnnotations()[iksv1.PauseAnnotation] == "true"
+}
+
+//getStateGateway returns the gateway the node reported, empty if there is no report
+func (rw *routeWrapper) getStateGateway(hostname string) string {
+	for _, val := range rw.instance.Status.NodeStatus {
+		if val.Hostname == hostname {
+			return val.State.Gateway
+		}
+	}
+	return ""
+}
+
+func (rw *routeWrapper) setProtectedSubnetException(hostname, exception string) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].ProtectedSubnetException = exception
+		}
+	}
+}
+
+func (rw *routeWrapper) setOwner(hostname, owner string) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].Owner = owner
+		}
+	}
+}
+
+//owner tells the resource which generated the route in the form of kind/name, the controller owner is preferred. Empty if there is no owner.
+func (rw *routeWrapper) owner() string {
+	ownerRef := metav1.GetControllerOf(rw.instance)
+	if ownerRef == nil {
+		if refs := rw.instance.GetOwnerReferences(); len(refs) != 0 {
+			ownerRef = &refs[0]
+		}
+	}
+	if ownerRef == nil {
+		return ""
+	}
+	return ownerRef.Kind + "/" + ownerRef.Name
+}
+
+func (rw *routeWrapper) getGatewayChanges(hostname string) int {
+	for _, val := range rw.instance.Status.NodeStatus {
+		if val.Hostname == hostname {
+			return val.GatewayChanges
+		}
+	}
+	return 0
+}
+
+func (rw *routeWrapper) setGatewayChanges(hostname string, changes int) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].GatewayChanges = changes
+		}
+	}
+}
+
 func (rw *routeWrapper) addToStatus(hostname string, gateway net.IP, err error) bool {
 	// Update the status if necessary
 	for _, val := range rw.instance.Status.NodeStatus {
@@ -98,10 +520,313 @@ func (rw *routeWrapper) addToStatus(hostname string, gateway net.IP, err error)
 		Hostname: hostname,
 		State:    spec,
 		Error:    errorString,
+		Rule:     rw.ruleState(),
 	})
 	return true
 }
 
+//expiresAt returns the earliest expiration time given by expiresAt or ttl, nil if the route never expires
+func (rw *routeWrapper) expiresAt() *time.Time {
+	var expiresAt *time.Time
+	if rw.instance.Spec.ExpiresAt != nil {
+		t := rw.instance.Spec.ExpiresAt.Time
+		expiresAt = &t
+	}
+	if rw.instance.Spec.TTL != nil {
+		t := rw.instance.GetCreationTimestamp().Add(rw.instance.Spec.TTL.Duration)
+		if expiresAt == nil || t.Before(*expiresAt) {
+			expiresAt = &t
+		}
+	}
+	return expiresAt
+}
+
+func (rw *routeWrapper) setStatusReason(hostname, reason string) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].Reason = reason
+		}
+	}
+}
+
+func (rw *routeWrapper) setReasonCode(hostname, code string) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].ReasonCode = code
+		}
+	}
+}
+
+func (rw *routeWrapper) getStatusReason(hostname string) string {
+	for _, val := range rw.instance.Status.NodeStatus {
+		if val.Hostname == hostname {
+			return val.Reason
+		}
+	}
+	return ""
+}
+
+func (rw *routeWrapper) setResolvedGateway(hostname string, gateway net.IP, resolvedAt *metav1.Time) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].ResolvedGateway = gateway.String()
+			rw.instance.Status.NodeStatus[i].LastResolution = resolvedAt
+		}
+	}
+}
+
+func (rw *routeWrapper) setNexthops(hostname string, nexthops []iksv1.StaticRouteNexthopStatus) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].Nexthops = nexthops
+		}
+	}
+}
+
+func (rw *routeWrapper) getMetric(hostname string) int {
+	for _, val := range rw.instance.Status.NodeStatus {
+		if val.Hostname == hostname {
+			return val.Metric
+		}
+	}
+	return 0
+}
+
+func (rw *routeWrapper) setFailoverStatus(hostname string, metric int, preferred string) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].Metric = metric
+			rw.instance.Status.NodeStatus[i].Preferred = preferred
+		}
+	}
+}
+
+func (rw *routeWrapper) getInstalledAt(hostname string) *metav1.Time {
+	for _, val := range rw.instance.Status.NodeStatus {
+		if val.Hostname == hostname {
+			return val.InstalledAt
+		}
+	}
+	return nil
+}
+
+func (rw *routeWrapper) setInstalledAt(hostname string, installedAt *metav1.Time) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].InstalledAt = installedAt
+		}
+	}
+}
+
+func (rw *routeWrapper) getSubnetStatus(hostname string) []iksv1.StaticRouteSubnetStatus {
+	for _, val := range rw.instance.Status.NodeStatus {
+		if val.Hostname == hostname {
+			return val.Subnets
+		}
+	}
+	return nil
+}
+
+func (rw *routeWrapper) setSubnetStatus(hostname string, subnets []iksv1.StaticRouteSubnetStatus) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].Subnets = subnets
+		}
+	}
+}
+
+func (rw *routeWrapper) getTableStatus(hostname string) []iksv1.StaticRouteTableStatus {
+	for _, val := range rw.instance.Status.NodeStatus {
+		if val.Hostname == hostname {
+			return val.Tables
+		}
+	}
+	return nil
+}
+
+func (rw *routeWrapper) setTableStatus(hostname string, tables []iksv1.StaticRouteTableStatus) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].Tables = tables
+		}
+	}
+}
+
+func (rw *routeWrapper) getFlushStatus(hostname string) *iksv1.StaticRouteFlushStatus {
+	for _, val := range rw.instance.Status.NodeStatus {
+		if val.Hostname == hostname {
+			return val.Flush
+		}
+	}
+	return nil
+}
+
+func (rw *routeWrapper) setFlushStatus(hostname string, flush *iksv1.StaticRouteFlushStatus) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].Flush = flush
+		}
+	}
+}
+
+func (rw *routeWrapper) getRemovedRoutes(hostname string) int {
+	for _, val := range rw.instance.Status.NodeStatus {
+		if val.Hostname == hostname {
+			return val.RemovedRoutes
+		}
+	}
+	return 0
+}
+
+func (rw *routeWrapper) setRemovedRoutes(hostname string, removed int) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].RemovedRoutes = removed
+		}
+	}
+}
+
+func (rw *routeWrapper) getDumpStatus(hostname string) *iksv1.StaticRouteDumpStatus {
+	for _, val := range rw.instance.Status.NodeStatus {
+		if val.Hostname == hostname {
+			return val.Dump
+		}
+	}
+	return nil
+}
+
+func (rw *routeWrapper) setDumpStatus(hostname string, dump *iksv1.StaticRouteDumpStatus) {
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			rw.instance.Status.NodeStatus[i].Dump = dump
+		}
+	}
+}
+
+//dumpPage returns the requested page of the dump, 0 if not set
+func (rw *routeWrapper) dumpPage() (int, error) {
+	page := rw.instance.GetAnnotations()[iksv1.DumpRoutesPageAnnotation]
+	if len(page) == 0 {
+		return 0, nil
+	}
+	return strconv.Atoi(page)
+}
+
+//isDumpRequested tells whether the dump annotations have a value the node has not handled yet
+func (rw *routeWrapper) isDumpRequested(hostname string) bool {
+	token := rw.instance.GetAnnotations()[iksv1.DumpRoutesAnnotation]
+	if len(token) == 0 {
+		return false
+	}
+	dump := rw.getDumpStatus(hostname)
+	page, _ := rw.dumpPage()
+	return dump == nil || dump.Token != token || dump.Page != page || dump.Format != rw.instance.GetAnnotations()[iksv1.DumpRoutesFormatAnnotation]
+}
+
+//isFlushRequested tells whether the flush annotation has a value the node has not handled yet
+func (rw *routeWrapper) isFlushRequested(hostname string) bool {
+	token := rw.instance.GetAnnotations()[iksv1.FlushTableAnnotation]
+	if len(token) == 0 {
+		return false
+	}
+	flush := rw.getFlushStatus(hostname)
+	return flush == nil || flush.Token != token
+}
+
+//destinations returns the normalized subnets of the CR together with the tos, the identity of its routes in the table
+func (rw *routeWrapper) destinations() map[string]bool {
+	destinations := map[string]bool{}
+	for _, subnet := range append([]string{rw.instance.Spec.Subnet}, rw.listedSubnets()...) {
+		if _, ipnet, err := net.ParseCIDR(subnet); err == nil {
+			destinations[fmt.Sprintf("%s tos %d", ipnet.String(), rw.instance.Spec.Tos)] = true
+		}
+	}
+	return destinations
+}
+
+//isManagedBy tells whether the CR belongs to the operator instance by its label
+func (rw *routeWrapper) isManagedBy(operatorID string) bool {
+	return rw.instance.GetLabels()[iksv1.OperatorIDLabel] == operatorID
+}
+
+//isOlderThan orders the CRs by creation time, the name breaks the tie
+func (rw *routeWrapper) isOlderThan(other *routeWrapper) bool {
+	created, otherCreated := rw.instance.GetCreationTimestamp(), other.instance.GetCreationTimestamp()
+	if !created.Equal(&otherCreated) {
+		return created.Before(&otherCreated)
+	}
+	return rw.instance.GetName() < other.instance.GetName()
+}
+
+//reportedSubnets returns the listed subnets the node has reported on, their routes may be still registered
+func (rw *routeWrapper) reportedSubnets(hostname string) []string {
+	reported := []string{}
+	for _, val := range rw.getSubnetStatus(hostname) {
+		reported = append(reported, val.Subnet)
+	}
+	return reported
+}
+
+//reportedTables returns the listed tables the node has reported on, the duplicates of the route may be still registered there
+func (rw *routeWrapper) reportedTables(hostname string) []int {
+	reported := []int{}
+	for _, val := range rw.getTableStatus(hostname) {
+		reported = append(reported, val.Table)
+	}
+	return reported
+}
+
+//isApplied tells whether the route was programmed on the node according to the status
+func (rw *routeWrapper) isApplied(hostname string) bool {
+	for _, val := range rw.instance.Status.NodeStatus {
+		if val.Hostname == hostname {
+			return val.Reason != iksv1.ReasonExpired && val.Reason != iksv1.ReasonDrained && val.Reason != iksv1.ReasonConflicting && val.Reason != iksv1.ReasonDisabled && val.Reason != iksv1.ReasonWaitingForInterface && val.Reason != iksv1.ReasonKillSwitch && val.Reason != iksv1.ReasonProtectedSubnetRejected && val.Reason != iksv1.ReasonPending
+		}
+	}
+	return false
+}
+
+/* appliedRoutes returns the routes the node reported as applied without error, named like their registrations.
+   The resources changed since the report are skipped, they are left to their reconcile. */
+func (rw *routeWrapper) appliedRoutes(hostname string, table int) map[string]routemanager.Route {
+	routes := map[string]routemanager.Route{}
+	for _, val := range rw.instance.Status.NodeStatus {
+		if val.Hostname != hostname || len(val.Error) != 0 || !rw.isApplied(hostname) {
+			continue
+		}
+		if gateway := rw.getGateway(); rw.isChanged(hostname, val.State.Gateway, rw.instance.Spec.Selectors) || (gateway != nil && gateway.String() != val.State.Gateway) {
+			continue
+		}
+		gateway := net.ParseIP(val.State.Gateway)
+		rw.metric = val.Metric
+		if len(rw.instance.Spec.Subnet) != 0 {
+			if route, err := rw.toRoute(gateway, table); err == nil {
+				routes[rw.instance.GetName()] = route
+			}
+			listedTables := rw.listedTables(table)
+			for _, t := range val.Tables {
+				if len(t.Error) != 0 || !containsTable(listedTables, t.Table) {
+					continue
+				}
+				if route, err := rw.toRoute(gateway, t.Table); err == nil {
+					route.Rule, route.HealthCheck = nil, nil
+					routes[tableRouteName(rw.instance.GetName(), t.Table)] = route
+				}
+			}
+		}
+		listed := rw.listedSubnets()
+		for _, subnet := range val.Subnets {
+			if len(subnet.Error) != 0 || !containsSubnet(listed, subnet.Subnet) {
+				continue
+			}
+			if route, err := rw.toSubnetRoute(subnet.Subnet, gateway, table); err == nil {
+				routes[subnetRouteName(rw.instance.GetName(), subnet.Subnet)] = route
+			}
+		}
+	}
+	return routes
+}
+
 func (rw *routeWrapper) alreadyInStatus(hostname string) bool {
 	for _, val := range rw.instance.Status.NodeStatus {
 		if val.Hostname == hostname {
@@ -130,3 +855,55 @@ func (rw *routeWrapper) removeFromStatus(hostname string) (existed bool) {
 
 	return
 }
+
+//readStatusHosts records the order of the node status as it is on the API server, it must be called after each read or write of the CR
+func (rw *routeWrapper) readStatusHosts() {
+	rw.statusHosts = make([]string, 0, len(rw.instance.Status.NodeStatus))
+	for _, val := range rw.instance.Status.NodeStatus {
+		rw.statusHosts = append(rw.statusHosts, val.Hostname)
+	}
+}
+
+/* nodeStatusPatch returns the patch of the status subresource which writes only the entry of the given node, so the nodes
+   writing the same CR don't overwrite the entries of each other. The entry is addressed by its index in the status as it was read,
+   guarded by a test of its hostname, the patch fails if the entries were reordered meanwhile. If the status was read empty,
+   the whole array is written with the resource version as precondition. Nil is returned if there is nothing to write. */
+func (rw *routeWrapper) nodeStatusPatch(hostname string) (client.Patch, error) {
+	var entry *iksv1.StaticRouteNodeStatus
+	for i := range rw.instance.Status.NodeStatus {
+		if rw.instance.Status.NodeStatus[i].Hostname == hostname {
+			entry = &rw.instance.Status.NodeStatus[i]
+		}
+	}
+	if len(rw.statusHosts) == 0 {
+		if entry == nil {
+			return nil, nil
+		}
+		patch := map[string]interface{}{"status": map[string]interface{}{"nodeStatus": rw.instance.Status.NodeStatus}}
+		if version := rw.instance.GetResourceVersion(); len(version) != 0 {
+			patch["metadata"] = map[string]string{"resourceVersion": version}
+		}
+		data, err := json.Marshal(patch)
+		return client.ConstantPatch(k8stypes.MergePatchType, data), err
+	}
+	index := -1
+	for i, h := range rw.statusHosts {
+		if h == hostname {
+			index = i
+		}
+	}
+	path := fmt.Sprintf("/status/nodeStatus/%d", index)
+	var ops []jsonPatchOperation
+	switch {
+	case index == -1 && entry == nil:
+		return nil, nil
+	case index == -1:
+		ops = []jsonPatchOperation{{Op: "add", Path: "/status/nodeStatus/-", Value: entry}}
+	case entry == nil:
+		ops = []jsonPatchOperation{{Op: "test", Path: path + "/hostname", Value: hostname}, {Op: "remove", Path: path}}
+	default:
+		ops = []jsonPatchOperation{{Op: "test", Path: path + "/hostname", Value: hostname}, {Op: "replace", Path: path, Value: entry}}
+	}
+	data, err := json.Marshal(ops)
+	return client.ConstantPatch(k8stypes.JSONPatchType, data), err
+}
@@ -19,7 +19,9 @@ package staticroute
 import (
 	"errors"
 	"net"
+	"reflect"
 	"testing"
+	"time"
 
 	iksv1 "github.com/IBM/staticroute-operator/pkg/apis/iks/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -63,7 +65,7 @@ func TestIsProtected(t *testing.T) {
 	for i, td := range testData {
 		rw := routeWrapper{instance: td.route}
 
-		res := rw.isProtected(td.protecteds)
+		res := rw.isProtected(td.protecteds, nil)
 
 		if res != td.result {
 			t.Errorf("Result must be %t, it is %t at %d", td.result, res, i)
@@ -71,6 +73,48 @@ func TestIsProtected(t *testing.T) {
 	}
 }
 
+func TestIsProtectedWithExceptions(t *testing.T) {
+	parse := func(subnets ...string) []*net.IPNet {
+		nets := []*net.IPNet{}
+		for _, subnet := range subnets {
+			_, n, _ := net.ParseCIDR(subnet)
+			nets = append(nets, n)
+		}
+		return nets
+	}
+	var testData = []struct {
+		protecteds []*net.IPNet
+		exceptions []*net.IPNet
+		subnet     string
+		result     bool
+		exception  string
+	}{
+		{parse("10.1.0.0/16"), parse("10.1.2.0/24"), "10.1.2.0/24", false, "10.1.2.0/24"},
+		{parse("10.1.0.0/16"), parse("10.1.2.0/24"), "10.1.2.1/24", false, "10.1.2.0/24"},
+		{parse("10.1.0.0/16"), parse("10.1.2.0/24"), "10.1.3.0/24", true, ""},
+		{parse("10.1.0.0/16"), parse("10.1.2.0/24"), "10.1.2.0/25", true, ""},
+		{parse("10.1.0.0/16"), parse("10.1.2.0/24"), "10.1.0.0/16", true, ""},
+		{parse("10.1.0.0/16", "10.1.2.0/23"), parse("10.1.2.0/24"), "10.1.2.0/24", false, "10.1.2.0/24"},
+		{parse("10.1.0.0/16", "10.1.2.128/25"), parse("10.1.2.0/24"), "10.1.2.0/24", true, ""},
+		{parse("10.1.0.0/16", "172.16.0.0/16"), parse("10.1.2.0/24"), "172.16.1.0/24", true, ""},
+		{parse("10.1.0.0/16"), parse("10.1.2.0/24"), "192.168.0.0/24", false, ""},
+	}
+
+	for i, td := range testData {
+		rw := routeWrapper{instance: &iksv1.StaticRoute{Spec: iksv1.StaticRouteSpec{Subnet: td.subnet}}}
+
+		res := rw.isProtected(td.protecteds, td.exceptions)
+		exception := rw.protectedSubnetException(td.protecteds, td.exceptions)
+
+		if res != td.result {
+			t.Errorf("Result must be %t, it is %t at %d", td.result, res, i)
+		}
+		if exception != td.exception {
+			t.Errorf("Exception must be %s, it is %s at %d", td.exception, exception, i)
+		}
+	}
+}
+
 func TestIsChanged(t *testing.T) {
 	var testData = []struct {
 		hostname  string
@@ -262,6 +306,53 @@ func TestIsChanged(t *testing.T) {
 			},
 			true,
 		},
+		{
+			"hostname",
+			"gateway",
+			nil,
+			&iksv1.StaticRoute{
+				Spec: iksv1.StaticRouteSpec{
+					Subnet:        "subnet",
+					SourceAddress: "10.0.0.2",
+				},
+				Status: iksv1.StaticRouteStatus{
+					NodeStatus: []iksv1.StaticRouteNodeStatus{
+						iksv1.StaticRouteNodeStatus{
+							Hostname: "hostname",
+							State: iksv1.StaticRouteSpec{
+								Subnet:        "subnet",
+								Gateway:       "gateway",
+								SourceAddress: "10.0.0.1",
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"hostname",
+			"gateway",
+			nil,
+			&iksv1.StaticRoute{
+				Spec: iksv1.StaticRouteSpec{
+					Subnet:       "subnet",
+					EnsureAbsent: true,
+				},
+				Status: iksv1.StaticRouteStatus{
+					NodeStatus: []iksv1.StaticRouteNodeStatus{
+						iksv1.StaticRouteNodeStatus{
+							Hostname: "hostname",
+							State: iksv1.StaticRouteSpec{
+								Subnet:  "subnet",
+								Gateway: "gateway",
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
 	}
 
 	for i, td := range testData {
@@ -300,6 +391,28 @@ func TestRouteWrapperSetFinalizerNotEmpty(t *testing.T) {
 	}
 }
 
+func TestRouteWrapperOwner(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	rw := routeWrapper{instance: route}
+	if owner := rw.owner(); owner != "" {
+		t.Errorf("Route without owner references must have no owner: %s", owner)
+	}
+
+	isController := true
+	route.SetOwnerReferences([]metav1.OwnerReference{
+		metav1.OwnerReference{Kind: "Tunnel", Name: "other"},
+		metav1.OwnerReference{Kind: "VPNConnection", Name: "dc-east", Controller: &isController},
+	})
+	if owner := rw.owner(); owner != "VPNConnection/dc-east" {
+		t.Errorf("Controller owner must be preferred: %s", owner)
+	}
+
+	route.SetOwnerReferences([]metav1.OwnerReference{metav1.OwnerReference{Kind: "Tunnel", Name: "other"}})
+	if owner := rw.owner(); owner != "Tunnel/other" {
+		t.Errorf("First owner must be used without controller: %s", owner)
+	}
+}
+
 func TestRouteWrapperGetGateway(t *testing.T) {
 	route := newStaticRouteWithValues(true, false)
 	rw := routeWrapper{instance: route}
@@ -409,3 +522,581 @@ func TestRouteWrapperRemoveFromStatusRemoved(t *testing.T) {
 		t.Errorf("Statuses must be empty: %v", route.Status.NodeStatus)
 	}
 }
+
+func TestRouteWrapperExpiresAt(t *testing.T) {
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var testData = []struct {
+		expiresAt *metav1.Time
+		ttl       *metav1.Duration
+		out       *time.Time
+	}{
+		{},
+		{
+			expiresAt: &metav1.Time{Time: created.Add(time.Hour)},
+			out:       timePtr(created.Add(time.Hour)),
+		},
+		{
+			ttl: &metav1.Duration{Duration: time.Minute},
+			out: timePtr(created.Add(time.Minute)),
+		},
+		{
+			expiresAt: &metav1.Time{Time: created.Add(time.Hour)},
+			ttl:       &metav1.Duration{Duration: time.Minute},
+			out:       timePtr(created.Add(time.Minute)),
+		},
+		{
+			expiresAt: &metav1.Time{Time: created.Add(time.Second)},
+			ttl:       &metav1.Duration{Duration: time.Minute},
+			out:       timePtr(created.Add(time.Second)),
+		},
+	}
+
+	for i, td := range testData {
+		route := newStaticRouteWithValues(true, false)
+		route.SetCreationTimestamp(metav1.Time{Time: created})
+		route.Spec.ExpiresAt = td.expiresAt
+		route.Spec.TTL = td.ttl
+		rw := routeWrapper{instance: route}
+
+		out := rw.expiresAt()
+
+		if (out == nil) != (td.out == nil) || (out != nil && !out.Equal(*td.out)) {
+			t.Errorf("Result must be %v, it is %v at %d", td.out, out, i)
+		}
+	}
+}
+
+func TestRouteWrapperIsApplied(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	rw := routeWrapper{instance: route}
+
+	if rw.isApplied("hostname2") {
+		t.Error("Route must be not applied on unknown node")
+	}
+	if !rw.isApplied("hostname") {
+		t.Error("Route must be applied")
+	}
+	rw.setStatusReason("hostname", iksv1.ReasonExpired)
+	if rw.isApplied("hostname") {
+		t.Error("Expired route must be not applied")
+	}
+	rw.setStatusReason("hostname", iksv1.ReasonPending)
+	if rw.isApplied("hostname") {
+		t.Error("Pending route must be not applied")
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestRouteWrapperGetSourceAddress(t *testing.T) {
+	var testData = []struct {
+		subnet string
+		source string
+		out    net.IP
+		err    error
+	}{
+		{"10.0.0.0/16", "", nil, nil},
+		{"10.0.0.0/16", "10.1.0.1", net.IP{10, 1, 0, 1}, nil},
+		{"10.0.0.0/16", "fd00::1", nil, errSourceAddressFamily},
+		{"fd00:1::/64", "fd00::1", net.ParseIP("fd00::1"), nil},
+		{"fd00:1::/64", "10.1.0.1", nil, errSourceAddressFamily},
+		{"10.0.0.0/16", "invalid", nil, errInvalidSourceAddress},
+	}
+
+	for i, td := range testData {
+		route := newStaticRouteWithValues(false, false)
+		route.Spec.Subnet = td.subnet
+		route.Spec.SourceAddress = td.source
+		rw := routeWrapper{instance: route}
+
+		out, err := rw.getSourceAddress()
+
+		if err != td.err {
+			t.Errorf("Error must be %v, it is %v at %d", td.err, err, i)
+		}
+		if !out.Equal(td.out) {
+			t.Errorf("Result must be %v, it is %v at %d", td.out, out, i)
+		}
+	}
+}
+
+func TestRouteWrapperValidateTos(t *testing.T) {
+	var testData = []struct {
+		subnet  string
+		subnets []string
+		tos     int
+		err     error
+	}{
+		{"10.0.0.0/16", nil, 0, nil},
+		{"10.0.0.0/16", nil, 0x10, nil},
+		{"10.0.0.0/16", nil, 255, nil},
+		{"10.0.0.0/16", nil, 256, errInvalidTos},
+		{"10.0.0.0/16", nil, -1, errInvalidTos},
+		{"fd00:1::/64", nil, 0, nil},
+		{"fd00:1::/64", nil, 0x10, errTosFamily},
+		{"10.0.0.0/16", []string{"fd00:1::/64"}, 0x10, errTosFamily},
+	}
+
+	for i, td := range testData {
+		route := newStaticRouteWithValues(false, false)
+		route.Spec.Subnet = td.subnet
+		route.Spec.Subnets = td.subnets
+		route.Spec.Tos = td.tos
+		rw := routeWrapper{instance: route}
+
+		if err := rw.validateTos(); err != td.err {
+			t.Errorf("Error must be %v, it is %v at %d", td.err, err, i)
+		}
+	}
+}
+
+func TestRouteWrapperToRoute(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Subnet = "10.1.0.0/16"
+	route.Spec.SourceAddress = "10.2.0.1"
+	route.Spec.Tos = 0x10
+	rw := routeWrapper{instance: route}
+
+	r, err := rw.toRoute(net.IP{10, 0, 0, 1}, 100)
+
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if r.Dst.String() != "10.1.0.0/16" || !r.Gw.Equal(net.IP{10, 0, 0, 1}) || !r.Src.Equal(net.IP{10, 2, 0, 1}) || r.Table != 100 || r.Tos != 0x10 {
+		t.Errorf("Route does not match with the spec: %v", r)
+	}
+}
+
+func TestRouteWrapperToRouteWithFwMark(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Annotations = map[string]string{iksv1.FwMarkAnnotation: "0x10", iksv1.FwMarkTableAnnotation: "200"}
+	rw := routeWrapper{instance: route}
+
+	r, err := rw.toRoute(net.IP{10, 0, 0, 1}, 100)
+
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if r.Rule == nil || r.Rule.Mark != 0x10 || r.Table != 200 {
+		t.Errorf("Route must be in the table of the rule: %v", r)
+	}
+}
+
+func TestRouteWrapperToRouteWithHealthCheck(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	rw := routeWrapper{instance: route}
+
+	if r, _ := rw.toRoute(net.IP{10, 0, 0, 1}, 100); r.HealthCheck != nil {
+		t.Errorf("Route without health check must not be probed: %v", r.HealthCheck)
+	}
+	route.Spec.HealthCheck = &iksv1.StaticRouteHealthCheck{TCP: "10.1.0.10:443", Interval: &metav1.Duration{Duration: time.Minute}}
+	r, err := rw.toRoute(net.IP{10, 0, 0, 1}, 100)
+
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if r.HealthCheck == nil || r.HealthCheck.TCP != "10.1.0.10:443" || r.HealthCheck.Interval != time.Minute || r.HealthCheck.Timeout != 0 {
+		t.Errorf("Health check does not match with the spec: %v", r.HealthCheck)
+	}
+}
+
+func TestRouteWrapperGetRule(t *testing.T) {
+	var testData = []struct {
+		fwMark string
+		table  string
+		mark   uint32
+		result int
+		state  string
+		err    error
+	}{
+		{"", "", 0, 0, "", nil},
+		{"", "200", 0, 0, "", nil},
+		{"16", "", 16, 0, "fwmark 0x10", nil},
+		{"0x10", "200", 16, 200, "fwmark 0x10 lookup 200", nil},
+		{"4294967295", "", 0xffffffff, 0, "fwmark 0xffffffff", nil},
+		{"0", "", 0, 0, "", errInvalidFwMark},
+		{"4294967296", "", 0, 0, "", errInvalidFwMark},
+		{"-1", "", 0, 0, "", errInvalidFwMark},
+		{"mark", "", 0, 0, "", errInvalidFwMark},
+		{"0x10", "0", 0, 0, "", errInvalidFwMarkTable},
+		{"0x10", "255", 0, 0, "", errInvalidFwMarkTable},
+		{"0x10", "table", 0, 0, "", errInvalidFwMarkTable},
+	}
+
+	for i, td := range testData {
+		route := newStaticRouteWithValues(true, false)
+		route.Annotations = map[string]string{iksv1.FwMarkAnnotation: td.fwMark, iksv1.FwMarkTableAnnotation: td.table}
+		rw := routeWrapper{instance: route}
+
+		rule, table, err := rw.getRule()
+
+		if err != td.err {
+			t.Errorf("Error must be %v, it is %v at %d", td.err, err, i)
+		}
+		if (rule == nil) != (td.mark == 0) || (rule != nil && rule.Mark != td.mark) || table != td.result {
+			t.Errorf("Rule not match at %d: %v %d", i, rule, table)
+		}
+		if state := rw.ruleState(); state != td.state {
+			t.Errorf("Rule state not match at %d: %s", i, state)
+		}
+	}
+}
+
+func TestRouteWrapperGetRuleAttributes(t *testing.T) {
+	var testData = []struct {
+		annotations map[string]string
+		state       string
+		err         error
+	}{
+		{map[string]string{iksv1.FwMarkSuppressPrefixLengthAnnotation: "0"}, "fwmark 0x10 suppress_prefixlength 0", nil},
+		{map[string]string{iksv1.FwMarkSuppressPrefixLengthAnnotation: "128", iksv1.FwMarkTableAnnotation: "200"}, "fwmark 0x10 lookup 200 suppress_prefixlength 128", nil},
+		{map[string]string{iksv1.FwMarkGotoAnnotation: "32000"}, "fwmark 0x10 goto 32000", nil},
+		{map[string]string{iksv1.FwMarkGotoAnnotation: "4294967295"}, "fwmark 0x10 goto 4294967295", nil},
+		{map[string]string{iksv1.FwMarkSuppressPrefixLengthAnnotation: "-1"}, "", errInvalidSuppressLen},
+		{map[string]string{iksv1.FwMarkSuppressPrefixLengthAnnotation: "129"}, "", errInvalidSuppressLen},
+		{map[string]string{iksv1.FwMarkSuppressPrefixLengthAnnotation: "len"}, "", errInvalidSuppressLen},
+		{map[string]string{iksv1.FwMarkGotoAnnotation: "0"}, "", errInvalidGoto},
+		{map[string]string{iksv1.FwMarkGotoAnnotation: "4294967296"}, "", errInvalidGoto},
+		{map[string]string{iksv1.FwMarkGotoAnnotation: "next"}, "", errInvalidGoto},
+		{map[string]string{iksv1.FwMarkGotoAnnotation: "32000", iksv1.FwMarkTableAnnotation: "200"}, "", errGotoWithLookup},
+		{map[string]string{iksv1.FwMarkGotoAnnotation: "32000", iksv1.FwMarkSuppressPrefixLengthAnnotation: "0"}, "", errGotoWithLookup},
+		{map[string]string{iksv1.FwMarkGotoAnnotation: "32000", iksv1.FwMarkAnnotation: ""}, "", errRuleWithoutFwMark},
+		{map[string]string{iksv1.FwMarkSuppressPrefixLengthAnnotation: "0", iksv1.FwMarkAnnotation: ""}, "", errRuleWithoutFwMark},
+	}
+
+	for i, td := range testData {
+		route := newStaticRouteWithValues(true, false)
+		route.Annotations = map[string]string{iksv1.FwMarkAnnotation: "0x10"}
+		for key, value := range td.annotations {
+			route.Annotations[key] = value
+		}
+		rw := routeWrapper{instance: route}
+
+		_, _, err := rw.getRule()
+
+		if err != td.err {
+			t.Errorf("Error must be %v, it is %v at %d", td.err, err, i)
+		}
+		if state := rw.ruleState(); state != td.state {
+			t.Errorf("Rule state not match at %d: %s", i, state)
+		}
+	}
+}
+
+func TestIsChangedFwMark(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Status.NodeStatus[0].State.Gateway = "10.0.0.1"
+	rw := routeWrapper{instance: route}
+
+	if rw.isChanged("hostname", "10.0.0.1", nil) {
+		t.Error("Route without fwmark must not be changed")
+	}
+	route.Annotations = map[string]string{iksv1.FwMarkAnnotation: "0x10"}
+	if !rw.isChanged("hostname", "10.0.0.1", nil) {
+		t.Error("Route must be changed by the fwmark")
+	}
+	route.Status.NodeStatus[0].Rule = "fwmark 0x10"
+	if rw.isChanged("hostname", "10.0.0.1", nil) {
+		t.Error("Route with applied fwmark must not be changed")
+	}
+}
+
+func TestIsChangedHealthCheck(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Status.NodeStatus[0].State.Gateway = "10.0.0.1"
+	rw := routeWrapper{instance: route}
+
+	route.Spec.HealthCheck = &iksv1.StaticRouteHealthCheck{TCP: "10.1.0.10:443"}
+	if !rw.isChanged("hostname", "10.0.0.1", nil) {
+		t.Error("Route must be changed by the health check")
+	}
+	route.Status.NodeStatus[0].State.HealthCheck = &iksv1.StaticRouteHealthCheck{TCP: "10.1.0.10:443"}
+	if rw.isChanged("hostname", "10.0.0.1", nil) {
+		t.Error("Route with applied health check must not be changed")
+	}
+}
+
+func TestIsChangedWeight(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	route.Status.NodeStatus[0].State.Gateway = "10.0.0.1"
+	rw := routeWrapper{instance: route}
+
+	route.Spec.Weight = 5
+	if !rw.isChanged("hostname", "10.0.0.1", nil) {
+		t.Error("Route must be changed by the weight")
+	}
+	route.Status.NodeStatus[0].State.Weight = 5
+	if rw.isChanged("hostname", "10.0.0.1", nil) {
+		t.Error("Route with applied weight must not be changed")
+	}
+	if r, _ := rw.toRoute(net.IP{10, 0, 0, 1}, 100); r.Weight != 5 {
+		t.Errorf("Weight does not match with the spec: %d", r.Weight)
+	}
+}
+
+func TestRouteWrapperListedSubnets(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Subnets = []string{"10.1.0.0/16", route.Spec.Subnet, "10.2.0.0/16", "10.1.0.0/16"}
+	rw := routeWrapper{instance: route}
+
+	listed := rw.listedSubnets()
+
+	if !reflect.DeepEqual(listed, []string{"10.1.0.0/16", "10.2.0.0/16"}) {
+		t.Errorf("Listed subnets must be deduplicated: %v", listed)
+	}
+	if rw.primarySubnet() != route.Spec.Subnet {
+		t.Errorf("Primary subnet must be the subnet: %s", rw.primarySubnet())
+	}
+	route.Spec.Subnet = ""
+	if rw.primarySubnet() != "10.1.0.0/16" {
+		t.Errorf("Primary subnet must be the first listed one: %s", rw.primarySubnet())
+	}
+}
+
+func TestRouteWrapperListedSubnetsWithNetworkGroup(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Subnets = []string{"10.1.0.0/16"}
+	rw := routeWrapper{instance: route, groupSubnets: []string{"10.2.0.0/16", route.Spec.Subnet, "10.1.0.0/16"}}
+
+	listed := rw.listedSubnets()
+
+	if !reflect.DeepEqual(listed, []string{"10.1.0.0/16", "10.2.0.0/16"}) {
+		t.Errorf("Subnets of the group must follow the list without duplicates: %v", listed)
+	}
+	if !reflect.DeepEqual(route.Spec.Subnets, []string{"10.1.0.0/16"}) {
+		t.Errorf("Subnets list must be untouched: %v", route.Spec.Subnets)
+	}
+}
+
+func TestRouteWrapperSubnetStatus(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	rw := routeWrapper{instance: route}
+	subnets := []iksv1.StaticRouteSubnetStatus{
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.1.0.0/16"},
+		iksv1.StaticRouteSubnetStatus{Subnet: "10.2.0.0/16", Error: "bla"},
+	}
+
+	rw.setSubnetStatus("hostname", subnets)
+
+	if !reflect.DeepEqual(rw.getSubnetStatus("hostname"), subnets) {
+		t.Errorf("Subnet status not match: %v", rw.getSubnetStatus("hostname"))
+	}
+	if reported := rw.reportedSubnets("hostname"); !reflect.DeepEqual(reported, []string{"10.1.0.0/16", "10.2.0.0/16"}) {
+		t.Errorf("Every reported subnet must be returned: %v", reported)
+	}
+	if reported := rw.reportedSubnets("other"); len(reported) != 0 {
+		t.Errorf("Other node has not reported: %v", reported)
+	}
+}
+
+func TestRouteWrapperToSubnetRouteFamilyMismatch(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.SourceAddress = "10.2.0.1"
+	rw := routeWrapper{instance: route}
+
+	_, err := rw.toSubnetRoute("fd00::/64", net.IP{10, 0, 0, 1}, 100)
+
+	if err != errSourceAddressFamily {
+		t.Errorf("Source address family must be checked per subnet: %v", err)
+	}
+}
+
+func TestIsOnLinkSubnet(t *testing.T) {
+	var testData = []struct {
+		subnet string
+		onLink bool
+	}{
+		{"169.254.0.0/16", true},
+		{"169.254.169.254/32", true},
+		{"169.0.0.0/8", false},
+		{"fe80::/64", true},
+		{"fe80::/8", false},
+		{"127.0.0.0/8", true},
+		{"127.1.0.0/16", true},
+		{"::1/128", true},
+		{"10.0.0.0/8", false},
+		{"fd00:1::/64", false},
+		{"invalid", false},
+	}
+
+	for _, td := range testData {
+		if onLink := isOnLinkSubnet(td.subnet); onLink != td.onLink {
+			t.Errorf("On-link must be %v for %s", td.onLink, td.subnet)
+		}
+	}
+}
+
+func TestRouteWrapperValidateOnLink(t *testing.T) {
+	var testData = []struct {
+		subnet  string
+		subnets []string
+		gateway string
+		iface   string
+		err     error
+	}{
+		{"10.0.0.0/16", nil, "10.0.0.1", "", nil},
+		{"10.0.0.0/16", nil, "10.0.0.1", "eth1", errInterfaceNotOnLink},
+		{"169.254.0.0/16", nil, "", "eth1", nil},
+		{"169.254.0.0/16", nil, "", "", errOnLinkInterface},
+		{"169.254.0.0/16", nil, "10.0.0.1", "eth1", errOnLinkGateway},
+		{"169.254.0.0/16", []string{"10.1.0.0/16"}, "", "eth1", errOnLinkMixed},
+		{"127.1.0.0/16", nil, "", "", nil},
+		{"fe80::/64", nil, "", "eth1", nil},
+	}
+
+	for i, td := range testData {
+		route := newStaticRouteWithValues(false, false)
+		route.Spec.Subnet = td.subnet
+		route.Spec.Subnets = td.subnets
+		route.Spec.Gateway = td.gateway
+		route.Spec.Interface = td.iface
+		rw := routeWrapper{instance: route}
+
+		if err := rw.validateOnLink(); err != td.err {
+			t.Errorf("Error must be %v, it is %v at %d", td.err, err, i)
+		}
+	}
+}
+
+func TestRouteWrapperToRouteOnLink(t *testing.T) {
+	route := newStaticRouteWithValues(false, false)
+	route.Spec.Subnet = "169.254.0.0/16"
+	route.Spec.Interface = "eth1"
+	rw := routeWrapper{instance: route}
+
+	r, err := rw.toRoute(net.IP{0, 0, 0, 0}, 254)
+
+	if err != nil || r.Device != "eth1" || r.Gw != nil {
+		t.Errorf("Link-local route must be reached through the interface: %v %v", err, r)
+	}
+	route.Spec.Subnet = "127.1.0.0/16"
+	route.Spec.Interface = ""
+	if r, err := rw.toRoute(net.IP{0, 0, 0, 0}, 254); err != nil || r.Device != "lo" || r.Gw != nil {
+		t.Errorf("Loopback route must be reached through the loopback interface: %v %v", err, r)
+	}
+}
+
+func TestIsChangedInterface(t *testing.T) {
+	route := newStaticRouteWithValues(true, true)
+	rw := routeWrapper{instance: route}
+
+	route.Spec.Interface = "eth1"
+	if !rw.isChanged("hostname", "10.0.0.1", nil) {
+		t.Error("Route must be changed by the interface")
+	}
+	route.Status.NodeStatus[0].State.Interface = "eth1"
+	if rw.isChanged("hostname", "10.0.0.1", nil) {
+		t.Error("Route with applied interface must not be changed")
+	}
+}
+
+func TestRouteWrapperNodeStatusPatch(t *testing.T) {
+	var testData = []struct {
+		read    []string
+		written []string
+		version string
+		patch   string
+	}{
+		{nil, nil, "", ""},
+		{nil, []string{"hostname"}, "", `{"status":{"nodeStatus":[{"hostname":"hostname","state":{},"error":""}]}}`},
+		{nil, []string{"hostname"}, "7", `{"metadata":{"resourceVersion":"7"},"status":{"nodeStatus":[{"hostname":"hostname","state":{},"error":""}]}}`},
+		{[]string{"other"}, []string{"other"}, "7", ""},
+		{[]string{"other"}, []string{"other", "hostname"}, "7", `[{"op":"add","path":"/status/nodeStatus/-","value":{"hostname":"hostname","state":{},"error":""}}]`},
+		{[]string{"other", "hostname"}, []string{"other", "hostname"}, "7", `[{"op":"test","path":"/status/nodeStatus/1/hostname","value":"hostname"},{"op":"replace","path":"/status/nodeStatus/1","value":{"hostname":"hostname","state":{},"error":""}}]`},
+		{[]string{"hostname", "other"}, []string{"other"}, "7", `[{"op":"test","path":"/status/nodeStatus/0/hostname","value":"hostname"},{"op":"remove","path":"/status/nodeStatus/0"}]`},
+	}
+
+	for i, td := range testData {
+		route := newStaticRouteWithValues(false, false)
+		route.SetResourceVersion(td.version)
+		for _, hostname := range td.read {
+			route.Status.NodeStatus = append(route.Status.NodeStatus, iksv1.StaticRouteNodeStatus{Hostname: hostname})
+		}
+		rw := routeWrapper{instance: route}
+		rw.readStatusHosts()
+		route.Status.NodeStatus = nil
+		for _, hostname := range td.written {
+			route.Status.NodeStatus = append(route.Status.NodeStatus, iksv1.StaticRouteNodeStatus{Hostname: hostname})
+		}
+
+		patch, err := rw.nodeStatusPatch("hostname")
+
+		if err != nil {
+			t.Errorf("Error must be nil at %d: %s", i, err.Error())
+		}
+		if patch == nil {
+			if len(td.patch) != 0 {
+				t.Errorf("Patch must be %s at %d", td.patch, i)
+			}
+			continue
+		}
+		if data, _ := patch.Data(route); string(data) != td.patch {
+			t.Errorf("Patch must be %s, it is %s at %d", td.patch, string(data), i)
+		}
+	}
+}
+
+func TestRouteWrapperIsOlderThan(t *testing.T) {
+	now := time.Now()
+	older := routeWrapper{instance: newStaticRouteWithValues(true, false)}
+	older.instance.SetName("b")
+	older.instance.SetCreationTimestamp(metav1.NewTime(now.Add(-time.Minute)))
+	newer := routeWrapper{instance: newStaticRouteWithValues(true, false)}
+	newer.instance.SetName("a")
+	newer.instance.SetCreationTimestamp(metav1.NewTime(now))
+
+	if !older.isOlderThan(&newer) || newer.isOlderThan(&older) {
+		t.Error("Creation time must decide")
+	}
+	newer.instance.SetCreationTimestamp(metav1.NewTime(now.Add(-time.Minute)))
+	if !newer.isOlderThan(&older) || older.isOlderThan(&newer) {
+		t.Error("Name must break the tie")
+	}
+}
+
+func TestRouteWrapperDestinations(t *testing.T) {
+	route := newStaticRouteWithValues(true, false)
+	route.Spec.Subnet = "10.1.2.3/16"
+	route.Spec.Subnets = []string{"10.2.0.0/16", "invalid"}
+	route.Spec.Tos = 16
+	rw := routeWrapper{instance: route}
+
+	destinations := rw.destinations()
+
+	if !reflect.DeepEqual(destinations, map[string]bool{"10.1.0.0/16 tos 16": true, "10.2.0.0/16 tos 16": true}) {
+		t.Errorf("Destinations must be normalized: %v", destinations)
+	}
+}
+
+func TestRouteWrapperUsesDefaultGateway(t *testing.T) {
+	var testData = []struct {
+		subnet          string
+		gateway         string
+		gatewayHostname string
+		defaultGateway  net.IP
+		uses            bool
+	}{
+		{"10.0.0.0/16", "", "", net.IP{10, 0, 0, 1}, true},
+		{"10.0.0.0/16", "", "", nil, false},
+		{"10.0.0.0/16", "10.0.0.2", "", net.IP{10, 0, 0, 1}, false},
+		{"10.0.0.0/16", iksv1.GatewayAuto, "", net.IP{10, 0, 0, 1}, false},
+		{"10.0.0.0/16", "", "gw.example.com", net.IP{10, 0, 0, 1}, false},
+		{"fd00::/64", "", "", net.IP{10, 0, 0, 1}, false},
+		{"fd00::/64", "", "", net.ParseIP("fd00::1"), true},
+		{"127.1.0.0/16", "", "", net.IP{10, 0, 0, 1}, false},
+	}
+
+	for i, td := range testData {
+		route := newStaticRouteWithValues(false, false)
+		route.Spec.Subnet = td.subnet
+		route.Spec.Gateway = td.gateway
+		route.Spec.GatewayHostname = td.gatewayHostname
+		rw := routeWrapper{instance: route}
+
+		if uses := rw.usesDefaultGateway(td.defaultGateway); uses != td.uses {
+			t.Errorf("Default gateway usage must be %v at %d", td.uses, i)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "staticroute"
+
+var (
+	//ReconcileDuration is the time spent in a single reconcile loop, labeled by controller
+	ReconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Duration of the reconcile loop in seconds per controller.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"controller"})
+
+	//NetlinkDuration is the latency of the netlink calls of RouteManager, labeled by operation
+	NetlinkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "netlink_operation_duration_seconds",
+		Help:      "Duration of the netlink operations in seconds per operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"operation"})
+
+	//NetlinkTimeouts counts the netlink calls of RouteManager which did not return within the timeout, labeled by operation
+	NetlinkTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "netlink_timeouts_total",
+		Help:      "Number of the netlink operations timed out per operation.",
+	}, []string{"operation"})
+
+	//ApplyLatency is the time from the creation of a StaticRoute until its route got installed on the node
+	ApplyLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "apply_latency_seconds",
+		Help:      "Time from the creation of a StaticRoute until its route is installed on the node in seconds.",
+		Buckets:   prometheus.ExponentialBuckets(0.25, 2, 12),
+	})
+	//ConflictingRoutes flags the StaticRoutes which are not installed on the node, because an older one has the same destination
+	ConflictingRoutes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "conflicting_routes",
+		Help:      "StaticRoutes not installed because of a conflicting older StaticRoute, 1 per conflicting resource.",
+	}, []string{"staticroute"})
+	//KillSwitchEngaged is 1 while the kill switch withdraws the routes of the operator
+	KillSwitchEngaged = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "kill_switch_engaged",
+		Help:      "1 while the kill switch withdraws every route of the operator, 0 otherwise.",
+	})
+)
+
+func init() {
+	// Registering into the controller-runtime registry exposes the histograms on the metrics endpoint of the manager
+	metrics.Registry.MustRegister(ReconcileDuration, NetlinkDuration, NetlinkTimeouts, ApplyLatency, ConflictingRoutes, KillSwitchEngaged)
+}
+
+//ObserveReconcile records the time elapsed since start as a reconcile of the given controller
+func ObserveReconcile(controller string, start time.Time) {
+	ReconcileDuration.WithLabelValues(controller).Observe(time.Since(start).Seconds())
+}
+
+//ObserveNetlink records the time elapsed since start as a netlink call of the given operation
+func ObserveNetlink(operation string, start time.Time) {
+	NetlinkDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+//CountNetlinkTimeout records a timed out netlink call of the given operation
+func CountNetlinkTimeout(operation string) {
+	NetlinkTimeouts.WithLabelValues(operation).Inc()
+}
+
+//ObserveApplyLatency records the time elapsed from the creation of a StaticRoute until its installation. Skewed clocks may give negative values, those are recorded as 0.
+func ObserveApplyLatency(createdAt, installedAt time.Time) {
+	latency := installedAt.Sub(createdAt)
+	if latency < 0 {
+		latency = 0
+	}
+	ApplyLatency.Observe(latency.Seconds())
+}
+
+//SetConflicting flags or unflags the given StaticRoute as conflicting
+func SetConflicting(name string, conflicting bool) {
+	if conflicting {
+		ConflictingRoutes.WithLabelValues(name).Set(1)
+	} else {
+		ConflictingRoutes.DeleteLabelValues(name)
+	}
+}
+
+//SetKillSwitch records the state of the kill switch
+func SetKillSwitch(engaged bool) {
+	if engaged {
+		KillSwitchEngaged.Set(1)
+	} else {
+		KillSwitchEngaged.Set(0)
+	}
+}
@@ -0,0 +1,92 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+/* apiServerRoute returns the route the node reaches the address of the apiserver through, nil if the kernel has no route to it.
+   The route is looked up once and kept until the next route update of the kernel, so a bulk deletion does not look it up route by route. */
+func (r *routeManagerImpl) apiServerRoute(ip net.IP) (*netlink.Route, error) {
+	if inUse, found := r.apiServerRoutes[ip.String()]; found {
+		return inUse, nil
+	}
+	var routes []netlink.Route
+	if err := r.withTimeout("get", func() (err error) {
+		routes, err = r.nlRouteGetFunc(ip)
+		return
+	}); err != nil {
+		return nil, err
+	}
+	var inUse *netlink.Route
+	if len(routes) != 0 {
+		inUse = &routes[0]
+	}
+	if r.apiServerRoutes == nil {
+		r.apiServerRoutes = make(map[string]*netlink.Route)
+	}
+	r.apiServerRoutes[ip.String()] = inUse
+	return inUse, nil
+}
+
+/* protectAPIServerRoute returns ErrAPIServerRoute if deleting or replacing the route would take away the route of the apiserver.
+   That is the route of the same table covering the address of the apiserver through the same gateway. The kernel reports only
+   the address of the apiserver as the destination of the route in use, so a covering route through the same gateway is taken for it.
+   A replacement keeping the gateway and the device is harmless, so is the deletion of a route through another gateway or of another protocol. */
+func (r *routeManagerImpl) protectAPIServerRoute(route *netlink.Route, replace bool) error {
+	if r.options.APIServerIPs == nil {
+		return nil
+	}
+	for _, ip := range r.options.APIServerIPs() {
+		if route.Dst != nil && !route.Dst.Contains(ip) {
+			continue
+		}
+		inUse, err := r.apiServerRoute(ip)
+		if err != nil {
+			// The route may be the one to the apiserver, it is kept until the lookup succeeds
+			return &RouteError{Class: ErrRetriable, Err: fmt.Errorf("Unable to look up the route to the apiserver: %w", err)}
+		}
+		if inUse != nil && takesAway(route, inUse, replace) {
+			return ErrAPIServerRoute
+		}
+	}
+	return nil
+}
+
+//takesAway tells whether deleting or replacing the route takes away the route in use
+func takesAway(route, inUse *netlink.Route, replace bool) bool {
+	if kernelTable(route.Table) != kernelTable(inUse.Table) {
+		return false
+	}
+	if replace {
+		return !route.Gw.Equal(inUse.Gw) || len(route.MultiPath) != 0 || (route.LinkIndex != 0 && route.LinkIndex != inUse.LinkIndex)
+	}
+	return (route.Gw == nil || route.Gw.Equal(inUse.Gw)) && (route.Protocol == 0 || inUse.Protocol == 0 || route.Protocol == inUse.Protocol)
+}
+
+//kernelTable returns the table the kernel puts the route into, the main one if it is not set
+func kernelTable(table int) int {
+	if table == unix.RT_TABLE_UNSPEC {
+		return unix.RT_TABLE_MAIN
+	}
+	return table
+}
@@ -0,0 +1,179 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+var gAPIServerIP = net.IP{172, 21, 0, 1}
+
+//apiServerRouteGet answers the route lookups like the node reaching the apiserver through the default route via 10.0.0.1
+func apiServerRouteGet(destination net.IP) ([]netlink.Route, error) {
+	return []netlink.Route{{Dst: &net.IPNet{IP: destination, Mask: net.CIDRMask(32, 32)}, Gw: net.IP{10, 0, 0, 1}, LinkIndex: 2, Table: unix.RT_TABLE_MAIN, Protocol: unix.RTPROT_BOOT}}, nil
+}
+
+func protectAPIServer(rm RouteManager) {
+	rm.(*routeManagerImpl).options.APIServerIPs = func() []net.IP { return []net.IP{gAPIServerIP} }
+	rm.(*routeManagerImpl).nlRouteGetFunc = apiServerRouteGet
+}
+
+func TestProtectAPIServerRoute(t *testing.T) {
+	_, defaultDst, _ := net.ParseCIDR("0.0.0.0/0")
+	_, serviceDst, _ := net.ParseCIDR("172.21.0.0/16")
+	_, otherDst, _ := net.ParseCIDR("192.168.0.0/16")
+	var testData = []struct {
+		route   netlink.Route
+		replace bool
+		err     error
+	}{
+		{netlink.Route{Dst: defaultDst, Gw: net.IP{10, 0, 0, 1}, Table: unix.RT_TABLE_MAIN}, false, ErrAPIServerRoute},
+		{netlink.Route{Dst: nil, Table: unix.RT_TABLE_MAIN}, false, ErrAPIServerRoute},
+		{netlink.Route{Dst: serviceDst, Gw: net.IP{10, 0, 0, 2}}, true, ErrAPIServerRoute},
+		{netlink.Route{Dst: defaultDst, MultiPath: []*netlink.NexthopInfo{{Gw: net.IP{10, 0, 0, 1}}}}, true, ErrAPIServerRoute},
+		{netlink.Route{Dst: serviceDst, Gw: net.IP{10, 0, 0, 1}, LinkIndex: 2}, true, nil},
+		{netlink.Route{Dst: serviceDst, Gw: net.IP{10, 0, 0, 1}, LinkIndex: 3}, true, ErrAPIServerRoute},
+		{netlink.Route{Dst: defaultDst, Gw: net.IP{10, 0, 0, 2}, Table: unix.RT_TABLE_MAIN}, false, nil},
+		{netlink.Route{Dst: defaultDst, Gw: net.IP{10, 0, 0, 1}, Protocol: DefaultProtocol}, false, nil},
+		{netlink.Route{Dst: defaultDst, Gw: net.IP{10, 0, 0, 1}, Table: 100}, false, nil},
+		{netlink.Route{Dst: otherDst, Gw: net.IP{10, 0, 0, 2}}, true, nil},
+	}
+	testable := newTestableRouteManager()
+	protectAPIServer(testable.rm)
+	rm := testable.rm.(*routeManagerImpl)
+
+	for i, td := range testData {
+		if err := rm.protectAPIServerRoute(&td.route, td.replace); err != td.err {
+			t.Errorf("Error must be %v, it is %v at %d", td.err, err, i)
+		}
+	}
+
+	rm.options.APIServerIPs = nil
+	if err := rm.protectAPIServerRoute(&testData[0].route, false); err != nil {
+		t.Errorf("Protection must be off without the address of the apiserver: %v", err)
+	}
+}
+
+func TestEnsureAbsentRefusesAPIServerRoute(t *testing.T) {
+	testable := newTestableRouteManager()
+	protectAPIServer(testable.rm)
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		return []netlink.Route{{Dst: filter.Dst, Gw: net.IP{10, 0, 0, 1}, LinkIndex: 2, Table: unix.RT_TABLE_MAIN, Protocol: unix.RTPROT_BOOT}}, nil
+	}
+	testable.rm.(*routeManagerImpl).nlRouteDelFunc = func(route *netlink.Route) error {
+		t.Errorf("Route to the apiserver must not be deleted: %v", route)
+		return nil
+	}
+	testable.start()
+	absent := Route{Dst: net.IPNet{IP: net.IP{0, 0, 0, 0}, Mask: net.CIDRMask(0, 32)}, Table: unix.RT_TABLE_MAIN}
+
+	removed, err := testable.rm.EnsureAbsent(absent)
+
+	testable.stop()
+	if removed != 0 || err != ErrAPIServerRoute || !errors.Is(err, ErrInvalidRoute) {
+		t.Errorf("Deletion of the default route must be refused as an invalid route: %d %v", removed, err)
+	}
+}
+
+func TestDeRegisterRouteRefusesAPIServerRoute(t *testing.T) {
+	testable := newTestableRouteManager()
+	protectAPIServer(testable.rm)
+	testable.start()
+	clobbering := Route{Dst: net.IPNet{IP: net.IP{172, 21, 0, 0}, Mask: net.CIDRMask(16, 32)}, Gw: net.IP{10, 0, 0, 1}, Table: unix.RT_TABLE_MAIN}
+	if err := testable.rm.RegisterRoute("clobbering", clobbering); err != nil {
+		t.Errorf("RegisterRoute shall pass here: %v", err)
+	}
+	testable.rm.(*routeManagerImpl).nlRouteGetFunc = func(destination net.IP) ([]netlink.Route, error) {
+		routes, _ := apiServerRouteGet(destination)
+		routes[0].Protocol = DefaultProtocol
+		return routes, nil
+	}
+
+	err := testable.rm.DeRegisterRoute("clobbering")
+
+	testable.stop()
+	if !errors.Is(err, ErrAPIServerRoute) {
+		t.Errorf("Deletion of the route carrying the apiserver traffic must be refused: %v", err)
+	}
+	if !testable.rm.IsRegistered("clobbering") {
+		t.Error("Refused route must stay registered")
+	}
+}
+
+func TestProtectAPIServerRouteFailsClosed(t *testing.T) {
+	_, defaultDst, _ := net.ParseCIDR("0.0.0.0/0")
+	_, otherDst, _ := net.ParseCIDR("192.168.0.0/16")
+	testable := newTestableRouteManager()
+	protectAPIServer(testable.rm)
+	rm := testable.rm.(*routeManagerImpl)
+	lookups := 0
+	rm.nlRouteGetFunc = func(net.IP) ([]netlink.Route, error) {
+		lookups++
+		return nil, errors.New("bla")
+	}
+
+	if err := rm.protectAPIServerRoute(&netlink.Route{Dst: otherDst}, false); err != nil || lookups != 0 {
+		t.Errorf("Route not covering the apiserver must be not looked up: %v %d", err, lookups)
+	}
+	err := rm.protectAPIServerRoute(&netlink.Route{Dst: defaultDst}, false)
+	if err == nil || err.Error() != "Unable to look up the route to the apiserver: bla" || !errors.Is(err, ErrRetriable) {
+		t.Errorf("Deletion must be refused as retriable if the lookup fails: %v", err)
+	}
+
+	rm.nlRouteGetFunc = apiServerRouteGet
+	if err := rm.protectAPIServerRoute(&netlink.Route{Dst: defaultDst, Gw: net.IP{10, 0, 0, 1}}, false); err != ErrAPIServerRoute {
+		t.Errorf("Failed lookup must be not cached: %v", err)
+	}
+}
+
+func TestAPIServerRouteIsLookedUpAgainAfterRouteUpdate(t *testing.T) {
+	testable := newTestableRouteManager()
+	protectAPIServer(testable.rm)
+	rm := testable.rm.(*routeManagerImpl)
+	lookups := 0
+	rm.nlRouteGetFunc = func(destination net.IP) ([]netlink.Route, error) {
+		lookups++
+		return apiServerRouteGet(destination)
+	}
+	rm.nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		return []netlink.Route{{Dst: filter.Dst, Gw: net.IP{10, 0, 0, 1}, LinkIndex: 2, Table: unix.RT_TABLE_MAIN, Protocol: unix.RTPROT_BOOT}}, nil
+	}
+	testable.start()
+	absent := Route{Dst: net.IPNet{IP: net.IP{0, 0, 0, 0}, Mask: net.CIDRMask(0, 32)}, Table: unix.RT_TABLE_MAIN}
+	for i := 0; i < 3; i++ {
+		if _, err := testable.rm.EnsureAbsent(absent); err != ErrAPIServerRoute {
+			t.Errorf("Deletion of the default route must be refused: %v", err)
+		}
+	}
+	cached := lookups
+	gMockUpdateChan <- netlink.RouteUpdate{Type: unix.RTM_NEWROUTE, Route: netlink.Route{Dst: &gTestRoute.Dst, Table: unix.RT_TABLE_MAIN}}
+
+	_, err := testable.rm.EnsureAbsent(absent)
+
+	testable.stop()
+	if err != ErrAPIServerRoute {
+		t.Errorf("Deletion of the default route must be refused: %v", err)
+	}
+	if cached != 1 || lookups != 2 {
+		t.Errorf("Route to the apiserver must be looked up once until a route update: %d %d", cached, lookups)
+	}
+}
@@ -0,0 +1,284 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"net"
+	"sort"
+
+	"github.com/vishvananda/netlink"
+)
+
+/* peerRoutes returns the routes of the other names routing the same destination, table, tos and metric through another gateway.
+   Their gateways are the nexthops merged into the route of the name, so it is always empty without ECMPMerge. */
+func (r *routeManagerImpl) peerRoutes(name string, route Route) map[string]Route {
+	if !r.options.ECMPMerge || route.Gw == nil {
+		return nil
+	}
+	route = withMainTable(route)
+	peers := map[string]Route{}
+	for managedName, managed := range r.managedRoutes {
+		managed = withMainTable(managed)
+		if managedName == name || managed.Gw == nil || managed.Gw.Equal(route.Gw) || managed.Dst.String() != route.Dst.String() || managed.Table != route.Table || managed.Tos != route.Tos || managed.Metric != route.Metric {
+			continue
+		}
+		peers[managedName] = managed
+	}
+	return peers
+}
+
+//peerGateways returns the distinct gateways of the peer routes
+func peerGateways(peers map[string]Route) []net.IP {
+	gateways := []net.IP{}
+	for _, peer := range peers {
+		if !containsIP(gateways, peer.Gw) {
+			gateways = append(gateways, peer.Gw)
+		}
+	}
+	return gateways
+}
+
+//mergedRoute converts the route of the name to netlink, with the gateways of its peers merged in as nexthops of a multipath route
+func (r *routeManagerImpl) mergedRoute(name string, route Route) netlink.Route {
+	peers := r.peerRoutes(name, route)
+	if len(peers) == 0 {
+		return route.toNetLinkRoute()
+	}
+	peers[name] = route
+	return withWeightedNexthops(route, r.nexthops(peers))
+}
+
+func (r *routeManagerImpl) Nexthops(name string) []Nexthop {
+	nexthopsChan := make(chan []Nexthop)
+	r.nexthopsChan <- routeManagerImplNexthopsParams{name, nexthopsChan}
+	return <-nexthopsChan
+}
+
+func (r *routeManagerImpl) nexthopsOf(name string) []Nexthop {
+	route, found := r.managedRoutes[name]
+	if !found {
+		return nil
+	}
+	peers := r.peerRoutes(name, route)
+	if len(peers) == 0 {
+		return nil
+	}
+	peers[name] = route
+	return r.nexthops(peers)
+}
+
+/* nexthops weighs the distinct gateways of the merged routes, a gateway routed by more names takes the highest weight of them.
+   A gateway is degraded if the route of any of its names is, its weight is then lowered or it is left out by the ECMPRebalance policy. */
+func (r *routeManagerImpl) nexthops(routes map[string]Route) []Nexthop {
+	weights := map[string]int{}
+	degraded := map[string]bool{}
+	gateways := map[string]net.IP{}
+	for name, route := range routes {
+		gw := route.Gw.String()
+		gateways[gw] = route.Gw
+		if weight := route.weight(); weight > weights[gw] {
+			weights[gw] = weight
+		}
+		if r.isDegraded(name) {
+			degraded[gw] = true
+		}
+	}
+	// Draining every nexthop would drop the route, so the degraded ones stay if no healthy one is left
+	drain := r.options.ECMPRebalance == ECMPRebalanceDrain && len(degraded) < len(gateways)
+	nexthops := make([]Nexthop, 0, len(gateways))
+	for gw, ip := range gateways {
+		weight := weights[gw]
+		if degraded[gw] {
+			if drain {
+				continue
+			}
+			if r.options.ECMPRebalance == ECMPRebalanceScale {
+				weight = weight * r.options.ECMPDegradedWeightPercent / 100
+				if weight < 1 {
+					weight = 1
+				}
+			}
+		}
+		nexthops = append(nexthops, Nexthop{Gw: ip, Weight: weight})
+	}
+	sort.Slice(nexthops, func(i, j int) bool {
+		return nexthops[i].Gw.String() < nexthops[j].Gw.String()
+	})
+	return nexthops
+}
+
+//weight returns the weight of the route as a nexthop, between 1 and MaxWeight
+func (r Route) weight() int {
+	if r.Weight < 1 {
+		return 1
+	}
+	if r.Weight > MaxWeight {
+		return MaxWeight
+	}
+	return r.Weight
+}
+
+//withNexthops converts the route to netlink through the given gateways. A single gateway makes an ordinary route, more make a multipath one.
+func withNexthops(route Route, gateways []net.IP) netlink.Route {
+	if len(gateways) == 1 {
+		nlRoute := route.toNetLinkRoute()
+		nlRoute.Gw = gateways[0]
+		return nlRoute
+	}
+	nexthops := make([]Nexthop, 0, len(gateways))
+	for _, gateway := range gateways {
+		nexthops = append(nexthops, Nexthop{Gw: gateway, Weight: 1})
+	}
+	return withWeightedNexthops(route, nexthops)
+}
+
+/* withWeightedNexthops converts the route to a multipath one through the given nexthops, even a single one, so it replaces the merged route in the kernel.
+   The kernel takes the weight of a nexthop as its hops plus one. */
+func withWeightedNexthops(route Route, nexthops []Nexthop) netlink.Route {
+	sort.Slice(nexthops, func(i, j int) bool {
+		return nexthops[i].Gw.String() < nexthops[j].Gw.String()
+	})
+	nlRoute := route.toNetLinkRoute()
+	nlRoute.Gw = nil
+	for _, nexthop := range nexthops {
+		nlRoute.MultiPath = append(nlRoute.MultiPath, &netlink.NexthopInfo{Gw: nexthop.Gw, Hops: nexthop.Weight - 1})
+	}
+	return nlRoute
+}
+
+/* rebalance replaces the merged routes of the names after their health changed, so the weights of the nexthops follow the ECMPRebalance policy.
+   The watchers of the peers are notified too, as their effective nexthops changed with it. */
+func (r *routeManagerImpl) rebalance(names []string) {
+	if r.options.ECMPRebalance == ECMPRebalanceNone {
+		return
+	}
+	notified := map[string]bool{}
+	for _, name := range names {
+		notified[name] = true
+	}
+	peerNames := []string{}
+	for _, name := range names {
+		route, found := r.managedRoutes[name]
+		if !found {
+			continue
+		}
+		peers := r.peerRoutes(name, route)
+		if len(peers) == 0 {
+			continue
+		}
+		nlRoute := r.mergedRoute(name, route)
+		// A failed replace is seen as a drift by the next verification of the route, which replaces it again
+		_ = r.routeReplace(&nlRoute)
+		for peer := range peers {
+			if !notified[peer] {
+				notified[peer] = true
+				peerNames = append(peerNames, peer)
+			}
+		}
+	}
+	sort.Strings(peerNames)
+	for _, peer := range peerNames {
+		r.notifyGatewayWatchers([]string{peer}, r.isDegraded(peer))
+	}
+}
+
+//installRoute creates the route in the kernel. A multipath route replaces the route of the peers, which has the same destination.
+func (r *routeManagerImpl) installRoute(nlRoute *netlink.Route) error {
+	if len(nlRoute.MultiPath) != 0 {
+		return r.routeReplace(nlRoute)
+	}
+	return r.routeAdd(nlRoute)
+}
+
+/* removeRoute removes the route of the name from the kernel, unless another name manages the same route.
+   A merged route is replaced with the nexthops of the peers, so only the gateway of the name is removed. */
+func (r *routeManagerImpl) removeRoute(name string, route Route) error {
+	if r.isSharedRoute(name, route) {
+		return nil
+	}
+	if peers := r.peerRoutes(name, route); len(peers) != 0 {
+		nlRoute := withNexthops(route, peerGateways(peers))
+		if len(nlRoute.MultiPath) != 0 {
+			nlRoute = withWeightedNexthops(route, r.nexthops(peers))
+		}
+		return r.routeReplace(&nlRoute)
+	}
+	return r.ownRouteDel(route)
+}
+
+/* sameNexthops tells whether the two routes go through the same set of gateways with the same weights, regardless of being multipath or not.
+   The kernel reports a multipath route of a single nexthop as an ordinary one, so its weight is meaningless. */
+func sameNexthops(x, y netlink.Route) bool {
+	xGateways, yGateways := nexthopGateways(x), nexthopGateways(y)
+	if len(xGateways) != len(yGateways) {
+		return false
+	}
+	for _, gateway := range xGateways {
+		if !containsIP(yGateways, gateway) {
+			return false
+		}
+	}
+	if len(xGateways) == 1 {
+		return true
+	}
+	yHops := map[string]int{}
+	for _, nexthop := range y.MultiPath {
+		yHops[nexthop.Gw.String()] = nexthop.Hops
+	}
+	for _, nexthop := range x.MultiPath {
+		if yHops[nexthop.Gw.String()] != nexthop.Hops {
+			return false
+		}
+	}
+	return true
+}
+
+//nexthopGateways returns the gateway of the route, or the gateways of its nexthops if it is a multipath one
+func nexthopGateways(route netlink.Route) []net.IP {
+	if len(route.MultiPath) == 0 {
+		return []net.IP{route.Gw}
+	}
+	gateways := make([]net.IP, 0, len(route.MultiPath))
+	for _, nexthop := range route.MultiPath {
+		gateways = append(gateways, nexthop.Gw)
+	}
+	return gateways
+}
+
+//expandNexthops splits a multipath route into a route per nexthop, so they can be compared with the managed routes
+func expandNexthops(route netlink.Route) []netlink.Route {
+	if len(route.MultiPath) == 0 {
+		return []netlink.Route{route}
+	}
+	routes := make([]netlink.Route, 0, len(route.MultiPath))
+	for _, nexthop := range route.MultiPath {
+		single := route
+		single.Gw = nexthop.Gw
+		single.MultiPath = nil
+		routes = append(routes, single)
+	}
+	return routes
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, item := range ips {
+		if item.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
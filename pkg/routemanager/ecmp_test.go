@@ -0,0 +1,349 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+//recordNetlink logs the route calls of the RouteManager with the gateways of the route
+func recordNetlink(testable *testableRouteManager) *[]string {
+	calls := []string{}
+	record := func(operation string) func(*netlink.Route) error {
+		return func(route *netlink.Route) error {
+			calls = append(calls, fmt.Sprintf("%s %v", operation, nexthopGateways(*route)))
+			return nil
+		}
+	}
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = record("add")
+	testable.rm.(*routeManagerImpl).nlRouteReplaceFunc = record("replace")
+	testable.rm.(*routeManagerImpl).nlRouteDelFunc = record("del")
+	return &calls
+}
+
+func TestECMPMergeAddsAndRemovesNexthops(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).options.ECMPMerge = true
+	calls := recordNetlink(&testable)
+	first := gTestRoute
+	second := gTestRoute
+	second.Gw = net.IP{192, 168, 1, 253}
+	testable.start()
+
+	if err := testable.rm.RegisterRoute("first", first); err != nil {
+		t.Errorf("RegisterRoute shall pass here: %s", err.Error())
+	}
+	if err := testable.rm.RegisterRoute("second", second); err != nil {
+		t.Errorf("RegisterRoute shall pass here: %s", err.Error())
+	}
+	if err := testable.rm.DeRegisterRoute("first"); err != nil {
+		t.Errorf("DeRegisterRoute shall pass here: %s", err.Error())
+	}
+	if err := testable.rm.DeRegisterRoute("second"); err != nil {
+		t.Errorf("DeRegisterRoute shall pass here: %s", err.Error())
+	}
+
+	testable.stop()
+	expected := "[add [192.168.1.254] replace [192.168.1.253 192.168.1.254] replace [192.168.1.253] del [192.168.1.253]]"
+	if fmt.Sprintf("%v", *calls) != expected {
+		t.Errorf("Nexthops must be merged and split: %v", *calls)
+	}
+}
+
+func TestECMPMergeDisabledDoesNotMerge(t *testing.T) {
+	testable := newTestableRouteManager()
+	calls := recordNetlink(&testable)
+	second := gTestRoute
+	second.Gw = net.IP{192, 168, 1, 253}
+	testable.start()
+
+	_ = testable.rm.RegisterRoute("first", gTestRoute)
+	_ = testable.rm.RegisterRoute("second", second)
+
+	testable.stop()
+	if fmt.Sprintf("%v", *calls) != "[add [192.168.1.254] add [192.168.1.253]]" {
+		t.Errorf("Routes must be created independently: %v", *calls)
+	}
+}
+
+func TestECMPMergeKeepsOtherTos(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).options.ECMPMerge = true
+	calls := recordNetlink(&testable)
+	second := gTestRoute
+	second.Gw = net.IP{192, 168, 1, 253}
+	second.Tos = 0x10
+	testable.start()
+
+	_ = testable.rm.RegisterRoute("first", gTestRoute)
+	_ = testable.rm.RegisterRoute("second", second)
+
+	testable.stop()
+	if fmt.Sprintf("%v", *calls) != "[add [192.168.1.254] add [192.168.1.253]]" {
+		t.Errorf("Routes with other tos must be not merged: %v", *calls)
+	}
+}
+
+func TestECMPMergeKeepsOtherMetric(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).options.ECMPMerge = true
+	calls := recordNetlink(&testable)
+	second := gTestRoute
+	second.Gw = net.IP{192, 168, 1, 253}
+	second.Metric = 101
+	testable.start()
+
+	_ = testable.rm.RegisterRoute("first", gTestRoute)
+	_ = testable.rm.RegisterRoute("second", second)
+
+	testable.stop()
+	if fmt.Sprintf("%v", *calls) != "[add [192.168.1.254] add [192.168.1.253]]" {
+		t.Errorf("Routes with other metric must be not merged: %v", *calls)
+	}
+}
+
+func TestVerifyRouteAcceptsMergedRoute(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).options.ECMPMerge = true
+	second := gTestRoute
+	second.Gw = net.IP{192, 168, 1, 253}
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		return []netlink.Route{withNexthops(gTestRoute, []net.IP{gTestRoute.Gw, second.Gw})}, nil
+	}
+	testable.start()
+	_ = testable.rm.RegisterRoute("first", gTestRoute)
+	_ = testable.rm.RegisterRoute("second", second)
+	calls := recordNetlink(&testable)
+
+	repair, err := testable.rm.VerifyRoute("first")
+
+	testable.stop()
+	if repair != RepairNone || err != nil || len(*calls) != 0 {
+		t.Errorf("Merged route must satisfy the route: %d %v %v", repair, err, *calls)
+	}
+}
+
+func TestVerifyRouteRestoresMissingNexthop(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).options.ECMPMerge = true
+	second := gTestRoute
+	second.Gw = net.IP{192, 168, 1, 253}
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		return []netlink.Route{gTestRoute.toNetLinkRoute()}, nil
+	}
+	testable.start()
+	_ = testable.rm.RegisterRoute("first", gTestRoute)
+	_ = testable.rm.RegisterRoute("second", second)
+	calls := recordNetlink(&testable)
+
+	repair, err := testable.rm.VerifyRoute("first")
+
+	testable.stop()
+	if repair != RepairGatewayRestored || err != nil {
+		t.Errorf("Missing nexthop must be restored: %d %v", repair, err)
+	}
+	if fmt.Sprintf("%v", *calls) != "[replace [192.168.1.253 192.168.1.254]]" {
+		t.Errorf("Route must be replaced with every nexthop: %v", *calls)
+	}
+}
+
+func TestWatchDelMultipathRouteTriggersEveryNexthop(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).options.ECMPMerge = true
+	second := gTestRoute
+	second.Gw = net.IP{192, 168, 1, 253}
+	testable.start()
+	_ = testable.rm.RegisterRoute("first", gTestRoute)
+	_ = testable.rm.RegisterRoute("second", second)
+	deleted := make(chan Route, 2)
+	testable.rm.RegisterWatcher(MockRouteWatcher{routeDeletedCalledWith: deleted})
+
+	gMockUpdateChan <- netlink.RouteUpdate{Type: unix.RTM_DELROUTE, Route: withNexthops(gTestRoute, []net.IP{gTestRoute.Gw, second.Gw})}
+	first, other := <-deleted, <-deleted
+
+	testable.stop()
+	if !first.Gw.Equal(second.Gw) || !other.Gw.Equal(gTestRoute.Gw) {
+		t.Errorf("Every nexthop must be reported: %v %v", first, other)
+	}
+}
+
+//recordWeights logs the replace calls of the RouteManager with the gateway and weight of every nexthop
+func recordWeights(testable *testableRouteManager) *[]string {
+	calls := []string{}
+	testable.rm.(*routeManagerImpl).nlRouteReplaceFunc = func(route *netlink.Route) error {
+		nexthops := []string{}
+		for _, nexthop := range route.MultiPath {
+			nexthops = append(nexthops, fmt.Sprintf("%s*%d", nexthop.Gw, nexthop.Hops+1))
+		}
+		calls = append(calls, fmt.Sprintf("%v", nexthops))
+		return nil
+	}
+	return &calls
+}
+
+func TestECMPMergeWeighsNexthops(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).options.ECMPMerge = true
+	calls := recordWeights(&testable)
+	first := gTestRoute
+	first.Weight = 3
+	second := gTestRoute
+	second.Gw = net.IP{192, 168, 1, 253}
+	testable.start()
+
+	_ = testable.rm.RegisterRoute("first", first)
+	_ = testable.rm.RegisterRoute("second", second)
+	nexthops := testable.rm.Nexthops("first")
+	unmerged := testable.rm.Nexthops("unknown")
+
+	testable.stop()
+	if fmt.Sprintf("%v", *calls) != "[[192.168.1.253*1 192.168.1.254*3]]" {
+		t.Errorf("Nexthops must be weighted: %v", *calls)
+	}
+	if fmt.Sprintf("%v", nexthops) != "[{192.168.1.253 1} {192.168.1.254 3}]" || unmerged != nil {
+		t.Errorf("Nexthops mismatch: %v %v", nexthops, unmerged)
+	}
+}
+
+func TestECMPRebalanceDrainsDegradedNexthop(t *testing.T) {
+	testable := newTestableRouteManager()
+	rm := testable.rm.(*routeManagerImpl)
+	rm.options.ECMPMerge = true
+	rm.options.ECMPRebalance = ECMPRebalanceDrain
+	calls := recordWeights(&testable)
+	var failing int32
+	rm.healthProbeFunc = func(HealthCheck, net.IP) error {
+		if atomic.LoadInt32(&failing) == 1 {
+			return errors.New("unreachable")
+		}
+		return nil
+	}
+	second := routeWithHealthCheck(HealthCheck{Interval: 5 * time.Millisecond})
+	second.Gw = net.IP{192, 168, 1, 253}
+	testable.start()
+	watcher := healthWatcher{changes: make(chan string, 10)}
+	testable.rm.RegisterWatcher(watcher)
+	_ = testable.rm.RegisterRoute("first", gTestRoute)
+	_ = testable.rm.RegisterRoute("second", second)
+
+	atomic.StoreInt32(&failing, 1)
+	degraded := []string{<-watcher.changes, <-watcher.changes}
+	drained := testable.rm.Nexthops("first")
+	atomic.StoreInt32(&failing, 0)
+	recovered := []string{<-watcher.changes, <-watcher.changes}
+	restored := testable.rm.Nexthops("first")
+
+	testable.stop()
+	if fmt.Sprintf("%v", degraded) != "[second degraded first recovered]" || fmt.Sprintf("%v", recovered) != "[second recovered first recovered]" {
+		t.Errorf("The route and its peer must be notified: %v %v", degraded, recovered)
+	}
+	if fmt.Sprintf("%v", drained) != "[{192.168.1.254 1}]" || fmt.Sprintf("%v", restored) != "[{192.168.1.253 1} {192.168.1.254 1}]" {
+		t.Errorf("Nexthops mismatch: %v %v", drained, restored)
+	}
+	expected := "[[192.168.1.253*1 192.168.1.254*1] [192.168.1.254*1] [192.168.1.253*1 192.168.1.254*1]]"
+	if fmt.Sprintf("%v", *calls) != expected {
+		t.Errorf("Degraded nexthop must be drained and restored: %v", *calls)
+	}
+}
+
+func TestECMPRebalanceDisabledKeepsWeights(t *testing.T) {
+	testable := newTestableRouteManager()
+	rm := testable.rm.(*routeManagerImpl)
+	rm.options.ECMPMerge = true
+	calls := recordWeights(&testable)
+	rm.healthProbeFunc = func(HealthCheck, net.IP) error {
+		return errors.New("unreachable")
+	}
+	second := routeWithHealthCheck(HealthCheck{Interval: time.Hour})
+	second.Gw = net.IP{192, 168, 1, 253}
+	testable.start()
+
+	_ = testable.rm.RegisterRoute("first", gTestRoute)
+	_ = testable.rm.RegisterRoute("second", second)
+	nexthops := testable.rm.Nexthops("first")
+
+	testable.stop()
+	if fmt.Sprintf("%v", *calls) != "[[192.168.1.253*1 192.168.1.254*1]]" || len(nexthops) != 2 {
+		t.Errorf("Degraded nexthop must be kept: %v %v", *calls, nexthops)
+	}
+}
+
+func TestECMPRebalanceNexthops(t *testing.T) {
+	first := gTestRoute
+	first.Weight = 10
+	second := gTestRoute
+	second.Gw = net.IP{192, 168, 1, 253}
+	second.Weight = 300
+	third := gTestRoute
+	third.Gw = net.IP{192, 168, 1, 252}
+	routes := map[string]Route{"first": first, "second": second, "third": third}
+	cases := []struct {
+		policy   string
+		degraded []string
+		expected string
+	}{
+		{ECMPRebalanceNone, []string{"192.168.1.254"}, "[{192.168.1.252 1} {192.168.1.253 256} {192.168.1.254 10}]"},
+		{ECMPRebalanceDrain, []string{"192.168.1.254"}, "[{192.168.1.252 1} {192.168.1.253 256}]"},
+		{ECMPRebalanceDrain, []string{"192.168.1.252", "192.168.1.253", "192.168.1.254"}, "[{192.168.1.252 1} {192.168.1.253 256} {192.168.1.254 10}]"},
+		{ECMPRebalanceScale, []string{"192.168.1.254", "192.168.1.252"}, "[{192.168.1.252 1} {192.168.1.253 256} {192.168.1.254 2}]"},
+	}
+	for _, c := range cases {
+		testable := newTestableRouteManager()
+		rm := testable.rm.(*routeManagerImpl)
+		rm.options.ECMPRebalance = c.policy
+		rm.options.ECMPDegradedWeightPercent = 25
+		rm.managedRoutes = routes
+		for _, gw := range c.degraded {
+			rm.gateways[gw] = &gatewayState{degraded: true}
+		}
+
+		if nexthops := fmt.Sprintf("%v", rm.nexthops(routes)); nexthops != c.expected {
+			t.Errorf("Nexthops mismatch with %q: %s", c.policy, nexthops)
+		}
+	}
+}
+
+func TestVerifyRouteRestoresChangedWeight(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).options.ECMPMerge = true
+	first := gTestRoute
+	first.Weight = 2
+	second := gTestRoute
+	second.Gw = net.IP{192, 168, 1, 253}
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		return []netlink.Route{withNexthops(gTestRoute, []net.IP{gTestRoute.Gw, second.Gw})}, nil
+	}
+	testable.start()
+	_ = testable.rm.RegisterRoute("first", first)
+	_ = testable.rm.RegisterRoute("second", second)
+	calls := recordWeights(&testable)
+
+	repair, err := testable.rm.VerifyRoute("first")
+
+	testable.stop()
+	if repair != RepairGatewayRestored || err != nil || fmt.Sprintf("%v", *calls) != "[[192.168.1.253*1 192.168.1.254*2]]" {
+		t.Errorf("Weight must be restored: %d %v %v", repair, err, *calls)
+	}
+}
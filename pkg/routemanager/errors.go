@@ -0,0 +1,86 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"errors"
+	"syscall"
+)
+
+var (
+	//ErrRetriable the class of the errors which are transient, ie. the network of the gateway is not reachable yet or the kernel did not answer, so the operation may succeed later
+	ErrRetriable = errors.New("Route operation may be retried")
+	//ErrInvalidRoute the class of the errors of the routes the kernel rejects, the operation fails until the route is changed
+	ErrInvalidRoute = errors.New("Route is invalid")
+	//ErrInterfaceMissing the class of the errors of the routes whose device does not exist on the node
+	ErrInterfaceMissing = errors.New("Interface of the route is missing")
+)
+
+var (
+	//NotFoundError route not found error
+	ErrNotFound = errors.New("Route could not found")
+	//ErrTableProtected the table can not be flushed
+	ErrTableProtected = errors.New("Flushing the main, local and default tables is not allowed")
+	//ErrInvalidTable the table of the route is out of the range of the kernel
+	ErrInvalidTable error = &RouteError{Class: ErrInvalidRoute, Err: errors.New("Table must be between 0 and 4294967295")}
+	//ErrNetlinkTimeout the kernel did not answer the netlink call within NetlinkTimeout
+	ErrNetlinkTimeout error = &RouteError{Class: ErrRetriable, Err: errors.New("Netlink call timed out")}
+	//ErrVrfNotFound the VRF device of the route does not exist on the node
+	ErrVrfNotFound error = &RouteError{Class: ErrInterfaceMissing, Err: errors.New("VRF device not found")}
+	//ErrAPIServerRoute the route the node reaches the apiserver through can not be deleted nor replaced, see Options.APIServerIPs
+	ErrAPIServerRoute error = &RouteError{Class: ErrInvalidRoute, Err: errors.New("Route to the apiserver must not be deleted nor replaced")}
+)
+
+/* RouteError is an error of the RouteManager classified by its cause, so the callers can decide to retry or give up without parsing messages.
+   errors.Is matches both its class (ErrRetriable, ErrInvalidRoute or ErrInterfaceMissing) and its cause, ie. the errno of the kernel. */
+type RouteError struct {
+	//Class tells how the error shall be handled
+	Class error
+	//Err the cause of the error, its message is the message of the RouteError
+	Err error
+}
+
+func (e *RouteError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
+
+//Is matches the class of the error, the cause is matched through Unwrap
+func (e *RouteError) Is(target error) bool {
+	return target == e.Class
+}
+
+//classify wraps the errno returned by netlink into a RouteError of its class. The errors without known class are returned as they are.
+func classify(err error) error {
+	var routeErr *RouteError
+	var errno syscall.Errno
+	if err == nil || errors.As(err, &routeErr) || !errors.As(err, &errno) {
+		return err
+	}
+	switch errno {
+	case syscall.ENETUNREACH, syscall.EHOSTUNREACH, syscall.EAGAIN, syscall.EBUSY, syscall.ENOBUFS, syscall.EINTR:
+		return &RouteError{Class: ErrRetriable, Err: err}
+	case syscall.EINVAL, syscall.ERANGE, syscall.EAFNOSUPPORT, syscall.EOPNOTSUPP:
+		return &RouteError{Class: ErrInvalidRoute, Err: err}
+	case syscall.ENODEV:
+		return &RouteError{Class: ErrInterfaceMissing, Err: err}
+	}
+	return err
+}
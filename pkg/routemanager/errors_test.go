@@ -0,0 +1,79 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestClassify(t *testing.T) {
+	var testData = []struct {
+		err   error
+		class error
+	}{
+		{syscall.ENETUNREACH, ErrRetriable},
+		{syscall.EBUSY, ErrRetriable},
+		{syscall.EINVAL, ErrInvalidRoute},
+		{syscall.ERANGE, ErrInvalidRoute},
+		{syscall.ENODEV, ErrInterfaceMissing},
+		{fmt.Errorf("Unable to create rule: %w", syscall.EHOSTUNREACH), ErrRetriable},
+		{ErrNetlinkTimeout, ErrRetriable},
+		{ErrVrfNotFound, ErrInterfaceMissing},
+		{ErrInvalidTable, ErrInvalidRoute},
+	}
+	for i, td := range testData {
+		err := classify(td.err)
+		if !errors.Is(err, td.class) || !errors.Is(err, td.err) {
+			t.Errorf("Class or cause mismatch at %d: %v", i, err)
+		}
+		if err.Error() != td.err.Error() {
+			t.Errorf("Message must be kept at %d: %s", i, err.Error())
+		}
+	}
+}
+
+func TestClassifyUnknown(t *testing.T) {
+	for _, err := range []error{nil, syscall.EEXIST, syscall.ESRCH, errors.New("other")} {
+		if classified := classify(err); classified != err {
+			t.Errorf("Error must be returned as it is: %v", classified)
+		}
+	}
+}
+
+func TestRegisterRouteReturnsRouteError(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(*netlink.Route) error {
+		return syscall.EINVAL
+	}
+	testable.start()
+
+	err := testable.rm.RegisterRoute(gTestRouteName, gTestRoute)
+
+	testable.stop()
+	var routeErr *RouteError
+	if !errors.As(err, &routeErr) || routeErr.Class != ErrInvalidRoute || !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("Error must be an invalid route: %v", err)
+	}
+	if errors.Is(err, ErrRetriable) || errors.Is(err, ErrInterfaceMissing) {
+		t.Errorf("Error must have a single class: %v", err)
+	}
+}
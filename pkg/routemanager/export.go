@@ -0,0 +1,111 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+type routeManagerImplExportRoutesResult struct {
+	commands []string
+	err      error
+}
+
+//routeTypeNames are the keywords of the route types in iproute2, unicast is the default which is not written
+var routeTypeNames = map[int]string{
+	unix.RTN_LOCAL:       "local",
+	unix.RTN_BROADCAST:   "broadcast",
+	unix.RTN_ANYCAST:     "anycast",
+	unix.RTN_MULTICAST:   "multicast",
+	unix.RTN_BLACKHOLE:   "blackhole",
+	unix.RTN_UNREACHABLE: "unreachable",
+	unix.RTN_PROHIBIT:    "prohibit",
+	unix.RTN_THROW:       "throw",
+}
+
+//scopeNames are the keywords of the route scopes in iproute2
+var scopeNames = map[netlink.Scope]string{
+	netlink.SCOPE_UNIVERSE: "global",
+	netlink.SCOPE_SITE:     "site",
+	netlink.SCOPE_LINK:     "link",
+	netlink.SCOPE_HOST:     "host",
+	netlink.SCOPE_NOWHERE:  "nowhere",
+}
+
+func (r *routeManagerImpl) ExportRoutes() ([]string, error) {
+	resultChan := make(chan routeManagerImplExportRoutesResult)
+	r.exportRoutesChan <- resultChan
+	result := <-resultChan
+	return result.commands, result.err
+}
+
+func (r *routeManagerImpl) exportRoutes(result chan<- routeManagerImplExportRoutesResult) {
+	kernelRoutes, err := r.ownKernelRoutes()
+	if err != nil {
+		result <- routeManagerImplExportRoutesResult{err: err}
+		return
+	}
+	commands := []string{}
+	for _, kernelRoute := range kernelRoutes {
+		commands = append(commands, iproute2Command(kernelRoute))
+	}
+	result <- routeManagerImplExportRoutesResult{commands: commands}
+}
+
+/* iproute2Command renders the route as an ip route add command. The protocol is kept, so a reinstalled operator
+   recognizes the route as its own. The routes which drop the packets have no gateway, the multipath ones have a nexthop per gateway. */
+func iproute2Command(route netlink.Route) string {
+	command := "ip route add "
+	if route.Dst.IP.To4() == nil {
+		command = "ip -6 route add "
+	}
+	if name, found := routeTypeNames[route.Type]; found {
+		command += name + " "
+	} else if route.Type != unix.RTN_UNSPEC && route.Type != unix.RTN_UNICAST {
+		command += strconv.Itoa(route.Type) + " "
+	}
+	command += route.Dst.String()
+	if route.Tos != 0 {
+		command += fmt.Sprintf(" tos 0x%02x", route.Tos)
+	}
+	if route.Gw != nil {
+		command += " via " + route.Gw.String()
+	}
+	if route.Src != nil {
+		command += " src " + route.Src.String()
+	}
+	if route.Table != 0 {
+		command += fmt.Sprintf(" table %d", route.Table)
+	}
+	command += fmt.Sprintf(" proto %d", route.Protocol)
+	if name, found := scopeNames[route.Scope]; found {
+		command += " scope " + name
+	} else {
+		command += fmt.Sprintf(" scope %d", route.Scope)
+	}
+	if route.Priority != 0 {
+		command += fmt.Sprintf(" metric %d", route.Priority)
+	}
+	for _, nexthop := range route.MultiPath {
+		command += " nexthop via " + nexthop.Gw.String()
+	}
+	return command
+}
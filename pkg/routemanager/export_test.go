@@ -0,0 +1,104 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestIproute2Command(t *testing.T) {
+	_, v4, _ := net.ParseCIDR("10.1.0.0/16")
+	_, v6, _ := net.ParseCIDR("fd00:1::/64")
+	var testData = []struct {
+		route   netlink.Route
+		command string
+	}{
+		{netlink.Route{Dst: v4, Gw: net.IP{10, 0, 0, 1}, Table: 254, Protocol: 196, Type: unix.RTN_UNICAST},
+			"ip route add 10.1.0.0/16 via 10.0.0.1 table 254 proto 196 scope global"},
+		{netlink.Route{Dst: v4, Gw: net.IP{10, 0, 0, 1}, Src: net.IP{10, 0, 0, 5}, Tos: 0x10, Table: 100, Protocol: 196, Priority: 50},
+			"ip route add 10.1.0.0/16 tos 0x10 via 10.0.0.1 src 10.0.0.5 table 100 proto 196 scope global metric 50"},
+		{netlink.Route{Dst: v6, Gw: net.ParseIP("fd00::1"), Table: 254, Protocol: 196, Type: unix.RTN_UNICAST, Priority: 1024},
+			"ip -6 route add fd00:1::/64 via fd00::1 table 254 proto 196 scope global metric 1024"},
+		{netlink.Route{Dst: v4, Table: 254, Protocol: 196, Type: unix.RTN_BLACKHOLE},
+			"ip route add blackhole 10.1.0.0/16 table 254 proto 196 scope global"},
+		{netlink.Route{Dst: v6, Table: 254, Protocol: 196, Type: unix.RTN_UNREACHABLE},
+			"ip -6 route add unreachable fd00:1::/64 table 254 proto 196 scope global"},
+		{netlink.Route{Dst: v4, Table: 254, Protocol: 196, Type: unix.RTN_PROHIBIT},
+			"ip route add prohibit 10.1.0.0/16 table 254 proto 196 scope global"},
+		{netlink.Route{Dst: v4, Table: 255, Protocol: 196, Type: unix.RTN_LOCAL, Scope: netlink.SCOPE_HOST},
+			"ip route add local 10.1.0.0/16 table 255 proto 196 scope host"},
+		{netlink.Route{Dst: v4, Table: 254, Protocol: 196, Type: 42, Scope: 100},
+			"ip route add 42 10.1.0.0/16 table 254 proto 196 scope 100"},
+		{netlink.Route{Dst: v4, Table: 254, Protocol: 196, MultiPath: []*netlink.NexthopInfo{&netlink.NexthopInfo{Gw: net.IP{10, 0, 0, 1}}, &netlink.NexthopInfo{Gw: net.IP{10, 0, 0, 2}}}},
+			"ip route add 10.1.0.0/16 table 254 proto 196 scope global nexthop via 10.0.0.1 nexthop via 10.0.0.2"},
+	}
+	for i, td := range testData {
+		if command := iproute2Command(td.route); command != td.command {
+			t.Errorf("Command mismatch at %d: %s", i, command)
+		}
+	}
+}
+
+func TestExportRoutes(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).protocol = DefaultProtocol
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		ours := gTestRoute.toNetLinkRoute()
+		ours.Protocol = DefaultProtocol
+		otherTable := ours
+		otherTable.Table = 100
+		foreign := gTestRoute.toNetLinkRoute()
+		foreign.Protocol = unix.RTPROT_BOOT
+		return []netlink.Route{ours, foreign, otherTable}, nil
+	}
+	testable.start()
+
+	commands, err := testable.rm.ExportRoutes()
+
+	testable.stop()
+	if err != nil {
+		t.Errorf("ExportRoutes shall pass here: %s", err.Error())
+	}
+	expected := []string{
+		"ip route add 192.168.1.0/24 via 192.168.1.254 table 100 proto 196 scope global",
+		"ip route add 192.168.1.0/24 via 192.168.1.254 table 254 proto 196 scope global",
+	}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("Only our routes must be exported ordered by table: %v", commands)
+	}
+}
+
+func TestExportRoutesFails(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		return nil, errors.New("bla")
+	}
+	testable.start()
+
+	_, err := testable.rm.ExportRoutes()
+
+	testable.stop()
+	if err == nil {
+		t.Error("ExportRoutes shall fail here")
+	}
+}
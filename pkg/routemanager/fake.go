@@ -0,0 +1,389 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+//FakeGatewayResolver is a GatewayResolver for tests. It gives the same answer to every query and records the queried addresses.
+type FakeGatewayResolver struct {
+	Gateway   net.IP
+	Interface string
+	Err       error
+
+	mutex   sync.Mutex
+	queries []net.IP
+}
+
+//ResolveGateway returns the configured Gateway and Err
+func (f *FakeGatewayResolver) ResolveGateway(ip net.IP) (net.IP, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.queries = append(f.queries, ip)
+	return f.Gateway, f.Err
+}
+
+//ResolvePrimaryRoute returns the configured Gateway, Interface and Err
+func (f *FakeGatewayResolver) ResolvePrimaryRoute(ip net.IP) (net.IP, string, error) {
+	gateway, err := f.ResolveGateway(ip)
+	return gateway, f.Interface, err
+}
+
+//Queries returns the addresses asked so far
+func (f *FakeGatewayResolver) Queries() []net.IP {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]net.IP{}, f.queries...)
+}
+
+//FakeOperation is a change of the routes recorded by the FakeRouteManager
+type FakeOperation string
+
+const (
+	//FakeAdd the route was installed
+	FakeAdd FakeOperation = "add"
+	//FakeDelete the route was removed
+	FakeDelete FakeOperation = "delete"
+	//FakeReplace the route was replaced, ie. its gateway was restored by VerifyRoute
+	FakeReplace FakeOperation = "replace"
+)
+
+//FakeCall is a change of the routes done by the FakeRouteManager
+type FakeCall struct {
+	Operation FakeOperation
+	Name      string
+	Route     Route
+}
+
+//FakeTestingT is the part of testing.T the assertions of the FakeRouteManager need
+type FakeTestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+/* FakeRouteManager is a RouteManager for tests, ie. of the controllers embedding the operator. It keeps the installed routes in memory
+   instead of the kernel, and records the routes added, deleted and replaced. The errors and the answers of the queries can be programmed
+   by its fields, which must not be changed while the RouteManager is in use. */
+type FakeRouteManager struct {
+	//RegisterErr is returned by RegisterRoute, RegisterRoutes and ApplyRoutes instead of installing the routes
+	RegisterErr error
+	//RouteErrs are returned instead of installing the routes of the given names, they take precedence over RegisterErr
+	RouteErrs map[string]error
+	//DeRegisterErr is returned by DeRegisterRoute, the route stays installed
+	DeRegisterErr error
+	//Repair is returned by VerifyRoute, RepairRecreated and RepairGatewayRestored are recorded as an add and a replace
+	Repair Repair
+	//VerifyErr is returned by VerifyRoute
+	VerifyErr error
+	//Degraded the names of the routes IsDegraded reports as degraded
+	Degraded map[string]bool
+	//Nexthops the nexthops Nexthops returns by the names of the routes
+	NexthopsByName map[string][]Nexthop
+	//LinksUp the names of the links IsLinkUp reports as up
+	LinksUp map[string]bool
+	//FlushErr is returned by FlushTable
+	FlushErr error
+
+	mutex     sync.Mutex
+	installed map[string]Route
+	calls     []FakeCall
+	watchers  []RouteWatcher
+}
+
+//NewFakeRouteManager returns a FakeRouteManager without routes
+func NewFakeRouteManager() *FakeRouteManager {
+	return &FakeRouteManager{installed: map[string]Route{}}
+}
+
+//IsRegistered returns true if the route of the name is installed
+func (f *FakeRouteManager) IsRegistered(name string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	_, found := f.installed[name]
+	return found
+}
+
+//RegisterRoute installs the route, unless it fails with the programmed error
+func (f *FakeRouteManager) RegisterRoute(name string, route Route) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, found := f.installed[name]; found {
+		return errors.New("Route with the same Name already registered")
+	}
+	if err := f.registerErr(name); err != nil {
+		return err
+	}
+	f.add(name, route)
+	return nil
+}
+
+//RegisterRoutes installs the routes as a unit, none of them is installed if any of them fails. Already installed routes are untouched.
+func (f *FakeRouteManager) RegisterRoutes(routes map[string]Route) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	names := sortedNames(routes)
+	for _, name := range names {
+		if _, found := f.installed[name]; found {
+			continue
+		}
+		if err := f.registerErr(name); err != nil {
+			return fmt.Errorf("Unable to register route %s: %w", name, err)
+		}
+	}
+	for _, name := range names {
+		if _, found := f.installed[name]; !found {
+			f.add(name, routes[name])
+		}
+	}
+	return nil
+}
+
+//ApplyRoutes installs the routes independently, the failing ones are returned by their name. Already installed routes are untouched.
+func (f *FakeRouteManager) ApplyRoutes(routes map[string]Route) map[string]error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	failed := map[string]error{}
+	for _, name := range sortedNames(routes) {
+		if _, found := f.installed[name]; found {
+			continue
+		}
+		if err := f.registerErr(name); err != nil {
+			failed[name] = err
+			continue
+		}
+		f.add(name, routes[name])
+	}
+	return failed
+}
+
+//DeRegisterRoute removes the route, ErrNotFound is returned if it is not installed
+func (f *FakeRouteManager) DeRegisterRoute(name string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	route, found := f.installed[name]
+	if !found {
+		return ErrNotFound
+	}
+	if f.DeRegisterErr != nil {
+		return f.DeRegisterErr
+	}
+	delete(f.installed, name)
+	f.calls = append(f.calls, FakeCall{Operation: FakeDelete, Name: name, Route: route})
+	return nil
+}
+
+//VerifyRoute returns the programmed Repair and VerifyErr, ErrNotFound if the route is not installed
+func (f *FakeRouteManager) VerifyRoute(name string) (Repair, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	route, found := f.installed[name]
+	if !found {
+		return RepairNone, ErrNotFound
+	}
+	if f.VerifyErr != nil {
+		return RepairNone, f.VerifyErr
+	}
+	switch f.Repair {
+	case RepairRecreated:
+		f.calls = append(f.calls, FakeCall{Operation: FakeAdd, Name: name, Route: route})
+	case RepairGatewayRestored:
+		f.calls = append(f.calls, FakeCall{Operation: FakeReplace, Name: name, Route: route})
+	}
+	return f.Repair, nil
+}
+
+//FlushTable returns FlushErr, the main, local and default tables are refused like by the RouteManager. The installed routes are kept.
+func (f *FakeRouteManager) FlushTable(table int) (int, error) {
+	switch table {
+	case unix.RT_TABLE_UNSPEC, unix.RT_TABLE_MAIN, unix.RT_TABLE_LOCAL, unix.RT_TABLE_DEFAULT:
+		return 0, ErrTableProtected
+	}
+	return 0, f.FlushErr
+}
+
+//EnsureAbsent never finds a route to remove, the installed ones are managed
+func (f *FakeRouteManager) EnsureAbsent(Route) (int, error) {
+	return 0, nil
+}
+
+//ListRoutes returns the installed routes, ordered by table and destination
+func (f *FakeRouteManager) ListRoutes() ([]Route, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	routes := []Route{}
+	for _, name := range sortedNames(f.installed) {
+		routes = append(routes, withMainTable(f.installed[name]))
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Table != routes[j].Table {
+			return routes[i].Table < routes[j].Table
+		}
+		return routes[i].Dst.String() < routes[j].Dst.String()
+	})
+	return routes, nil
+}
+
+//ExportRoutes returns the installed routes as iproute2 commands
+func (f *FakeRouteManager) ExportRoutes() ([]string, error) {
+	routes, _ := f.ListRoutes()
+	commands := []string{}
+	for _, route := range routes {
+		nlRoute := route.toNetLinkRoute()
+		nlRoute.Protocol = DefaultProtocol
+		commands = append(commands, iproute2Command(nlRoute))
+	}
+	return commands, nil
+}
+
+//IsDegraded returns true if the name is programmed in Degraded
+func (f *FakeRouteManager) IsDegraded(name string) bool {
+	return f.Degraded[name]
+}
+
+//Nexthops returns the nexthops programmed in NexthopsByName
+func (f *FakeRouteManager) Nexthops(name string) []Nexthop {
+	return f.NexthopsByName[name]
+}
+
+//IsLinkUp returns true if the link is programmed in LinksUp
+func (f *FakeRouteManager) IsLinkUp(name string) bool {
+	return f.LinksUp[name]
+}
+
+//RegisterWatcher registers a RouteWatcher, which is notified by DeleteRoute
+func (f *FakeRouteManager) RegisterWatcher(w RouteWatcher) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.watchers = append(f.watchers, w)
+}
+
+//DeRegisterWatcher removes the RouteWatcher
+func (f *FakeRouteManager) DeRegisterWatcher(w RouteWatcher) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for index, item := range f.watchers {
+		if reflect.DeepEqual(item, w) {
+			f.watchers = append(f.watchers[:index], f.watchers[index+1:]...)
+			break
+		}
+	}
+}
+
+//Run returns when the channel sent in got closed
+func (f *FakeRouteManager) Run(stopChan chan struct{}) error {
+	<-stopChan
+	return nil
+}
+
+//DeleteRoute simulates that the installed route was deleted behind the back of the RouteManager, the RouteWatchers are notified
+func (f *FakeRouteManager) DeleteRoute(name string) {
+	f.mutex.Lock()
+	route, found := f.installed[name]
+	watchers := append([]RouteWatcher{}, f.watchers...)
+	f.mutex.Unlock()
+	if !found {
+		return
+	}
+	for _, watcher := range watchers {
+		watcher.RouteDeleted(route)
+	}
+}
+
+//Installed returns the installed routes by their names
+func (f *FakeRouteManager) Installed() map[string]Route {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	installed := make(map[string]Route, len(f.installed))
+	for name, route := range f.installed {
+		installed[name] = route
+	}
+	return installed
+}
+
+//InstalledNames returns the names of the installed routes in order
+func (f *FakeRouteManager) InstalledNames() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return sortedNames(f.installed)
+}
+
+//Calls returns the changes of the routes so far
+func (f *FakeRouteManager) Calls() []FakeCall {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]FakeCall{}, f.calls...)
+}
+
+//ResetCalls forgets the changes recorded so far, the installed routes are kept
+func (f *FakeRouteManager) ResetCalls() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.calls = nil
+}
+
+//AssertInstalled reports an error if the names of the installed routes differ from the given ones
+func (f *FakeRouteManager) AssertInstalled(t FakeTestingT, names ...string) {
+	t.Helper()
+	expected := append([]string{}, names...)
+	sort.Strings(expected)
+	if installed := f.InstalledNames(); !reflect.DeepEqual(installed, expected) && (len(installed) != 0 || len(expected) != 0) {
+		t.Errorf("Installed routes must be %v, they are %v", expected, installed)
+	}
+}
+
+//AssertRoute reports an error if the route of the name is not installed or it differs from the given one
+func (f *FakeRouteManager) AssertRoute(t FakeTestingT, name string, route Route) {
+	t.Helper()
+	if installed, found := f.Installed()[name]; !found {
+		t.Errorf("Route %s must be installed", name)
+	} else if !reflect.DeepEqual(installed, route) {
+		t.Errorf("Route %s must be %v, it is %v", name, route, installed)
+	}
+}
+
+func (f *FakeRouteManager) registerErr(name string) error {
+	if err, found := f.RouteErrs[name]; found {
+		return err
+	}
+	return f.RegisterErr
+}
+
+func (f *FakeRouteManager) add(name string, route Route) {
+	if f.installed == nil {
+		f.installed = map[string]Route{}
+	}
+	f.installed[name] = route
+	f.calls = append(f.calls, FakeCall{Operation: FakeAdd, Name: name, Route: route})
+}
+
+//sortedNames returns the names of the routes in order, so the fake changes them deterministically
+func sortedNames(routes map[string]Route) []string {
+	names := make([]string, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
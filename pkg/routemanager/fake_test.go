@@ -0,0 +1,139 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+var _ RouteManager = &FakeRouteManager{}
+
+type fakeTestingT struct {
+	errors []string
+}
+
+func (t *fakeTestingT) Helper() {}
+
+func (t *fakeTestingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, format)
+}
+
+func fakeRoute(dst string) Route {
+	_, subnet, _ := net.ParseCIDR(dst)
+	return Route{Dst: *subnet, Gw: net.IP{10, 0, 0, 1}}
+}
+
+func TestFakeRouteManagerRecordsCalls(t *testing.T) {
+	f := NewFakeRouteManager()
+
+	if err := f.RegisterRoute("a", fakeRoute("10.1.0.0/16")); err != nil {
+		t.Errorf("RegisterRoute must succeed: %v", err)
+	}
+	if err := f.RegisterRoute("a", fakeRoute("10.1.0.0/16")); err == nil {
+		t.Error("RegisterRoute must refuse a registered name")
+	}
+	f.Repair = RepairGatewayRestored
+	if repair, err := f.VerifyRoute("a"); repair != RepairGatewayRestored || err != nil {
+		t.Errorf("VerifyRoute must return the programmed repair: %v %v", repair, err)
+	}
+	if err := f.DeRegisterRoute("a"); err != nil {
+		t.Errorf("DeRegisterRoute must succeed: %v", err)
+	}
+	if err := f.DeRegisterRoute("a"); err != ErrNotFound {
+		t.Errorf("DeRegisterRoute must return ErrNotFound: %v", err)
+	}
+
+	expected := []FakeCall{
+		{Operation: FakeAdd, Name: "a", Route: fakeRoute("10.1.0.0/16")},
+		{Operation: FakeReplace, Name: "a", Route: fakeRoute("10.1.0.0/16")},
+		{Operation: FakeDelete, Name: "a", Route: fakeRoute("10.1.0.0/16")},
+	}
+	if calls := f.Calls(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Calls must be recorded: %v", calls)
+	}
+	f.AssertInstalled(t)
+}
+
+func TestFakeRouteManagerProgrammedErrors(t *testing.T) {
+	f := NewFakeRouteManager()
+	f.RouteErrs = map[string]error{"b": errors.New("refused")}
+
+	if err := f.RegisterRoutes(map[string]Route{"a": fakeRoute("10.1.0.0/16"), "b": fakeRoute("10.2.0.0/16")}); err == nil {
+		t.Error("RegisterRoutes must fail if a route fails")
+	}
+	f.AssertInstalled(t)
+	errs := f.ApplyRoutes(map[string]Route{"a": fakeRoute("10.1.0.0/16"), "b": fakeRoute("10.2.0.0/16")})
+	if len(errs) != 1 || errs["b"] == nil {
+		t.Errorf("ApplyRoutes must return the failing route: %v", errs)
+	}
+	f.AssertInstalled(t, "a")
+	f.AssertRoute(t, "a", fakeRoute("10.1.0.0/16"))
+
+	f.DeRegisterErr = errors.New("busy")
+	if err := f.DeRegisterRoute("a"); err != f.DeRegisterErr {
+		t.Errorf("DeRegisterRoute must return the programmed error: %v", err)
+	}
+	f.AssertInstalled(t, "a")
+	if _, err := f.FlushTable(254); err != ErrTableProtected {
+		t.Errorf("FlushTable must refuse the main table: %v", err)
+	}
+}
+
+func TestFakeRouteManagerListAndExport(t *testing.T) {
+	f := NewFakeRouteManager()
+	f.RegisterRoute("b", fakeRoute("10.2.0.0/16"))
+	f.RegisterRoute("a", fakeRoute("10.1.0.0/16"))
+
+	routes, _ := f.ListRoutes()
+	if len(routes) != 2 || routes[0].Dst.String() != "10.1.0.0/16" || routes[0].Table != 254 {
+		t.Errorf("ListRoutes must return the routes by destination in the main table: %v", routes)
+	}
+	commands, _ := f.ExportRoutes()
+	if len(commands) != 2 || commands[0] != "ip route add 10.1.0.0/16 via 10.0.0.1 table 254 proto 196 scope global" {
+		t.Errorf("ExportRoutes must render the routes: %v", commands)
+	}
+}
+
+func TestFakeRouteManagerDeleteRouteNotifies(t *testing.T) {
+	f := NewFakeRouteManager()
+	f.RegisterRoute("a", fakeRoute("10.1.0.0/16"))
+	watcher := MockRouteWatcher{routeDeletedCalledWith: make(chan Route, 1)}
+	f.RegisterWatcher(watcher)
+
+	f.DeleteRoute("a")
+
+	if deleted := <-watcher.routeDeletedCalledWith; deleted.Dst.String() != "10.1.0.0/16" {
+		t.Errorf("Watchers must be notified: %v", deleted)
+	}
+}
+
+func TestFakeRouteManagerAssertions(t *testing.T) {
+	f := NewFakeRouteManager()
+	f.RegisterRoute("a", fakeRoute("10.1.0.0/16"))
+	mockT := &fakeTestingT{}
+
+	f.AssertInstalled(mockT, "b")
+	f.AssertRoute(mockT, "a", fakeRoute("10.2.0.0/16"))
+	f.AssertRoute(mockT, "b", fakeRoute("10.2.0.0/16"))
+
+	if len(mockT.errors) != 3 {
+		t.Errorf("Assertions must report the differences: %v", mockT.errors)
+	}
+}
@@ -0,0 +1,63 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+//NetlinkGatewayResolver resolves the gateway by asking the kernel for the route towards the address
+type NetlinkGatewayResolver struct {
+	nlRouteGetFunc    func(net.IP) ([]netlink.Route, error)
+	nlLinkByIndexFunc func(int) (netlink.Link, error)
+}
+
+//NewGatewayResolver creates the default GatewayResolver, backed by netlink
+func NewGatewayResolver() *NetlinkGatewayResolver {
+	return &NetlinkGatewayResolver{nlRouteGetFunc: netlink.RouteGet, nlLinkByIndexFunc: netlink.LinkByIndex}
+}
+
+//ResolveGateway returns the gateway of the route selected by the kernel for the address
+func (r *NetlinkGatewayResolver) ResolveGateway(ip net.IP) (net.IP, error) {
+	routes, err := r.nlRouteGetFunc(ip)
+	if err != nil {
+		return nil, err
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("No route found to %s", ip)
+	}
+	return routes[0].Gw, nil
+}
+
+//ResolvePrimaryRoute returns the gateway and the name of the outgoing interface of the route selected by the kernel for the address
+func (r *NetlinkGatewayResolver) ResolvePrimaryRoute(ip net.IP) (net.IP, string, error) {
+	routes, err := r.nlRouteGetFunc(ip)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(routes) == 0 {
+		return nil, "", fmt.Errorf("No route found to %s", ip)
+	}
+	link, err := r.nlLinkByIndexFunc(routes[0].LinkIndex)
+	if err != nil {
+		return nil, "", fmt.Errorf("Unable to find the interface of the route to %s: %w", ip, err)
+	}
+	return routes[0].Gw, link.Attrs().Name, nil
+}
@@ -0,0 +1,124 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestNewGatewayResolverUsesNetlink(t *testing.T) {
+	r := NewGatewayResolver()
+	if runtime.FuncForPC(reflect.ValueOf(r.nlRouteGetFunc).Pointer()).Name() != runtime.FuncForPC(reflect.ValueOf(netlink.RouteGet).Pointer()).Name() {
+		t.Error("nlRouteGetFunc function is not pointing to netlink package")
+	}
+	if runtime.FuncForPC(reflect.ValueOf(r.nlLinkByIndexFunc).Pointer()).Name() != runtime.FuncForPC(reflect.ValueOf(netlink.LinkByIndex).Pointer()).Name() {
+		t.Error("nlLinkByIndexFunc function is not pointing to netlink package")
+	}
+}
+
+func TestResolveGateway(t *testing.T) {
+	var asked net.IP
+	r := NetlinkGatewayResolver{nlRouteGetFunc: func(ip net.IP) ([]netlink.Route, error) {
+		asked = ip
+		return []netlink.Route{netlink.Route{Gw: net.IP{10, 0, 0, 1}}}, nil
+	}}
+
+	gw, err := r.ResolveGateway(net.IP{10, 1, 0, 1})
+
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !gw.Equal(net.IP{10, 0, 0, 1}) || !asked.Equal(net.IP{10, 1, 0, 1}) {
+		t.Errorf("Gateway not match: %s %s", gw, asked)
+	}
+}
+
+func TestResolveGatewayErrors(t *testing.T) {
+	r := NetlinkGatewayResolver{nlRouteGetFunc: func(ip net.IP) ([]netlink.Route, error) {
+		return nil, errors.New("bla")
+	}}
+	if _, err := r.ResolveGateway(net.IP{10, 1, 0, 1}); err == nil {
+		t.Error("Netlink error must be returned")
+	}
+
+	r.nlRouteGetFunc = func(ip net.IP) ([]netlink.Route, error) {
+		return nil, nil
+	}
+	if _, err := r.ResolveGateway(net.IP{10, 1, 0, 1}); err == nil {
+		t.Error("Missing route must be an error")
+	}
+}
+
+func TestResolvePrimaryRoute(t *testing.T) {
+	var askedIndex int
+	r := NetlinkGatewayResolver{
+		nlRouteGetFunc: func(ip net.IP) ([]netlink.Route, error) {
+			return []netlink.Route{netlink.Route{Gw: net.IP{10, 0, 0, 1}, LinkIndex: 2}}, nil
+		},
+		nlLinkByIndexFunc: func(index int) (netlink.Link, error) {
+			askedIndex = index
+			return &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0", Index: index}}, nil
+		},
+	}
+
+	gw, iface, err := r.ResolvePrimaryRoute(net.IP{10, 1, 0, 1})
+
+	if err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !gw.Equal(net.IP{10, 0, 0, 1}) || iface != "eth0" || askedIndex != 2 {
+		t.Errorf("Primary route not match: %s %s %d", gw, iface, askedIndex)
+	}
+}
+
+func TestResolvePrimaryRouteErrors(t *testing.T) {
+	r := NetlinkGatewayResolver{nlRouteGetFunc: func(ip net.IP) ([]netlink.Route, error) {
+		return nil, nil
+	}}
+	if _, _, err := r.ResolvePrimaryRoute(net.IP{10, 1, 0, 1}); err == nil {
+		t.Error("Missing route must be an error")
+	}
+
+	r.nlRouteGetFunc = func(ip net.IP) ([]netlink.Route, error) {
+		return []netlink.Route{netlink.Route{Gw: net.IP{10, 0, 0, 1}, LinkIndex: 2}}, nil
+	}
+	r.nlLinkByIndexFunc = func(int) (netlink.Link, error) {
+		return nil, errors.New("bla")
+	}
+	if _, _, err := r.ResolvePrimaryRoute(net.IP{10, 1, 0, 1}); err == nil {
+		t.Error("Missing interface must be an error")
+	}
+}
+
+func TestFakeGatewayResolver(t *testing.T) {
+	f := &FakeGatewayResolver{Gateway: net.IP{10, 0, 0, 1}}
+
+	gw, err := f.ResolveGateway(net.IP{10, 1, 0, 1})
+
+	if err != nil || !gw.Equal(net.IP{10, 0, 0, 1}) {
+		t.Errorf("Fake must return the configured gateway: %s %v", gw, err)
+	}
+	if queries := f.Queries(); len(queries) != 1 || !queries[0].Equal(net.IP{10, 1, 0, 1}) {
+		t.Errorf("Fake must record the queries: %v", queries)
+	}
+}
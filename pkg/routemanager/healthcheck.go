@@ -0,0 +1,185 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+//healthCheckState is the outcome of the last probe of a route and the stop channel of its periodic probes
+type healthCheckState struct {
+	failing bool
+	stop    chan struct{}
+}
+
+//healthCheckResult is the outcome of a periodic probe, sent back to the event loop
+type healthCheckResult struct {
+	name string
+	stop chan struct{}
+	err  error
+}
+
+//icmpSequence numbers the echo requests, so the replies of the concurrent probes are told apart
+var icmpSequence uint32
+
+/* startHealthCheck runs the first probe of the route right away, so the registration returns with the data plane verified,
+   then probes the route periodically in the background until it is forgotten. */
+func (r *routeManagerImpl) startHealthCheck(name string, route Route) {
+	if route.HealthCheck == nil {
+		return
+	}
+	check := *route.HealthCheck
+	if check.Interval <= 0 {
+		check.Interval = DefaultHealthCheckInterval
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = DefaultHealthCheckTimeout
+	}
+	state := &healthCheckState{
+		failing: r.healthProbeFunc(check, route.Gw) != nil,
+		stop:    make(chan struct{}),
+	}
+	r.healthChecks[name] = state
+	// The route was installed as healthy, so it is rebalanced if the first probe failed
+	if state.failing {
+		r.rebalance([]string{name})
+	}
+	go func() {
+		ticker := time.NewTicker(check.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-state.stop:
+				return
+			case <-ticker.C:
+			}
+			result := healthCheckResult{name: name, stop: state.stop, err: r.healthProbeFunc(check, route.Gw)}
+			select {
+			case <-state.stop:
+				return
+			case r.healthCheckResultChan <- result:
+			}
+		}
+	}()
+}
+
+//stopHealthCheck stops the periodic probes of the route
+func (r *routeManagerImpl) stopHealthCheck(name string) {
+	if state, found := r.healthChecks[name]; found {
+		close(state.stop)
+		delete(r.healthChecks, name)
+	}
+}
+
+func (r *routeManagerImpl) stopHealthChecks() {
+	for name := range r.healthChecks {
+		r.stopHealthCheck(name)
+	}
+}
+
+//healthChecked records the outcome of a periodic probe, the watchers are notified if the route failed or recovered
+func (r *routeManagerImpl) healthChecked(result healthCheckResult) {
+	state, found := r.healthChecks[result.name]
+	// The probe may belong to a route which was registered again meanwhile
+	if !found || state.stop != result.stop {
+		return
+	}
+	failing := result.err != nil
+	if failing == state.failing {
+		return
+	}
+	state.failing = failing
+	r.notifyGatewayWatchers([]string{result.name}, r.isDegraded(result.name))
+	r.rebalance([]string{result.name})
+}
+
+func (r *routeManagerImpl) isHealthCheckFailing(name string) bool {
+	state, found := r.healthChecks[name]
+	return found && state.failing
+}
+
+//probeHealth dials the TCP address of the health check if it is given, otherwise pings the gateway
+func probeHealth(check HealthCheck, gateway net.IP) error {
+	if len(check.TCP) != 0 {
+		conn, err := net.DialTimeout("tcp", check.TCP, check.Timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	if gateway == nil {
+		return nil
+	}
+	return ping(gateway, check.Timeout)
+}
+
+//ping sends an ICMP echo request to the IP and waits for the reply until the timeout
+func ping(ip net.IP, timeout time.Duration) error {
+	network, address, echoRequest, echoReply := "ip4:icmp", "0.0.0.0", byte(8), byte(0)
+	if ip.To4() == nil {
+		network, address, echoRequest, echoReply = "ip6:ipv6-icmp", "::", byte(128), byte(129)
+	}
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	id, seq := uint16(os.Getpid()), uint16(atomic.AddUint32(&icmpSequence, 1))
+	request := []byte{echoRequest, 0, 0, 0, byte(id >> 8), byte(id), byte(seq >> 8), byte(seq)}
+	// The kernel computes the checksum of ICMPv6
+	if echoRequest == 8 {
+		sum := icmpChecksum(request)
+		request[2], request[3] = byte(sum>>8), byte(sum)
+	}
+	if _, err := conn.WriteTo(request, &net.IPAddr{IP: ip}); err != nil {
+		return err
+	}
+	// The raw socket receives every ICMP message of the node, wait for our reply
+	reply := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(reply)
+		if err != nil {
+			return fmt.Errorf("No echo reply from %s: %w", ip, err)
+		}
+		if addr, ok := from.(*net.IPAddr); ok && addr.IP.Equal(ip) && n >= len(request) && reply[0] == echoReply && string(reply[4:8]) == string(request[4:8]) {
+			return nil
+		}
+	}
+}
+
+//icmpChecksum is the internet checksum of RFC 1071
+func icmpChecksum(message []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(message); i += 2 {
+		sum += uint32(message[i])<<8 | uint32(message[i+1])
+	}
+	if len(message)%2 == 1 {
+		sum += uint32(message[len(message)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,160 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type healthWatcher struct {
+	MockRouteWatcher
+	changes chan string
+}
+
+func (w healthWatcher) GatewayStateChanged(name string, degraded bool) {
+	state := "recovered"
+	if degraded {
+		state = "degraded"
+	}
+	w.changes <- name + " " + state
+}
+
+func routeWithHealthCheck(check HealthCheck) Route {
+	route := gTestRoute
+	route.HealthCheck = &check
+	return route
+}
+
+func TestRegisterRouteProbesHealthCheckFirst(t *testing.T) {
+	testable := newTestableRouteManager()
+	rm := testable.rm.(*routeManagerImpl)
+	var probed []HealthCheck
+	rm.healthProbeFunc = func(check HealthCheck, gateway net.IP) error {
+		probed = append(probed, check)
+		if !gateway.Equal(gTestRoute.Gw) {
+			t.Errorf("Gateway mismatch: %s", gateway)
+		}
+		return errors.New("unreachable")
+	}
+	testable.start()
+	defer testable.stop()
+
+	if err := testable.rm.RegisterRoute("checked", routeWithHealthCheck(HealthCheck{Interval: time.Hour})); err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if err := testable.rm.RegisterRoute("unchecked", gTestRoute); err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if !testable.rm.IsDegraded("checked") {
+		t.Error("Route with failing health check must be degraded")
+	}
+	if testable.rm.IsDegraded("unchecked") {
+		t.Error("Route without health check must not be degraded")
+	}
+	if len(probed) != 1 || probed[0].Interval != time.Hour || probed[0].Timeout != DefaultHealthCheckTimeout {
+		t.Errorf("First probe mismatch: %+v", probed)
+	}
+}
+
+func TestHealthCheckPeriodicProbeNotifiesWatchers(t *testing.T) {
+	testable := newTestableRouteManager()
+	rm := testable.rm.(*routeManagerImpl)
+	var failing int32
+	rm.healthProbeFunc = func(HealthCheck, net.IP) error {
+		if atomic.LoadInt32(&failing) == 1 {
+			return errors.New("unreachable")
+		}
+		return nil
+	}
+	testable.start()
+	watcher := healthWatcher{changes: make(chan string, 10)}
+	testable.rm.RegisterWatcher(watcher)
+
+	if err := testable.rm.RegisterRoute(gTestRouteName, routeWithHealthCheck(HealthCheck{Interval: 5 * time.Millisecond})); err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	if testable.rm.IsDegraded(gTestRouteName) {
+		t.Error("Route with passing health check must not be degraded")
+	}
+	atomic.StoreInt32(&failing, 1)
+	if change := <-watcher.changes; change != gTestRouteName+" degraded" {
+		t.Errorf("Change mismatch: %s", change)
+	}
+	if !testable.rm.IsDegraded(gTestRouteName) {
+		t.Error("Route with failing health check must be degraded")
+	}
+	atomic.StoreInt32(&failing, 0)
+	if change := <-watcher.changes; change != gTestRouteName+" recovered" {
+		t.Errorf("Change mismatch: %s", change)
+	}
+
+	if err := testable.rm.DeRegisterRoute(gTestRouteName); err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	testable.stop()
+	if len(rm.healthChecks) != 0 {
+		t.Errorf("Health check must be stopped: %+v", rm.healthChecks)
+	}
+}
+
+func TestHealthCheckedIgnoresStaleResults(t *testing.T) {
+	rm := newTestableRouteManager().rm.(*routeManagerImpl)
+	rm.managedRoutes[gTestRouteName] = gTestRoute
+	rm.healthChecks[gTestRouteName] = &healthCheckState{stop: make(chan struct{})}
+
+	rm.healthChecked(healthCheckResult{name: gTestRouteName, stop: make(chan struct{}), err: errors.New("unreachable")})
+
+	if rm.isDegraded(gTestRouteName) {
+		t.Error("Result of a previous registration must be ignored")
+	}
+}
+
+func TestProbeHealthTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err.Error())
+	}
+	address := listener.Addr().String()
+	check := HealthCheck{TCP: address, Timeout: time.Second}
+
+	if err := probeHealth(check, nil); err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+	listener.Close()
+	if err := probeHealth(check, nil); err == nil {
+		t.Error("Error must be returned if nothing listens")
+	}
+}
+
+func TestProbeHealthWithoutTarget(t *testing.T) {
+	if err := probeHealth(HealthCheck{Timeout: time.Second}, nil); err != nil {
+		t.Errorf("Error must be nil: %s", err.Error())
+	}
+}
+
+func TestICMPChecksum(t *testing.T) {
+	if sum := icmpChecksum([]byte{8, 0, 0, 0, 0, 1, 0, 1}); sum != 0xf7fd {
+		t.Errorf("Checksum mismatch: %x", sum)
+	}
+	if sum := icmpChecksum([]byte{8, 0, 0, 0, 0, 1, 0}); sum != 0xf7fe {
+		t.Errorf("Checksum of odd length mismatch: %x", sum)
+	}
+}
@@ -0,0 +1,133 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+type routeManagerImplIsLinkUpParams struct {
+	name string
+	up   chan<- bool
+}
+
+func (r *routeManagerImpl) IsLinkUp(name string) bool {
+	upChan := make(chan bool)
+	r.isLinkUpChan <- routeManagerImplIsLinkUpParams{name, upChan}
+	return <-upChan
+}
+
+func (r *routeManagerImpl) isLinkUp(name string) bool {
+	up := r.readLinkState(name)
+	r.links[name] = up
+	return up
+}
+
+//readLinkState asks the kernel whether the link is up. A missing link is down, ie. the tunnel of a stopped VPN client.
+func (r *routeManagerImpl) readLinkState(name string) bool {
+	var link netlink.Link
+	if err := r.withTimeout("link_get", func() (err error) {
+		link, err = r.nlLinkByNameFunc(name)
+		return
+	}); err != nil {
+		return false
+	}
+	return link.Attrs().Flags&net.FlagUp != 0 && link.Attrs().OperState != netlink.OperDown
+}
+
+//resolveVrf points the route to the table of its VRF device, the route without VRF is returned as is
+func (r *routeManagerImpl) resolveVrf(route Route) (Route, error) {
+	if len(route.Vrf) == 0 {
+		return route, nil
+	}
+	var link netlink.Link
+	if err := r.withTimeout("link_get", func() (err error) {
+		link, err = r.nlLinkByNameFunc(route.Vrf)
+		return
+	}); err != nil {
+		if errors.Is(err, ErrNetlinkTimeout) {
+			return route, err
+		}
+		return route, fmt.Errorf("Unable to find VRF %s: %w", route.Vrf, ErrVrfNotFound)
+	}
+	vrf, ok := link.(*netlink.Vrf)
+	if !ok {
+		return route, fmt.Errorf("Device %s is not a VRF: %w", route.Vrf, ErrVrfNotFound)
+	}
+	route.Table = int(vrf.Table)
+	return route, nil
+}
+
+/* resolveDevice points the route without gateway to its device. The route is on-link, or local to the host for loopback destinations,
+   the route without device is returned as is. */
+func (r *routeManagerImpl) resolveDevice(route Route) (Route, error) {
+	if len(route.Device) == 0 || route.Gw != nil {
+		return route, nil
+	}
+	var link netlink.Link
+	if err := r.withTimeout("link_get", func() (err error) {
+		link, err = r.nlLinkByNameFunc(route.Device)
+		return
+	}); err != nil {
+		if errors.Is(err, ErrNetlinkTimeout) {
+			return route, err
+		}
+		return route, &RouteError{Class: ErrInterfaceMissing, Err: fmt.Errorf("Unable to find device %s: %w", route.Device, err)}
+	}
+	route.linkIndex = link.Attrs().Index
+	route.scope = netlink.SCOPE_LINK
+	if route.Dst.IP.IsLoopback() {
+		route.scope = netlink.SCOPE_HOST
+	}
+	return route, nil
+}
+
+//resolveLinks resolves the VRF and the device of the route by their names
+func (r *routeManagerImpl) resolveLinks(route Route) (Route, error) {
+	route, err := r.resolveVrf(route)
+	if err != nil {
+		return route, err
+	}
+	return r.resolveDevice(route)
+}
+
+/* linkChanged notifies the LinkWatchers if a watched link went up or down. The state is read back by name,
+   as the update of a removed link may still carry the flags of the link. */
+func (r *routeManagerImpl) linkChanged(update netlink.LinkUpdate) {
+	if update.Link == nil {
+		return
+	}
+	name := update.Attrs().Name
+	wasUp, watched := r.links[name]
+	if !watched {
+		return
+	}
+	up := r.readLinkState(name)
+	if up == wasUp {
+		return
+	}
+	r.links[name] = up
+	for _, watcher := range r.watchers {
+		if linkWatcher, ok := watcher.(LinkWatcher); ok {
+			linkWatcher.LinkStateChanged(name, up)
+		}
+	}
+}
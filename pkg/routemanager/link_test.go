@@ -0,0 +1,218 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+type mockLinkWatcher struct {
+	MockRouteWatcher
+	linkStateChangedCalledWith chan string
+}
+
+func (m mockLinkWatcher) LinkStateChanged(name string, up bool) {
+	state := "down"
+	if up {
+		state = "up"
+	}
+	m.linkStateChangedCalledWith <- name + " " + state
+}
+
+type mockLinks struct {
+	mutex sync.Mutex
+	links map[string]*netlink.Device
+}
+
+func (m *mockLinks) set(name string, flags net.Flags, operState netlink.LinkOperState) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.links[name] = &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: name, Flags: flags, OperState: operState}}
+}
+
+func (m *mockLinks) remove(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.links, name)
+}
+
+func (m *mockLinks) linkByName(name string) (netlink.Link, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if link, found := m.links[name]; found {
+		return link, nil
+	}
+	return nil, errors.New("Link not found")
+}
+
+func withMockLinks(testable *testableRouteManager) *mockLinks {
+	links := &mockLinks{links: map[string]*netlink.Device{}}
+	testable.rm.(*routeManagerImpl).nlLinkByNameFunc = links.linkByName
+	return links
+}
+
+func TestIsLinkUp(t *testing.T) {
+	testable := newTestableRouteManager()
+	links := withMockLinks(&testable)
+	links.set("up", net.FlagUp, netlink.OperUp)
+	links.set("unknown", net.FlagUp, netlink.OperUnknown)
+	links.set("admin-down", 0, netlink.OperDown)
+	links.set("no-carrier", net.FlagUp, netlink.OperDown)
+	testable.start()
+
+	var testData = []struct {
+		name string
+		up   bool
+	}{
+		{"up", true},
+		{"unknown", true},
+		{"admin-down", false},
+		{"no-carrier", false},
+		{"missing", false},
+	}
+	for _, td := range testData {
+		if up := testable.rm.IsLinkUp(td.name); up != td.up {
+			t.Errorf("Link %s must be up: %t", td.name, td.up)
+		}
+	}
+
+	testable.stop()
+	if len(testable.rm.(*routeManagerImpl).links) != len(testData) {
+		t.Errorf("Asked links must be watched: %v", testable.rm.(*routeManagerImpl).links)
+	}
+}
+
+func TestLinkWatcherNotifiedOnChange(t *testing.T) {
+	testable := newTestableRouteManager()
+	links := withMockLinks(&testable)
+	testable.start()
+	watcher := mockLinkWatcher{linkStateChangedCalledWith: make(chan string)}
+	testable.rm.RegisterWatcher(watcher)
+	if testable.rm.IsLinkUp("tun0") {
+		t.Error("Missing link must be down")
+	}
+
+	links.set("tun0", net.FlagUp, netlink.OperUnknown)
+	gMockLinkUpdateChan <- netlink.LinkUpdate{Link: &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "tun0"}}}
+	up := <-watcher.linkStateChangedCalledWith
+	// Unchanged and not watched links are not reported, the next notification must be the removal
+	gMockLinkUpdateChan <- netlink.LinkUpdate{Link: &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "tun0"}}}
+	gMockLinkUpdateChan <- netlink.LinkUpdate{Link: &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0"}}}
+	gMockLinkUpdateChan <- netlink.LinkUpdate{}
+	links.remove("tun0")
+	gMockLinkUpdateChan <- netlink.LinkUpdate{Link: &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "tun0", Flags: net.FlagUp}}}
+	down := <-watcher.linkStateChangedCalledWith
+
+	testable.stop()
+	if up != "tun0 up" || down != "tun0 down" {
+		t.Errorf("Link changes not match: %s, %s", up, down)
+	}
+}
+
+func TestWatchCloseLinkUpdateChan(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.start()
+	testable.rm.RegisterWatcher(MockRouteWatcher{})
+
+	close(gMockLinkUpdateChan)
+
+	testable.wg.Wait()
+}
+
+func TestRegisterRouteResolvesVrf(t *testing.T) {
+	testable := newTestableRouteManager()
+	links := withMockLinks(&testable)
+	links.set("eth1", net.FlagUp, netlink.OperUp)
+	testable.rm.(*routeManagerImpl).nlLinkByNameFunc = func(name string) (netlink.Link, error) {
+		if name == "tenant" {
+			return &netlink.Vrf{LinkAttrs: netlink.LinkAttrs{Name: name}, Table: 1001}, nil
+		}
+		return links.linkByName(name)
+	}
+	var added *netlink.Route
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		added = route
+		return nil
+	}
+	testable.start()
+	route := gTestRoute
+	route.Vrf = "tenant"
+
+	err := testable.rm.RegisterRoute(gTestRouteName, route)
+	missing := route
+	missing.Vrf = "missing"
+	missingErr := testable.rm.RegisterRoute("missing", missing)
+	device := route
+	device.Vrf = "eth1"
+	deviceErr := testable.rm.RegisterRoute("device", device)
+
+	testable.stop()
+	if err != nil || added == nil || added.Table != 1001 {
+		t.Errorf("Route must be created in the table of the VRF: %v %v", err, added)
+	}
+	if managed := testable.rm.(*routeManagerImpl).managedRoutes[gTestRouteName]; managed.Table != 1001 || managed.Vrf != "tenant" {
+		t.Errorf("Route must be managed in the table of the VRF: %v", managed)
+	}
+	if !errors.Is(missingErr, ErrVrfNotFound) || !errors.Is(deviceErr, ErrVrfNotFound) {
+		t.Errorf("Missing VRF must be reported: %v %v", missingErr, deviceErr)
+	}
+	if testable.rm.IsRegistered("missing") || testable.rm.IsRegistered("device") {
+		t.Error("Route without VRF must be not registered")
+	}
+}
+
+func TestRegisterRouteResolvesDevice(t *testing.T) {
+	testable := newTestableRouteManager()
+	withMockLinks(&testable)
+	testable.rm.(*routeManagerImpl).nlLinkByNameFunc = func(name string) (netlink.Link, error) {
+		switch name {
+		case "eth1":
+			return &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: name, Index: 3}}, nil
+		case "lo":
+			return &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: name, Index: 1}}, nil
+		}
+		return nil, errors.New("Link not found")
+	}
+	added := map[string]*netlink.Route{}
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		added[route.Dst.String()] = route
+		return nil
+	}
+	testable.start()
+	_, linkLocal, _ := net.ParseCIDR("169.254.0.0/16")
+	_, loopback, _ := net.ParseCIDR("127.1.0.0/16")
+
+	linkLocalErr := testable.rm.RegisterRoute("link-local", Route{Dst: *linkLocal, Device: "eth1", Table: 254})
+	loopbackErr := testable.rm.RegisterRoute("loopback", Route{Dst: *loopback, Device: "lo", Table: 254})
+	missingErr := testable.rm.RegisterRoute("missing", Route{Dst: *linkLocal, Device: "missing", Table: 254})
+
+	testable.stop()
+	if r := added["169.254.0.0/16"]; linkLocalErr != nil || r == nil || r.LinkIndex != 3 || r.Scope != netlink.SCOPE_LINK || r.Gw != nil {
+		t.Errorf("Link-local route must be created on the device with link scope: %v %v", linkLocalErr, r)
+	}
+	if r := added["127.1.0.0/16"]; loopbackErr != nil || r == nil || r.LinkIndex != 1 || r.Scope != netlink.SCOPE_HOST {
+		t.Errorf("Loopback route must be created on the device with host scope: %v %v", loopbackErr, r)
+	}
+	if !errors.Is(missingErr, ErrInterfaceMissing) || testable.rm.IsRegistered("missing") {
+		t.Errorf("Missing device must be reported as missing interface: %v", missingErr)
+	}
+}
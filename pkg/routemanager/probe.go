@@ -0,0 +1,121 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"sort"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+//gatewayState is the reported state of a gateway and the time since the probes contradict it
+type gatewayState struct {
+	degraded bool
+	// Zero if the last probe agreed with the reported state
+	changingSince time.Time
+}
+
+func (r *routeManagerImpl) IsDegraded(name string) bool {
+	degradedChan := make(chan bool)
+	r.isDegradedChan <- routeManagerImplIsDegradedParams{name, degradedChan}
+	return <-degradedChan
+}
+
+func (r *routeManagerImpl) isDegraded(name string) bool {
+	route, found := r.managedRoutes[name]
+	if !found {
+		return false
+	}
+	if r.isHealthCheckFailing(name) {
+		return true
+	}
+	if route.Gw == nil {
+		return false
+	}
+	state, found := r.gateways[route.Gw.String()]
+	return found && state.degraded
+}
+
+/* probeGateways checks the gateways of the managed routes in the neighbor table. A gateway is unreachable if the kernel
+   failed or still tries to resolve it, a missing entry means no traffic went through it yet, so it is not suspicious.
+   The reported state flips only if the probes say the opposite continuously for DegradedAfter or RecoveredAfter,
+   so brief neighbor-table churn does not flap the routes. */
+func (r *routeManagerImpl) probeGateways() {
+	neighs, err := r.neighList(0, netlink.FAMILY_ALL)
+	if err != nil {
+		// Keep the reported states, the next probe tries again
+		return
+	}
+	unreachable := map[string]bool{}
+	for _, neigh := range neighs {
+		if neigh.State&(netlink.NUD_FAILED|netlink.NUD_INCOMPLETE) != 0 {
+			unreachable[neigh.IP.String()] = true
+		}
+	}
+
+	inUse := map[string][]string{}
+	for name, route := range r.managedRoutes {
+		if route.Gw != nil {
+			inUse[route.Gw.String()] = append(inUse[route.Gw.String()], name)
+		}
+	}
+	for gw := range r.gateways {
+		if _, found := inUse[gw]; !found {
+			delete(r.gateways, gw)
+		}
+	}
+
+	now := r.now()
+	for gw, names := range inUse {
+		state, found := r.gateways[gw]
+		if !found {
+			state = &gatewayState{}
+			r.gateways[gw] = state
+		}
+		observed := unreachable[gw]
+		if observed == state.degraded {
+			state.changingSince = time.Time{}
+			continue
+		}
+		if state.changingSince.IsZero() {
+			state.changingSince = now
+		}
+		window := r.options.RecoveredAfter
+		if observed {
+			window = r.options.DegradedAfter
+		}
+		if now.Sub(state.changingSince) < window {
+			continue
+		}
+		state.degraded = observed
+		state.changingSince = time.Time{}
+		r.notifyGatewayWatchers(names, observed)
+		r.rebalance(names)
+	}
+}
+
+func (r *routeManagerImpl) notifyGatewayWatchers(names []string, degraded bool) {
+	sort.Strings(names)
+	for _, watcher := range r.watchers {
+		if gatewayWatcher, ok := watcher.(GatewayWatcher); ok {
+			for _, name := range names {
+				gatewayWatcher.GatewayStateChanged(name, degraded)
+			}
+		}
+	}
+}
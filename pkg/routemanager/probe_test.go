@@ -0,0 +1,201 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package routemanager
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+type mockGatewayWatcher struct {
+	MockRouteWatcher
+	changes *[]string
+}
+
+func (m mockGatewayWatcher) GatewayStateChanged(name string, degraded bool) {
+	state := "recovered"
+	if degraded {
+		state = "degraded"
+	}
+	*m.changes = append(*m.changes, name+" "+state)
+}
+
+type probeTestContext struct {
+	rm      *routeManagerImpl
+	clock   time.Time
+	state   int
+	changes []string
+}
+
+func newProbeTestContext(degradedAfter, recoveredAfter time.Duration) *probeTestContext {
+	ctx := &probeTestContext{clock: time.Now(), state: netlink.NUD_REACHABLE}
+	ctx.rm = newTestableRouteManager().rm.(*routeManagerImpl)
+	ctx.rm.options = Options{ProbeInterval: time.Second, DegradedAfter: degradedAfter, RecoveredAfter: recoveredAfter}
+	ctx.rm.now = func() time.Time {
+		return ctx.clock
+	}
+	ctx.rm.nlNeighListFunc = func(linkIndex, family int) ([]netlink.Neigh, error) {
+		return []netlink.Neigh{
+			netlink.Neigh{IP: net.ParseIP("192.168.1.254"), State: ctx.state},
+			netlink.Neigh{IP: net.ParseIP("192.168.1.253"), State: netlink.NUD_FAILED},
+		}, nil
+	}
+	ctx.rm.managedRoutes[gTestRouteName] = gTestRoute
+	ctx.rm.watchers = []RouteWatcher{MockRouteWatcher{}, mockGatewayWatcher{changes: &ctx.changes}}
+	return ctx
+}
+
+//probeAt runs a probe with the given neighbor state after the given time elapsed
+func (ctx *probeTestContext) probeAt(elapsed time.Duration, state int) {
+	ctx.clock = ctx.clock.Add(elapsed)
+	ctx.state = state
+	ctx.rm.probeGateways()
+}
+
+func TestProbeGatewaysHysteresis(t *testing.T) {
+	ctx := newProbeTestContext(30*time.Second, 20*time.Second)
+
+	var testData = []struct {
+		elapsed  time.Duration
+		state    int
+		degraded bool
+	}{
+		{0, netlink.NUD_REACHABLE, false},
+		{10 * time.Second, netlink.NUD_FAILED, false},
+		{10 * time.Second, netlink.NUD_STALE, false},
+		{10 * time.Second, netlink.NUD_INCOMPLETE, false},
+		{20 * time.Second, netlink.NUD_FAILED, false},
+		{10 * time.Second, netlink.NUD_FAILED, true},
+		{10 * time.Second, netlink.NUD_FAILED, true},
+		{10 * time.Second, netlink.NUD_REACHABLE, true},
+		{10 * time.Second, netlink.NUD_FAILED, true},
+		{10 * time.Second, netlink.NUD_DELAY, true},
+		{10 * time.Second, netlink.NUD_REACHABLE, true},
+		{10 * time.Second, netlink.NUD_REACHABLE, false},
+	}
+	for i, td := range testData {
+		ctx.probeAt(td.elapsed, td.state)
+
+		if degraded := ctx.rm.isDegraded(gTestRouteName); degraded != td.degraded {
+			t.Errorf("Degraded must be %t at %d", td.degraded, i)
+		}
+	}
+	if !reflect.DeepEqual(ctx.changes, []string{gTestRouteName + " degraded", gTestRouteName + " recovered"}) {
+		t.Errorf("Watcher must be notified once per transition: %v", ctx.changes)
+	}
+}
+
+func TestProbeGatewaysWithoutWindowFlipsImmediately(t *testing.T) {
+	ctx := newProbeTestContext(0, 0)
+
+	ctx.probeAt(0, netlink.NUD_FAILED)
+	degraded := ctx.rm.isDegraded(gTestRouteName)
+	ctx.probeAt(time.Second, netlink.NUD_REACHABLE)
+
+	if !degraded || ctx.rm.isDegraded(gTestRouteName) {
+		t.Error("Gateway state must follow every probe")
+	}
+	if len(ctx.changes) != 2 {
+		t.Errorf("Watcher must be notified on every transition: %v", ctx.changes)
+	}
+}
+
+func TestProbeGatewaysMissingNeighborIsReachable(t *testing.T) {
+	ctx := newProbeTestContext(0, 0)
+	ctx.rm.nlNeighListFunc = func(linkIndex, family int) ([]netlink.Neigh, error) {
+		return nil, nil
+	}
+
+	ctx.probeAt(0, netlink.NUD_FAILED)
+
+	if ctx.rm.isDegraded(gTestRouteName) {
+		t.Error("Gateway without neighbor entry must not be degraded")
+	}
+}
+
+func TestProbeGatewaysListFailsKeepsState(t *testing.T) {
+	ctx := newProbeTestContext(0, 0)
+	ctx.probeAt(0, netlink.NUD_FAILED)
+	ctx.rm.nlNeighListFunc = func(linkIndex, family int) ([]netlink.Neigh, error) {
+		return nil, errors.New("bla")
+	}
+
+	ctx.probeAt(time.Second, netlink.NUD_REACHABLE)
+
+	if !ctx.rm.isDegraded(gTestRouteName) {
+		t.Error("Gateway state must be kept if the neighbor table can't be read")
+	}
+}
+
+func TestProbeGatewaysForgetsUnusedGateways(t *testing.T) {
+	ctx := newProbeTestContext(0, 0)
+	ctx.probeAt(0, netlink.NUD_FAILED)
+	delete(ctx.rm.managedRoutes, gTestRouteName)
+
+	ctx.probeAt(time.Second, netlink.NUD_FAILED)
+
+	if len(ctx.rm.gateways) != 0 {
+		t.Errorf("Gateways without managed routes must be forgotten: %v", ctx.rm.gateways)
+	}
+}
+
+func TestIsDegraded(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).gateways[gTestRoute.Gw.String()] = &gatewayState{degraded: true}
+	testable.start()
+	if err := testable.rm.RegisterRoute(gTestRouteName, gTestRoute); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+
+	degraded := testable.rm.IsDegraded(gTestRouteName)
+	unknown := testable.rm.IsDegraded("unknown")
+
+	testable.stop()
+	if !degraded {
+		t.Error("Route with degraded gateway must be degraded")
+	}
+	if unknown {
+		t.Error("Unknown route must not be degraded")
+	}
+}
+
+func TestRunProbesPeriodically(t *testing.T) {
+	testable := newTestableRouteManager()
+	probed := make(chan struct{}, 1)
+	testable.rm.(*routeManagerImpl).options.ProbeInterval = time.Millisecond
+	testable.rm.(*routeManagerImpl).nlNeighListFunc = func(linkIndex, family int) ([]netlink.Neigh, error) {
+		select {
+		case probed <- struct{}{}:
+		default:
+		}
+		return nil, nil
+	}
+	testable.start()
+
+	select {
+	case <-probed:
+	case <-time.After(5 * time.Second):
+		t.Error("Gateways must be probed by the event loop")
+	}
+
+	testable.stop()
+}
@@ -18,26 +18,56 @@ package routemanager
 
 import (
 	"errors"
+	"fmt"
+	"net"
 	"reflect"
+	"sort"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/IBM/staticroute-operator/pkg/metrics"
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 )
 
-var (
-	//NotFoundError route not found error
-	ErrNotFound = errors.New("Route could not found")
-)
-
 type routeManagerImpl struct {
 	managedRoutes         map[string]Route
+	managedMutex          sync.RWMutex
+	protocol              int
+	options               Options
+	gateways              map[string]*gatewayState
+	links                 map[string]bool
+	driftCorrections      map[string]time.Time
+	healthChecks          map[string]*healthCheckState
+	healthProbeFunc       func(check HealthCheck, gateway net.IP) error
+	now                   func() time.Time
 	watchers              []RouteWatcher
 	nlRouteSubscribeFunc  func(chan<- netlink.RouteUpdate, <-chan struct{}) error
+	nlLinkSubscribeFunc   func(chan<- netlink.LinkUpdate, <-chan struct{}) error
+	nlLinkByNameFunc      func(name string) (netlink.Link, error)
 	nlRouteAddFunc        func(route *netlink.Route) error
 	nlRouteDelFunc        func(route *netlink.Route) error
+	nlRouteReplaceFunc    func(route *netlink.Route) error
+	nlRouteListFunc       func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error)
+	nlRouteGetFunc        func(destination net.IP) ([]netlink.Route, error)
+	apiServerRoutes       map[string]*netlink.Route
+	nlRuleAddFunc         func(rule *netlink.Rule) error
+	nlRuleDelFunc         func(rule *netlink.Rule) error
+	nlNeighListFunc       func(linkIndex, family int) ([]netlink.Neigh, error)
 	registerRouteChan     chan routeManagerImplRegisterRouteParams
+	registerRoutesChan    chan routeManagerImplRegisterRoutesParams
+	applyRoutesChan       chan routeManagerImplApplyRoutesParams
 	deRegisterRouteChan   chan routeManagerImplDeRegisterRouteParams
+	verifyRouteChan       chan routeManagerImplVerifyRouteParams
+	flushTableChan        chan routeManagerImplFlushTableParams
+	ensureAbsentChan      chan routeManagerImplEnsureAbsentParams
+	listRoutesChan        chan chan<- routeManagerImplListRoutesResult
+	exportRoutesChan      chan chan<- routeManagerImplExportRoutesResult
+	isDegradedChan        chan routeManagerImplIsDegradedParams
+	nexthopsChan          chan routeManagerImplNexthopsParams
+	isLinkUpChan          chan routeManagerImplIsLinkUpParams
+	healthCheckResultChan chan healthCheckResult
 	registerWatcherChan   chan RouteWatcher
 	deRegisterWatcherChan chan RouteWatcher
 }
@@ -48,20 +78,105 @@ type routeManagerImplRegisterRouteParams struct {
 	err   chan<- error
 }
 
+type routeManagerImplRegisterRoutesParams struct {
+	routes map[string]Route
+	err    chan<- error
+}
+
+type routeManagerImplApplyRoutesParams struct {
+	routes map[string]Route
+	errs   chan<- map[string]error
+}
+
 type routeManagerImplDeRegisterRouteParams struct {
 	name string
 	err  chan<- error
 }
 
+type routeManagerImplVerifyRouteParams struct {
+	name   string
+	result chan<- routeManagerImplVerifyRouteResult
+}
+
+type routeManagerImplVerifyRouteResult struct {
+	repair Repair
+	err    error
+}
+
+type routeManagerImplFlushTableParams struct {
+	table  int
+	result chan<- routeManagerImplFlushTableResult
+}
+
+type routeManagerImplFlushTableResult struct {
+	flushed int
+	err     error
+}
+
+type routeManagerImplEnsureAbsentParams struct {
+	route  Route
+	result chan<- routeManagerImplEnsureAbsentResult
+}
+
+type routeManagerImplEnsureAbsentResult struct {
+	removed int
+	err     error
+}
+
+type routeManagerImplListRoutesResult struct {
+	routes []Route
+	err    error
+}
+
+type routeManagerImplIsDegradedParams struct {
+	name     string
+	degraded chan<- bool
+}
+
+type routeManagerImplNexthopsParams struct {
+	name     string
+	nexthops chan<- []Nexthop
+}
+
 //New creates a RouteManager for production use. It populates the routeManagerImpl structure with the final pointers to netlink package's functions.
-func New() RouteManager {
+func New(options Options) RouteManager {
+	if options.Protocol == 0 {
+		options.Protocol = DefaultProtocol
+	}
 	return &routeManagerImpl{
 		managedRoutes:         make(map[string]Route),
+		protocol:              options.Protocol,
+		options:               options,
+		gateways:              make(map[string]*gatewayState),
+		links:                 make(map[string]bool),
+		driftCorrections:      make(map[string]time.Time),
+		healthChecks:          make(map[string]*healthCheckState),
+		healthProbeFunc:       probeHealth,
+		now:                   time.Now,
 		nlRouteSubscribeFunc:  netlink.RouteSubscribe,
+		nlLinkSubscribeFunc:   netlink.LinkSubscribe,
+		nlLinkByNameFunc:      netlink.LinkByName,
 		nlRouteAddFunc:        netlink.RouteAdd,
 		nlRouteDelFunc:        netlink.RouteDel,
+		nlRouteReplaceFunc:    netlink.RouteReplace,
+		nlRouteListFunc:       netlink.RouteListFiltered,
+		nlRouteGetFunc:        netlink.RouteGet,
+		nlRuleAddFunc:         netlink.RuleAdd,
+		nlRuleDelFunc:         netlink.RuleDel,
+		nlNeighListFunc:       netlink.NeighList,
 		registerRouteChan:     make(chan routeManagerImplRegisterRouteParams),
+		registerRoutesChan:    make(chan routeManagerImplRegisterRoutesParams),
+		applyRoutesChan:       make(chan routeManagerImplApplyRoutesParams),
 		deRegisterRouteChan:   make(chan routeManagerImplDeRegisterRouteParams),
+		verifyRouteChan:       make(chan routeManagerImplVerifyRouteParams),
+		flushTableChan:        make(chan routeManagerImplFlushTableParams),
+		ensureAbsentChan:      make(chan routeManagerImplEnsureAbsentParams),
+		listRoutesChan:        make(chan chan<- routeManagerImplListRoutesResult),
+		exportRoutesChan:      make(chan chan<- routeManagerImplExportRoutesResult),
+		isDegradedChan:        make(chan routeManagerImplIsDegradedParams),
+		nexthopsChan:          make(chan routeManagerImplNexthopsParams),
+		isLinkUpChan:          make(chan routeManagerImplIsLinkUpParams),
+		healthCheckResultChan: make(chan healthCheckResult),
 		registerWatcherChan:   make(chan RouteWatcher),
 		deRegisterWatcherChan: make(chan RouteWatcher),
 	}
@@ -73,28 +188,135 @@ func (r *routeManagerImpl) RegisterRoute(name string, route Route) error {
 	return <-errChan
 }
 
+//IsRegistered is called by the controllers directly, not through the event loop, so the managed routes are guarded by a lock
 func (r *routeManagerImpl) IsRegistered(name string) bool {
+	r.managedMutex.RLock()
+	defer r.managedMutex.RUnlock()
 	_, exists := r.managedRoutes[name]
 	return exists
 }
 
+//manage adds the route to the managed ones. Only the event loop changes the managed routes, so it reads them without the lock.
+func (r *routeManagerImpl) manage(name string, route Route) {
+	r.managedMutex.Lock()
+	defer r.managedMutex.Unlock()
+	r.managedRoutes[name] = route
+}
+
+//forget removes the route from the managed ones and stops its health check
+func (r *routeManagerImpl) forget(name string) {
+	r.stopHealthCheck(name)
+	r.managedMutex.Lock()
+	defer r.managedMutex.Unlock()
+	delete(r.managedRoutes, name)
+}
+
 func (r *routeManagerImpl) registerRoute(params routeManagerImplRegisterRouteParams) {
 	if r.IsRegistered(params.name) {
 		params.err <- errors.New("Route with the same Name already registered")
 		return
 	}
-	nlRoute := params.route.toNetLinkRoute()
+	route, err := r.resolveLinks(params.route)
+	if err != nil {
+		params.err <- err
+		return
+	}
 	/* If syscall returns EEXIST (file exists), it means the route already existing.
 	   There is no evidence that we created is before a crash, or someone else.
-	   We assume we created it and so start managing it again. */
-	if err := r.nlRouteAddFunc(&nlRoute); err != nil && syscall.EEXIST.Error() != err.Error() {
+	   We assume we created it and so start managing it again, the route of a previous version is adopted with our protocol. */
+	if err := r.addRouteWithRule(params.name, route, false); err != nil && syscall.EEXIST.Error() != err.Error() {
 		params.err <- err
 		return
 	}
-	r.managedRoutes[params.name] = params.route
+	r.manage(params.name, route)
+	r.startHealthCheck(params.name, route)
 	params.err <- nil
 }
 
+func (r *routeManagerImpl) RegisterRoutes(routes map[string]Route) error {
+	errChan := make(chan error)
+	r.registerRoutesChan <- routeManagerImplRegisterRoutesParams{routes, errChan}
+	return <-errChan
+}
+
+func (r *routeManagerImpl) registerRoutes(params routeManagerImplRegisterRoutesParams) {
+	names := make([]string, 0, len(params.routes))
+	for name := range params.routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var installed, adopted []string
+	for _, name := range names {
+		if r.IsRegistered(name) {
+			continue
+		}
+		route, err := r.resolveLinks(params.routes[name])
+		if err == nil {
+			err = r.addRouteWithRule(name, route, false)
+		}
+		if err == nil {
+			installed = append(installed, name)
+		} else if syscall.EEXIST.Error() == err.Error() {
+			adopted = append(adopted, name)
+		} else {
+			/* Roll back the transaction. Only the routes created here are removed from the kernel,
+			   adopted ones existed before, so they are just forgotten. */
+			for i := len(installed) - 1; i >= 0; i-- {
+				_ = r.removeRoute(installed[i], r.managedRoutes[installed[i]])
+				_ = r.delRule(installed[i], r.managedRoutes[installed[i]])
+				r.forget(installed[i])
+			}
+			for _, a := range adopted {
+				r.forget(a)
+			}
+			params.err <- fmt.Errorf("Unable to create route %s: %w", name, err)
+			return
+		}
+		r.manage(name, route)
+		r.startHealthCheck(name, route)
+	}
+	params.err <- nil
+}
+
+func (r *routeManagerImpl) ApplyRoutes(routes map[string]Route) map[string]error {
+	errsChan := make(chan map[string]error)
+	r.applyRoutesChan <- routeManagerImplApplyRoutesParams{routes, errsChan}
+	return <-errsChan
+}
+
+/* applyRoutes creates the routes in a single round of the event loop, so the callers don't have to wait for
+   each other between the routes. The routes are independent, a failing one does not affect the others. */
+func (r *routeManagerImpl) applyRoutes(params routeManagerImplApplyRoutesParams) {
+	defer metrics.ObserveNetlink("batch_add", time.Now())
+	names := make([]string, 0, len(params.routes))
+	for name := range params.routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := map[string]error{}
+	for _, name := range names {
+		if r.IsRegistered(name) {
+			continue
+		}
+		route, err := r.resolveLinks(params.routes[name])
+		if err != nil {
+			errs[name] = fmt.Errorf("Unable to create route %s: %w", name, err)
+			continue
+		}
+		/* Existing routes are adopted, like in registerRoute. The routes were reported applied by the node,
+		   so an untagged route with the same gateway was created by a released version of the operator. */
+		if err := r.addRouteWithRule(name, route, true); err != nil && syscall.EEXIST.Error() != err.Error() {
+			errs[name] = fmt.Errorf("Unable to create route %s: %w", name, err)
+			continue
+		}
+		r.manage(name, route)
+		r.startHealthCheck(name, route)
+	}
+	params.errs <- errs
+}
+
 func (r *routeManagerImpl) DeRegisterRoute(name string) error {
 	errChan := make(chan error)
 	r.deRegisterRouteChan <- routeManagerImplDeRegisterRouteParams{name, errChan}
@@ -107,17 +329,392 @@ func (r *routeManagerImpl) deRegisterRoute(params routeManagerImplDeRegisterRout
 		params.err <- ErrNotFound
 		return
 	}
-	nlRoute := item.toNetLinkRoute()
-	/* We remove the route from the managed ones, regardless of the ESRCH (no such process) error from the lower layer.
+	/* Another name may manage the same route, then it has to stay in the kernel. We remove the route from the managed ones, regardless of the ESRCH (no such process) error from the lower layer.
 	   Error supposed to happen only when the route is already missing, which was reported to the watchers, so they know. */
-	if err := r.nlRouteDelFunc(&nlRoute); err != nil && syscall.ESRCH.Error() != err.Error() {
+	if err := r.removeRoute(params.name, item); err != nil && syscall.ESRCH.Error() != err.Error() {
+		params.err <- err
+		return
+	}
+	if err := r.delRule(params.name, item); err != nil {
 		params.err <- err
 		return
 	}
-	delete(r.managedRoutes, params.name)
+	r.forget(params.name)
+	delete(r.driftCorrections, params.name)
 	params.err <- nil
 }
 
+func (r *routeManagerImpl) VerifyRoute(name string) (Repair, error) {
+	resultChan := make(chan routeManagerImplVerifyRouteResult)
+	r.verifyRouteChan <- routeManagerImplVerifyRouteParams{name, resultChan}
+	result := <-resultChan
+	return result.repair, result.err
+}
+
+func (r *routeManagerImpl) verifyRoute(params routeManagerImplVerifyRouteParams) {
+	item, found := r.managedRoutes[params.name]
+	if !found {
+		params.result <- routeManagerImplVerifyRouteResult{err: ErrNotFound}
+		return
+	}
+	expected := withMainTable(item)
+	merged := r.mergedRoute(params.name, expected)
+	filter := expected.toNetLinkRoute()
+	kernelRoutes, err := r.routeList(netlink.FAMILY_ALL, &filter, netlink.RT_FILTER_DST|netlink.RT_FILTER_TABLE)
+	if err != nil {
+		params.result <- routeManagerImplVerifyRouteResult{err: err}
+		return
+	}
+	drifted := false
+	for _, kernelRoute := range kernelRoutes {
+		if kernelRoute.Dst == nil {
+			continue
+		}
+		// The routes of other metrics coexist with ours, ie. the members of a failover group
+		if routeMetric(kernelRoute) != expected.Metric {
+			continue
+		}
+		// A merged route is expected with the nexthops of its peers
+		if len(merged.MultiPath) != 0 || len(kernelRoute.MultiPath) != 0 {
+			if kernelRoute.Tos != expected.Tos || r.isForeignMainRoute(kernelRoute) {
+				continue
+			}
+			if sameNexthops(kernelRoute, merged) {
+				params.result <- routeManagerImplVerifyRouteResult{}
+				return
+			}
+			drifted = true
+			continue
+		}
+		actual := fromNetLinkRoute(kernelRoute)
+		if expected.equal(actual) {
+			params.result <- routeManagerImplVerifyRouteResult{}
+			return
+		}
+		// A foreign route of the main table belongs to the kernel or the node (ie. DHCP), it must never be replaced
+		if r.isForeignMainRoute(kernelRoute) {
+			continue
+		}
+		if actual.Dst.String() == expected.Dst.String() && actual.Tos == expected.Tos && !actual.Gw.Equal(expected.Gw) {
+			drifted = true
+		}
+	}
+	if drifted {
+		r.restoreGateway(params, item)
+		return
+	}
+	// The route was removed behind our back, so create it again
+	if err := r.addRouteWithRule(params.name, item, false); err != nil && syscall.EEXIST.Error() != err.Error() {
+		params.result <- routeManagerImplVerifyRouteResult{err: err}
+		return
+	}
+	params.result <- routeManagerImplVerifyRouteResult{repair: RepairRecreated}
+}
+
+/* restoreGateway replaces the route whose gateway was changed behind our back (ie. by ip route change). The corrections
+   of a route are rate limited by DriftCorrectionInterval, so the RouteManager doesn't fight with someone changing it continuously. */
+func (r *routeManagerImpl) restoreGateway(params routeManagerImplVerifyRouteParams, item Route) {
+	if last, found := r.driftCorrections[params.name]; found && r.now().Sub(last) < r.options.DriftCorrectionInterval {
+		params.result <- routeManagerImplVerifyRouteResult{}
+		return
+	}
+	nlRoute := r.mergedRoute(params.name, item)
+	if err := r.routeReplace(&nlRoute); err != nil {
+		params.result <- routeManagerImplVerifyRouteResult{err: fmt.Errorf("Unable to restore the gateway: %w", err)}
+		return
+	}
+	r.driftCorrections[params.name] = r.now()
+	params.result <- routeManagerImplVerifyRouteResult{repair: RepairGatewayRestored}
+}
+
+func (r *routeManagerImpl) FlushTable(table int) (int, error) {
+	resultChan := make(chan routeManagerImplFlushTableResult)
+	r.flushTableChan <- routeManagerImplFlushTableParams{table, resultChan}
+	result := <-resultChan
+	return result.flushed, result.err
+}
+
+func (r *routeManagerImpl) flushTable(params routeManagerImplFlushTableParams) {
+	switch params.table {
+	case unix.RT_TABLE_UNSPEC, unix.RT_TABLE_MAIN, unix.RT_TABLE_LOCAL, unix.RT_TABLE_DEFAULT:
+		params.result <- routeManagerImplFlushTableResult{err: ErrTableProtected}
+		return
+	}
+	filter := netlink.Route{Table: params.table, Protocol: r.protocol}
+	kernelRoutes, err := r.routeList(netlink.FAMILY_ALL, &filter, netlink.RT_FILTER_TABLE|netlink.RT_FILTER_PROTOCOL)
+	if err != nil {
+		params.result <- routeManagerImplFlushTableResult{err: err}
+		return
+	}
+	flushed := 0
+	for i := range kernelRoutes {
+		// Double check, a foreign route must never be removed
+		if kernelRoutes[i].Protocol != r.protocol || kernelRoutes[i].Table != params.table {
+			continue
+		}
+		if err := r.routeDel(&kernelRoutes[i]); err != nil && syscall.ESRCH.Error() != err.Error() {
+			params.result <- routeManagerImplFlushTableResult{flushed: flushed, err: fmt.Errorf("Unable to flush route %v: %w", kernelRoutes[i].Dst, err)}
+			return
+		}
+		flushed++
+	}
+
+	names := make([]string, 0, len(r.managedRoutes))
+	for name, route := range r.managedRoutes {
+		if route.Table == params.table {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		nlRoute := r.mergedRoute(name, r.managedRoutes[name])
+		if err := r.installRoute(&nlRoute); err != nil && syscall.EEXIST.Error() != err.Error() {
+			params.result <- routeManagerImplFlushTableResult{flushed: flushed, err: fmt.Errorf("Unable to reinstall route %s: %w", name, err)}
+			return
+		}
+	}
+	params.result <- routeManagerImplFlushTableResult{flushed: flushed}
+}
+
+func (r *routeManagerImpl) EnsureAbsent(route Route) (int, error) {
+	resultChan := make(chan routeManagerImplEnsureAbsentResult)
+	r.ensureAbsentChan <- routeManagerImplEnsureAbsentParams{route, resultChan}
+	result := <-resultChan
+	return result.removed, result.err
+}
+
+func (r *routeManagerImpl) ensureAbsent(params routeManagerImplEnsureAbsentParams) {
+	absent := withMainTable(params.route)
+	filter := absent.toNetLinkRoute()
+	filterMask := netlink.RT_FILTER_DST | netlink.RT_FILTER_TABLE
+	if absent.Gw != nil {
+		filterMask |= netlink.RT_FILTER_GW
+	}
+	if absent.Tos != 0 {
+		filterMask |= netlink.RT_FILTER_TOS
+	}
+	kernelRoutes, err := r.routeList(netlink.FAMILY_ALL, &filter, filterMask)
+	if err != nil {
+		params.result <- routeManagerImplEnsureAbsentResult{err: err}
+		return
+	}
+	removed := 0
+	for i := range kernelRoutes {
+		if kernelRoutes[i].Dst == nil || kernelRoutes[i].Dst.String() != absent.Dst.String() || kernelRoutes[i].Table != absent.Table {
+			continue
+		}
+		if absent.Gw != nil && !absent.Gw.Equal(kernelRoutes[i].Gw) {
+			continue
+		}
+		if absent.Tos != 0 && absent.Tos != kernelRoutes[i].Tos {
+			continue
+		}
+		if r.isManaged(fromNetLinkRoute(kernelRoutes[i])) || r.isOtherInstance(kernelRoutes[i].Protocol) {
+			continue
+		}
+		if err := r.routeDel(&kernelRoutes[i]); err != nil && syscall.ESRCH.Error() != err.Error() {
+			params.result <- routeManagerImplEnsureAbsentResult{removed: removed, err: err}
+			return
+		}
+		removed++
+	}
+	params.result <- routeManagerImplEnsureAbsentResult{removed: removed}
+}
+
+//isOtherInstance tells whether the protocol belongs to another instance of the operator on the node
+func (r *routeManagerImpl) isOtherInstance(protocol int) bool {
+	return protocol != r.protocol && protocol >= DefaultProtocol && protocol <= MaxProtocol
+}
+
+func (r *routeManagerImpl) isManaged(route Route) bool {
+	route = withMainTable(route)
+	for _, managed := range r.managedRoutes {
+		if withMainTable(managed).equal(route) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *routeManagerImpl) ListRoutes() ([]Route, error) {
+	resultChan := make(chan routeManagerImplListRoutesResult)
+	r.listRoutesChan <- resultChan
+	result := <-resultChan
+	return result.routes, result.err
+}
+
+func (r *routeManagerImpl) listRoutes(result chan<- routeManagerImplListRoutesResult) {
+	kernelRoutes, err := r.ownKernelRoutes()
+	if err != nil {
+		result <- routeManagerImplListRoutesResult{err: err}
+		return
+	}
+	routes := []Route{}
+	for _, kernelRoute := range kernelRoutes {
+		routes = append(routes, fromNetLinkRoute(kernelRoute))
+	}
+	result <- routeManagerImplListRoutesResult{routes: routes}
+}
+
+//ownKernelRoutes reads every route of our protocol from the kernel in any table, ordered by table and destination
+func (r *routeManagerImpl) ownKernelRoutes() ([]netlink.Route, error) {
+	// Table filter with unspecified table lists every table
+	filter := netlink.Route{Protocol: r.protocol}
+	kernelRoutes, err := r.routeList(netlink.FAMILY_ALL, &filter, netlink.RT_FILTER_TABLE|netlink.RT_FILTER_PROTOCOL)
+	if err != nil {
+		return nil, err
+	}
+	routes := []netlink.Route{}
+	for _, kernelRoute := range kernelRoutes {
+		if kernelRoute.Protocol != r.protocol || kernelRoute.Dst == nil {
+			continue
+		}
+		routes = append(routes, kernelRoute)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Table != routes[j].Table {
+			return routes[i].Table < routes[j].Table
+		}
+		return routes[i].Dst.String() < routes[j].Dst.String()
+	})
+	return routes, nil
+}
+
+//String formats the route like iproute2 does
+func (r Route) String() string {
+	s := r.Dst.String()
+	if r.Gw != nil {
+		s += " via " + r.Gw.String()
+	}
+	if r.Src != nil {
+		s += " src " + r.Src.String()
+	}
+	if r.Table != 0 {
+		s += fmt.Sprintf(" table %d", r.Table)
+	}
+	if r.Tos != 0 {
+		s += fmt.Sprintf(" tos 0x%02x", r.Tos)
+	}
+	if r.Metric != 0 {
+		s += fmt.Sprintf(" metric %d", r.Metric)
+	}
+	return s
+}
+
+//isSharedRoute tells whether the route is managed by another name as well
+func (r *routeManagerImpl) isSharedRoute(name string, route Route) bool {
+	route = withMainTable(route)
+	for managedName, managed := range r.managedRoutes {
+		if managedName != name && withMainTable(managed).equal(route) {
+			return true
+		}
+	}
+	return false
+}
+
+/* addRouteWithRule creates the rule of the route before the route itself, so marked packets never look up an incomplete table.
+   If the route can't be created, the rule is removed again unless it existed before or it belongs to another managed route. */
+func (r *routeManagerImpl) addRouteWithRule(name string, route Route, reported bool) error {
+	if route.Table < 0 || int64(route.Table) > MaxTable {
+		return ErrInvalidTable
+	}
+	ruleCreated := false
+	if route.Rule != nil {
+		if err := r.ruleAdd(route.toNetLinkRule()); err == nil {
+			ruleCreated = true
+		} else if syscall.EEXIST.Error() != err.Error() {
+			return fmt.Errorf("Unable to create rule: %w", err)
+		}
+	}
+	nlRoute := r.mergedRoute(name, route)
+	err := r.installRoute(&nlRoute)
+	if err != nil && syscall.EEXIST.Error() == err.Error() {
+		// The existing route is adopted by the caller, it may need our protocol first
+		if aerr := r.adoptRoute(route, nlRoute, reported); aerr != nil {
+			err = fmt.Errorf("Unable to adopt route: %w", aerr)
+		}
+	}
+	if err != nil && syscall.EEXIST.Error() != err.Error() && ruleCreated && !r.isSharedRule(name, route) {
+		_ = r.ruleDel(route.toNetLinkRule())
+	}
+	return err
+}
+
+/* adoptRoute tags the existing route of the kernel with our protocol if it has one of the AdoptProtocols, ie. it was created by the previous version of the operator.
+   Released versions created their routes untagged, like "ip route add" of an admin does, so an untagged route is adopted only if
+   the route was reported applied by the node and the gateway is the same.
+   The route is replaced in place instead of deleted and created again, so the traffic through it is not dropped during the upgrade. */
+func (r *routeManagerImpl) adoptRoute(route Route, nlRoute netlink.Route, reported bool) error {
+	if len(r.options.AdoptProtocols) == 0 && !reported {
+		return nil
+	}
+	filter := withMainTable(route).toNetLinkRoute()
+	kernelRoutes, err := r.routeList(netlink.FAMILY_ALL, &filter, netlink.RT_FILTER_DST|netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return err
+	}
+	for _, kernelRoute := range kernelRoutes {
+		if kernelRoute.Dst == nil || kernelRoute.Dst.String() != filter.Dst.String() || kernelRoute.Table != filter.Table || kernelRoute.Tos != filter.Tos || routeMetric(kernelRoute) != route.Metric {
+			continue
+		}
+		if r.isAdoptable(kernelRoute.Protocol) || (reported && isUntagged(kernelRoute.Protocol) && kernelRoute.Gw.Equal(nlRoute.Gw)) {
+			return r.routeReplace(&nlRoute)
+		}
+	}
+	return nil
+}
+
+//isAdoptable tells whether the protocol belongs to a previous version of the operator, whose routes are taken over
+func (r *routeManagerImpl) isAdoptable(protocol int) bool {
+	for _, adoptable := range r.options.AdoptProtocols {
+		if protocol == adoptable && protocol != r.protocol {
+			return true
+		}
+	}
+	return false
+}
+
+//isUntagged tells whether the route was created without a protocol, as released versions of the operator did
+func isUntagged(protocol int) bool {
+	return protocol == unix.RTPROT_BOOT || protocol == unix.RTPROT_UNSPEC
+}
+
+//delRule removes the rule of the route from the kernel, unless another managed route has the same rule
+func (r *routeManagerImpl) delRule(name string, route Route) error {
+	if route.Rule == nil || r.isSharedRule(name, route) {
+		return nil
+	}
+	// ENOENT means the rule is already missing
+	if err := r.ruleDel(route.toNetLinkRule()); err != nil && syscall.ENOENT.Error() != err.Error() {
+		return fmt.Errorf("Unable to delete rule: %w", err)
+	}
+	return nil
+}
+
+//isSharedRule tells whether another managed route has the same rule
+func (r *routeManagerImpl) isSharedRule(name string, route Route) bool {
+	rule := route.toNetLinkRule()
+	for managedName, managed := range r.managedRoutes {
+		if managedName != name && managed.Rule != nil && reflect.DeepEqual(managed.toNetLinkRule(), rule) {
+			return true
+		}
+	}
+	return false
+}
+
+//isForeignMainRoute tells whether the kernel route is in the main table and it was not created by us
+func (r *routeManagerImpl) isForeignMainRoute(route netlink.Route) bool {
+	return (route.Table == unix.RT_TABLE_UNSPEC || route.Table == unix.RT_TABLE_MAIN) && route.Protocol != r.protocol
+}
+
+//withMainTable returns the route with the main table set explicitly, as the kernel reports it
+func withMainTable(route Route) Route {
+	if route.Table == 0 {
+		route.Table = unix.RT_TABLE_MAIN
+	}
+	return route
+}
+
 func (r *routeManagerImpl) RegisterWatcher(w RouteWatcher) {
 	r.registerWatcherChan <- w
 }
@@ -141,12 +738,36 @@ func (r *routeManagerImpl) deRegisterWatcher(w RouteWatcher) {
 
 func (r Route) toNetLinkRoute() netlink.Route {
 	return netlink.Route{
-		Dst:   &r.Dst,
-		Gw:    r.Gw,
-		Table: r.Table,
+		Dst:       &r.Dst,
+		Gw:        r.Gw,
+		Src:       r.Src,
+		Table:     r.Table,
+		Tos:       r.Tos,
+		Priority:  r.Metric,
+		LinkIndex: r.linkIndex,
+		Scope:     r.scope,
 	}
 }
 
+//toNetLinkRule converts the rule of the route, it points to the table of the route in the family of the destination
+func (r Route) toNetLinkRule() *netlink.Rule {
+	rule := netlink.NewRule()
+	rule.Family = netlink.FAMILY_V4
+	if r.Dst.IP.To4() == nil {
+		rule.Family = netlink.FAMILY_V6
+	}
+	if r.Rule.Goto != 0 {
+		rule.Goto = r.Rule.Goto
+	} else {
+		rule.Table = withMainTable(r).Table
+	}
+	if r.Rule.SuppressPrefixlen != nil {
+		rule.SuppressPrefixlen = *r.Rule.SuppressPrefixlen
+	}
+	rule.Mark = int(r.Rule.Mark)
+	return rule
+}
+
 /* This version of equal shall be used everywhere in this package.
    Netlink also does have an Equal function, however if we use that with
    mixing netlink.Route and routemanager.Route input, it will report false.
@@ -155,44 +776,102 @@ func (r Route) toNetLinkRoute() netlink.Route {
    to convert back and forth the netlink.Route instances before comparing them
    to zero out the fields which we do not store in this package. */
 func (r Route) equal(x Route) bool {
-	return r.toNetLinkRoute().Equal(x.toNetLinkRoute())
+	// The kernel reports the device of the routes through a gateway too, so it is compared by the scope only
+	rRoute, xRoute := r.toNetLinkRoute(), x.toNetLinkRoute()
+	rRoute.LinkIndex, xRoute.LinkIndex = 0, 0
+	return rRoute.Equal(xRoute)
 }
 
 func fromNetLinkRoute(netlinkRoute netlink.Route) Route {
 	return Route{
-		Dst:   *netlinkRoute.Dst,
-		Gw:    netlinkRoute.Gw,
-		Table: netlinkRoute.Table,
+		Dst:    *netlinkRoute.Dst,
+		Gw:     netlinkRoute.Gw,
+		Src:    netlinkRoute.Src,
+		Table:  netlinkRoute.Table,
+		Tos:    netlinkRoute.Tos,
+		Metric: routeMetric(netlinkRoute),
+		scope:  netlinkRoute.Scope,
 	}
 }
 
+//ip6DefaultMetric is the metric the kernel gives to the IPv6 routes created without one
+const ip6DefaultMetric = 1024
+
+//routeMetric returns the metric of the kernel route, 0 if it has the default metric of its family
+func routeMetric(netlinkRoute netlink.Route) int {
+	if netlinkRoute.Priority == ip6DefaultMetric && netlinkRoute.Dst != nil && netlinkRoute.Dst.IP.To4() == nil {
+		return 0
+	}
+	return netlinkRoute.Priority
+}
+
 func (r *routeManagerImpl) notifyWatchers(update netlink.RouteUpdate) {
+	if r.isDefaultRouteChange(update) {
+		for _, watcher := range r.watchers {
+			if defaultRouteWatcher, ok := watcher.(DefaultRouteWatcher); ok {
+				defaultRouteWatcher.DefaultRouteChanged()
+			}
+		}
+	}
 	if update.Type != unix.RTM_DELROUTE {
 		return
 	}
-	for _, route := range r.managedRoutes {
-		updateRoute := fromNetLinkRoute(update.Route)
-		if route.equal(updateRoute) {
-			for _, watcher := range r.watchers {
-				watcher.RouteDeleted(updateRoute)
+	// Every nexthop of a deleted multipath route is reported as a deleted route
+	for _, nlRoute := range expandNexthops(update.Route) {
+		updateRoute := fromNetLinkRoute(nlRoute)
+		for _, route := range r.managedRoutes {
+			if route.equal(updateRoute) {
+				for _, watcher := range r.watchers {
+					watcher.RouteDeleted(updateRoute)
+				}
+				break
 			}
-			break
 		}
 	}
 }
 
+//isDefaultRouteChange tells whether the update is about a default route of the main table, which was not created by us
+func (r *routeManagerImpl) isDefaultRouteChange(update netlink.RouteUpdate) bool {
+	if !r.isForeignMainRoute(update.Route) {
+		return false
+	}
+	if update.Dst == nil {
+		return true
+	}
+	ones, _ := update.Dst.Mask.Size()
+	return ones == 0
+}
+
 func (r *routeManagerImpl) Run(stopChan chan struct{}) error {
 	updateChan := make(chan netlink.RouteUpdate)
 	if err := r.nlRouteSubscribeFunc(updateChan, stopChan); err != nil {
 		return err
 	}
+	linkChan := make(chan netlink.LinkUpdate)
+	if err := r.nlLinkSubscribeFunc(linkChan, stopChan); err != nil {
+		return err
+	}
+	var probeChan <-chan time.Time
+	if r.options.ProbeInterval > 0 {
+		ticker := time.NewTicker(r.options.ProbeInterval)
+		defer ticker.Stop()
+		probeChan = ticker.C
+	}
+	defer r.stopHealthChecks()
 	for {
 		select {
 		case update, ok := <-updateChan:
 			if !ok {
 				return nil
 			}
+			// The route to the apiserver may have changed, it is looked up again
+			r.apiServerRoutes = nil
 			r.notifyWatchers(update)
+		case update, ok := <-linkChan:
+			if !ok {
+				return nil
+			}
+			r.linkChanged(update)
 		case <-stopChan:
 			return nil
 		case watcher := <-r.registerWatcherChan:
@@ -201,8 +880,130 @@ func (r *routeManagerImpl) Run(stopChan chan struct{}) error {
 			r.deRegisterWatcher(watcher)
 		case params := <-r.registerRouteChan:
 			r.registerRoute(params)
+		case params := <-r.registerRoutesChan:
+			r.registerRoutes(params)
+		case params := <-r.applyRoutesChan:
+			r.applyRoutes(params)
 		case params := <-r.deRegisterRouteChan:
 			r.deRegisterRoute(params)
+		case params := <-r.verifyRouteChan:
+			r.verifyRoute(params)
+		case params := <-r.flushTableChan:
+			r.flushTable(params)
+		case params := <-r.ensureAbsentChan:
+			r.ensureAbsent(params)
+		case result := <-r.listRoutesChan:
+			r.listRoutes(result)
+		case result := <-r.exportRoutesChan:
+			r.exportRoutes(result)
+		case params := <-r.isDegradedChan:
+			params.degraded <- r.isDegraded(params.name)
+		case params := <-r.nexthopsChan:
+			params.nexthops <- r.nexthopsOf(params.name)
+		case params := <-r.isLinkUpChan:
+			params.up <- r.isLinkUp(params.name)
+		case <-probeChan:
+			r.probeGateways()
+		case result := <-r.healthCheckResultChan:
+			r.healthChecked(result)
 		}
 	}
 }
+
+//routeAdd tags the route with our protocol, every route created by the RouteManager goes through here
+func (r *routeManagerImpl) routeAdd(route *netlink.Route) error {
+	defer metrics.ObserveNetlink("add", time.Now())
+	route.Protocol = r.protocol
+	return r.withTimeout("add", func() error {
+		return r.nlRouteAddFunc(route)
+	})
+}
+
+//ownRouteDel removes a route created by us. The kernel matches the protocol too, so the same route of another instance stays.
+func (r *routeManagerImpl) ownRouteDel(route Route) error {
+	nlRoute := route.toNetLinkRoute()
+	nlRoute.Protocol = r.protocol
+	return r.routeDel(&nlRoute)
+}
+
+//routeReplace tags the route with our protocol like routeAdd, the route of the same destination is replaced in place
+func (r *routeManagerImpl) routeReplace(route *netlink.Route) error {
+	if err := r.protectAPIServerRoute(route, true); err != nil {
+		return err
+	}
+	defer metrics.ObserveNetlink("replace", time.Now())
+	route.Protocol = r.protocol
+	return r.withTimeout("replace", func() error {
+		return r.nlRouteReplaceFunc(route)
+	})
+}
+
+func (r *routeManagerImpl) routeDel(route *netlink.Route) error {
+	if err := r.protectAPIServerRoute(route, false); err != nil {
+		return err
+	}
+	defer metrics.ObserveNetlink("delete", time.Now())
+	return r.withTimeout("delete", func() error {
+		return r.nlRouteDelFunc(route)
+	})
+}
+
+func (r *routeManagerImpl) ruleAdd(rule *netlink.Rule) error {
+	defer metrics.ObserveNetlink("rule_add", time.Now())
+	return r.withTimeout("rule_add", func() error {
+		return r.nlRuleAddFunc(rule)
+	})
+}
+
+func (r *routeManagerImpl) ruleDel(rule *netlink.Rule) error {
+	defer metrics.ObserveNetlink("rule_delete", time.Now())
+	return r.withTimeout("rule_delete", func() error {
+		return r.nlRuleDelFunc(rule)
+	})
+}
+
+func (r *routeManagerImpl) neighList(linkIndex, family int) ([]netlink.Neigh, error) {
+	defer metrics.ObserveNetlink("neigh_list", time.Now())
+	var neighs []netlink.Neigh
+	if err := r.withTimeout("neigh_list", func() (err error) {
+		neighs, err = r.nlNeighListFunc(linkIndex, family)
+		return
+	}); err != nil {
+		return nil, err
+	}
+	return neighs, nil
+}
+
+func (r *routeManagerImpl) routeList(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	defer metrics.ObserveNetlink("list", time.Now())
+	var routes []netlink.Route
+	if err := r.withTimeout("list", func() (err error) {
+		routes, err = r.nlRouteListFunc(family, filter, filterMask)
+		return
+	}); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+/* withTimeout bounds the netlink call by NetlinkTimeout. The call of a wedged kernel can't be cancelled, it is left behind
+   in its own goroutine, but the event loop goes on, and the caller can retry. The results of a timed out call must not be read.
+   The errors of the kernel are classified, so they tell the callers whether to retry. */
+func (r *routeManagerImpl) withTimeout(operation string, call func() error) error {
+	if r.options.NetlinkTimeout <= 0 {
+		return classify(call())
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- call()
+	}()
+	timer := time.NewTimer(r.options.NetlinkTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return classify(err)
+	case <-timer.C:
+		metrics.CountNetlinkTimeout(operation)
+		return fmt.Errorf("Netlink operation %s: %w", operation, ErrNetlinkTimeout)
+	}
+}
@@ -18,12 +18,15 @@ package routemanager
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"reflect"
 	"runtime"
+	"strconv"
 	"sync"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
@@ -38,6 +41,7 @@ func (m MockRouteWatcher) RouteDeleted(r Route) {
 }
 
 var gMockUpdateChan chan<- netlink.RouteUpdate
+var gMockLinkUpdateChan chan<- netlink.LinkUpdate
 var gTestRoute = Route{Dst: net.IPNet{IP: net.IP{192, 168, 1, 0}, Mask: net.CIDRMask(24, 32)}, Gw: net.IP{192, 168, 1, 254}, Table: 254}
 var gTestRouteName = "name"
 
@@ -46,14 +50,43 @@ func mockRouteSubscribe(u chan<- netlink.RouteUpdate, c <-chan struct{}) error {
 	return nil
 }
 
+func mockLinkSubscribe(u chan<- netlink.LinkUpdate, c <-chan struct{}) error {
+	gMockLinkUpdateChan = u
+	return nil
+}
+
+func dummyLinkByName(name string) (netlink.Link, error) {
+	return nil, errors.New("Link not found")
+}
+
 func dummyRouteAdd(route *netlink.Route) error {
 	return nil
 }
 
+func dummyRouteReplace(route *netlink.Route) error {
+	return nil
+}
+
 func dummyRouteDel(route *netlink.Route) error {
 	return nil
 }
 
+func dummyRouteList(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	return nil, nil
+}
+
+func dummyRuleAdd(rule *netlink.Rule) error {
+	return nil
+}
+
+func dummyRuleDel(rule *netlink.Rule) error {
+	return nil
+}
+
+func dummyHealthProbe(check HealthCheck, gateway net.IP) error {
+	return nil
+}
+
 type testableRouteManager struct {
 	rm       RouteManager
 	runError error
@@ -78,11 +111,34 @@ func newTestableRouteManager() testableRouteManager {
 	return testableRouteManager{
 		rm: &routeManagerImpl{
 			managedRoutes:         make(map[string]Route),
+			gateways:              make(map[string]*gatewayState),
+			links:                 make(map[string]bool),
+			driftCorrections:      make(map[string]time.Time),
+			healthChecks:          make(map[string]*healthCheckState),
+			healthProbeFunc:       dummyHealthProbe,
+			now:                   time.Now,
 			nlRouteSubscribeFunc:  mockRouteSubscribe,
+			nlLinkSubscribeFunc:   mockLinkSubscribe,
+			nlLinkByNameFunc:      dummyLinkByName,
 			nlRouteAddFunc:        dummyRouteAdd,
 			nlRouteDelFunc:        dummyRouteDel,
+			nlRouteReplaceFunc:    dummyRouteReplace,
+			nlRouteListFunc:       dummyRouteList,
+			nlRuleAddFunc:         dummyRuleAdd,
+			nlRuleDelFunc:         dummyRuleDel,
 			registerRouteChan:     make(chan routeManagerImplRegisterRouteParams),
+			registerRoutesChan:    make(chan routeManagerImplRegisterRoutesParams),
+			applyRoutesChan:       make(chan routeManagerImplApplyRoutesParams),
 			deRegisterRouteChan:   make(chan routeManagerImplDeRegisterRouteParams),
+			verifyRouteChan:       make(chan routeManagerImplVerifyRouteParams),
+			flushTableChan:        make(chan routeManagerImplFlushTableParams),
+			ensureAbsentChan:      make(chan routeManagerImplEnsureAbsentParams),
+			listRoutesChan:        make(chan chan<- routeManagerImplListRoutesResult),
+			exportRoutesChan:      make(chan chan<- routeManagerImplExportRoutesResult),
+			isDegradedChan:        make(chan routeManagerImplIsDegradedParams),
+			nexthopsChan:          make(chan routeManagerImplNexthopsParams),
+			isLinkUpChan:          make(chan routeManagerImplIsLinkUpParams),
+			healthCheckResultChan: make(chan healthCheckResult),
 			registerWatcherChan:   make(chan RouteWatcher),
 			deRegisterWatcherChan: make(chan RouteWatcher),
 		},
@@ -92,7 +148,7 @@ func newTestableRouteManager() testableRouteManager {
 }
 
 func TestNewDoesReturnValidManager(t *testing.T) {
-	rm := New()
+	rm := New(Options{ProbeInterval: time.Second, DegradedAfter: time.Minute})
 	//Pretty intuitive way to check if two function pointers are identical. Thanks for: https://github.com/stretchr/testify/issues/182#issuecomment-495359313
 	if runtime.FuncForPC(reflect.ValueOf(rm.(*routeManagerImpl).nlRouteAddFunc).Pointer()).Name() != runtime.FuncForPC(reflect.ValueOf(netlink.RouteAdd).Pointer()).Name() {
 		t.Error("nlRouteAddFunc function is not pointing to netlink package")
@@ -100,15 +156,87 @@ func TestNewDoesReturnValidManager(t *testing.T) {
 	if runtime.FuncForPC(reflect.ValueOf(rm.(*routeManagerImpl).nlRouteDelFunc).Pointer()).Name() != runtime.FuncForPC(reflect.ValueOf(netlink.RouteDel).Pointer()).Name() {
 		t.Error("nlRouteDelFunc function is not pointing to netlink package")
 	}
+	if runtime.FuncForPC(reflect.ValueOf(rm.(*routeManagerImpl).nlRouteReplaceFunc).Pointer()).Name() != runtime.FuncForPC(reflect.ValueOf(netlink.RouteReplace).Pointer()).Name() {
+		t.Error("nlRouteReplaceFunc function is not pointing to netlink package")
+	}
+	if runtime.FuncForPC(reflect.ValueOf(rm.(*routeManagerImpl).nlRouteListFunc).Pointer()).Name() != runtime.FuncForPC(reflect.ValueOf(netlink.RouteListFiltered).Pointer()).Name() {
+		t.Error("nlRouteListFunc function is not pointing to netlink package")
+	}
+	if runtime.FuncForPC(reflect.ValueOf(rm.(*routeManagerImpl).nlRouteGetFunc).Pointer()).Name() != runtime.FuncForPC(reflect.ValueOf(netlink.RouteGet).Pointer()).Name() {
+		t.Error("nlRouteGetFunc function is not pointing to netlink package")
+	}
+	if runtime.FuncForPC(reflect.ValueOf(rm.(*routeManagerImpl).nlRuleAddFunc).Pointer()).Name() != runtime.FuncForPC(reflect.ValueOf(netlink.RuleAdd).Pointer()).Name() {
+		t.Error("nlRuleAddFunc function is not pointing to netlink package")
+	}
+	if runtime.FuncForPC(reflect.ValueOf(rm.(*routeManagerImpl).nlRuleDelFunc).Pointer()).Name() != runtime.FuncForPC(reflect.ValueOf(netlink.RuleDel).Pointer()).Name() {
+		t.Error("nlRuleDelFunc function is not pointing to netlink package")
+	}
+	if runtime.FuncForPC(reflect.ValueOf(rm.(*routeManagerImpl).nlNeighListFunc).Pointer()).Name() != runtime.FuncForPC(reflect.ValueOf(netlink.NeighList).Pointer()).Name() {
+		t.Error("nlNeighListFunc function is not pointing to netlink package")
+	}
+	if runtime.FuncForPC(reflect.ValueOf(rm.(*routeManagerImpl).nlLinkSubscribeFunc).Pointer()).Name() != runtime.FuncForPC(reflect.ValueOf(netlink.LinkSubscribe).Pointer()).Name() {
+		t.Error("nlLinkSubscribeFunc function is not pointing to netlink package")
+	}
+	if runtime.FuncForPC(reflect.ValueOf(rm.(*routeManagerImpl).nlLinkByNameFunc).Pointer()).Name() != runtime.FuncForPC(reflect.ValueOf(netlink.LinkByName).Pointer()).Name() {
+		t.Error("nlLinkByNameFunc function is not pointing to netlink package")
+	}
 	if runtime.FuncForPC(reflect.ValueOf(rm.(*routeManagerImpl).nlRouteSubscribeFunc).Pointer()).Name() != runtime.FuncForPC(reflect.ValueOf(netlink.RouteSubscribe).Pointer()).Name() {
 		t.Error("nlRouteSubscribeFunc function is not pointing to netlink package")
 	}
+	if runtime.FuncForPC(reflect.ValueOf(rm.(*routeManagerImpl).healthProbeFunc).Pointer()).Name() != runtime.FuncForPC(reflect.ValueOf(probeHealth).Pointer()).Name() {
+		t.Error("healthProbeFunc function is not pointing to probeHealth")
+	}
+	if rm.(*routeManagerImpl).healthCheckResultChan == nil {
+		t.Error("healthCheckResult channel is not initialized")
+	}
 	if rm.(*routeManagerImpl).registerRouteChan == nil {
 		t.Error("registerRoute channel is not initialized")
 	}
+	if rm.(*routeManagerImpl).registerRoutesChan == nil {
+		t.Error("registerRoutes channel is not initialized")
+	}
+	if rm.(*routeManagerImpl).applyRoutesChan == nil {
+		t.Error("applyRoutes channel is not initialized")
+	}
 	if rm.(*routeManagerImpl).deRegisterRouteChan == nil {
 		t.Error("deRegisterRoute channel is not initialized")
 	}
+	if rm.(*routeManagerImpl).verifyRouteChan == nil {
+		t.Error("verifyRoute channel is not initialized")
+	}
+	if rm.(*routeManagerImpl).flushTableChan == nil {
+		t.Error("flushTable channel is not initialized")
+	}
+	if rm.(*routeManagerImpl).ensureAbsentChan == nil {
+		t.Error("ensureAbsent channel is not initialized")
+	}
+	if rm.(*routeManagerImpl).listRoutesChan == nil {
+		t.Error("listRoutes channel is not initialized")
+	}
+	if rm.(*routeManagerImpl).exportRoutesChan == nil {
+		t.Error("exportRoutes channel is not initialized")
+	}
+	if rm.(*routeManagerImpl).isLinkUpChan == nil || rm.(*routeManagerImpl).links == nil {
+		t.Error("isLinkUp channel is not initialized")
+	}
+	if rm.(*routeManagerImpl).isDegradedChan == nil {
+		t.Error("isDegraded channel is not initialized")
+	}
+	if rm.(*routeManagerImpl).nexthopsChan == nil {
+		t.Error("nexthops channel is not initialized")
+	}
+	if rm.(*routeManagerImpl).options.ProbeInterval != time.Second || rm.(*routeManagerImpl).options.DegradedAfter != time.Minute {
+		t.Error("options are not stored")
+	}
+	if rm.(*routeManagerImpl).gateways == nil || rm.(*routeManagerImpl).now == nil {
+		t.Error("gateway probe is not initialized")
+	}
+	if rm.(*routeManagerImpl).protocol != DefaultProtocol {
+		t.Error("protocol is not the default one")
+	}
+	if rm := New(Options{Protocol: DefaultProtocol + 1}); rm.(*routeManagerImpl).protocol != DefaultProtocol+1 {
+		t.Error("protocol is not the given one")
+	}
 	if rm.(*routeManagerImpl).registerWatcherChan == nil {
 		t.Error("registerWatcher channel is not initialized")
 	}
@@ -146,6 +274,18 @@ func TestRunReturnsSubscribeError(t *testing.T) {
 	}
 }
 
+func TestRunReturnsLinkSubscribeError(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).nlLinkSubscribeFunc = func(chan<- netlink.LinkUpdate, <-chan struct{}) error {
+		return errors.New("bla")
+	}
+	testable.start()
+	testable.stop()
+	if testable.runError == nil {
+		t.Error("Run supposed to early exit with an error due to link subscription failure")
+	}
+}
+
 func TestWatchNewRouteDoesNotTrigger(t *testing.T) {
 	testable := newTestableRouteManager()
 	testable.start()
@@ -212,6 +352,46 @@ func TestWatch(t *testing.T) {
 	testable.rm.DeRegisterWatcher(mockWatcher)
 }
 
+type mockDefaultRouteWatcher struct {
+	MockRouteWatcher
+	defaultRouteChangedCalled chan bool
+}
+
+func (m mockDefaultRouteWatcher) DefaultRouteChanged() {
+	m.defaultRouteChangedCalled <- true
+}
+
+func TestWatchDefaultRoute(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).protocol = DefaultProtocol
+	testable.start()
+	mockWatcher := mockDefaultRouteWatcher{defaultRouteChangedCalled: make(chan bool, 10)}
+	testable.rm.RegisterWatcher(mockWatcher)
+	defaultRoute := netlink.Route{Gw: net.IP{10, 0, 0, 1}, Table: unix.RT_TABLE_MAIN, Protocol: unix.RTPROT_BOOT}
+	ours := defaultRoute
+	ours.Protocol = DefaultProtocol
+	otherTable := defaultRoute
+	otherTable.Table = 100
+	notDefault := gTestRoute.toNetLinkRoute()
+	explicit := defaultRoute
+	explicit.Dst = &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}
+
+	for _, update := range []netlink.RouteUpdate{
+		{Type: unix.RTM_NEWROUTE, Route: defaultRoute},
+		{Type: unix.RTM_NEWROUTE, Route: ours},
+		{Type: unix.RTM_NEWROUTE, Route: otherTable},
+		{Type: unix.RTM_DELROUTE, Route: notDefault},
+		{Type: unix.RTM_DELROUTE, Route: explicit},
+	} {
+		gMockUpdateChan <- update
+	}
+
+	testable.stop()
+	if len(mockWatcher.defaultRouteChangedCalled) != 2 {
+		t.Errorf("Only the foreign default routes of the main table must be reported: %d", len(mockWatcher.defaultRouteChangedCalled))
+	}
+}
+
 func TestWatchCloseUpdateChan(t *testing.T) {
 	testable := newTestableRouteManager()
 	testable.start()
@@ -278,6 +458,62 @@ func TestRegisterRouteFail(t *testing.T) {
 	testable.stop()
 }
 
+func TestRegisterRouteNetlinkTimeout(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).options.NetlinkTimeout = 10 * time.Millisecond
+	release := make(chan struct{})
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		<-release
+		return nil
+	}
+	testable.start()
+
+	err := testable.rm.RegisterRoute(gTestRouteName, gTestRoute)
+
+	close(release)
+	registered := testable.rm.IsRegistered(gTestRouteName)
+	testable.stop()
+	if !errors.Is(err, ErrNetlinkTimeout) {
+		t.Errorf("Hanging netlink call must time out: %v", err)
+	}
+	if registered {
+		t.Error("Timed out route must be not registered")
+	}
+}
+
+func TestRegisterRouteLargeTable(t *testing.T) {
+	testable := newTestableRouteManager()
+	var added []int
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		added = append(added, route.Table)
+		return nil
+	}
+	testable.start()
+	defer testable.stop()
+
+	for _, table := range []int{1000, MaxTable} {
+		route := gTestRoute
+		route.Table = table
+		if err := testable.rm.RegisterRoute("table-"+strconv.Itoa(table), route); err != nil {
+			t.Errorf("RegisterRoute shall pass with table %d: %v", table, err)
+		}
+	}
+	if !reflect.DeepEqual(added, []int{1000, MaxTable}) {
+		t.Errorf("The full table id must be sent to netlink: %v", added)
+	}
+
+	for _, table := range []int{-1, MaxTable + 1} {
+		route := gTestRoute
+		route.Table = table
+		if err := testable.rm.RegisterRoute("table-"+strconv.Itoa(table), route); err != ErrInvalidTable {
+			t.Errorf("RegisterRoute shall fail with table %d: %v", table, err)
+		}
+	}
+	if len(added) != 2 || len(testable.rm.(*routeManagerImpl).managedRoutes) != 2 {
+		t.Errorf("Invalid tables must not reach netlink: %v", added)
+	}
+}
+
 func TestSameRegisterRouteTwiceFail(t *testing.T) {
 	testable := newTestableRouteManager()
 	testable.start()
@@ -356,6 +592,38 @@ func TestDeRegisterRouteUnknownError(t *testing.T) {
 	testable.stop()
 }
 
+func TestDeRegisterSharedRouteKeepsKernelRoute(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.start()
+	if err := testable.rm.RegisterRoute(gTestRouteName, gTestRoute); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	if err := testable.rm.RegisterRoute("other", gTestRoute); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	deleted := 0
+	testable.rm.(*routeManagerImpl).nlRouteDelFunc = func(route *netlink.Route) error {
+		deleted++
+		return nil
+	}
+
+	if err := testable.rm.DeRegisterRoute(gTestRouteName); err != nil {
+		t.Error("DeRegisterRoute shall pass here")
+	}
+	sharedDeleted := deleted
+	if err := testable.rm.DeRegisterRoute("other"); err != nil {
+		t.Error("DeRegisterRoute shall pass here")
+	}
+
+	testable.stop()
+	if sharedDeleted != 0 {
+		t.Error("Route managed by another name must stay in the kernel")
+	}
+	if deleted != 1 {
+		t.Error("Route must be removed with its last name")
+	}
+}
+
 func TestDeRegisterRouteWhichIsNotRegistered(t *testing.T) {
 	testable := newTestableRouteManager()
 	testable.start()
@@ -365,3 +633,1176 @@ func TestDeRegisterRouteWhichIsNotRegistered(t *testing.T) {
 	}
 	testable.stop()
 }
+
+func newTestRouteWithRule() Route {
+	route := gTestRoute
+	route.Table = 100
+	route.Rule = &Rule{Mark: 0x10}
+	return route
+}
+
+func TestRegisterRouteWithRule(t *testing.T) {
+	testable := newTestableRouteManager()
+	var calls []string
+	var addedRule *netlink.Rule
+	testable.rm.(*routeManagerImpl).nlRuleAddFunc = func(rule *netlink.Rule) error {
+		calls = append(calls, "rule")
+		addedRule = rule
+		return nil
+	}
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		calls = append(calls, "route")
+		return nil
+	}
+	testable.start()
+
+	err := testable.rm.RegisterRoute(gTestRouteName, newTestRouteWithRule())
+
+	testable.stop()
+	if err != nil {
+		t.Errorf("RegisterRoute shall pass here: %s", err.Error())
+	}
+	if !reflect.DeepEqual(calls, []string{"rule", "route"}) {
+		t.Errorf("Rule must be created before the route: %v", calls)
+	}
+	if addedRule == nil || addedRule.Mark != 0x10 || addedRule.Table != 100 || addedRule.Family != netlink.FAMILY_V4 {
+		t.Errorf("Rule sent to netlink does not match: %+v", addedRule)
+	}
+}
+
+func TestRegisterRouteWithRuleRollsBackRule(t *testing.T) {
+	testable := newTestableRouteManager()
+	ruleDeleted := false
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		return errors.New("bla")
+	}
+	testable.rm.(*routeManagerImpl).nlRuleDelFunc = func(rule *netlink.Rule) error {
+		ruleDeleted = true
+		return nil
+	}
+	testable.start()
+
+	err := testable.rm.RegisterRoute(gTestRouteName, newTestRouteWithRule())
+
+	testable.stop()
+	if err == nil {
+		t.Error("RegisterRoute shall fail here")
+	}
+	if !ruleDeleted {
+		t.Error("Rule must be removed if the route fails")
+	}
+	if len(testable.rm.(*routeManagerImpl).managedRoutes) != 0 {
+		t.Error("managedRoute slice must be empty")
+	}
+}
+
+func TestRegisterRouteWithRuleKeepsExistingRule(t *testing.T) {
+	testable := newTestableRouteManager()
+	ruleDeleted := false
+	testable.rm.(*routeManagerImpl).nlRuleAddFunc = func(rule *netlink.Rule) error {
+		return errors.New(syscall.EEXIST.Error())
+	}
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		return errors.New("bla")
+	}
+	testable.rm.(*routeManagerImpl).nlRuleDelFunc = func(rule *netlink.Rule) error {
+		ruleDeleted = true
+		return nil
+	}
+	testable.start()
+
+	err := testable.rm.RegisterRoute(gTestRouteName, newTestRouteWithRule())
+
+	testable.stop()
+	if err == nil {
+		t.Error("RegisterRoute shall fail here")
+	}
+	if ruleDeleted {
+		t.Error("Rule existed before, it must not be removed")
+	}
+}
+
+func TestRegisterRouteRuleFails(t *testing.T) {
+	testable := newTestableRouteManager()
+	routeAdded := false
+	testable.rm.(*routeManagerImpl).nlRuleAddFunc = func(rule *netlink.Rule) error {
+		return errors.New("bla")
+	}
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		routeAdded = true
+		return nil
+	}
+	testable.start()
+
+	err := testable.rm.RegisterRoute(gTestRouteName, newTestRouteWithRule())
+
+	testable.stop()
+	if err == nil {
+		t.Error("RegisterRoute shall fail here")
+	}
+	if routeAdded {
+		t.Error("Route must not be created without its rule")
+	}
+}
+
+func TestDeRegisterRouteRemovesSharedRuleWithLastRoute(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.start()
+	other := newTestRouteWithRule()
+	other.Dst = net.IPNet{IP: net.IP{192, 168, 2, 0}, Mask: net.CIDRMask(24, 32)}
+	if err := testable.rm.RegisterRoute(gTestRouteName, newTestRouteWithRule()); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	if err := testable.rm.RegisterRoute("other", other); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	rulesDeleted := 0
+	testable.rm.(*routeManagerImpl).nlRuleDelFunc = func(rule *netlink.Rule) error {
+		rulesDeleted++
+		return errors.New(syscall.ENOENT.Error())
+	}
+
+	if err := testable.rm.DeRegisterRoute(gTestRouteName); err != nil {
+		t.Error("DeRegisterRoute shall pass here")
+	}
+	sharedDeleted := rulesDeleted
+	if err := testable.rm.DeRegisterRoute("other"); err != nil {
+		t.Errorf("Missing rule must not fail the deregistration: %s", err.Error())
+	}
+
+	testable.stop()
+	if sharedDeleted != 0 {
+		t.Error("Rule of another route must stay in the kernel")
+	}
+	if rulesDeleted != 1 {
+		t.Error("Rule must be removed with its last route")
+	}
+}
+
+func TestDeRegisterRouteRuleFails(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.start()
+	if err := testable.rm.RegisterRoute(gTestRouteName, newTestRouteWithRule()); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	testable.rm.(*routeManagerImpl).nlRuleDelFunc = func(rule *netlink.Rule) error {
+		return errors.New("bla")
+	}
+
+	err := testable.rm.DeRegisterRoute(gTestRouteName)
+
+	testable.stop()
+	if err == nil {
+		t.Error("DeRegisterRoute shall fail here")
+	}
+	if !testable.rm.IsRegistered(gTestRouteName) {
+		t.Error("Route must stay registered, so the removal can be retried")
+	}
+}
+
+func TestRouteToNetLinkRule(t *testing.T) {
+	route := Route{Dst: net.IPNet{IP: net.ParseIP("fd00::"), Mask: net.CIDRMask(64, 128)}, Rule: &Rule{Mark: 0xffffffff}}
+
+	rule := route.toNetLinkRule()
+
+	if rule.Family != netlink.FAMILY_V6 || rule.Table != unix.RT_TABLE_MAIN || rule.Mark != 0xffffffff || rule.Priority != -1 {
+		t.Errorf("Rule not match: %+v", rule)
+	}
+}
+
+func TestRouteToNetLinkRuleAttributes(t *testing.T) {
+	suppress := 0
+	lookup := Route{Dst: gTestRoute.Dst, Table: 200, Rule: &Rule{Mark: 0x10, SuppressPrefixlen: &suppress}}
+	jump := Route{Dst: gTestRoute.Dst, Table: 200, Rule: &Rule{Mark: 0x10, Goto: 32000}}
+
+	lookupRule, jumpRule := lookup.toNetLinkRule(), jump.toNetLinkRule()
+
+	if lookupRule.Family != netlink.FAMILY_V4 || lookupRule.Table != 200 || lookupRule.SuppressPrefixlen != 0 || lookupRule.Goto != -1 {
+		t.Errorf("Rule with suppress prefix length not match: %+v", lookupRule)
+	}
+	if jumpRule.Table != 0 || jumpRule.Goto != 32000 || jumpRule.SuppressPrefixlen != -1 || jumpRule.Mark != 0x10 {
+		t.Errorf("Rule with goto not match: %+v", jumpRule)
+	}
+}
+
+func newTestRoutes() map[string]Route {
+	routes := make(map[string]Route)
+	for i, name := range []string{"a", "b", "c"} {
+		routes[name] = Route{Dst: net.IPNet{IP: net.IP{192, 168, byte(i), 0}, Mask: net.CIDRMask(24, 32)}, Gw: net.IP{10, 0, 0, 1}, Table: 254}
+	}
+	return routes
+}
+
+func TestRegisterRoutesSuccess(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.start()
+
+	if err := testable.rm.RegisterRoutes(newTestRoutes()); err != nil {
+		t.Errorf("RegisterRoutes shall pass here: %s", err.Error())
+	}
+
+	testable.stop()
+	if len(testable.rm.(*routeManagerImpl).managedRoutes) != 3 {
+		t.Errorf("managedRoute slice must contain all the routes: %v", testable.rm.(*routeManagerImpl).managedRoutes)
+	}
+}
+
+func TestRegisterRoutesRollback(t *testing.T) {
+	testable := newTestableRouteManager()
+	routes := newTestRoutes()
+	routeA, routeB, routeC := routes["a"], routes["b"], routes["c"]
+	var deleted []*net.IPNet
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		switch route.Dst.String() {
+		case routeB.Dst.String():
+			return errors.New(syscall.EEXIST.Error())
+		case routeC.Dst.String():
+			return errors.New("bla")
+		}
+		return nil
+	}
+	testable.rm.(*routeManagerImpl).nlRouteDelFunc = func(route *netlink.Route) error {
+		deleted = append(deleted, route.Dst)
+		return nil
+	}
+	testable.start()
+	if err := testable.rm.RegisterRoute("already-registered", gTestRoute); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	routes["already-registered"] = gTestRoute
+
+	err := testable.rm.RegisterRoutes(routes)
+
+	testable.stop()
+	if err == nil {
+		t.Error("RegisterRoutes shall fail here")
+	}
+	if len(deleted) != 1 || deleted[0].String() != routeA.Dst.String() {
+		t.Errorf("Only the route created by the transaction must be removed: %v", deleted)
+	}
+	if len(testable.rm.(*routeManagerImpl).managedRoutes) != 1 || !testable.rm.IsRegistered("already-registered") {
+		t.Errorf("managedRoute slice must contain only the previously registered route: %v", testable.rm.(*routeManagerImpl).managedRoutes)
+	}
+}
+
+func TestApplyRoutes(t *testing.T) {
+	testable := newTestableRouteManager()
+	added := []string{}
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		added = append(added, route.Dst.String())
+		switch route.Dst.String() {
+		case "192.168.1.0/24":
+			return errors.New("bla")
+		case "192.168.2.0/24":
+			return errors.New(syscall.EEXIST.Error())
+		}
+		return nil
+	}
+	testable.start()
+	routes := newTestRoutes()
+	already := gTestRoute
+	already.Dst = net.IPNet{IP: net.IP{192, 168, 3, 0}, Mask: net.CIDRMask(24, 32)}
+	if err := testable.rm.RegisterRoute("already", already); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	routes["already"] = already
+
+	errs := testable.rm.ApplyRoutes(routes)
+
+	testable.stop()
+	if len(errs) != 1 || errs["b"] == nil {
+		t.Errorf("Only the failing route must be reported: %v", errs)
+	}
+	if !reflect.DeepEqual(added, []string{"192.168.3.0/24", "192.168.0.0/24", "192.168.1.0/24", "192.168.2.0/24"}) {
+		t.Errorf("Every unregistered route must be added once: %v", added)
+	}
+	managed := testable.rm.(*routeManagerImpl).managedRoutes
+	if _, found := managed["b"]; found || len(managed) != 3 {
+		t.Errorf("Created and adopted routes must be managed: %v", managed)
+	}
+}
+
+func TestVerifyRouteInPlace(t *testing.T) {
+	testable := newTestableRouteManager()
+	var listFilter netlink.Route
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		listFilter = *filter
+		kernelRoute := gTestRoute.toNetLinkRoute()
+		kernelRoute.LinkIndex = 2
+		kernelRoute.Protocol = 3
+		return []netlink.Route{kernelRoute}, nil
+	}
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		return nil
+	}
+	testable.start()
+	if err := testable.rm.RegisterRoute(gTestRouteName, gTestRoute); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		t.Error("Route in place must be not created again")
+		return nil
+	}
+
+	repair, err := testable.rm.VerifyRoute(gTestRouteName)
+
+	testable.stop()
+	if repair != RepairNone || err != nil {
+		t.Errorf("Route must be not repaired: %d %v", repair, err)
+	}
+	if listFilter.Dst.String() != gTestRoute.Dst.String() || listFilter.Table != gTestRoute.Table {
+		t.Errorf("Routes must be listed by destination and table: %v", listFilter)
+	}
+}
+
+func TestVerifyRouteRepairsMissingRoute(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.start()
+	if err := testable.rm.RegisterRoute(gTestRouteName, gTestRoute); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	var added *netlink.Route
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		added = route
+		return nil
+	}
+
+	repair, err := testable.rm.VerifyRoute(gTestRouteName)
+
+	testable.stop()
+	if repair != RepairRecreated || err != nil {
+		t.Errorf("Route must be repaired: %d %v", repair, err)
+	}
+	if added == nil || !added.Equal(gTestRoute.toNetLinkRoute()) {
+		t.Errorf("Route must be created again: %v", added)
+	}
+}
+
+func TestVerifyRouteMainTable(t *testing.T) {
+	testable := newTestableRouteManager()
+	route := gTestRoute
+	route.Table = 0
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		kernelRoute := route.toNetLinkRoute()
+		kernelRoute.Table = unix.RT_TABLE_MAIN
+		return []netlink.Route{kernelRoute}, nil
+	}
+	testable.start()
+	if err := testable.rm.RegisterRoute(gTestRouteName, route); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+
+	repair, err := testable.rm.VerifyRoute(gTestRouteName)
+
+	testable.stop()
+	if repair != RepairNone || err != nil {
+		t.Errorf("Route in the main table must be found: %d %v", repair, err)
+	}
+}
+
+func TestVerifyRouteTosIsPartOfTheKey(t *testing.T) {
+	testable := newTestableRouteManager()
+	route := gTestRoute
+	route.Tos = 0x10
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		return []netlink.Route{gTestRoute.toNetLinkRoute()}, nil
+	}
+	testable.start()
+	if err := testable.rm.RegisterRoute(gTestRouteName, route); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	var added *netlink.Route
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(nlRoute *netlink.Route) error {
+		added = nlRoute
+		return nil
+	}
+
+	repair, err := testable.rm.VerifyRoute(gTestRouteName)
+
+	testable.stop()
+	if repair != RepairRecreated || err != nil {
+		t.Errorf("Route with other tos must not satisfy the route: %d %v", repair, err)
+	}
+	if added == nil || added.Tos != 0x10 {
+		t.Errorf("Route must be created with its tos: %v", added)
+	}
+}
+
+func TestVerifyRouteIgnoresOtherMetrics(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).protocol = DefaultProtocol
+	route := gTestRoute
+	route.Metric = 101
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		preferred := gTestRoute.toNetLinkRoute()
+		preferred.Gw = net.IP{10, 0, 0, 254}
+		preferred.Priority = 100
+		preferred.Protocol = DefaultProtocol
+		return []netlink.Route{preferred, route.toNetLinkRoute()}, nil
+	}
+	testable.start()
+	if err := testable.rm.RegisterRoute(gTestRouteName, route); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	testable.rm.(*routeManagerImpl).nlRouteReplaceFunc = func(route *netlink.Route) error {
+		t.Error("Route of another metric must not be taken as drift")
+		return nil
+	}
+
+	repair, err := testable.rm.VerifyRoute(gTestRouteName)
+
+	testable.stop()
+	if repair != RepairNone || err != nil {
+		t.Errorf("Route must be found in place next to the route of another metric: %d %v", repair, err)
+	}
+}
+
+func TestFromNetLinkRouteMetric(t *testing.T) {
+	_, v6Dst, _ := net.ParseCIDR("fd00:1::/64")
+	var testData = []struct {
+		route  netlink.Route
+		metric int
+	}{
+		{netlink.Route{Dst: &gTestRoute.Dst, Priority: 100}, 100},
+		{netlink.Route{Dst: &gTestRoute.Dst, Priority: 1024}, 1024},
+		{netlink.Route{Dst: v6Dst, Priority: 1024}, 0},
+		{netlink.Route{Dst: v6Dst, Priority: 100}, 100},
+	}
+
+	for i, td := range testData {
+		if metric := fromNetLinkRoute(td.route).Metric; metric != td.metric {
+			t.Errorf("Metric must be %d, it is %d at %d", td.metric, metric, i)
+		}
+	}
+}
+
+func TestVerifyRouteRestoresDriftedGateway(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).protocol = DefaultProtocol
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		kernelRoute := gTestRoute.toNetLinkRoute()
+		kernelRoute.Gw = net.IP{10, 0, 0, 254}
+		kernelRoute.Protocol = DefaultProtocol
+		return []netlink.Route{kernelRoute}, nil
+	}
+	testable.start()
+	if err := testable.rm.RegisterRoute(gTestRouteName, gTestRoute); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		t.Error("Drifted route must be replaced instead of created")
+		return nil
+	}
+	var replaced *netlink.Route
+	testable.rm.(*routeManagerImpl).nlRouteReplaceFunc = func(route *netlink.Route) error {
+		replaced = route
+		return nil
+	}
+
+	repair, err := testable.rm.VerifyRoute(gTestRouteName)
+
+	testable.stop()
+	if repair != RepairGatewayRestored || err != nil {
+		t.Errorf("Gateway must be restored: %d %v", repair, err)
+	}
+	if replaced == nil || !replaced.Gw.Equal(gTestRoute.Gw) || replaced.Protocol != DefaultProtocol {
+		t.Errorf("Route must be replaced with the registered gateway and our protocol: %v", replaced)
+	}
+}
+
+func TestVerifyRouteDriftCorrectionIsRateLimited(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).options.DriftCorrectionInterval = time.Minute
+	now := time.Now()
+	testable.rm.(*routeManagerImpl).now = func() time.Time {
+		return now
+	}
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		kernelRoute := gTestRoute.toNetLinkRoute()
+		kernelRoute.Gw = net.IP{10, 0, 0, 254}
+		return []netlink.Route{kernelRoute}, nil
+	}
+	replaced := 0
+	testable.rm.(*routeManagerImpl).nlRouteReplaceFunc = func(route *netlink.Route) error {
+		replaced++
+		return nil
+	}
+	testable.start()
+	if err := testable.rm.RegisterRoute(gTestRouteName, gTestRoute); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	if repair, err := testable.rm.VerifyRoute(gTestRouteName); repair != RepairGatewayRestored || err != nil {
+		t.Errorf("First drift must be corrected: %d %v", repair, err)
+	}
+
+	repair, err := testable.rm.VerifyRoute(gTestRouteName)
+
+	testable.stop()
+	if repair != RepairNone || err != nil {
+		t.Errorf("Drift within the interval must not be corrected: %d %v", repair, err)
+	}
+	if replaced != 1 {
+		t.Errorf("Route must be replaced only once: %d", replaced)
+	}
+}
+
+func TestVerifyRouteDoesNotReplaceForeignMainTableRoute(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).protocol = DefaultProtocol
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		kernelRoute := gTestRoute.toNetLinkRoute()
+		kernelRoute.Gw = net.IP{10, 0, 0, 254}
+		kernelRoute.Protocol = unix.RTPROT_BOOT
+		return []netlink.Route{kernelRoute}, nil
+	}
+	testable.rm.(*routeManagerImpl).nlRouteReplaceFunc = func(route *netlink.Route) error {
+		t.Error("Foreign route of the main table must be not replaced")
+		return nil
+	}
+	testable.start()
+	if err := testable.rm.RegisterRoute(gTestRouteName, gTestRoute); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+
+	repair, err := testable.rm.VerifyRoute(gTestRouteName)
+
+	testable.stop()
+	if repair != RepairRecreated || err != nil {
+		t.Errorf("Own route must be created next to the foreign one: %d %v", repair, err)
+	}
+}
+
+func TestRouteTosIsPartOfTheKey(t *testing.T) {
+	route := gTestRoute
+	route.Tos = 0x10
+
+	if route.equal(gTestRoute) {
+		t.Error("Routes differing by tos must be distinct")
+	}
+	if nlRoute := route.toNetLinkRoute(); nlRoute.Tos != 0x10 || !fromNetLinkRoute(nlRoute).equal(route) {
+		t.Errorf("Tos must be converted: %v", nlRoute)
+	}
+}
+
+func TestWatchDelRouteWithOtherTosDoesNotTrigger(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.start()
+	mockWatcher := MockRouteWatcher{routeDeletedCalledWith: make(chan Route)}
+	if err := testable.rm.RegisterRoute(gTestRouteName, gTestRoute); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	testable.rm.RegisterWatcher(mockWatcher)
+	otherTos := gTestRoute.toNetLinkRoute()
+	otherTos.Tos = 0x10
+
+	gMockUpdateChan <- netlink.RouteUpdate{Type: unix.RTM_DELROUTE, Route: otherTos}
+
+	testable.stop()
+	select {
+	case <-mockWatcher.routeDeletedCalledWith:
+		t.Error("Mock must not be triggered with a route of other tos")
+	default:
+	}
+}
+
+func TestVerifyRouteListFails(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		return nil, errors.New("bla")
+	}
+	testable.start()
+	if err := testable.rm.RegisterRoute(gTestRouteName, gTestRoute); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+
+	_, err := testable.rm.VerifyRoute(gTestRouteName)
+
+	testable.stop()
+	if err == nil {
+		t.Error("VerifyRoute shall fail here")
+	}
+}
+
+func TestVerifyRouteWhichIsNotRegistered(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.start()
+
+	_, err := testable.rm.VerifyRoute(gTestRouteName)
+
+	testable.stop()
+	if err != ErrNotFound {
+		t.Error("Verification shall fail due to asking for a non-managed route")
+	}
+}
+
+func TestRegisterRouteTagsProtocol(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).protocol = DefaultProtocol
+	var added *netlink.Route
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		added = route
+		return nil
+	}
+	testable.start()
+
+	err := testable.rm.RegisterRoute(gTestRouteName, gTestRoute)
+
+	testable.stop()
+	if err != nil {
+		t.Errorf("RegisterRoute shall pass here: %s", err.Error())
+	}
+	if added == nil || added.Protocol != DefaultProtocol {
+		t.Errorf("Route must be tagged with our protocol: %v", added)
+	}
+}
+
+func TestFlushTable(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).protocol = DefaultProtocol
+	testable.start()
+	routes := newTestRoutes()
+	for name, route := range routes {
+		route.Table = 100
+		routes[name] = route
+	}
+	other := gTestRoute
+	routes["other"] = other
+	if err := testable.rm.RegisterRoutes(routes); err != nil {
+		t.Errorf("RegisterRoutes shall pass here: %s", err.Error())
+	}
+	var listFilter netlink.Route
+	var listMask uint64
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		listFilter, listMask = *filter, filterMask
+		ours := routes["a"].toNetLinkRoute()
+		ours.Protocol = DefaultProtocol
+		stale := Route{Dst: net.IPNet{IP: net.IP{192, 168, 9, 0}, Mask: net.CIDRMask(24, 32)}, Table: 100}.toNetLinkRoute()
+		stale.Protocol = DefaultProtocol
+		foreign := Route{Dst: net.IPNet{IP: net.IP{192, 168, 8, 0}, Mask: net.CIDRMask(24, 32)}, Table: 100}.toNetLinkRoute()
+		foreign.Protocol = unix.RTPROT_BOOT
+		return []netlink.Route{ours, stale, foreign}, nil
+	}
+	deleted := []string{}
+	testable.rm.(*routeManagerImpl).nlRouteDelFunc = func(route *netlink.Route) error {
+		deleted = append(deleted, route.Dst.String())
+		return nil
+	}
+	added := []string{}
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		added = append(added, route.Dst.String())
+		return nil
+	}
+
+	flushed, err := testable.rm.FlushTable(100)
+
+	testable.stop()
+	if err != nil {
+		t.Errorf("FlushTable shall pass here: %s", err.Error())
+	}
+	if flushed != 2 || !reflect.DeepEqual(deleted, []string{"192.168.0.0/24", "192.168.9.0/24"}) {
+		t.Errorf("Only our routes must be flushed: %d %v", flushed, deleted)
+	}
+	if !reflect.DeepEqual(added, []string{"192.168.0.0/24", "192.168.1.0/24", "192.168.2.0/24"}) {
+		t.Errorf("Managed routes of the table must be reinstalled: %v", added)
+	}
+	if listFilter.Table != 100 || listFilter.Protocol != DefaultProtocol || listMask != netlink.RT_FILTER_TABLE|netlink.RT_FILTER_PROTOCOL {
+		t.Errorf("Routes must be listed by table and protocol: %v %d", listFilter, listMask)
+	}
+}
+
+func TestFlushTableProtected(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		t.Error("Protected table must be not listed")
+		return nil, nil
+	}
+	testable.start()
+
+	for _, table := range []int{0, unix.RT_TABLE_MAIN, unix.RT_TABLE_LOCAL, unix.RT_TABLE_DEFAULT} {
+		if _, err := testable.rm.FlushTable(table); err != ErrTableProtected {
+			t.Errorf("Table %d must be protected: %v", table, err)
+		}
+	}
+
+	testable.stop()
+}
+
+func TestFlushTableReinstallFails(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.start()
+	route := gTestRoute
+	route.Table = 100
+	if err := testable.rm.RegisterRoute(gTestRouteName, route); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	testable.rm.(*routeManagerImpl).nlRouteAddFunc = func(route *netlink.Route) error {
+		return errors.New("bla")
+	}
+
+	_, err := testable.rm.FlushTable(100)
+
+	testable.stop()
+	if err == nil {
+		t.Error("FlushTable shall fail here")
+	}
+}
+
+func TestEnsureAbsent(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.start()
+	managed := gTestRoute
+	managed.Gw = net.IP{10, 0, 0, 1}
+	if err := testable.rm.RegisterRoute(gTestRouteName, managed); err != nil {
+		t.Error("RegisterRoute shall pass here")
+	}
+	var listFilter netlink.Route
+	var listMask uint64
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		listFilter, listMask = *filter, filterMask
+		foreign := gTestRoute.toNetLinkRoute()
+		foreign.Protocol = unix.RTPROT_BOOT
+		other := gTestRoute.toNetLinkRoute()
+		other.Dst = &net.IPNet{IP: net.IP{192, 168, 2, 0}, Mask: net.CIDRMask(24, 32)}
+		return []netlink.Route{foreign, managed.toNetLinkRoute(), other}, nil
+	}
+	deleted := []*netlink.Route{}
+	testable.rm.(*routeManagerImpl).nlRouteDelFunc = func(route *netlink.Route) error {
+		deleted = append(deleted, route)
+		return nil
+	}
+	absent := gTestRoute
+	absent.Gw = nil
+
+	removed, err := testable.rm.EnsureAbsent(absent)
+
+	testable.stop()
+	if err != nil {
+		t.Errorf("EnsureAbsent shall pass here: %s", err.Error())
+	}
+	if removed != 1 || len(deleted) != 1 || !deleted[0].Gw.Equal(gTestRoute.Gw) {
+		t.Errorf("Only the foreign route must be removed: %d %v", removed, deleted)
+	}
+	if listFilter.Dst.String() != gTestRoute.Dst.String() || listFilter.Table != gTestRoute.Table || listMask != netlink.RT_FILTER_DST|netlink.RT_FILTER_TABLE {
+		t.Errorf("Routes must be listed by destination and table: %v %d", listFilter, listMask)
+	}
+}
+
+func TestEnsureAbsentByGateway(t *testing.T) {
+	testable := newTestableRouteManager()
+	var listMask uint64
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		listMask = filterMask
+		otherGw := gTestRoute.toNetLinkRoute()
+		otherGw.Gw = net.IP{10, 0, 0, 2}
+		return []netlink.Route{gTestRoute.toNetLinkRoute(), otherGw}, nil
+	}
+	testable.start()
+
+	removed, err := testable.rm.EnsureAbsent(gTestRoute)
+
+	testable.stop()
+	if err != nil || removed != 1 {
+		t.Errorf("Only the route through the gateway must be removed: %d %v", removed, err)
+	}
+	if listMask&netlink.RT_FILTER_GW == 0 {
+		t.Error("Routes must be filtered by gateway")
+	}
+}
+
+func TestEnsureAbsentFails(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		return []netlink.Route{gTestRoute.toNetLinkRoute()}, nil
+	}
+	testable.rm.(*routeManagerImpl).nlRouteDelFunc = func(route *netlink.Route) error {
+		return errors.New("bla")
+	}
+	testable.start()
+
+	_, err := testable.rm.EnsureAbsent(gTestRoute)
+
+	testable.stop()
+	if err == nil {
+		t.Error("EnsureAbsent shall fail here")
+	}
+}
+
+func TestListRoutes(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).protocol = DefaultProtocol
+	var listFilter netlink.Route
+	var listMask uint64
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		listFilter, listMask = *filter, filterMask
+		ours := gTestRoute.toNetLinkRoute()
+		ours.Protocol = DefaultProtocol
+		otherTable := ours
+		otherTable.Table = 100
+		foreign := gTestRoute.toNetLinkRoute()
+		foreign.Protocol = unix.RTPROT_BOOT
+		return []netlink.Route{ours, foreign, otherTable}, nil
+	}
+	testable.start()
+
+	routes, err := testable.rm.ListRoutes()
+
+	testable.stop()
+	if err != nil {
+		t.Errorf("ListRoutes shall pass here: %s", err.Error())
+	}
+	if len(routes) != 2 || routes[0].Table != 100 || routes[1].Table != 254 {
+		t.Errorf("Only our routes must be listed ordered by table: %v", routes)
+	}
+	if listFilter.Protocol != DefaultProtocol || listFilter.Table != 0 || listMask != netlink.RT_FILTER_TABLE|netlink.RT_FILTER_PROTOCOL {
+		t.Errorf("Routes must be listed by protocol in every table: %v %d", listFilter, listMask)
+	}
+}
+
+func TestListRoutesFails(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.rm.(*routeManagerImpl).nlRouteListFunc = func(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+		return nil, errors.New("bla")
+	}
+	testable.start()
+
+	_, err := testable.rm.ListRoutes()
+
+	testable.stop()
+	if err == nil {
+		t.Error("ListRoutes shall fail here")
+	}
+}
+
+/* fakeKernel keeps the routes of more RouteManagers, the deletion matches the protocol if given like the kernel does.
+   The exclusive one refuses a second route to the same destination, table and tos with EEXIST, which is replaced in place instead. */
+type fakeKernel struct {
+	mutex     sync.Mutex
+	routes    []netlink.Route
+	exclusive bool
+	deleted   int
+}
+
+func (k *fakeKernel) add(route *netlink.Route) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if k.exclusive && k.find(route) >= 0 {
+		return errors.New(syscall.EEXIST.Error())
+	}
+	k.routes = append(k.routes, *route)
+	return nil
+}
+
+func (k *fakeKernel) replace(route *netlink.Route) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if i := k.find(route); i >= 0 {
+		k.routes[i] = *route
+		return nil
+	}
+	k.routes = append(k.routes, *route)
+	return nil
+}
+
+func (k *fakeKernel) find(route *netlink.Route) int {
+	for i, kernelRoute := range k.routes {
+		if kernelRoute.Dst.String() == route.Dst.String() && kernelRoute.Table == route.Table && kernelRoute.Tos == route.Tos {
+			return i
+		}
+	}
+	return -1
+}
+
+func (k *fakeKernel) del(route *netlink.Route) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	for i, kernelRoute := range k.routes {
+		if kernelRoute.Dst.String() == route.Dst.String() && kernelRoute.Table == route.Table && (route.Protocol == 0 || route.Protocol == kernelRoute.Protocol) {
+			k.routes = append(k.routes[:i], k.routes[i+1:]...)
+			k.deleted++
+			return nil
+		}
+	}
+	return errors.New(syscall.ESRCH.Error())
+}
+
+func (k *fakeKernel) list(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return append([]netlink.Route{}, k.routes...), nil
+}
+
+func asInstance(testable *testableRouteManager, kernel *fakeKernel, protocol int) {
+	rm := testable.rm.(*routeManagerImpl)
+	rm.protocol = protocol
+	rm.nlRouteSubscribeFunc = func(chan<- netlink.RouteUpdate, <-chan struct{}) error { return nil }
+	rm.nlLinkSubscribeFunc = func(chan<- netlink.LinkUpdate, <-chan struct{}) error { return nil }
+	rm.nlRouteAddFunc = kernel.add
+	rm.nlRouteDelFunc = kernel.del
+	rm.nlRouteReplaceFunc = kernel.replace
+	rm.nlRouteListFunc = kernel.list
+}
+
+func TestInstancesDoNotTouchRoutesOfEachOther(t *testing.T) {
+	kernel := &fakeKernel{}
+	first, second := newTestableRouteManager(), newTestableRouteManager()
+	asInstance(&first, kernel, DefaultProtocol)
+	asInstance(&second, kernel, DefaultProtocol+1)
+	first.start()
+	second.start()
+	route := gTestRoute
+	route.Table = 100
+	other := route
+	other.Dst = net.IPNet{IP: net.IP{192, 168, 2, 0}, Mask: net.CIDRMask(24, 32)}
+	if err := first.rm.RegisterRoute("first", route); err != nil {
+		t.Errorf("RegisterRoute shall pass here: %s", err.Error())
+	}
+	if err := second.rm.RegisterRoutes(map[string]Route{"second": route, "other": other}); err != nil {
+		t.Errorf("RegisterRoutes shall pass here: %s", err.Error())
+	}
+
+	if routes, _ := first.rm.ListRoutes(); len(routes) != 1 {
+		t.Errorf("Only the own routes must be listed: %v", routes)
+	}
+	if flushed, _ := first.rm.FlushTable(100); flushed != 1 {
+		t.Errorf("Only the own routes must be flushed: %d", flushed)
+	}
+	if removed, _ := first.rm.EnsureAbsent(other); removed != 0 {
+		t.Error("Routes of the other instance must be not removed as absent")
+	}
+	if err := first.rm.DeRegisterRoute("first"); err != nil {
+		t.Errorf("DeRegisterRoute shall pass here: %s", err.Error())
+	}
+
+	routes, _ := second.rm.ListRoutes()
+	first.stop()
+	second.stop()
+	if len(routes) != 2 || len(kernel.routes) != 2 {
+		t.Errorf("Routes of the second instance must be kept: %v", kernel.routes)
+	}
+}
+
+func TestForeignMainTableRoutesAreNeverDeleted(t *testing.T) {
+	kernel := &fakeKernel{}
+	foreign := netlink.Route{Dst: &gTestRoute.Dst, Gw: net.IP{10, 0, 0, 254}, Table: unix.RT_TABLE_MAIN, Protocol: unix.RTPROT_BOOT}
+	connected := netlink.Route{Dst: &net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(24, 32)}, Table: unix.RT_TABLE_MAIN, Protocol: unix.RTPROT_KERNEL}
+	kernel.routes = []netlink.Route{foreign, connected}
+	testable := newTestableRouteManager()
+	asInstance(&testable, kernel, DefaultProtocol)
+	testable.start()
+	if err := testable.rm.RegisterRoutes(map[string]Route{"own": gTestRoute}); err != nil {
+		t.Errorf("RegisterRoutes shall pass here: %s", err.Error())
+	}
+
+	if routes, _ := testable.rm.ListRoutes(); len(routes) != 1 {
+		t.Errorf("Only the own routes of the main table must be listed: %v", routes)
+	}
+	if _, err := testable.rm.FlushTable(unix.RT_TABLE_MAIN); err != ErrTableProtected {
+		t.Errorf("Main table must be not flushed: %v", err)
+	}
+	if err := testable.rm.DeRegisterRoute("own"); err != nil {
+		t.Errorf("DeRegisterRoute shall pass here: %s", err.Error())
+	}
+	err := testable.rm.DeRegisterRoute("own")
+
+	testable.stop()
+	if err != ErrNotFound {
+		t.Errorf("Route must be deregistered: %v", err)
+	}
+	if len(kernel.routes) != 2 || kernel.routes[0].Protocol != unix.RTPROT_BOOT || kernel.routes[1].Protocol != unix.RTPROT_KERNEL {
+		t.Errorf("Foreign routes of the main table must be kept: %v", kernel.routes)
+	}
+}
+
+func TestUpgradeAdoptsRoutesOfPreviousVersion(t *testing.T) {
+	kernel := &fakeKernel{exclusive: true}
+	route := gTestRoute
+	route.Table = 100
+	other := route
+	other.Dst = net.IPNet{IP: net.IP{192, 168, 2, 0}, Mask: net.CIDRMask(24, 32)}
+	applied := route
+	applied.Dst = net.IPNet{IP: net.IP{192, 168, 3, 0}, Mask: net.CIDRMask(24, 32)}
+	for _, old := range []Route{route, other, applied} {
+		nlRoute := old.toNetLinkRoute()
+		nlRoute.Protocol = DefaultProtocol
+		kernel.routes = append(kernel.routes, nlRoute)
+	}
+	testable := newTestableRouteManager()
+	asInstance(&testable, kernel, DefaultProtocol+1)
+	testable.rm.(*routeManagerImpl).options.AdoptProtocols = []int{DefaultProtocol}
+	testable.start()
+
+	if err := testable.rm.RegisterRoute("route", route); err != nil {
+		t.Errorf("RegisterRoute shall pass here: %s", err.Error())
+	}
+	if err := testable.rm.RegisterRoutes(map[string]Route{"other": other}); err != nil {
+		t.Errorf("RegisterRoutes shall pass here: %s", err.Error())
+	}
+	if errs := testable.rm.ApplyRoutes(map[string]Route{"applied": applied}); len(errs) != 0 {
+		t.Errorf("ApplyRoutes shall pass here: %v", errs)
+	}
+	routes, _ := testable.rm.ListRoutes()
+
+	testable.stop()
+	if kernel.deleted != 0 || len(kernel.routes) != 3 {
+		t.Errorf("Routes of the previous version must be not deleted: %d %v", kernel.deleted, kernel.routes)
+	}
+	for _, kernelRoute := range kernel.routes {
+		if kernelRoute.Protocol != DefaultProtocol+1 {
+			t.Errorf("Route must be tagged with the new protocol: %v", kernelRoute)
+		}
+	}
+	if len(routes) != 3 {
+		t.Errorf("Adopted routes must be listed as own: %v", routes)
+	}
+}
+
+func TestUpgradeDoesNotAdoptOtherProtocols(t *testing.T) {
+	kernel := &fakeKernel{exclusive: true}
+	route := gTestRoute
+	route.Table = 100
+	foreign := route.toNetLinkRoute()
+	foreign.Protocol = DefaultProtocol + 2
+	kernel.routes = []netlink.Route{foreign}
+	testable := newTestableRouteManager()
+	asInstance(&testable, kernel, DefaultProtocol+1)
+	testable.rm.(*routeManagerImpl).options.AdoptProtocols = []int{DefaultProtocol}
+	testable.start()
+
+	err := testable.rm.RegisterRoute("route", route)
+
+	testable.stop()
+	if err != nil {
+		t.Errorf("RegisterRoute shall pass here: %s", err.Error())
+	}
+	if len(kernel.routes) != 1 || kernel.routes[0].Protocol != DefaultProtocol+2 {
+		t.Errorf("Route of another protocol must be kept untouched: %v", kernel.routes)
+	}
+}
+
+func TestUpgradeAdoptsReportedRoutesOfReleasedVersion(t *testing.T) {
+	kernel := &fakeKernel{exclusive: true}
+	route := gTestRoute
+	other := route
+	other.Dst = net.IPNet{IP: net.IP{192, 168, 2, 0}, Mask: net.CIDRMask(24, 32)}
+	for _, released := range []Route{route, other} {
+		dst := released.Dst
+		kernel.routes = append(kernel.routes, netlink.Route{Dst: &dst, Gw: released.Gw, Table: unix.RT_TABLE_MAIN, Protocol: unix.RTPROT_BOOT})
+	}
+	testable := newTestableRouteManager()
+	asInstance(&testable, kernel, DefaultProtocol)
+	testable.start()
+
+	if errs := testable.rm.ApplyRoutes(map[string]Route{"route": route, "other": other}); len(errs) != 0 {
+		t.Errorf("ApplyRoutes shall pass here: %v", errs)
+	}
+	if err := testable.rm.DeRegisterRoute("other"); err != nil {
+		t.Errorf("DeRegisterRoute shall pass here: %s", err.Error())
+	}
+
+	testable.stop()
+	if len(kernel.routes) != 1 || kernel.routes[0].Protocol != DefaultProtocol || kernel.routes[0].Dst.String() != route.Dst.String() {
+		t.Errorf("Reported route must be tagged with our protocol and the deregistered one deleted: %v", kernel.routes)
+	}
+}
+
+func TestUpgradeDoesNotAdoptForeignBootRoute(t *testing.T) {
+	kernel := &fakeKernel{exclusive: true}
+	adminGw := net.IP{10, 0, 0, 99}
+	admin := netlink.Route{Dst: &gTestRoute.Dst, Gw: adminGw, Table: unix.RT_TABLE_MAIN, Protocol: unix.RTPROT_BOOT}
+	kernel.routes = []netlink.Route{admin}
+	testable := newTestableRouteManager()
+	asInstance(&testable, kernel, DefaultProtocol)
+	testable.rm.(*routeManagerImpl).options.AdoptProtocols = []int{DefaultProtocol + 1}
+	testable.start()
+
+	if err := testable.rm.RegisterRoute("route", gTestRoute); err != nil {
+		t.Errorf("RegisterRoute shall pass here: %s", err.Error())
+	}
+	if err := testable.rm.DeRegisterRoute("route"); err != nil {
+		t.Errorf("DeRegisterRoute shall pass here: %s", err.Error())
+	}
+	if errs := testable.rm.ApplyRoutes(map[string]Route{"route": gTestRoute}); len(errs) != 0 {
+		t.Errorf("ApplyRoutes shall pass here: %v", errs)
+	}
+	if err := testable.rm.DeRegisterRoute("route"); err != nil {
+		t.Errorf("DeRegisterRoute shall pass here: %s", err.Error())
+	}
+
+	testable.stop()
+	if len(kernel.routes) != 1 || kernel.routes[0].Protocol != unix.RTPROT_BOOT || !kernel.routes[0].Gw.Equal(adminGw) {
+		t.Errorf("Foreign route of the main table must be kept untouched: %v", kernel.routes)
+	}
+}
+
+func TestUpgradeAdoptionFails(t *testing.T) {
+	kernel := &fakeKernel{exclusive: true}
+	old := gTestRoute.toNetLinkRoute()
+	old.Table = unix.RT_TABLE_MAIN
+	old.Protocol = DefaultProtocol
+	kernel.routes = []netlink.Route{old}
+	testable := newTestableRouteManager()
+	asInstance(&testable, kernel, DefaultProtocol+1)
+	rm := testable.rm.(*routeManagerImpl)
+	rm.options.AdoptProtocols = []int{DefaultProtocol}
+	rm.nlRouteReplaceFunc = func(*netlink.Route) error {
+		return errors.New("bla")
+	}
+	testable.start()
+
+	err := testable.rm.RegisterRoute("route", gTestRoute)
+
+	testable.stop()
+	if err == nil || err.Error() != "Unable to adopt route: bla" {
+		t.Errorf("RegisterRoute shall fail here: %v", err)
+	}
+	if testable.rm.IsRegistered("route") {
+		t.Error("Route must be not registered")
+	}
+}
+
+func TestConcurrentCallersOfDistinctRoutes(t *testing.T) {
+	testable := newTestableRouteManager()
+	testable.start()
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("route-%d", i)
+			route := Route{Dst: net.IPNet{IP: net.IP{10, 1, byte(i), 0}, Mask: net.CIDRMask(24, 32)}, Gw: net.IP{10, 0, 0, 1}}
+			for j := 0; j < 10; j++ {
+				if testable.rm.IsRegistered(name) {
+					t.Errorf("Route %s must be not registered yet", name)
+				}
+				if err := testable.rm.RegisterRoute(name, route); err != nil {
+					t.Errorf("RegisterRoute shall pass here: %s", err.Error())
+				}
+				if !testable.rm.IsRegistered(name) {
+					t.Errorf("Route %s must be registered", name)
+				}
+				if i%2 == 0 || j < 9 {
+					if err := testable.rm.DeRegisterRoute(name); err != nil {
+						t.Errorf("DeRegisterRoute shall pass here: %s", err.Error())
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	testable.stop()
+	if managed := testable.rm.(*routeManagerImpl).managedRoutes; len(managed) != 8 {
+		t.Errorf("Only the routes kept by odd callers must be managed: %v", managed)
+	}
+}
+
+func TestRouteString(t *testing.T) {
+	route := gTestRoute
+	route.Src = net.IP{192, 168, 1, 10}
+	route.Tos = 0x10
+	route.Metric = 100
+
+	if s := route.String(); s != "192.168.1.0/24 via 192.168.1.254 src 192.168.1.10 table 254 tos 0x10 metric 100" {
+		t.Errorf("Route must be formatted like iproute2: %s", s)
+	}
+}
@@ -18,28 +18,174 @@ package routemanager
 
 import (
 	"net"
+	"time"
+
+	"github.com/vishvananda/netlink"
 )
 
 //Route structure represents just-enough data to manage IP routes from user code
 type Route struct {
 	Dst   net.IPNet
 	Gw    net.IP
+	Src   net.IP
 	Table int
+	Tos   int
+	Rule  *Rule
+	//Vrf name of the VRF device, the route is created in the table of the VRF instead of Table
+	Vrf string
+	//HealthCheck verifies the data plane of the route after it is created and periodically, not probed if nil
+	HealthCheck *HealthCheck
+	//Weight the weight of the gateway as a nexthop of a merged multipath route between 1 and MaxWeight, 1 if not set
+	Weight int
+	//Device name of the interface the route without gateway goes through, ie. of a link-local or loopback destination
+	Device string
+	//Metric the priority of the route, the kernel prefers the lowest one among the routes of the same destination, table and tos
+	Metric int
+
+	// Resolved from Device when the route is registered, or read from the kernel
+	linkIndex int
+	scope     netlink.Scope
+}
+
+//Nexthop is a gateway of a merged multipath route with its effective weight
+type Nexthop struct {
+	Gw     net.IP
+	Weight int
+}
+
+//MaxWeight is the highest weight of a nexthop the kernel takes
+const MaxWeight = 256
+
+const (
+	//ECMPRebalanceNone keeps the weights of the nexthops regardless of their health
+	ECMPRebalanceNone = ""
+	//ECMPRebalanceDrain removes the degraded nexthops from the merged multipath route while a healthy one is left
+	ECMPRebalanceDrain = "drain"
+	//ECMPRebalanceScale lowers the weight of the degraded nexthops to ECMPDegradedWeightPercent of their weight
+	ECMPRebalanceScale = "scale"
+)
+
+//HealthCheck is the probe of a route. The route is reported as degraded while the probe fails.
+type HealthCheck struct {
+	//TCP the address in the form of host:port which is dialed, an ICMP echo is sent to the gateway of the route if not set
+	TCP string
+	//Interval the time between two probes, DefaultHealthCheckInterval if not set
+	Interval time.Duration
+	//Timeout the upper limit of a probe, DefaultHealthCheckTimeout if not set
+	Timeout time.Duration
 }
 
+//DefaultHealthCheckInterval is the time between two probes of a route if the health check does not give it
+const DefaultHealthCheckInterval = 30 * time.Second
+
+//DefaultHealthCheckTimeout is the upper limit of a probe if the health check does not give it
+const DefaultHealthCheckTimeout = time.Second
+
+//Rule is an IP policy rule which selects the table of the route by the firewall mark of the packets. It is created and removed together with its route.
+type Rule struct {
+	Mark uint32
+	//SuppressPrefixlen rejects the routes of the table with this prefix length or shorter, not set if nil
+	SuppressPrefixlen *int
+	//Goto jumps to the rule of this priority instead of looking up the table of the route, not set if 0
+	Goto int
+}
+
+//DefaultProtocol is the routing protocol number the routes created by the RouteManager are tagged with. It tells our routes apart from the foreign ones.
+const DefaultProtocol = 196
+
+//MaxProtocol is the highest routing protocol number. The protocols from DefaultProtocol up to it are reserved for the instances of the operator.
+const MaxProtocol = 255
+
+//MaxTable is the highest routing table id. The ids above 255 are given to the kernel in the 32 bit table attribute of the route, for both families.
+const MaxTable = 1<<32 - 1
+
+//Options contains the tunables of the RouteManager
+type Options struct {
+	//Protocol the routing protocol number the routes are tagged with, DefaultProtocol if not set. Instances sharing a node must use distinct ones, so they never touch the routes of each other.
+	Protocol int
+	//ProbeInterval the interval of checking the gateways of the managed routes in the neighbor table, 0 disables the probe
+	ProbeInterval time.Duration
+	//DegradedAfter the time a gateway has to be unreachable continuously before it is reported as degraded
+	DegradedAfter time.Duration
+	//RecoveredAfter the time a degraded gateway has to be reachable continuously before it is reported as recovered
+	RecoveredAfter time.Duration
+	//DriftCorrectionInterval the minimum time between two corrections of the gateway of the same route, 0 corrects at every verification
+	DriftCorrectionInterval time.Duration
+	//NetlinkTimeout the upper limit of a single netlink call, the call returns ErrNetlinkTimeout when it expires. 0 waits for the kernel forever.
+	NetlinkTimeout time.Duration
+	//AdoptProtocols the protocols of the previous versions of the operator. An existing route with one of them is tagged with Protocol in place when it is registered, instead of being left behind with the old protocol.
+	//Untagged routes are adopted only by ApplyRoutes, if the gateway is the same.
+	AdoptProtocols []int
+	//ECMPMerge merges the routes of different names to the same destination, table and tos into a single multipath route, with a nexthop per distinct gateway. Without it the routes conflict in the kernel.
+	ECMPMerge bool
+	//ECMPRebalance the policy of shifting the traffic of a merged multipath route from the degraded nexthops to the healthy ones, one of the ECMPRebalance constants
+	ECMPRebalance string
+	//ECMPDegradedWeightPercent the percentage of its weight a degraded nexthop keeps with ECMPRebalanceScale, the weight is at least 1
+	ECMPDegradedWeightPercent int
+	//APIServerIPs returns the current addresses of the apiserver, the routes the node reaches them through are never deleted nor replaced with another gateway, ErrAPIServerRoute is returned instead. Nil turns the protection off.
+	APIServerIPs func() []net.IP
+}
+
+//Repair tells what VerifyRoute did to the route in the kernel
+type Repair int
+
+const (
+	//RepairNone the route was found in place
+	RepairNone Repair = iota
+	//RepairRecreated the route was missing, it was created again
+	RepairRecreated
+	//RepairGatewayRestored the gateway of the route was changed behind our back, the route got replaced with the registered one
+	RepairGatewayRestored
+)
+
 //RouteWatcher is a user-implemented interface, where RouteManager will call back if a managed route is damaged
 type RouteWatcher interface {
 	RouteDeleted(Route)
 }
 
+//LinkWatcher can be implemented by a RouteWatcher in addition, RouteManager will call it back when a link asked by IsLinkUp goes up or down. It is called from the event loop of the RouteManager, so it must not call the RouteManager.
+type LinkWatcher interface {
+	LinkStateChanged(name string, up bool)
+}
+
+//GatewayWatcher can be implemented by a RouteWatcher in addition, RouteManager will call it back with the name of every managed route whose gateway got degraded or recovered. It is called from the event loop of the RouteManager, so it must not call the RouteManager.
+type GatewayWatcher interface {
+	GatewayStateChanged(name string, degraded bool)
+}
+
+//DefaultRouteWatcher can be implemented by a RouteWatcher in addition, RouteManager will call it back when a foreign default route of the main table is added, replaced or deleted. It is called from the event loop of the RouteManager, so it must not call the RouteManager.
+type DefaultRouteWatcher interface {
+	DefaultRouteChanged()
+}
+
 //RouteManager is the main interface, which is implemented by the package
 type RouteManager interface {
 	//IsRegistered returns true if a Route (by it's name) is already managed
 	IsRegistered(string) bool
-	//RegisterRoute creates and start watching the route. If the route is deleted after the registration, RouteWatchers will be notified.
+	//RegisterRoute creates and start watching the route. If the route has a rule, it is created before the route and removed if the route fails. The route of a VRF goes to the table of the VRF device, ErrVrfNotFound is returned if the device is missing. The health check of the route is probed before it returns. If the route is deleted after the registration, RouteWatchers will be notified.
 	RegisterRoute(string, Route) error
-	//DeRegisterRoute removed the route from the kernel and also stop watching it.
+	//RegisterRoutes creates the routes as a unit. Already registered routes are untouched. If any of them fails, the ones created by this call are removed.
+	RegisterRoutes(map[string]Route) error
+	//ApplyRoutes creates many routes at once, ie. on startup. Unlike RegisterRoutes, the routes are independent: the failing ones are returned by their name, the others are created. Already registered routes are untouched.
+	ApplyRoutes(map[string]Route) map[string]error
+	//DeRegisterRoute removed the route and its rule from the kernel and also stop watching it. A rule shared with another managed route stays. A merged multipath route only loses the nexthop of the name.
 	DeRegisterRoute(string) error
+	//VerifyRoute reads back the route from the kernel and creates it again if it is missing, or replaces it if its gateway was changed. Returns what was repaired.
+	VerifyRoute(string) (Repair, error)
+	//FlushTable removes every route of our protocol from the given table and creates the managed ones again. Returns the number of removed routes. Foreign routes are never touched, and the main, local and default tables are refused.
+	FlushTable(int) (int, error)
+	//EnsureAbsent removes every route of the table to the destination of the given route, regardless of its protocol. If the gateway is set, only the routes through it are removed. Managed routes are never removed. Returns the number of removed routes.
+	EnsureAbsent(Route) (int, error)
+	//ListRoutes returns every route of our protocol from the kernel in any table, ordered by table and destination
+	ListRoutes() ([]Route, error)
+	//ExportRoutes returns the routes listed by ListRoutes as iproute2 commands, which create them again with every attribute the kernel reports, ie. after the operator is removed
+	ExportRoutes() ([]string, error)
+	//IsDegraded returns true if the gateway of the managed route is found unreachable by the probe, or the last health check of the route failed
+	IsDegraded(string) bool
+	//Nexthops returns the nexthops of the merged multipath route of the managed route with their effective weights, nil if the route is not merged
+	Nexthops(string) []Nexthop
+	//IsLinkUp returns true if the link (by it's name) exists and it is up. The link is watched from then on, and the LinkWatchers are notified about its changes.
+	IsLinkUp(string) bool
 	//RegisterWatcher registers a new RouteWatcher, which will be notified if the managed routes are deleted.
 	RegisterWatcher(RouteWatcher)
 	//DeRegisterWatcher removes watchers
@@ -0,0 +1,37 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package types
+
+import "net"
+
+//GatewayResolver tells the next hop towards the given IP address. It returns nil if the address is directly routable.
+type GatewayResolver interface {
+	ResolveGateway(net.IP) (net.IP, error)
+}
+
+//PrimaryRouteResolver tells the gateway and the interface of the route the kernel selects towards the given IP address
+type PrimaryRouteResolver interface {
+	ResolvePrimaryRoute(net.IP) (net.IP, string, error)
+}
+
+//GatewayResolverFunc adapts an ordinary function to GatewayResolver
+type GatewayResolverFunc func(net.IP) (net.IP, error)
+
+//ResolveGateway calls f(ip)
+func (f GatewayResolverFunc) ResolveGateway(ip net.IP) (net.IP, error) {
+	return f(ip)
+}
@@ -249,7 +249,7 @@ EOF
 manage_common_operator_resources() {
   local action=$1
   fvtlog "${action^} common static-route-operator related resources..."
-  declare -a common_resources=('crds/static-route.ibm.com_staticroutes_crd.yaml' 'service_account.yaml' 'role.yaml' 'role_binding.yaml');
+  declare -a common_resources=('crds/static-route.ibm.com_staticroutes_crd.yaml' 'crds/static-route.ibm.com_networkgroups_crd.yaml' 'service_account.yaml' 'role.yaml' 'role_binding.yaml');
   for resource in "${common_resources[@]}"; do
     kubectl "${action}" -f "${SCRIPT_PATH}"/../deploy/"${resource}"
   done